@@ -17,12 +17,14 @@ import (
 	"k8s.io/klog/v2"
 
 	addonclient "open-cluster-management.io/api/client/addon/clientset/versioned"
+	clusterclientset "open-cluster-management.io/api/client/cluster/clientset/versioned"
 
 	"open-cluster-management.io/addon-framework/examples/helloworld"
 	"open-cluster-management.io/addon-framework/examples/helloworld_agent"
 	"open-cluster-management.io/addon-framework/examples/helloworld_helm"
 	"open-cluster-management.io/addon-framework/pkg/addonfactory"
 	"open-cluster-management.io/addon-framework/pkg/addonmanager"
+	"open-cluster-management.io/addon-framework/pkg/agent"
 	cmdfactory "open-cluster-management.io/addon-framework/pkg/cmd/factory"
 	"open-cluster-management.io/addon-framework/pkg/utils"
 	"open-cluster-management.io/addon-framework/pkg/version"
@@ -60,6 +62,7 @@ func newCommand() *cobra.Command {
 	}
 
 	cmd.AddCommand(newControllerCommand())
+	cmd.AddCommand(newRenderCommand())
 	cmd.AddCommand(helloworld_agent.NewAgentCommand(helloworld_helm.AddonName))
 	cmd.AddCommand(helloworld_agent.NewCleanupAgentCommand(helloworld_helm.AddonName))
 	return cmd
@@ -75,6 +78,18 @@ func newControllerCommand() *cobra.Command {
 	return cmd
 }
 
+func newRenderCommand() *cobra.Command {
+	cmd := cmdfactory.NewRenderCommandConfig(
+		func(kubeClient kubernetes.Interface, addonClient addonclient.Interface,
+			_ clusterclientset.Interface) (agent.AgentAddon, error) {
+			// the kubeConfig is only used to set up the agent RBAC on the hub, which is not invoked when rendering.
+			return newAgentAddon(&rest.Config{}, kubeClient, addonClient)
+		}).NewCommand()
+	cmd.Short = "Render the manifestWorks of the addon from the local files"
+
+	return cmd
+}
+
 func runController(ctx context.Context, kubeConfig *rest.Config) error {
 	kubeClient, err := kubernetes.NewForConfig(kubeConfig)
 	if err != nil {
@@ -92,12 +107,34 @@ func runController(ctx context.Context, kubeConfig *rest.Config) error {
 		return err
 	}
 
+	agentAddon, err := newAgentAddon(kubeConfig, kubeClient, addonClient)
+	if err != nil {
+		klog.Errorf("failed to build agent %v", err)
+		return err
+	}
+
+	err = mgr.AddAgent(agentAddon)
+	if err != nil {
+		klog.Fatal(err)
+	}
+
+	err = mgr.Start(ctx)
+	if err != nil {
+		klog.Fatal(err)
+	}
+	<-ctx.Done()
+
+	return nil
+}
+
+func newAgentAddon(kubeConfig *rest.Config, kubeClient kubernetes.Interface,
+	addonClient addonclient.Interface) (agent.AgentAddon, error) {
 	registrationOption := helloworld.NewRegistrationOption(
 		kubeConfig,
 		helloworld_helm.AddonName,
 		utilrand.String(5))
 
-	agentAddon, err := addonfactory.NewAgentAddonFactory(helloworld_helm.AddonName, helloworld_helm.FS, "manifests/charts/helloworld").
+	return addonfactory.NewAgentAddonFactory(helloworld_helm.AddonName, helloworld_helm.FS, "manifests/charts/helloworld").
 		WithConfigGVRs(
 			schema.GroupVersionResource{Version: "v1", Resource: "configmaps"},
 			utils.AddOnDeploymentConfigGVR,
@@ -126,21 +163,4 @@ func runController(ctx context.Context, kubeConfig *rest.Config) error {
 			),
 		).WithAgentHealthProber(helloworld_helm.AgentHealthProber()).
 		BuildHelmAgentAddon()
-	if err != nil {
-		klog.Errorf("failed to build agent %v", err)
-		return err
-	}
-
-	err = mgr.AddAgent(agentAddon)
-	if err != nil {
-		klog.Fatal(err)
-	}
-
-	err = mgr.Start(ctx)
-	if err != nil {
-		klog.Fatal(err)
-	}
-	<-ctx.Done()
-
-	return nil
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"embed"
 	"fmt"
+	"time"
 
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -14,9 +15,11 @@ import (
 	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
 	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
 	clusterclientset "open-cluster-management.io/api/client/cluster/clientset/versioned"
+	worklister "open-cluster-management.io/api/client/work/listers/work/v1"
 	clusterv1 "open-cluster-management.io/api/cluster/v1"
 
 	"open-cluster-management.io/addon-framework/pkg/agent"
+	"open-cluster-management.io/addon-framework/pkg/utils"
 )
 
 const AddonDefaultInstallNamespace = "open-cluster-management-agent-addon"
@@ -39,7 +42,28 @@ type AgentAddonFactory struct {
 	// trimCRDDescription flag is used to trim the description of CRDs in manifestWork. disabled by default.
 	trimCRDDescription bool
 	clusterClient      clusterclientset.Interface
+	workLister         worklister.ManifestWorkLister
 	helmEngineStrict   bool
+	// kustomizeOverlayFuncs select the overlay to build for the kustomize agentAddon.
+	kustomizeOverlayFuncs []KustomizeOverlayFunc
+	// chartLoader loads the chart of the helm agentAddon from a chart source instead of the fs.
+	chartLoader *helmChartLoader
+	// helmLookupFuncs answer the lookup function of the helm chart.
+	helmLookupFuncs []HelmLookupFunc
+	// templateEngine renders the template files of the template agentAddon.
+	templateEngine TemplateEngine
+	// valuesProvenanceAnnotation records the values report in the annotation of the deploy manifestWorks.
+	valuesProvenanceAnnotation bool
+	// valuesValidateFuncs validate the final merged values of the helm and template agentAddons.
+	valuesValidateFuncs []ValuesValidateFunc
+	// typedValuesValidateFuncs validate the final merged values against the Go structs added by WithTypedValues.
+	typedValuesValidateFuncs []typedValuesValidateFunc
+	// secretValuesFuncs return the sensitive values of the helm and template agentAddons.
+	secretValuesFuncs []SecretValuesFunc
+	// workloadConfigFuncs return the scheduling and security configuration applied to the workloads.
+	workloadConfigFuncs []WorkloadConfigFunc
+	// deploymentConfigMutationGetter gets the AddOnDeploymentConfig applied to the workloads directly.
+	deploymentConfigMutationGetter utils.AddOnDeploymentConfigGetter
 }
 
 // NewAgentAddonFactory builds an addonAgentFactory instance with addon name and fs.
@@ -63,6 +87,7 @@ func NewAgentAddonFactory(addonName string, fs embed.FS, dir string) *AgentAddon
 		trimCRDDescription: false,
 		scheme:             s,
 		helmEngineStrict:   false,
+		templateEngine:     TemplateEngineDefault,
 	}
 }
 
@@ -81,6 +106,25 @@ func (f *AgentAddonFactory) WithGetValuesFuncs(getValuesFuncs ...GetValuesFunc)
 	return f
 }
 
+// WithSecretValuesFuncs adds a list of the funcs to return the sensitive values of the helm or template agentAddon,
+// e.g. GetSecretValues. The values from the big index func override the one from small index func, and they
+// override the values of the getValues funcs. The values are redacted from the logs of the agentAddon, the errors
+// and the values report, and the deploy manifestWorks are marked by the
+// "addon.open-cluster-management.io/sensitive-data" annotation, so their manifests are not logged by the addon
+// manager.
+func (f *AgentAddonFactory) WithSecretValuesFuncs(secretValuesFuncs ...SecretValuesFunc) *AgentAddonFactory {
+	f.secretValuesFuncs = append(f.secretValuesFuncs, secretValuesFuncs...)
+	return f
+}
+
+// WithValuesValidateFuncs adds a list of the funcs to validate the final merged values of the helm or template
+// agentAddon before the manifests are rendered. If the values are invalid, the manifestWorks of the addon are not
+// updated and the ManifestsRendered condition of the addon is set to false with the reason ValuesInvalid.
+func (f *AgentAddonFactory) WithValuesValidateFuncs(validateFuncs ...ValuesValidateFunc) *AgentAddonFactory {
+	f.valuesValidateFuncs = append(f.valuesValidateFuncs, validateFuncs...)
+	return f
+}
+
 // WithAgentRegistrationOption defines how agent is registered to the hub cluster.
 func (f *AgentAddonFactory) WithAgentRegistrationOption(option *agent.RegistrationOption) *AgentAddonFactory {
 	f.agentAddonOptions.Registration = option
@@ -112,6 +156,31 @@ func (f *AgentAddonFactory) WithConfigCheckEnabledOption() *AgentAddonFactory {
 	return f
 }
 
+// WithRolloutStrategy defines how the changed manifests of the addon are rolled out across the clusters.
+func (f *AgentAddonFactory) WithRolloutStrategy(strategy *agent.RolloutStrategy) *AgentAddonFactory {
+	f.agentAddonOptions.RolloutStrategy = strategy
+	return f
+}
+
+// WithRollbackOption enables to roll back the deploy manifestWorks of the addon to the last known good spec.
+func (f *AgentAddonFactory) WithRollbackOption(option *agent.RollbackOption) *AgentAddonFactory {
+	f.agentAddonOptions.RollbackOption = option
+	return f
+}
+
+// WithFlapDetection enables to keep the history of the Available condition transitions of the addon and to
+// detect the flapping of the addon.
+func (f *AgentAddonFactory) WithFlapDetection(option *agent.FlapDetectionOption) *AgentAddonFactory {
+	f.agentAddonOptions.FlapDetection = option
+	return f
+}
+
+// WithPreDeleteHookTimeout sets the time to wait for the pre-delete hook to complete after the addon is deleted.
+func (f *AgentAddonFactory) WithPreDeleteHookTimeout(timeout time.Duration) *AgentAddonFactory {
+	f.agentAddonOptions.PreDeleteHookTimeout = timeout
+	return f
+}
+
 // WithTrimCRDDescription is to enable trim the description of CRDs in manifestWork.
 func (f *AgentAddonFactory) WithTrimCRDDescription() *AgentAddonFactory {
 	f.trimCRDDescription = true
@@ -124,6 +193,75 @@ func (f *AgentAddonFactory) WithHelmEngineStrict() *AgentAddonFactory {
 	return f
 }
 
+// WithTemplateEngine selects the engine to render the template files of the template agentAddon, the
+// TemplateEngineDefault is used by default.
+func (f *AgentAddonFactory) WithTemplateEngine(engine TemplateEngine) *AgentAddonFactory {
+	f.templateEngine = engine
+	return f
+}
+
+// WithValuesProvenanceAnnotation is to record the final merged values of the helm or template agentAddon and the
+// source of each leaf key in the "addon.open-cluster-management.io/values-provenance" annotation of the deploy
+// manifestWorks, see ValuesReport. Note that the values are recorded as they are, and the size of the annotations
+// of a manifestWork is limited to 256KB.
+func (f *AgentAddonFactory) WithValuesProvenanceAnnotation() *AgentAddonFactory {
+	f.valuesProvenanceAnnotation = true
+	return f
+}
+
+// WithManifestWorkAnnotations defines the func to return the annotations added to the deploy manifestWorks of the
+// addon, the annotations of the values provenance and the sensitive data are added to them by the helm and
+// template agentAddons.
+func (f *AgentAddonFactory) WithManifestWorkAnnotations(annotationsFunc agent.ManifestWorkAnnotationsFunc) *AgentAddonFactory {
+	f.agentAddonOptions.ManifestWorkAnnotations = annotationsFunc
+	return f
+}
+
+// WithWorkloadConfigFuncs adds a list of the funcs to return the WorkloadConfig applied to all the Deployments and
+// DaemonSets in the manifests of the agentAddon, e.g. GetAddOnDeploymentConfigWorkloadConfig. The config of the big
+// index func overrides the one of the small index func.
+func (f *AgentAddonFactory) WithWorkloadConfigFuncs(workloadConfigFuncs ...WorkloadConfigFunc) *AgentAddonFactory {
+	f.workloadConfigFuncs = append(f.workloadConfigFuncs, workloadConfigFuncs...)
+	return f
+}
+
+// WithAddOnDeploymentConfigMutation is to apply the AddOnDeploymentConfig of the addon to the Deployments,
+// DaemonSets, StatefulSets and Jobs in the manifests of the agentAddon after they are rendered, so the resource
+// requirements, the node placement and the image registries take effect without the chart or templates using the
+// values. The container ID of the resource requirements is in the format of "<resource>:<name>:<container name>",
+// e.g. "deployments:helloworld-agent:helloworld-agent". Note that the addon should support the AddOnDeploymentConfig
+// by WithConfigGVRs(utils.AddOnDeploymentConfigGVR).
+func (f *AgentAddonFactory) WithAddOnDeploymentConfigMutation(getter utils.AddOnDeploymentConfigGetter) *AgentAddonFactory {
+	f.deploymentConfigMutationGetter = getter
+	return f
+}
+
+// WithKustomizeOverlayFuncs adds a list of the funcs to select the overlay to build for the kustomize agentAddon,
+// the overlay selected by the small index func is used. The kustomization directory is built if no overlay is
+// selected.
+func (f *AgentAddonFactory) WithKustomizeOverlayFuncs(overlayFuncs ...KustomizeOverlayFunc) *AgentAddonFactory {
+	f.kustomizeOverlayFuncs = append(f.kustomizeOverlayFuncs, overlayFuncs...)
+	return f
+}
+
+// WithHelmChartSource loads the chart of the helm agentAddon from the chart source instead of the fs, the chart
+// version of each addon is returned by the versionFunc. The loaded charts are cached by the version, the charts
+// of the ConfigMap and Secret chart sources are reloaded once the ConfigMap or Secret is updated, while the
+// charts of the OCI chart source are not reloaded, so the tags of the OCI charts should not be overwritten.
+func (f *AgentAddonFactory) WithHelmChartSource(source HelmChartSource, versionFunc HelmChartVersionFunc) *AgentAddonFactory {
+	f.chartLoader = newHelmChartLoader(source, versionFunc)
+	return f
+}
+
+// WithHelmLookupFuncs adds a list of the funcs to answer the lookup function of the helm chart, the lookup returns
+// the objects of the small index func which returns objects. The lookup function returns nothing if the funcs are
+// not set. Note that the strict mode of the helm engine is not supported with the lookup funcs, the
+// BuildHelmAgentAddon returns an error if both are set.
+func (f *AgentAddonFactory) WithHelmLookupFuncs(lookupFuncs ...HelmLookupFunc) *AgentAddonFactory {
+	f.helmLookupFuncs = append(f.helmLookupFuncs, lookupFuncs...)
+	return f
+}
+
 // WithConfigGVRs defines the addon supported configuration GroupVersionResource
 func (f *AgentAddonFactory) WithConfigGVRs(gvrs ...schema.GroupVersionResource) *AgentAddonFactory {
 	f.agentAddonOptions.SupportedConfigGVRs = append(f.agentAddonOptions.SupportedConfigGVRs, gvrs...)
@@ -136,6 +274,14 @@ func (f *AgentAddonFactory) WithManagedClusterClient(c clusterclientset.Interfac
 	return f
 }
 
+// WithManifestWorkLister defines the work lister that can list the deploy manifestWorks of the addon, it is used
+// by the helm agentAddon to set the Release.IsInstall, Release.IsUpgrade and Release.Revision of the chart. The
+// informer of the lister should be started by the caller.
+func (f *AgentAddonFactory) WithManifestWorkLister(lister worklister.ManifestWorkLister) *AgentAddonFactory {
+	f.workLister = lister
+	return f
+}
+
 // WithAgentDeployTriggerClusterFilter defines the filter func to trigger the agent deploy/redploy when cluster info is
 // changed. Addons that need information from the ManagedCluster resource when deploying the agent should use this
 // function to set what information they need, otherwise the expected/up-to-date agent may be deployed delayed since the
@@ -170,10 +316,22 @@ func (f *AgentAddonFactory) BuildHelmAgentAddon() (agent.AgentAddon, error) {
 		return nil, err
 	}
 
+	// the helm engine with a client provider can only be created with the default options.
+	if f.helmEngineStrict && len(f.helmLookupFuncs) > 0 {
+		return nil, fmt.Errorf("the strict mode of the helm engine is not supported with the helm lookup funcs")
+	}
+
+	if f.chartLoader != nil {
+		return newHelmAgentAddon(f, nil), nil
+	}
+
 	userChart, err := loadChart(f.fs, f.dir)
 	if err != nil {
 		return nil, err
 	}
+	if err := validateChart(userChart); err != nil {
+		return nil, err
+	}
 
 	agentAddon := newHelmAgentAddon(f, userChart)
 
@@ -186,6 +344,10 @@ func (f *AgentAddonFactory) BuildTemplateAgentAddon() (agent.AgentAddon, error)
 		return nil, err
 	}
 
+	if f.templateEngine != TemplateEngineDefault && f.templateEngine != TemplateEngineSprig {
+		return nil, fmt.Errorf("unsupported template engine %q", f.templateEngine)
+	}
+
 	templateFiles, err := getTemplateFiles(f.fs, f.dir)
 	if err != nil {
 		klog.Errorf("failed to get template files. %v", err)
@@ -207,6 +369,24 @@ func (f *AgentAddonFactory) BuildTemplateAgentAddon() (agent.AgentAddon, error)
 	return agentAddon, nil
 }
 
+// BuildKustomizeAgentAddon builds a kustomize agentAddon instance, the dir of the factory is the kustomization
+// directory. The overlays of the kustomization can be selected per cluster by WithKustomizeOverlayFuncs, and the
+// builtin values of the addon can be used in the replacements of the kustomization,
+// see KustomizeBuiltinValuesFileName.
+func (f *AgentAddonFactory) BuildKustomizeAgentAddon() (agent.AgentAddon, error) {
+	if err := validateSupportedConfigGVRs(f.agentAddonOptions.SupportedConfigGVRs); err != nil {
+		return nil, err
+	}
+
+	files, err := loadKustomizationFiles(f.fs, f.dir)
+	if err != nil {
+		klog.Errorf("failed to load kustomization files. %v", err)
+		return nil, err
+	}
+
+	return newKustomizeAgentAddon(f, files), nil
+}
+
 func validateSupportedConfigGVRs(configGVRs []schema.GroupVersionResource) error {
 	if len(configGVRs) == 0 {
 		// no configs required, ignore
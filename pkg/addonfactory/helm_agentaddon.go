@@ -3,9 +3,12 @@ package addonfactory
 import (
 	"bufio"
 	"context"
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"io"
 	"sort"
+	"strconv"
 	"strings"
 
 	"helm.sh/helm/v3/pkg/chart"
@@ -15,6 +18,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
 	"k8s.io/apimachinery/pkg/util/yaml"
@@ -22,9 +26,26 @@ import (
 
 	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
 	clusterclientset "open-cluster-management.io/api/client/cluster/clientset/versioned"
+	worklister "open-cluster-management.io/api/client/work/listers/work/v1"
 	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	workapiv1 "open-cluster-management.io/api/work/v1"
 
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
 	"open-cluster-management.io/addon-framework/pkg/agent"
+	"open-cluster-management.io/addon-framework/pkg/utils"
+)
+
+const (
+	// HelmAPIVersionsClusterClaimName is the name of the cluster claim listing the API versions available on the
+	// managed cluster in addition to the built-in Kubernetes API versions, e.g.
+	// "monitoring.coreos.com/v1,monitoring.coreos.com/v1/ServiceMonitor". The API versions are added to the
+	// Capabilities.APIVersions of the helm chart. Since the changes of the cluster claims do not trigger the
+	// redeploy of the addon by default, the addon should set a cluster filter by WithAgentDeployTriggerClusterFilter
+	// to watch the claim.
+	HelmAPIVersionsClusterClaimName = "apiversions.addon.open-cluster-management.io"
+
+	// kubeVersionClusterClaimName is the name of the cluster claim of the Kubernetes version.
+	kubeVersionClusterClaimName = "kubeversion.open-cluster-management.io"
 )
 
 // helmBuiltinValues includes the built-in values for helm agentAddon.
@@ -48,35 +69,60 @@ type helmDefaultValues struct {
 }
 
 type HelmAgentAddon struct {
-	decoder            runtime.Decoder
-	chart              *chart.Chart
-	getValuesFuncs     []GetValuesFunc
-	agentAddonOptions  agent.AgentAddonOptions
-	trimCRDDescription bool
-	clusterClient      clusterclientset.Interface
-	helmEngineStrict   bool
+	decoder                        runtime.Decoder
+	chart                          *chart.Chart
+	chartLoader                    *helmChartLoader
+	getValuesFuncs                 []GetValuesFunc
+	agentAddonOptions              agent.AgentAddonOptions
+	trimCRDDescription             bool
+	workloadConfigFuncs            []WorkloadConfigFunc
+	deploymentConfigMutationGetter utils.AddOnDeploymentConfigGetter
+	clusterClient                  clusterclientset.Interface
+	workLister                     worklister.ManifestWorkLister
+	helmEngineStrict               bool
+	lookupFuncs                    []HelmLookupFunc
+	validateFuncs                  []ValuesValidateFunc
+	secretValuesFuncs              []SecretValuesFunc
 }
 
 func newHelmAgentAddon(factory *AgentAddonFactory, chart *chart.Chart) *HelmAgentAddon {
-	return &HelmAgentAddon{
-		decoder:            serializer.NewCodecFactory(factory.scheme).UniversalDeserializer(),
-		chart:              chart,
-		getValuesFuncs:     factory.getValuesFuncs,
-		agentAddonOptions:  factory.agentAddonOptions,
-		trimCRDDescription: factory.trimCRDDescription,
-		clusterClient:      factory.clusterClient,
-		helmEngineStrict:   factory.helmEngineStrict,
+	agentAddon := &HelmAgentAddon{
+		decoder:                        serializer.NewCodecFactory(factory.scheme).UniversalDeserializer(),
+		chart:                          chart,
+		chartLoader:                    factory.chartLoader,
+		getValuesFuncs:                 factory.getValuesFuncs,
+		agentAddonOptions:              factory.agentAddonOptions,
+		trimCRDDescription:             factory.trimCRDDescription,
+		workloadConfigFuncs:            factory.workloadConfigFuncs,
+		deploymentConfigMutationGetter: factory.deploymentConfigMutationGetter,
+		clusterClient:                  factory.clusterClient,
+		workLister:                     factory.workLister,
+		helmEngineStrict:               factory.helmEngineStrict,
+		lookupFuncs:                    factory.helmLookupFuncs,
+		validateFuncs:                  valuesValidateFuncs(factory, false),
+		secretValuesFuncs:              factory.secretValuesFuncs,
+	}
+	agentAddon.agentAddonOptions.ManifestWorkAnnotations = manifestWorkAnnotations(factory, agentAddon)
+	if agentAddon.workLister != nil {
+		agentAddon.agentAddonOptions.ManifestWorkAnnotations = agentAddon.releaseAnnotations(
+			agentAddon.agentAddonOptions.ManifestWorkAnnotations)
 	}
+	return agentAddon
 }
 
 func (a *HelmAgentAddon) Manifests(
 	ctx context.Context,
 	cluster *clusterv1.ManagedCluster,
 	addon *addonapiv1beta1.ManagedClusterAddOn) ([]runtime.Object, error) {
-	objects, err := a.renderManifests(cluster, addon)
+	secrets, err := getSecretValues(a.secretValuesFuncs, cluster, addon)
 	if err != nil {
 		return nil, err
 	}
+	objects, err := a.renderManifests(ctx, cluster, addon, secrets)
+	if err != nil {
+		// the errors of the helm engine and the values validation may contain the secret values.
+		return nil, secrets.redactError(err)
+	}
 
 	manifests := make([]manifest, 0, len(objects))
 	for _, obj := range objects {
@@ -98,11 +144,18 @@ func (a *HelmAgentAddon) Manifests(
 }
 
 func (a *HelmAgentAddon) renderManifests(
+	ctx context.Context,
 	cluster *clusterv1.ManagedCluster,
-	addon *addonapiv1beta1.ManagedClusterAddOn) ([]runtime.Object, error) {
+	addon *addonapiv1beta1.ManagedClusterAddOn,
+	secrets *secretValues) ([]runtime.Object, error) {
 	var objects []runtime.Object
 
-	values, err := a.getValues(cluster, addon)
+	userChart, err := a.getChart(ctx, cluster, addon)
+	if err != nil {
+		return objects, err
+	}
+
+	userChart, values, err := a.getValues(ctx, userChart, cluster, addon, secrets, nil)
 	if err != nil {
 		return objects, err
 	}
@@ -112,7 +165,7 @@ func (a *HelmAgentAddon) renderManifests(
 		LintMode: false,
 	}
 
-	crds := a.chart.CRDObjects()
+	crds := userChart.CRDObjects()
 	for _, crd := range crds {
 		klog.V(4).Infof("%v/n", crd.File.Data)
 		object, _, err := a.decoder.Decode(crd.File.Data, nil, nil)
@@ -122,7 +175,18 @@ func (a *HelmAgentAddon) renderManifests(
 		objects = append(objects, object)
 	}
 
-	templates, err := helmEngine.Render(a.chart, values)
+	var templates map[string]string
+	if len(a.lookupFuncs) == 0 {
+		templates, err = helmEngine.Render(userChart, values)
+	} else {
+		// the helm engine with a client provider can only be created with the default options.
+		templates, err = engine.RenderWithClientProvider(userChart, values, &helmLookupClientProvider{
+			ctx:         ctx,
+			cluster:     cluster,
+			addon:       addon,
+			lookupFuncs: a.lookupFuncs,
+		})
+	}
 	if err != nil {
 		return objects, err
 	}
@@ -131,7 +195,7 @@ func (a *HelmAgentAddon) renderManifests(
 		if len(data) == 0 {
 			continue
 		}
-		klog.V(4).Infof("rendered template: %v", data)
+		klog.V(4).Infof("rendered template: %v", secrets.redact(data))
 
 		yamlReader := yaml.NewYAMLReader(bufio.NewReader(strings.NewReader(data)))
 		for {
@@ -158,6 +222,15 @@ func (a *HelmAgentAddon) renderManifests(
 		}
 	}
 
+	if err := applyAddOnDeploymentConfig(objects, a.deploymentConfigMutationGetter, addon); err != nil {
+		return nil, err
+	}
+	workloadConfig, err := getWorkloadConfig(a.workloadConfigFuncs, cluster, addon)
+	if err != nil {
+		return nil, err
+	}
+	applyWorkloadConfig(objects, workloadConfig)
+
 	if a.trimCRDDescription {
 		objects = trimCRDDescription(objects)
 	}
@@ -168,59 +241,158 @@ func (a *HelmAgentAddon) GetAgentAddonOptions() agent.AgentAddonOptions {
 	return a.agentAddonOptions
 }
 
+// getChart returns the chart of the addon, the chart is loaded from the chart source if it is set.
+func (a *HelmAgentAddon) getChart(ctx context.Context,
+	cluster *clusterv1.ManagedCluster,
+	addon *addonapiv1beta1.ManagedClusterAddOn) (*chart.Chart, error) {
+	if a.chartLoader == nil {
+		return a.chart, nil
+	}
+	return a.chartLoader.load(ctx, cluster, addon)
+}
+
+// ValuesReport returns the final merged values of the chart on the cluster, and the source of each leaf key.
+// The keys which are not overridden are from the values.yaml of the chart and its subcharts.
+func (a *HelmAgentAddon) ValuesReport(
+	ctx context.Context,
+	cluster *clusterv1.ManagedCluster,
+	addon *addonapiv1beta1.ManagedClusterAddOn) (*ValuesReport, error) {
+	userChart, err := a.getChart(ctx, cluster, addon)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets, err := getSecretValues(a.secretValuesFuncs, cluster, addon)
+	if err != nil {
+		return nil, err
+	}
+	provenance := newValuesProvenance()
+	_, values, err := a.getValues(ctx, userChart, cluster, addon, secrets, provenance)
+	if err != nil {
+		return nil, secrets.redactError(err)
+	}
+	return helmValuesReport(provenance, values)
+}
+
+// helmValuesReport returns the report of the chart values in the render values.
+func helmValuesReport(provenance *valuesProvenance, values chartutil.Values) (*ValuesReport, error) {
+	chartValues, err := values.Table("Values")
+	if err != nil {
+		return nil, err
+	}
+	return provenance.report(Values(chartValues), ValuesSourceChart)
+}
+
+// getValues returns the render values of the chart, and the copy of the chart whose dependencies are
+// processed with the values. The secret values override the values of the getValuesFuncs. The sources of the
+// values are recorded in the provenance if it is not nil.
 func (a *HelmAgentAddon) getValues(
+	ctx context.Context,
+	userChart *chart.Chart,
+	cluster *clusterv1.ManagedCluster,
+	addon *addonapiv1beta1.ManagedClusterAddOn,
+	secrets *secretValues,
+	provenance *valuesProvenance) (*chart.Chart, chartutil.Values, error) {
+	userChart, overrideValues, err := a.getOverrideValues(userChart, cluster, addon, secrets, provenance)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	valuesHash, err := releaseValuesHash(userChart, overrideValues)
+	if err != nil {
+		return nil, nil, err
+	}
+	releaseOptions, err := a.releaseOptions(cluster, addon, valuesHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	cap := a.capabilities(cluster, addon)
+	values, err := chartutil.ToRenderValuesWithSchemaValidation(userChart, overrideValues,
+		releaseOptions, cap, true)
+	if err != nil {
+		klog.Errorf("failed to render helm chart with values %v. err:%v",
+			secrets.redact(fmt.Sprintf("%v", overrideValues)), secrets.redact(err.Error()))
+		return nil, values, err
+	}
+
+	// validate the values against the values.schema.json of the chart and the enabled subcharts.
+	if chartValues, err := values.Table("Values"); err == nil {
+		if err := chartutil.ValidateAgainstSchema(userChart, chartValues); err != nil {
+			return nil, values, &agent.ManifestsRenderError{
+				Reason: constants.ManifestsRenderedReasonValuesSchemaInvalid,
+				Err: fmt.Errorf("values don't meet the specifications of the schema(s) in the following chart(s):\n%v",
+					err),
+			}
+		}
+		if err := validateValues(a.validateFuncs, Values(chartValues)); err != nil {
+			return nil, values, err
+		}
+	}
+
+	return userChart, values, nil
+}
+
+// getOverrideValues returns the values overriding the values.yaml of the chart, and the copy of the chart whose
+// dependencies are processed with the values.
+func (a *HelmAgentAddon) getOverrideValues(
+	userChart *chart.Chart,
 	cluster *clusterv1.ManagedCluster,
-	addon *addonapiv1beta1.ManagedClusterAddOn) (chartutil.Values, error) {
+	addon *addonapiv1beta1.ManagedClusterAddOn,
+	secrets *secretValues,
+	provenance *valuesProvenance) (*chart.Chart, Values, error) {
 	overrideValues := map[string]interface{}{}
 
 	defaultValues, err := a.getDefaultValues(cluster, addon)
 	if err != nil {
 		klog.Errorf("failed to get defaultValue. err:%v", err)
-		return nil, err
+		return nil, nil, err
 	}
 	overrideValues = MergeValues(overrideValues, defaultValues)
+	provenance.record(ValuesSourceDefault, defaultValues)
 
 	for i := 0; i < len(a.getValuesFuncs); i++ {
 		if a.getValuesFuncs[i] != nil {
 			userValues, err := a.getValuesFuncs[i](cluster, addon)
 			if err != nil {
-				return overrideValues, err
+				return nil, nil, err
 			}
 
 			// MergeValues deep-merges only map[string]interface{} values, so typed Go
 			// maps and structs must be normalized to JSON-compatible types beforehand.
 			normalizedUserValues, err := JsonStructToValues(userValues)
 			if err != nil {
-				return overrideValues, fmt.Errorf("failed to normalize Helm values: %w", err)
+				return nil, nil, fmt.Errorf("failed to normalize Helm values: %w", err)
 			}
 
 			klog.V(4).Infof("index=%d, user values: %v", i, normalizedUserValues)
 			overrideValues = MergeValues(overrideValues, normalizedUserValues)
+			provenance.record(getValuesFuncSource(i, a.getValuesFuncs[i]), normalizedUserValues)
 			klog.V(4).Infof("index=%d, override values: %v", i, overrideValues)
 		}
 	}
 
+	for i, values := range secrets.values {
+		// the secret values are not logged.
+		overrideValues = MergeValues(overrideValues, values)
+		provenance.record(getSecretValuesFuncSource(i), values)
+	}
+
 	builtinValues, err := a.getBuiltinValues(cluster, addon)
 	if err != nil {
 		klog.Errorf("failed to get builtinValue. err:%v", err)
-		return nil, err
+		return nil, nil, err
 	}
 
 	overrideValues = MergeValues(overrideValues, builtinValues)
+	provenance.record(ValuesSourceBuiltin, builtinValues)
 
-	releaseOptions, err := a.releaseOptions(addon)
-	if err != nil {
-		return nil, err
-	}
-	cap := a.capabilities(cluster, addon)
-	values, err := chartutil.ToRenderValues(a.chart, overrideValues,
-		releaseOptions, cap)
+	// the subcharts disabled by the condition or tags are removed, and the import-values are imported into
+	// the parent chart before the values are coalesced.
+	userChart, err = processChartDependencies(userChart, overrideValues)
 	if err != nil {
-		klog.Errorf("failed to render helm chart with values %v. err:%v", overrideValues, err)
-		return values, err
+		return nil, nil, err
 	}
-
-	return values, nil
+	return userChart, overrideValues, nil
 }
 
 func (a *HelmAgentAddon) getValueAgentInstallNamespace(addon *addonapiv1beta1.ManagedClusterAddOn) (string, error) {
@@ -302,29 +474,199 @@ func (a *HelmAgentAddon) getDefaultValues(
 	return helmDefaultValues, nil
 }
 
-// only support Capabilities.KubeVersion
+// capabilities returns the Capabilities of the cluster. The KubeVersion is from the status of the cluster, or
+// the kubeversion cluster claim if the status is not reported. The APIVersions are the API versions built in the
+// addon manager and the API versions in the HelmAPIVersionsClusterClaimName cluster claim.
 func (a *HelmAgentAddon) capabilities(
 	cluster *clusterv1.ManagedCluster,
 	_ *addonapiv1beta1.ManagedClusterAddOn) *chartutil.Capabilities {
-	return &chartutil.Capabilities{
-		KubeVersion: chartutil.KubeVersion{Version: cluster.Status.Version.Kubernetes},
+	kubeVersion := cluster.Status.Version.Kubernetes
+	apiVersions := append(chartutil.VersionSet{}, chartutil.DefaultVersionSet...)
+	for _, claim := range cluster.Status.ClusterClaims {
+		switch claim.Name {
+		case kubeVersionClusterClaimName:
+			if len(kubeVersion) == 0 {
+				kubeVersion = claim.Value
+			}
+		case HelmAPIVersionsClusterClaimName:
+			for _, apiVersion := range strings.Split(claim.Value, ",") {
+				apiVersion = strings.TrimSpace(apiVersion)
+				if len(apiVersion) > 0 && !apiVersions.Has(apiVersion) {
+					apiVersions = append(apiVersions, apiVersion)
+				}
+			}
+		}
 	}
+
+	capabilities := &chartutil.Capabilities{
+		KubeVersion: chartutil.KubeVersion{Version: kubeVersion},
+		APIVersions: apiVersions,
+	}
+	if parsed, err := chartutil.ParseKubeVersion(kubeVersion); err == nil {
+		capabilities.KubeVersion.Major = parsed.Major
+		capabilities.KubeVersion.Minor = parsed.Minor
+	}
+	return capabilities
 }
 
-// only support Release.Name, Release.Namespace
+// releaseOptions returns the Release of the chart. The release is an install if there is no deploy manifestWork
+// of the addon in the cache of the work lister, otherwise it is an upgrade. The deploy manifestWorks are not
+// checked if the work lister is not set, so the release is always an install.
+//
+// The Revision is 1 for an install. For an upgrade, it is the revision recorded on the deploy manifestWorks, and
+// it is increased by 1 if the valuesHash of the chart and values is different from the recorded one. The Revision
+// is not derived from the rendered manifests, so rendering with a new Revision does not change it again.
 func (a *HelmAgentAddon) releaseOptions(
-	addon *addonapiv1beta1.ManagedClusterAddOn) (chartutil.ReleaseOptions, error) {
+	cluster *clusterv1.ManagedCluster,
+	addon *addonapiv1beta1.ManagedClusterAddOn,
+	valuesHash string) (chartutil.ReleaseOptions, error) {
 	releaseOptions := chartutil.ReleaseOptions{
-		Name: a.agentAddonOptions.AddonName,
+		Name:      a.agentAddonOptions.AddonName,
+		IsInstall: true,
+		Revision:  1,
 	}
 	namespace, err := a.getValueAgentInstallNamespace(addon)
 	if err != nil {
 		return releaseOptions, err
 	}
 	releaseOptions.Namespace = namespace
+
+	works, err := a.getDeployWorks(cluster, addon)
+	if err != nil {
+		return releaseOptions, err
+	}
+	if len(works) > 0 {
+		releaseOptions.IsInstall = false
+		releaseOptions.IsUpgrade = true
+		revision, deployedValuesHash := deployedRelease(works)
+		if deployedValuesHash != valuesHash {
+			revision++
+		}
+		releaseOptions.Revision = revision
+	}
 	return releaseOptions, nil
 }
 
+// deployedRelease returns the latest revision recorded on the deploy manifestWorks and its values hash, the
+// deploy manifestWorks may be rendered with different revisions during the rollout. The revision is 1 if it is
+// not recorded.
+func deployedRelease(works []*workapiv1.ManifestWork) (int, string) {
+	revision, valuesHash := 1, ""
+	for i, work := range works {
+		workRevision, err := strconv.Atoi(work.Annotations[constants.ReleaseRevisionAnnotationKey])
+		if err != nil || workRevision < 1 {
+			workRevision = 1
+		}
+		if i == 0 || workRevision > revision {
+			revision = workRevision
+			valuesHash = work.Annotations[constants.ReleaseValuesHashAnnotationKey]
+		}
+	}
+	return revision, valuesHash
+}
+
+// releaseValuesHash returns the hash of the chart name, version and the values overriding the values.yaml of
+// the chart.
+func releaseValuesHash(userChart *chart.Chart, overrideValues Values) (string, error) {
+	data, err := json.Marshal(overrideValues)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	if userChart.Metadata != nil {
+		hash.Write([]byte(userChart.Metadata.Name + "/" + userChart.Metadata.Version + "\n"))
+	}
+	hash.Write(data)
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// releaseAnnotations returns the ManifestWorkAnnotationsFunc which adds the Release.Revision and the values hash
+// of the release to the annotations returned by the annotationsFunc, so the next render of the addon knows
+// whether the release is upgraded.
+func (a *HelmAgentAddon) releaseAnnotations(
+	annotationsFunc agent.ManifestWorkAnnotationsFunc) agent.ManifestWorkAnnotationsFunc {
+	return func(ctx context.Context, cluster *clusterv1.ManagedCluster,
+		addon *addonapiv1beta1.ManagedClusterAddOn) (map[string]string, error) {
+		annotations := map[string]string{}
+		if annotationsFunc != nil {
+			userAnnotations, err := annotationsFunc(ctx, cluster, addon)
+			if err != nil {
+				return nil, err
+			}
+			for k, v := range userAnnotations {
+				annotations[k] = v
+			}
+		}
+
+		userChart, err := a.getChart(ctx, cluster, addon)
+		if err != nil {
+			return nil, err
+		}
+		secrets, err := getSecretValues(a.secretValuesFuncs, cluster, addon)
+		if err != nil {
+			return nil, err
+		}
+		userChart, overrideValues, err := a.getOverrideValues(userChart, cluster, addon, secrets, nil)
+		if err != nil {
+			return nil, secrets.redactError(err)
+		}
+		valuesHash, err := releaseValuesHash(userChart, overrideValues)
+		if err != nil {
+			return nil, err
+		}
+		releaseOptions, err := a.releaseOptions(cluster, addon, valuesHash)
+		if err != nil {
+			return nil, err
+		}
+		annotations[constants.ReleaseRevisionAnnotationKey] = strconv.Itoa(releaseOptions.Revision)
+		annotations[constants.ReleaseValuesHashAnnotationKey] = valuesHash
+		return annotations, nil
+	}
+}
+
+// getDeployWorks returns the deploy manifestWorks of the addon in the cluster namespace, and the deploy
+// manifestWorks in the hosting cluster namespace in Hosted mode.
+func (a *HelmAgentAddon) getDeployWorks(
+	cluster *clusterv1.ManagedCluster,
+	addon *addonapiv1beta1.ManagedClusterAddOn) ([]*workapiv1.ManifestWork, error) {
+	if a.workLister == nil {
+		return nil, nil
+	}
+
+	listDeployWorks := func(namespace, namePrefix string, selector labels.Set) ([]*workapiv1.ManifestWork, error) {
+		workList, err := a.workLister.ManifestWorks(namespace).List(labels.SelectorFromSet(selector))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the deploy manifestWorks of addon %s/%s: %v",
+				addon.Namespace, addon.Name, err)
+		}
+		var works []*workapiv1.ManifestWork
+		for _, work := range workList {
+			if strings.HasPrefix(work.Name, namePrefix) {
+				works = append(works, work)
+			}
+		}
+		return works, nil
+	}
+
+	works, err := listDeployWorks(addon.Namespace, constants.DeployWorkNamePrefix(addon.Name),
+		labels.Set{addonapiv1beta1.AddonLabelKey: addon.Name})
+	if err != nil {
+		return nil, err
+	}
+
+	installMode, hostingClusterName := a.agentAddonOptions.HostedModeInfoFunc(addon, cluster)
+	if installMode != constants.InstallModeHosted || len(hostingClusterName) == 0 {
+		return works, nil
+	}
+	hostingWorks, err := listDeployWorks(hostingClusterName,
+		constants.DeployHostingWorkNamePrefix(addon.Namespace, addon.Name),
+		labels.Set{addonapiv1beta1.AddonLabelKey: addon.Name, addonapiv1beta1.AddonNamespaceLabelKey: addon.Namespace})
+	if err != nil {
+		return nil, err
+	}
+	return append(works, hostingWorks...), nil
+}
+
 // manifest represents a manifest file, which has a name and some content.
 type manifest struct {
 	Object runtime.Object
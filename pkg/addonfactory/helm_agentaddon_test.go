@@ -6,19 +6,26 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chartutil"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/scheme"
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
 	"open-cluster-management.io/addon-framework/pkg/agent"
 	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
 	clusterclientset "open-cluster-management.io/api/client/cluster/clientset/versioned/fake"
+	fakework "open-cluster-management.io/api/client/work/clientset/versioned/fake"
+	workinformers "open-cluster-management.io/api/client/work/informers/externalversions"
 	clusterv1 "open-cluster-management.io/api/cluster/v1"
 	clusterv1alpha1 "open-cluster-management.io/api/cluster/v1alpha1"
+	workapiv1 "open-cluster-management.io/api/work/v1"
 )
 
 //go:embed testmanifests/chart
@@ -347,6 +354,205 @@ func TestChartAgentAddon_Manifests(t *testing.T) {
 	}
 }
 
+func TestHelmAgentAddonCapabilitiesAndRelease(t *testing.T) {
+	newDeployWork := func(name, namespace string, generation int64, labels map[string]string) *workapiv1.ManifestWork {
+		return &workapiv1.ManifestWork{ObjectMeta: metav1.ObjectMeta{
+			Name:       name,
+			Namespace:  namespace,
+			Generation: generation,
+			Labels:     labels,
+		}}
+	}
+	withReleaseAnnotations := func(work *workapiv1.ManifestWork, revision, valuesHash string) *workapiv1.ManifestWork {
+		work.Annotations = map[string]string{
+			constants.ReleaseRevisionAnnotationKey:   revision,
+			constants.ReleaseValuesHashAnnotationKey: valuesHash,
+		}
+		return work
+	}
+	addonLabels := map[string]string{addonapiv1beta1.AddonLabelKey: "test"}
+	hostedAddonLabels := map[string]string{
+		addonapiv1beta1.AddonLabelKey:          "test",
+		addonapiv1beta1.AddonNamespaceLabelKey: "cluster1",
+	}
+
+	cases := []struct {
+		name                string
+		kubeVersion         string
+		claims              []clusterv1.ManagedClusterClaim
+		hostingCluster      string
+		works               []*workapiv1.ManifestWork
+		expectedKubeVersion chartutil.KubeVersion
+		expectedAPIVersions []string
+		expectedRelease     chartutil.ReleaseOptions
+	}{
+		{
+			name:                "install",
+			kubeVersion:         "v1.30.2",
+			expectedKubeVersion: chartutil.KubeVersion{Version: "v1.30.2", Major: "1", Minor: "30"},
+			expectedAPIVersions: []string{"v1", "apps/v1"},
+			expectedRelease:     chartutil.ReleaseOptions{IsInstall: true, Revision: 1},
+		},
+		{
+			name: "api versions and kube version from claims",
+			claims: []clusterv1.ManagedClusterClaim{
+				{Name: "kubeversion.open-cluster-management.io", Value: "v1.29.0"},
+				{Name: HelmAPIVersionsClusterClaimName,
+					Value: "monitoring.coreos.com/v1, monitoring.coreos.com/v1/ServiceMonitor"},
+			},
+			expectedKubeVersion: chartutil.KubeVersion{Version: "v1.29.0", Major: "1", Minor: "29"},
+			expectedAPIVersions: []string{"apps/v1", "monitoring.coreos.com/v1", "monitoring.coreos.com/v1/ServiceMonitor"},
+			expectedRelease:     chartutil.ReleaseOptions{IsInstall: true, Revision: 1},
+		},
+		{
+			name:        "upgrade",
+			kubeVersion: "v1.30.2",
+			works: []*workapiv1.ManifestWork{
+				newDeployWork("addon-test-deploy-0", "cluster1", 3, addonLabels),
+				newDeployWork("addon-test-deploy-wave-1-0", "cluster1", 5, addonLabels),
+				newDeployWork("addon-test-pre-delete", "cluster1", 7, addonLabels),
+				newDeployWork("addon-test-deploy-0", "cluster2", 9, addonLabels),
+			},
+			expectedKubeVersion: chartutil.KubeVersion{Version: "v1.30.2", Major: "1", Minor: "30"},
+			expectedRelease:     chartutil.ReleaseOptions{IsUpgrade: true, Revision: 2},
+		},
+		{
+			name:        "upgrade with the same values",
+			kubeVersion: "v1.30.2",
+			works: []*workapiv1.ManifestWork{
+				withReleaseAnnotations(newDeployWork("addon-test-deploy-0", "cluster1", 3, addonLabels), "3", "hash"),
+			},
+			expectedKubeVersion: chartutil.KubeVersion{Version: "v1.30.2", Major: "1", Minor: "30"},
+			expectedRelease:     chartutil.ReleaseOptions{IsUpgrade: true, Revision: 3},
+		},
+		{
+			name:        "upgrade with the changed values",
+			kubeVersion: "v1.30.2",
+			works: []*workapiv1.ManifestWork{
+				withReleaseAnnotations(newDeployWork("addon-test-deploy-0", "cluster1", 3, addonLabels), "3", "old"),
+			},
+			expectedKubeVersion: chartutil.KubeVersion{Version: "v1.30.2", Major: "1", Minor: "30"},
+			expectedRelease:     chartutil.ReleaseOptions{IsUpgrade: true, Revision: 4},
+		},
+		{
+			name:        "upgrade during the rollout of the works",
+			kubeVersion: "v1.30.2",
+			works: []*workapiv1.ManifestWork{
+				withReleaseAnnotations(newDeployWork("addon-test-deploy-0", "cluster1", 3, addonLabels), "3", "old"),
+				withReleaseAnnotations(newDeployWork("addon-test-deploy-wave-1-0", "cluster1", 5, addonLabels),
+					"4", "hash"),
+			},
+			expectedKubeVersion: chartutil.KubeVersion{Version: "v1.30.2", Major: "1", Minor: "30"},
+			expectedRelease:     chartutil.ReleaseOptions{IsUpgrade: true, Revision: 4},
+		},
+		{
+			name:           "upgrade in hosted mode",
+			kubeVersion:    "v1.30.2",
+			hostingCluster: "hosting",
+			works: []*workapiv1.ManifestWork{
+				newDeployWork("addon-test-deploy-hosting-cluster1-0", "hosting", 2, hostedAddonLabels),
+			},
+			expectedKubeVersion: chartutil.KubeVersion{Version: "v1.30.2", Major: "1", Minor: "30"},
+			expectedRelease:     chartutil.ReleaseOptions{IsUpgrade: true, Revision: 2},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			workInformerFactory := workinformers.NewSharedInformerFactory(fakework.NewSimpleClientset(), 10*time.Minute)
+			for _, work := range c.works {
+				if err := workInformerFactory.Work().V1().ManifestWorks().Informer().GetStore().Add(work); err != nil {
+					t.Fatal(err)
+				}
+			}
+			factory := NewAgentAddonFactory("test", chartFS, "testmanifests/chart").
+				WithManifestWorkLister(workInformerFactory.Work().V1().ManifestWorks().Lister())
+			if len(c.hostingCluster) > 0 {
+				factory = factory.WithAgentHostedModeEnabledOption()
+			}
+			agentAddon := newHelmAgentAddon(factory, nil)
+
+			cluster := NewFakeManagedCluster("cluster1", c.kubeVersion)
+			cluster.Status.ClusterClaims = c.claims
+			addon := NewFakeManagedClusterAddon("test", "cluster1", "", "")
+			if len(c.hostingCluster) > 0 {
+				addon.Annotations = map[string]string{addonapiv1beta1.HostingClusterNameAnnotationKey: c.hostingCluster}
+			}
+
+			capabilities := agentAddon.capabilities(cluster, addon)
+			if capabilities.KubeVersion != c.expectedKubeVersion {
+				t.Errorf("expected kube version %v, but got %v", c.expectedKubeVersion, capabilities.KubeVersion)
+			}
+			for _, apiVersion := range c.expectedAPIVersions {
+				if !capabilities.APIVersions.Has(apiVersion) {
+					t.Errorf("expected api version %s, but got %v", apiVersion, capabilities.APIVersions)
+				}
+			}
+
+			release, err := agentAddon.releaseOptions(cluster, addon, "hash")
+			if err != nil {
+				t.Fatalf("expected no error, got err %v", err)
+			}
+			if release.IsInstall != c.expectedRelease.IsInstall || release.IsUpgrade != c.expectedRelease.IsUpgrade ||
+				release.Revision != c.expectedRelease.Revision {
+				t.Errorf("expected release %v, but got %v", c.expectedRelease, release)
+			}
+		})
+	}
+}
+
+func TestHelmAgentAddonReleaseAnnotations(t *testing.T) {
+	cluster := NewFakeManagedCluster("cluster1", "v1.30.2")
+	addon := NewFakeManagedClusterAddon("test", "cluster1", "", "")
+
+	workStore := workinformers.NewSharedInformerFactory(fakework.NewSimpleClientset(), 10*time.Minute).
+		Work().V1().ManifestWorks()
+	imageValues := map[string]interface{}{"global": map[string]interface{}{"imageOverrides": map[string]interface{}{
+		"testImage": "quay.io/testimage:v1"}}}
+	factory := NewAgentAddonFactory("test", chartFS, "testmanifests/chart").
+		WithManifestWorkLister(workStore.Lister()).
+		WithGetValuesFuncs(func(*clusterv1.ManagedCluster, *addonapiv1beta1.ManagedClusterAddOn) (Values, error) {
+			return imageValues, nil
+		})
+	agentAddon, err := factory.BuildHelmAgentAddon()
+	if err != nil {
+		t.Fatalf("failed to build helm agent addon %v", err)
+	}
+
+	expectRevision := func(expected string) map[string]string {
+		annotations, err := agentAddon.GetAgentAddonOptions().ManifestWorkAnnotations(context.TODO(), cluster, addon)
+		if err != nil {
+			t.Fatalf("expected no error, got err %v", err)
+		}
+		if annotations[constants.ReleaseRevisionAnnotationKey] != expected {
+			t.Errorf("expected revision %s, but got %v", expected, annotations)
+		}
+		return annotations
+	}
+
+	// the revision is not changed once the deploy work is annotated with the release of the same values.
+	annotations := expectRevision("1")
+	work := &workapiv1.ManifestWork{ObjectMeta: metav1.ObjectMeta{
+		Name:        "addon-test-deploy-0",
+		Namespace:   "cluster1",
+		Labels:      map[string]string{addonapiv1beta1.AddonLabelKey: "test"},
+		Annotations: annotations,
+	}}
+	if err := workStore.Informer().GetStore().Add(work); err != nil {
+		t.Fatal(err)
+	}
+	expectRevision("1")
+
+	// the revision is increased once the values are changed.
+	imageValues = map[string]interface{}{"global": map[string]interface{}{"imageOverrides": map[string]interface{}{
+		"testImage": "quay.io/testimage:v2"}}}
+	work.Annotations = expectRevision("2")
+	if err := workStore.Informer().GetStore().Update(work); err != nil {
+		t.Fatal(err)
+	}
+	expectRevision("2")
+}
+
 func validateTrimCRDv1(crd *apiextensionsv1.CustomResourceDefinition) bool {
 	versions := crd.Spec.Versions
 	for i := range versions {
@@ -0,0 +1,396 @@
+package addonfactory
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/sync/singleflight"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/helmpath"
+	"helm.sh/helm/v3/pkg/registry"
+	corev1lister "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
+	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content"
+	"oras.land/oras-go/v2/registry/remote"
+	"oras.land/oras-go/v2/registry/remote/auth"
+	"oras.land/oras-go/v2/registry/remote/credentials"
+	"oras.land/oras-go/v2/registry/remote/retry"
+
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+
+	"open-cluster-management.io/addon-framework/pkg/utils"
+)
+
+// HelmChartSource loads the chart archives of the helm agentAddon from a source out of the addon manager, so
+// the chart can be updated without rebuilding the addon manager.
+type HelmChartSource interface {
+	// Load returns the chart archive (.tgz) of the given version and the digest of the archive in the form of
+	// "sha256:<hex>". The digest is verified against the archive if it is not empty. The default version of
+	// the source is loaded if the version is empty.
+	Load(ctx context.Context, version string) (archive []byte, digest string, err error)
+}
+
+// HelmChartVersionFunc returns the chart version of the addon, the default version of the chart source is
+// used if it returns an empty string.
+type HelmChartVersionFunc func(cluster *clusterv1.ManagedCluster,
+	addon *addonapiv1beta1.ManagedClusterAddOn) (string, error)
+
+// ChartVersionFromDeploymentConfig returns a HelmChartVersionFunc which gets the chart version from the
+// customized variable with the given name in the AddOnDeploymentConfig of the addon.
+func ChartVersionFromDeploymentConfig(getter utils.AddOnDeploymentConfigGetter, variableName string) HelmChartVersionFunc {
+	return func(_ *clusterv1.ManagedCluster, addon *addonapiv1beta1.ManagedClusterAddOn) (string, error) {
+		config, err := utils.GetDesiredAddOnDeploymentConfig(addon, getter)
+		if err != nil {
+			return "", fmt.Errorf("failed to get deployment config for addon %s: %v", addon.Name, err)
+		}
+		if config == nil {
+			return "", nil
+		}
+		for _, variable := range config.Spec.CustomizedVariables {
+			if variable.Name == variableName {
+				return variable.Value, nil
+			}
+		}
+		return "", nil
+	}
+}
+
+// ociChartSource loads the chart from an OCI registry.
+type ociChartSource struct {
+	repository      string
+	defaultVersion  string
+	plainHTTP       bool
+	credentialsFile string
+	client          remote.Client
+}
+
+// OCIChartSourceOption configures how the OCI chart source accesses the registry.
+type OCIChartSourceOption func(source *ociChartSource)
+
+// WithOCIPlainHTTP makes the OCI chart source access the registry by plain HTTP instead of HTTPS.
+func WithOCIPlainHTTP() OCIChartSourceOption {
+	return func(source *ociChartSource) {
+		source.plainHTTP = true
+	}
+}
+
+// WithOCICredentialsFile sets the credentials file of the registry, which is in the format of the docker config
+// file. The credentials file of helm is used by default.
+func WithOCICredentialsFile(credentialsFile string) OCIChartSourceOption {
+	return func(source *ociChartSource) {
+		source.credentialsFile = credentialsFile
+	}
+}
+
+// NewOCIChartSource returns a HelmChartSource which pulls the chart from the OCI repository, e.g.
+// "oci://quay.io/open-cluster-management/charts/helloworld". The version is the tag of the chart, and it can
+// be pinned to a digest in the form of "<tag>@sha256:<hex>".
+func NewOCIChartSource(repository, defaultVersion string, options ...OCIChartSourceOption) (HelmChartSource, error) {
+	source := &ociChartSource{
+		repository:      strings.TrimPrefix(repository, fmt.Sprintf("%s://", registry.OCIScheme)),
+		defaultVersion:  defaultVersion,
+		credentialsFile: helmpath.ConfigPath(registry.CredentialsFileBasename),
+	}
+	for _, option := range options {
+		option(source)
+	}
+
+	store, err := credentials.NewStore(source.credentialsFile, credentials.StoreOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the credentials file %s: %v", source.credentialsFile, err)
+	}
+	source.client = &auth.Client{
+		Client:     retry.DefaultClient,
+		Cache:      auth.NewCache(),
+		Credential: credentials.Credential(store),
+	}
+	return source, nil
+}
+
+// Load pulls the chart and returns the digest of the chart layer resolved from the manifest of the chart, so
+// the archive is verified against the manifest. If the version is pinned to a digest, the manifest is verified
+// against the pinned digest.
+func (s *ociChartSource) Load(ctx context.Context, version string) ([]byte, string, error) {
+	if len(version) == 0 {
+		version = s.defaultVersion
+	}
+	if len(version) == 0 {
+		return nil, "", fmt.Errorf("the version of chart %s is not specified", s.repository)
+	}
+
+	reference := fmt.Sprintf("%s:%s", s.repository, version)
+	repository, err := remote.NewRepository(reference)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to parse chart %s: %v", reference, err)
+	}
+	repository.PlainHTTP = s.plainHTTP
+	repository.Client = s.client
+
+	_, data, err := oras.FetchBytes(ctx, repository, reference, oras.DefaultFetchBytesOptions)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to pull chart %s: %v", reference, err)
+	}
+	manifest := &ocispec.Manifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, "", fmt.Errorf("failed to parse the manifest of chart %s: %v", reference, err)
+	}
+	for _, layer := range manifest.Layers {
+		if layer.MediaType != registry.ChartLayerMediaType && layer.MediaType != registry.LegacyChartLayerMediaType {
+			continue
+		}
+		// the archive is verified against the digest of the layer when it is fetched.
+		archive, err := content.FetchAll(ctx, repository.Blobs(), layer)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to pull chart %s: %v", reference, err)
+		}
+		return archive, layer.Digest.String(), nil
+	}
+	return nil, "", fmt.Errorf("the chart layer is not found in the manifest of chart %s", reference)
+}
+
+// kubeChartSource loads the chart from a ConfigMap or a Secret on the hub, the ConfigMap or Secret is read from
+// the lister, so it is not got from the kube-apiserver in each render of the addon manifests.
+type kubeChartSource struct {
+	kind string
+	get  func(key string) ([]byte, bool, error)
+	// resourceVersion returns the resourceVersion of the ConfigMap or Secret.
+	resourceVersion func() (string, error)
+}
+
+// revisionedChartSource is implemented by the chart sources whose charts can be updated in place, the loaded
+// charts are reloaded once the revision of the source changes.
+type revisionedChartSource interface {
+	revision(ctx context.Context) (string, error)
+}
+
+func (s *kubeChartSource) revision(_ context.Context) (string, error) {
+	return s.resourceVersion()
+}
+
+// chartArchiveKey returns the key of the chart archive of the version in the ConfigMap or Secret, the digest
+// of the archive is the value of the key with the suffix ".sha256".
+func chartArchiveKey(version string) string {
+	if len(version) == 0 {
+		return "chart.tgz"
+	}
+	return fmt.Sprintf("chart-%s.tgz", version)
+}
+
+// NewConfigMapChartSource returns a HelmChartSource which loads the chart from the binaryData of the ConfigMap.
+// The archive of the default version is in the key "chart.tgz", and the archive of a version is in the key
+// "chart-<version>.tgz". The optional digest of an archive is in the data of the key with the suffix ".sha256".
+// The lister is usually from an informer scoped to the namespace of the ConfigMap, and the informer should be
+// started before the addon manager.
+func NewConfigMapChartSource(configMapLister corev1lister.ConfigMapLister, namespace, name string) HelmChartSource {
+	return &kubeChartSource{
+		kind: fmt.Sprintf("configmap %s/%s", namespace, name),
+		get: func(key string) ([]byte, bool, error) {
+			cm, err := configMapLister.ConfigMaps(namespace).Get(name)
+			if err != nil {
+				return nil, false, err
+			}
+			if data, ok := cm.BinaryData[key]; ok {
+				return data, true, nil
+			}
+			data, ok := cm.Data[key]
+			return []byte(data), ok, nil
+		},
+		resourceVersion: func() (string, error) {
+			cm, err := configMapLister.ConfigMaps(namespace).Get(name)
+			if err != nil {
+				return "", err
+			}
+			return cm.ResourceVersion, nil
+		},
+	}
+}
+
+// NewSecretChartSource returns a HelmChartSource which loads the chart from the data of the Secret, the keys are
+// the same as the ConfigMap chart source. The lister is usually from an informer scoped to the namespace of the
+// Secret, and the informer should be started before the addon manager.
+func NewSecretChartSource(secretLister corev1lister.SecretLister, namespace, name string) HelmChartSource {
+	return &kubeChartSource{
+		kind: fmt.Sprintf("secret %s/%s", namespace, name),
+		get: func(key string) ([]byte, bool, error) {
+			secret, err := secretLister.Secrets(namespace).Get(name)
+			if err != nil {
+				return nil, false, err
+			}
+			data, ok := secret.Data[key]
+			return data, ok, nil
+		},
+		resourceVersion: func() (string, error) {
+			secret, err := secretLister.Secrets(namespace).Get(name)
+			if err != nil {
+				return "", err
+			}
+			return secret.ResourceVersion, nil
+		},
+	}
+}
+
+func (s *kubeChartSource) Load(_ context.Context, version string) ([]byte, string, error) {
+	key := chartArchiveKey(version)
+	archive, ok, err := s.get(key)
+	if err != nil {
+		return nil, "", err
+	}
+	if !ok {
+		return nil, "", fmt.Errorf("the chart %s is not found in %s", key, s.kind)
+	}
+	digest, _, err := s.get(key + ".sha256")
+	if err != nil {
+		return nil, "", err
+	}
+	return archive, strings.TrimSpace(string(digest)), nil
+}
+
+// maxCachedCharts is the max number of the chart versions cached by the helmChartLoader.
+const maxCachedCharts = 10
+
+// helmChartLoader loads the charts of the helm agentAddon from the chart source, the loaded charts are cached
+// by the version, and they are reloaded once the revision of the chart source changes. At most maxCachedCharts
+// versions are cached, the least recently used one is evicted first.
+type helmChartLoader struct {
+	source      HelmChartSource
+	versionFunc HelmChartVersionFunc
+
+	// group deduplicates the concurrent loads of the same chart, the chart is loaded out of the lock.
+	group  singleflight.Group
+	lock   sync.Mutex
+	charts map[string]*cachedChart
+	// uses is the number of the uses of the cached charts, it orders the uses of the cached charts.
+	uses uint64
+}
+
+type cachedChart struct {
+	chart    *chart.Chart
+	revision string
+	lastUsed uint64
+}
+
+func newHelmChartLoader(source HelmChartSource, versionFunc HelmChartVersionFunc) *helmChartLoader {
+	return &helmChartLoader{
+		source:      source,
+		versionFunc: versionFunc,
+		charts:      map[string]*cachedChart{},
+	}
+}
+
+func (l *helmChartLoader) load(ctx context.Context,
+	cluster *clusterv1.ManagedCluster, addon *addonapiv1beta1.ManagedClusterAddOn) (*chart.Chart, error) {
+	var version string
+	if l.versionFunc != nil {
+		var err error
+		version, err = l.versionFunc(cluster, addon)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var revision string
+	if source, ok := l.source.(revisionedChartSource); ok {
+		var err error
+		revision, err = source.revision(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if userChart, ok := l.getCachedChart(version, revision); ok {
+		return userChart, nil
+	}
+
+	result, err, _ := l.group.Do(fmt.Sprintf("%s/%s", version, revision), func() (interface{}, error) {
+		if userChart, ok := l.getCachedChart(version, revision); ok {
+			return userChart, nil
+		}
+		userChart, err := l.loadChart(ctx, version)
+		if err != nil {
+			return nil, err
+		}
+		l.setCachedChart(version, revision, userChart)
+		return userChart, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(*chart.Chart), nil
+}
+
+func (l *helmChartLoader) loadChart(ctx context.Context, version string) (*chart.Chart, error) {
+	archive, digest, err := l.source.Load(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyChartDigest(archive, digest); err != nil {
+		return nil, fmt.Errorf("failed to verify the chart of version %q: %v", version, err)
+	}
+	userChart, err := loader.LoadArchive(bytes.NewReader(archive))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the chart of version %q: %v", version, err)
+	}
+	if err := validateChart(userChart); err != nil {
+		return nil, fmt.Errorf("failed to load the chart of version %q: %v", version, err)
+	}
+
+	klog.V(4).InfoS("Loaded the helm chart", "name", userChart.Name(), "version", userChart.Metadata.Version,
+		"digest", digest)
+	return userChart, nil
+}
+
+func (l *helmChartLoader) getCachedChart(version, revision string) (*chart.Chart, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	cached, ok := l.charts[version]
+	if !ok || cached.revision != revision {
+		return nil, false
+	}
+	l.uses++
+	cached.lastUsed = l.uses
+	return cached.chart, true
+}
+
+func (l *helmChartLoader) setCachedChart(version, revision string, userChart *chart.Chart) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.uses++
+	l.charts[version] = &cachedChart{chart: userChart, revision: revision, lastUsed: l.uses}
+	for len(l.charts) > maxCachedCharts {
+		var oldest string
+		for v, cached := range l.charts {
+			if len(oldest) == 0 || cached.lastUsed < l.charts[oldest].lastUsed {
+				oldest = v
+			}
+		}
+		delete(l.charts, oldest)
+	}
+}
+
+func verifyChartDigest(archive []byte, digest string) error {
+	if len(digest) == 0 {
+		return nil
+	}
+	algorithm, expected, found := strings.Cut(digest, ":")
+	if !found {
+		algorithm, expected = "sha256", digest
+	}
+	if algorithm != "sha256" {
+		return fmt.Errorf("unsupported digest algorithm %q", algorithm)
+	}
+	sum := sha256.Sum256(archive)
+	if actual := hex.EncodeToString(sum[:]); actual != expected {
+		return fmt.Errorf("digest mismatch, expected %s, but got sha256:%s", digest, actual)
+	}
+	return nil
+}
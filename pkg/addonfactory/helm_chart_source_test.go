@@ -0,0 +1,358 @@
+package addonfactory
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/registry"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubeinformers "k8s.io/client-go/informers"
+	fakekube "k8s.io/client-go/kubernetes/fake"
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+	fakeaddon "open-cluster-management.io/api/client/addon/clientset/versioned/fake"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	clusterv1alpha1 "open-cluster-management.io/api/cluster/v1alpha1"
+
+	"open-cluster-management.io/addon-framework/pkg/utils"
+)
+
+func newTestChartArchive(t *testing.T) ([]byte, string) {
+	userChart, err := loadChart(chartFS, "testmanifests/chart")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := chartutil.Save(userChart, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(archive)
+	return archive, "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// newTestRegistry starts a registry stand-in serving the chart archive with the given tags in the repository
+// "charts/test", it returns the host of the registry and the number of the manifest requests.
+func newTestRegistry(t *testing.T, archive []byte, tags ...string) (string, *int) {
+	blobs := map[string][]byte{}
+	addBlob := func(data []byte) string {
+		sum := sha256.Sum256(data)
+		digest := "sha256:" + hex.EncodeToString(sum[:])
+		blobs[digest] = data
+		return digest
+	}
+
+	config := []byte(`{"name":"test","version":"2.2.0","apiVersion":"v1"}`)
+	manifest, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.oci.image.manifest.v1+json",
+		"config": map[string]interface{}{
+			"mediaType": registry.ConfigMediaType,
+			"digest":    addBlob(config),
+			"size":      len(config),
+		},
+		"layers": []map[string]interface{}{{
+			"mediaType": registry.ChartLayerMediaType,
+			"digest":    addBlob(archive),
+			"size":      len(archive),
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifestDigest := addBlob(manifest)
+
+	manifestRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var data []byte
+		switch {
+		case r.URL.Path == "/v2/":
+		case strings.HasPrefix(r.URL.Path, "/v2/charts/test/manifests/"):
+			reference := strings.TrimPrefix(r.URL.Path, "/v2/charts/test/manifests/")
+			found := reference == manifestDigest
+			for _, tag := range tags {
+				found = found || reference == tag
+			}
+			if !found {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			manifestRequests++
+			data = manifest
+			w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+			w.Header().Set("Docker-Content-Digest", manifestDigest)
+		case strings.HasPrefix(r.URL.Path, "/v2/charts/test/blobs/"):
+			blob, ok := blobs[strings.TrimPrefix(r.URL.Path, "/v2/charts/test/blobs/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			data = blob
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(data)))
+		if r.Method != http.MethodHead {
+			_, _ = w.Write(data)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "http://"), &manifestRequests
+}
+
+func TestHelmChartSource(t *testing.T) {
+	archive, digest := newTestChartArchive(t)
+	host, manifestRequests := newTestRegistry(t, archive, "2.2.0")
+
+	ociSource, err := NewOCIChartSource(fmt.Sprintf("oci://%s/charts/test", host), "2.2.0",
+		WithOCIPlainHTTP(), WithOCICredentialsFile(t.TempDir()+"/config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chartConfigMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "chart", Namespace: "open-cluster-management"},
+		BinaryData: map[string][]byte{"chart.tgz": archive, "chart-2.2.0.tgz": archive},
+		Data:       map[string]string{"chart-2.2.0.tgz.sha256": "sha256:invalid"},
+	}
+	chartSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "chart", Namespace: "open-cluster-management"},
+		Data:       map[string][]byte{"chart-2.2.0.tgz": archive, "chart-2.2.0.tgz.sha256": []byte(digest)},
+	}
+	kubeInformers := kubeinformers.NewSharedInformerFactory(fakekube.NewSimpleClientset(), 10*time.Minute)
+	if err := kubeInformers.Core().V1().ConfigMaps().Informer().GetStore().Add(chartConfigMap); err != nil {
+		t.Fatal(err)
+	}
+	if err := kubeInformers.Core().V1().Secrets().Informer().GetStore().Add(chartSecret); err != nil {
+		t.Fatal(err)
+	}
+	configMapLister := kubeInformers.Core().V1().ConfigMaps().Lister()
+	secretLister := kubeInformers.Core().V1().Secrets().Lister()
+
+	versionFunc := func(version string) HelmChartVersionFunc {
+		return func(*clusterv1.ManagedCluster, *addonapiv1beta1.ManagedClusterAddOn) (string, error) {
+			return version, nil
+		}
+	}
+
+	cases := []struct {
+		name                     string
+		source                   HelmChartSource
+		versionFunc              HelmChartVersionFunc
+		expectedManifestRequests int
+		expectedErr              string
+	}{
+		{
+			name:                     "oci default version",
+			source:                   ociSource,
+			expectedManifestRequests: 1,
+		},
+		{
+			name:                     "oci version with digest",
+			source:                   ociSource,
+			versionFunc:              versionFunc("2.2.0@" + digestOfManifest(t, host)),
+			expectedManifestRequests: 1,
+		},
+		{
+			name:        "oci version not found",
+			source:      ociSource,
+			versionFunc: versionFunc("3.0.0"),
+			expectedErr: "failed to pull chart",
+		},
+		{
+			name:   "configmap default version",
+			source: NewConfigMapChartSource(configMapLister, "open-cluster-management", "chart"),
+		},
+		{
+			name:        "configmap digest mismatch",
+			source:      NewConfigMapChartSource(configMapLister, "open-cluster-management", "chart"),
+			versionFunc: versionFunc("2.2.0"),
+			expectedErr: "digest mismatch",
+		},
+		{
+			name:        "secret version",
+			source:      NewSecretChartSource(secretLister, "open-cluster-management", "chart"),
+			versionFunc: versionFunc("2.2.0"),
+		},
+		{
+			name:        "secret version not found",
+			source:      NewSecretChartSource(secretLister, "open-cluster-management", "chart"),
+			versionFunc: versionFunc("3.0.0"),
+			expectedErr: "not found",
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	_ = clusterv1alpha1.Install(scheme)
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			*manifestRequests = 0
+			agentAddon, err := NewAgentAddonFactory("test", chartFS, "testmanifests/nochart").
+				WithScheme(scheme).
+				WithHelmChartSource(c.source, c.versionFunc).
+				BuildHelmAgentAddon()
+			if err != nil {
+				t.Fatalf("expected no error, got err %v", err)
+			}
+
+			cluster := NewFakeManagedCluster("cluster1", "1.16.0")
+			addon := NewFakeManagedClusterAddon("test", "cluster1", "", "")
+			for i := 0; i < 2; i++ {
+				objects, err := agentAddon.Manifests(context.TODO(), cluster, addon)
+				if len(c.expectedErr) > 0 {
+					if err == nil || !strings.Contains(err.Error(), c.expectedErr) {
+						t.Fatalf("expected error %q, but got %v", c.expectedErr, err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("expected no error, got err %v", err)
+				}
+				if len(objects) == 0 {
+					t.Errorf("expected the chart is rendered")
+				}
+			}
+
+			// the chart is cached after it is loaded.
+			if *manifestRequests != c.expectedManifestRequests {
+				t.Errorf("expected %d manifest requests, but got %d", c.expectedManifestRequests, *manifestRequests)
+			}
+		})
+	}
+}
+
+func TestOCIChartSourceCanceled(t *testing.T) {
+	archive, _ := newTestChartArchive(t)
+	host, manifestRequests := newTestRegistry(t, archive, "2.2.0")
+
+	ociSource, err := NewOCIChartSource(fmt.Sprintf("oci://%s/charts/test", host), "2.2.0",
+		WithOCIPlainHTTP(), WithOCICredentialsFile(t.TempDir()+"/config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the pull is aborted once the context is canceled.
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	if _, _, err := ociSource.Load(ctx, ""); err == nil || !strings.Contains(err.Error(), "context canceled") {
+		t.Errorf("expected the pull is canceled, but got %v", err)
+	}
+	if *manifestRequests != 0 {
+		t.Errorf("expected no manifest request, but got %d", *manifestRequests)
+	}
+}
+
+func TestHelmChartLoaderReload(t *testing.T) {
+	archive, digest := newTestChartArchive(t)
+	chartConfigMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "chart", Namespace: "open-cluster-management", ResourceVersion: "1"},
+		BinaryData: map[string][]byte{"chart.tgz": archive},
+		Data:       map[string]string{"chart.tgz.sha256": digest},
+	}
+	kubeClient := fakekube.NewSimpleClientset()
+	kubeInformers := kubeinformers.NewSharedInformerFactory(kubeClient, 10*time.Minute)
+	store := kubeInformers.Core().V1().ConfigMaps().Informer().GetStore()
+	if err := store.Add(chartConfigMap); err != nil {
+		t.Fatal(err)
+	}
+	chartLoader := newHelmChartLoader(NewConfigMapChartSource(
+		kubeInformers.Core().V1().ConfigMaps().Lister(), "open-cluster-management", "chart"), nil)
+
+	cluster := NewFakeManagedCluster("cluster1", "1.16.0")
+	addon := NewFakeManagedClusterAddon("test", "cluster1", "", "")
+	if _, err := chartLoader.load(context.TODO(), cluster, addon); err != nil {
+		t.Fatalf("expected no error, got err %v", err)
+	}
+
+	// the chart is not reloaded if the configmap is not changed, and the configmap is only read from the lister.
+	if _, err := chartLoader.load(context.TODO(), cluster, addon); err != nil {
+		t.Fatalf("expected no error, got err %v", err)
+	}
+	if len(kubeClient.Actions()) != 0 {
+		t.Errorf("expected no request to the kube-apiserver, but got %v", kubeClient.Actions())
+	}
+
+	// the chart is reloaded once the configmap is updated.
+	updated := chartConfigMap.DeepCopy()
+	updated.ResourceVersion = "2"
+	updated.Data["chart.tgz.sha256"] = "sha256:invalid"
+	if err := store.Update(updated); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chartLoader.load(context.TODO(), cluster, addon); err == nil ||
+		!strings.Contains(err.Error(), "digest mismatch") {
+		t.Errorf("expected the chart is reloaded and the digest mismatches, but got %v", err)
+	}
+}
+
+func TestHelmChartLoaderCache(t *testing.T) {
+	chartLoader := newHelmChartLoader(nil, nil)
+	for i := 0; i <= maxCachedCharts; i++ {
+		chartLoader.setCachedChart(fmt.Sprintf("%d", i), "", &chart.Chart{})
+	}
+	if len(chartLoader.charts) != maxCachedCharts {
+		t.Errorf("expected %d cached charts, but got %d", maxCachedCharts, len(chartLoader.charts))
+	}
+	if _, ok := chartLoader.charts["0"]; ok {
+		t.Errorf("expected the least recently used chart is evicted")
+	}
+	if _, ok := chartLoader.getCachedChart("1", "changed"); ok {
+		t.Errorf("expected the chart of a changed revision is not returned")
+	}
+}
+
+func digestOfManifest(t *testing.T, host string) string {
+	resp, err := http.Head(fmt.Sprintf("http://%s/v2/charts/test/manifests/2.2.0", host))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	return resp.Header.Get("Docker-Content-Digest")
+}
+
+func TestChartVersionFromDeploymentConfig(t *testing.T) {
+	config := &addonapiv1beta1.AddOnDeploymentConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "cluster1"},
+		Spec: addonapiv1beta1.AddOnDeploymentConfigSpec{
+			CustomizedVariables: []addonapiv1beta1.CustomizedVariable{{Name: "chartVersion", Value: "2.2.0"}},
+		},
+	}
+	addon := NewFakeManagedClusterAddon("test", "cluster1", "", "")
+	addon.Status.ConfigReferences = []addonapiv1beta1.ConfigReference{{
+		ConfigGroupResource: addonapiv1beta1.ConfigGroupResource{
+			Group:    utils.AddOnDeploymentConfigGVR.Group,
+			Resource: utils.AddOnDeploymentConfigGVR.Resource,
+		},
+		DesiredConfig: &addonapiv1beta1.ConfigSpecHash{
+			ConfigReferent: addonapiv1beta1.ConfigReferent{Namespace: "cluster1", Name: "config"},
+			SpecHash:       "hash",
+		},
+	}}
+	getter := utils.NewAddOnDeploymentConfigGetter(fakeaddon.NewSimpleClientset([]runtime.Object{config}...))
+
+	version, err := ChartVersionFromDeploymentConfig(getter, "chartVersion")(
+		NewFakeManagedCluster("cluster1", "1.16.0"), addon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != "2.2.0" {
+		t.Errorf("expected version 2.2.0, but got %s", version)
+	}
+}
@@ -0,0 +1,86 @@
+package addonfactory
+
+import (
+	"fmt"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+// validateChart checks the chart can be installed by the helm agentAddon, the chart should not be a library
+// chart, and the dependencies in the Chart.yaml of the chart and its subcharts should be vendored in the
+// charts/ directory.
+func validateChart(userChart *chart.Chart) error {
+	if strings.EqualFold(userChart.Metadata.Type, "library") {
+		return fmt.Errorf("library chart %s is not installable", userChart.Name())
+	}
+	return checkChartDependencies(userChart)
+}
+
+func checkChartDependencies(userChart *chart.Chart) error {
+	var missing []string
+	for _, dependency := range userChart.Metadata.Dependencies {
+		if dependency == nil {
+			continue
+		}
+		found := false
+		for _, subchart := range userChart.Dependencies() {
+			if subchart.Name() == dependency.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, dependency.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("the dependencies %s of chart %s are in Chart.yaml, but missing in the charts/ directory",
+			strings.Join(missing, ", "), userChart.ChartFullPath())
+	}
+
+	for _, subchart := range userChart.Dependencies() {
+		if err := checkChartDependencies(subchart); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// processChartDependencies returns a copy of the chart whose subcharts are disabled by the condition and tags
+// of the dependencies with the values, and the import-values of the dependencies are imported into the values
+// of the parent charts. The given chart is not changed, so it can be rendered with other values.
+func processChartDependencies(userChart *chart.Chart, values map[string]interface{}) (*chart.Chart, error) {
+	processed := copyChart(userChart)
+	if err := chartutil.ProcessDependenciesWithMerge(processed, values); err != nil {
+		return nil, fmt.Errorf("failed to process the dependencies of chart %s: %v", userChart.Name(), err)
+	}
+	return processed, nil
+}
+
+// copyChart copies the chart and its subcharts with the fields changed when the dependencies are processed,
+// the templates and files are shared with the given chart.
+func copyChart(userChart *chart.Chart) *chart.Chart {
+	chartCopy := *userChart
+	if userChart.Metadata != nil {
+		metadata := *userChart.Metadata
+		metadata.Dependencies = nil
+		for _, dependency := range userChart.Metadata.Dependencies {
+			if dependency == nil {
+				metadata.Dependencies = append(metadata.Dependencies, nil)
+				continue
+			}
+			dependencyCopy := *dependency
+			metadata.Dependencies = append(metadata.Dependencies, &dependencyCopy)
+		}
+		chartCopy.Metadata = &metadata
+	}
+
+	var subcharts []*chart.Chart
+	for _, subchart := range userChart.Dependencies() {
+		subcharts = append(subcharts, copyChart(subchart))
+	}
+	chartCopy.SetDependencies(subcharts...)
+	return &chartCopy
+}
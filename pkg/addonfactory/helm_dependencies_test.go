@@ -0,0 +1,171 @@
+package addonfactory
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
+	"open-cluster-management.io/addon-framework/pkg/agent"
+)
+
+//go:embed all:testmanifests/umbrella
+var umbrellaChartFS embed.FS
+
+func TestHelmAgentAddonDependencies(t *testing.T) {
+	cases := []struct {
+		name               string
+		values             Values
+		expectedObjects    []string
+		expectedAgentImage string
+		// expectedImportedImage is the agent image imported into the values of the umbrella chart.
+		expectedImportedImage string
+		expectedErrReason     string
+	}{
+		{
+			name:                  "default values",
+			expectedObjects:       []string{"ConfigMap/umbrella", "Deployment/agent"},
+			expectedAgentImage:    "quay.io/open-cluster-management/agent:latest",
+			expectedImportedImage: "quay.io/open-cluster-management/agent:latest",
+		},
+		{
+			name:                  "enable subchart by tags",
+			values:                Values{"tags": map[string]interface{}{"monitoring": true}},
+			expectedObjects:       []string{"ConfigMap/monitoring", "ConfigMap/umbrella", "Deployment/agent"},
+			expectedAgentImage:    "quay.io/open-cluster-management/agent:latest",
+			expectedImportedImage: "quay.io/open-cluster-management/agent:latest",
+		},
+		{
+			name:            "disable subchart by condition",
+			values:          Values{"agent": map[string]interface{}{"enabled": false}},
+			expectedObjects: []string{"ConfigMap/umbrella"},
+		},
+		{
+			name: "override the values of subchart",
+			values: Values{"agent": map[string]interface{}{
+				"image": map[string]interface{}{"tag": "v1"},
+			}},
+			expectedObjects:       []string{"ConfigMap/umbrella", "Deployment/agent"},
+			expectedAgentImage:    "quay.io/open-cluster-management/agent:v1",
+			expectedImportedImage: "quay.io/open-cluster-management/agent:latest",
+		},
+		{
+			name:                  "override the imported values",
+			values:                Values{"agentImage": map[string]interface{}{"tag": "v2"}},
+			expectedObjects:       []string{"ConfigMap/umbrella", "Deployment/agent"},
+			expectedAgentImage:    "quay.io/open-cluster-management/agent:latest",
+			expectedImportedImage: "quay.io/open-cluster-management/agent:v2",
+		},
+		{
+			name:              "values do not meet the schema",
+			values:            Values{"replicas": 0},
+			expectedErrReason: constants.ManifestsRenderedReasonValuesSchemaInvalid,
+		},
+		{
+			name: "values do not meet the schema of subchart",
+			values: Values{"agent": map[string]interface{}{
+				"image": map[string]interface{}{"tag": 1},
+			}},
+			expectedErrReason: constants.ManifestsRenderedReasonValuesSchemaInvalid,
+		},
+		{
+			name: "schema of disabled subchart is not validated",
+			values: Values{"agent": map[string]interface{}{
+				"enabled": false,
+				"image":   map[string]interface{}{"tag": 1},
+			}},
+			expectedObjects: []string{"ConfigMap/umbrella"},
+		},
+	}
+
+	// the same agentAddon renders all the cases, so the chart should not be changed by the values of a case.
+	var values Values
+	agentAddon, err := NewAgentAddonFactory("umbrella", umbrellaChartFS, "testmanifests/umbrella").
+		WithGetValuesFuncs(func(*clusterv1.ManagedCluster, *addonapiv1beta1.ManagedClusterAddOn) (Values, error) {
+			return values, nil
+		}).
+		BuildHelmAgentAddon()
+	if err != nil {
+		t.Fatalf("expected no error, got err %v", err)
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			values = c.values
+			cluster := NewFakeManagedCluster("cluster1", "1.10.1")
+			addon := NewFakeManagedClusterAddon("umbrella", "cluster1", "", "")
+
+			objects, err := agentAddon.Manifests(context.TODO(), cluster, addon)
+			if len(c.expectedErrReason) > 0 {
+				var renderErr *agent.ManifestsRenderError
+				if !errors.As(err, &renderErr) || renderErr.Reason != c.expectedErrReason {
+					t.Fatalf("expected render error with reason %s, but got %v", c.expectedErrReason, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got err %v", err)
+			}
+
+			var names []string
+			for _, o := range objects {
+				switch object := o.(type) {
+				case *corev1.ConfigMap:
+					names = append(names, "ConfigMap/"+object.Name)
+					if object.Labels["app.kubernetes.io/instance"] != "umbrella" {
+						t.Errorf("expected the labels from the library chart, but got %v", object.Labels)
+					}
+					if object.Name == "umbrella" && object.Data["agentImage"] != c.expectedImportedImage {
+						t.Errorf("expected imported image %q, but got %q", c.expectedImportedImage, object.Data["agentImage"])
+					}
+				case *appsv1.Deployment:
+					names = append(names, "Deployment/"+object.Name)
+					if image := object.Spec.Template.Spec.Containers[0].Image; image != c.expectedAgentImage {
+						t.Errorf("expected agent image %q, but got %q", c.expectedAgentImage, image)
+					}
+				default:
+					t.Errorf("unexpected object %T", o)
+				}
+			}
+			sort.Strings(names)
+			if strings.Join(names, ",") != strings.Join(c.expectedObjects, ",") {
+				t.Errorf("expected objects %v, but got %v", c.expectedObjects, names)
+			}
+		})
+	}
+}
+
+func TestValidateChart(t *testing.T) {
+	userChart, err := loadChart(umbrellaChartFS, "testmanifests/umbrella")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validateChart(userChart); err != nil {
+		t.Errorf("expected no error, got err %v", err)
+	}
+
+	libraryChart, err := loadChart(umbrellaChartFS, "testmanifests/umbrella/charts/common")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validateChart(libraryChart); err == nil || !strings.Contains(err.Error(), "not installable") {
+		t.Errorf("expected library chart is not installable, but got %v", err)
+	}
+
+	for _, subchart := range userChart.Dependencies() {
+		if subchart.Name() == "common" {
+			userChart.SetDependencies(subchart)
+		}
+	}
+	if err := validateChart(userChart); err == nil || !strings.Contains(err.Error(), "agent, monitoring") {
+		t.Errorf("expected missing dependencies error, but got %v", err)
+	}
+}
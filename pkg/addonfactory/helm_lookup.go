@@ -0,0 +1,305 @@
+package addonfactory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"helm.sh/helm/v3/pkg/engine"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/klog/v2"
+
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+	worklister "open-cluster-management.io/api/client/work/listers/work/v1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	workapiv1 "open-cluster-management.io/api/work/v1"
+)
+
+// HelmLookupFunc answers the lookup function of the helm chart rendered for the cluster and addon. It returns the
+// objects of the apiVersion and kind in the namespace, the objects in all namespaces are returned if the namespace
+// is empty, and only the object with the name is returned if the name is not empty. It returns nothing if the
+// objects are unknown to the func.
+type HelmLookupFunc func(ctx context.Context, cluster *clusterv1.ManagedCluster,
+	addon *addonapiv1beta1.ManagedClusterAddOn,
+	apiVersion, kind, namespace, name string) ([]*unstructured.Unstructured, error)
+
+// HelmLookupFromWorkStatusFeedback returns a HelmLookupFunc which answers from the status feedback of the
+// manifestWorks of the addon in the cache of the hub. The objects contain the apiVersion, kind, name and
+// namespace of the available resources in the manifestWorks, and the status feedback values of the resources.
+//
+// A JSONPaths feedback value is set to the path of its feedback rule, e.g. the value of the rule
+// {name: data, path: .data} of a Secret is set to the data of the Secret, and the values of the JsonRaw type are
+// decoded from json. A WellKnownStatus feedback value is set to the status with the lower camel case name of the
+// value, e.g. ReadyReplicas is set to .status.readyReplicas. The values with the paths which are not a simple
+// field path, e.g. a path with filters, are ignored.
+func HelmLookupFromWorkStatusFeedback(workLister worklister.ManifestWorkLister) HelmLookupFunc {
+	return func(_ context.Context, _ *clusterv1.ManagedCluster, addon *addonapiv1beta1.ManagedClusterAddOn,
+		apiVersion, kind, namespace, name string) ([]*unstructured.Unstructured, error) {
+		works, err := workLister.ManifestWorks(addon.Namespace).List(
+			labels.SelectorFromSet(labels.Set{addonapiv1beta1.AddonLabelKey: addon.Name}))
+		if err != nil {
+			return nil, err
+		}
+		// the manifestWorks of the addon in the hosting cluster namespace in Hosted mode.
+		hostingWorks, err := workLister.List(labels.SelectorFromSet(labels.Set{
+			addonapiv1beta1.AddonLabelKey:          addon.Name,
+			addonapiv1beta1.AddonNamespaceLabelKey: addon.Namespace,
+		}))
+		if err != nil {
+			return nil, err
+		}
+
+		var objects []*unstructured.Unstructured
+		for _, work := range append(works, hostingWorks...) {
+			for _, object := range objectsFromWorkStatusFeedback(work) {
+				if matchLookupObject(object, apiVersion, kind, namespace, name) {
+					objects = append(objects, object)
+				}
+			}
+		}
+		return objects, nil
+	}
+}
+
+// HelmLookupHubResource declares the resources on the hub which can be read by the lookup function of the helm
+// chart.
+type HelmLookupHubResource struct {
+	Resource schema.GroupVersionResource
+	Kind     string
+	// Namespace is the namespace of the resources, the resources in all namespaces or the cluster scoped
+	// resources can be read if it is empty.
+	Namespace string
+}
+
+// HelmLookupFromHubResources returns a HelmLookupFunc which answers from the declared resources on the hub, the
+// lookups of the other resources return nothing.
+func HelmLookupFromHubResources(client dynamic.Interface, resources ...HelmLookupHubResource) HelmLookupFunc {
+	return func(ctx context.Context, _ *clusterv1.ManagedCluster, _ *addonapiv1beta1.ManagedClusterAddOn,
+		apiVersion, kind, namespace, name string) ([]*unstructured.Unstructured, error) {
+		for _, resource := range resources {
+			if resource.Resource.GroupVersion().String() != apiVersion || resource.Kind != kind {
+				continue
+			}
+			if len(resource.Namespace) > 0 && resource.Namespace != namespace {
+				continue
+			}
+
+			var resourceClient dynamic.ResourceInterface = client.Resource(resource.Resource)
+			if len(namespace) > 0 {
+				resourceClient = client.Resource(resource.Resource).Namespace(namespace)
+			}
+			if len(name) > 0 {
+				object, err := resourceClient.Get(ctx, name, metav1.GetOptions{})
+				if errors.IsNotFound(err) {
+					return nil, nil
+				}
+				if err != nil {
+					return nil, err
+				}
+				return []*unstructured.Unstructured{object}, nil
+			}
+
+			list, err := resourceClient.List(ctx, metav1.ListOptions{})
+			if err != nil {
+				return nil, err
+			}
+			var objects []*unstructured.Unstructured
+			for i := range list.Items {
+				objects = append(objects, &list.Items[i])
+			}
+			return objects, nil
+		}
+		return nil, nil
+	}
+}
+
+// objectsFromWorkStatusFeedback returns the available resources in the status of the manifestWork with their
+// status feedback values.
+func objectsFromWorkStatusFeedback(work *workapiv1.ManifestWork) []*unstructured.Unstructured {
+	var objects []*unstructured.Unstructured
+	for _, manifest := range work.Status.ResourceStatus.Manifests {
+		if !meta.IsStatusConditionTrue(manifest.Conditions, workapiv1.ManifestAvailable) {
+			continue
+		}
+		resourceMeta := manifest.ResourceMeta
+		object := &unstructured.Unstructured{}
+		object.SetAPIVersion(schema.GroupVersion{Group: resourceMeta.Group, Version: resourceMeta.Version}.String())
+		object.SetKind(resourceMeta.Kind)
+		object.SetName(resourceMeta.Name)
+		object.SetNamespace(resourceMeta.Namespace)
+
+		paths := feedbackJSONPaths(work, resourceMeta)
+		for _, value := range manifest.StatusFeedbacks.Values {
+			path, ok := paths[value.Name]
+			if !ok {
+				path = ".status." + lowerFirst(value.Name)
+			}
+			fields, ok := jsonPathFields(path)
+			if !ok {
+				klog.V(4).Infof("skip the status feedback %s of %s %s/%s with the path %s",
+					value.Name, resourceMeta.Kind, resourceMeta.Namespace, resourceMeta.Name, path)
+				continue
+			}
+			fieldValue, err := feedbackFieldValue(value.Value)
+			if err != nil {
+				klog.V(4).Infof("skip the status feedback %s of %s %s/%s: %v",
+					value.Name, resourceMeta.Kind, resourceMeta.Namespace, resourceMeta.Name, err)
+				continue
+			}
+			if err := unstructured.SetNestedField(object.Object, fieldValue, fields...); err != nil {
+				klog.V(4).Infof("skip the status feedback %s of %s %s/%s: %v",
+					value.Name, resourceMeta.Kind, resourceMeta.Namespace, resourceMeta.Name, err)
+			}
+		}
+		objects = append(objects, object)
+	}
+	return objects
+}
+
+// feedbackJSONPaths returns the paths of the JSONPaths feedback rules of the resource in the manifestWork.
+func feedbackJSONPaths(work *workapiv1.ManifestWork, resourceMeta workapiv1.ManifestResourceMeta) map[string]string {
+	paths := map[string]string{}
+	for _, config := range work.Spec.ManifestConfigs {
+		identifier := config.ResourceIdentifier
+		if identifier.Group != resourceMeta.Group || identifier.Resource != resourceMeta.Resource ||
+			identifier.Name != resourceMeta.Name || identifier.Namespace != resourceMeta.Namespace {
+			continue
+		}
+		for _, rule := range config.FeedbackRules {
+			for _, jsonPath := range rule.JsonPaths {
+				paths[jsonPath.Name] = jsonPath.Path
+			}
+		}
+	}
+	return paths
+}
+
+// jsonPathFields returns the fields of a simple field path, e.g. .status.readyReplicas.
+func jsonPathFields(path string) ([]string, bool) {
+	path = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(path), "{"), "}")
+	if !strings.HasPrefix(path, ".") {
+		return nil, false
+	}
+	fields := strings.Split(strings.TrimPrefix(path, "."), ".")
+	for _, field := range fields {
+		if len(field) == 0 || strings.ContainsAny(field, "[]()@?*$=\"' ") {
+			return nil, false
+		}
+	}
+	return fields, true
+}
+
+func feedbackFieldValue(value workapiv1.FieldValue) (interface{}, error) {
+	switch {
+	case value.Type == workapiv1.Integer && value.Integer != nil:
+		return *value.Integer, nil
+	case value.Type == workapiv1.String && value.String != nil:
+		return *value.String, nil
+	case value.Type == workapiv1.Boolean && value.Boolean != nil:
+		return *value.Boolean, nil
+	case value.Type == workapiv1.JsonRaw && value.JsonRaw != nil:
+		var raw interface{}
+		if err := json.Unmarshal([]byte(*value.JsonRaw), &raw); err != nil {
+			return nil, err
+		}
+		return raw, nil
+	}
+	return nil, fmt.Errorf("the value of type %s is not set", value.Type)
+}
+
+func lowerFirst(s string) string {
+	if len(s) == 0 {
+		return s
+	}
+	runes := []rune(s)
+	runes[0] = unicode.ToLower(runes[0])
+	return string(runes)
+}
+
+func matchLookupObject(object *unstructured.Unstructured, apiVersion, kind, namespace, name string) bool {
+	if object.GetAPIVersion() != apiVersion || object.GetKind() != kind {
+		return false
+	}
+	if len(namespace) > 0 && object.GetNamespace() != namespace {
+		return false
+	}
+	return len(name) == 0 || object.GetName() == name
+}
+
+// helmLookupClientProvider provides the clients of the lookup function of the helm engine, the clients answer
+// the lookups by the lookup funcs. The first lookup func which returns objects wins.
+type helmLookupClientProvider struct {
+	ctx         context.Context
+	cluster     *clusterv1.ManagedCluster
+	addon       *addonapiv1beta1.ManagedClusterAddOn
+	lookupFuncs []HelmLookupFunc
+}
+
+var _ engine.ClientProvider = &helmLookupClientProvider{}
+
+func (p *helmLookupClientProvider) GetClientFor(apiVersion, kind string) (dynamic.NamespaceableResourceInterface, bool, error) {
+	return &helmLookupClient{provider: p, apiVersion: apiVersion, kind: kind}, true, nil
+}
+
+func (p *helmLookupClientProvider) lookup(apiVersion, kind, namespace, name string) ([]*unstructured.Unstructured, error) {
+	for _, lookupFunc := range p.lookupFuncs {
+		objects, err := lookupFunc(p.ctx, p.cluster, p.addon, apiVersion, kind, namespace, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to lookup %s %s %s/%s: %v", apiVersion, kind, namespace, name, err)
+		}
+		if len(objects) > 0 {
+			return objects, nil
+		}
+	}
+	return nil, nil
+}
+
+// helmLookupClient is the client used by the lookup function of the helm engine, the lookup function only
+// calls the Namespace, Get and List of the client.
+type helmLookupClient struct {
+	dynamic.NamespaceableResourceInterface
+
+	provider   *helmLookupClientProvider
+	apiVersion string
+	kind       string
+	namespace  string
+}
+
+func (c *helmLookupClient) Namespace(namespace string) dynamic.ResourceInterface {
+	return &helmLookupClient{provider: c.provider, apiVersion: c.apiVersion, kind: c.kind, namespace: namespace}
+}
+
+func (c *helmLookupClient) Get(_ context.Context, name string, _ metav1.GetOptions,
+	_ ...string) (*unstructured.Unstructured, error) {
+	objects, err := c.provider.lookup(c.apiVersion, c.kind, c.namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 0 {
+		gv, _ := schema.ParseGroupVersion(c.apiVersion)
+		return nil, errors.NewNotFound(gv.WithResource(strings.ToLower(c.kind)).GroupResource(), name)
+	}
+	return objects[0], nil
+}
+
+func (c *helmLookupClient) List(_ context.Context, _ metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	objects, err := c.provider.lookup(c.apiVersion, c.kind, c.namespace, "")
+	if err != nil {
+		return nil, err
+	}
+	list := &unstructured.UnstructuredList{}
+	list.SetAPIVersion(c.apiVersion)
+	list.SetKind(c.kind + "List")
+	for _, object := range objects {
+		list.Items = append(list.Items, *object)
+	}
+	return list, nil
+}
@@ -0,0 +1,179 @@
+package addonfactory
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/tools/cache"
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+	worklister "open-cluster-management.io/api/client/work/listers/work/v1"
+	workapiv1 "open-cluster-management.io/api/work/v1"
+)
+
+func newLookupTestWork(available bool, feedbacks ...workapiv1.FeedbackValue) *workapiv1.ManifestWork {
+	status := metav1.ConditionTrue
+	if !available {
+		status = metav1.ConditionFalse
+	}
+	return &workapiv1.ManifestWork{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "addon-lookup-deploy-0",
+			Namespace: "cluster1",
+			Labels:    map[string]string{addonapiv1beta1.AddonLabelKey: "lookup"},
+		},
+		Spec: workapiv1.ManifestWorkSpec{
+			ManifestConfigs: []workapiv1.ManifestConfigOption{{
+				ResourceIdentifier: workapiv1.ResourceIdentifier{
+					Resource: "secrets", Name: "agent-password", Namespace: "open-cluster-management-agent-addon",
+				},
+				FeedbackRules: []workapiv1.FeedbackRule{{
+					Type:      workapiv1.JSONPathsType,
+					JsonPaths: []workapiv1.JsonPath{{Name: "data", Path: ".data"}},
+				}},
+			}},
+		},
+		Status: workapiv1.ManifestWorkStatus{
+			ResourceStatus: workapiv1.ManifestResourceStatus{
+				Manifests: []workapiv1.ManifestCondition{{
+					ResourceMeta: workapiv1.ManifestResourceMeta{
+						Version: "v1", Kind: "Secret", Resource: "secrets",
+						Name: "agent-password", Namespace: "open-cluster-management-agent-addon",
+					},
+					StatusFeedbacks: workapiv1.StatusFeedbackResult{Values: feedbacks},
+					Conditions: []metav1.Condition{
+						{Type: workapiv1.ManifestAvailable, Status: status},
+					},
+				}},
+			},
+		},
+	}
+}
+
+func TestHelmAgentAddonLookup(t *testing.T) {
+	password := `{"password":"c2VjcmV0"}`
+	passwordFeedback := workapiv1.FeedbackValue{
+		Name:  "data",
+		Value: workapiv1.FieldValue{Type: workapiv1.JsonRaw, JsonRaw: &password},
+	}
+	hubConfig := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "agent-config", "namespace": "open-cluster-management-hub"},
+		"data":       map[string]interface{}{"logLevel": "debug"},
+	}}
+	hubResource := HelmLookupHubResource{
+		Resource:  schema.GroupVersionResource{Version: "v1", Resource: "configmaps"},
+		Kind:      "ConfigMap",
+		Namespace: "open-cluster-management-hub",
+	}
+
+	cases := []struct {
+		name             string
+		works            []*workapiv1.ManifestWork
+		hubResources     []HelmLookupHubResource
+		expectedPassword string
+		expectedLogLevel string
+	}{
+		{
+			name:             "nothing is found",
+			expectedPassword: "generated",
+			expectedLogLevel: "info",
+		},
+		{
+			name:             "lookup from status feedback",
+			works:            []*workapiv1.ManifestWork{newLookupTestWork(true, passwordFeedback)},
+			expectedPassword: "secret",
+			expectedLogLevel: "info",
+		},
+		{
+			name:             "resource is not available",
+			works:            []*workapiv1.ManifestWork{newLookupTestWork(false, passwordFeedback)},
+			expectedPassword: "generated",
+			expectedLogLevel: "info",
+		},
+		{
+			name:             "lookup from hub resources",
+			hubResources:     []HelmLookupHubResource{hubResource},
+			expectedPassword: "generated",
+			expectedLogLevel: "debug",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{
+				cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+			})
+			for _, work := range c.works {
+				if err := indexer.Add(work); err != nil {
+					t.Fatal(err)
+				}
+			}
+			dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), hubConfig)
+
+			agentAddon, err := NewAgentAddonFactory("lookup", templateFS, "testmanifests/lookup").
+				WithHelmLookupFuncs(
+					HelmLookupFromWorkStatusFeedback(worklister.NewManifestWorkLister(indexer)),
+					HelmLookupFromHubResources(dynamicClient, c.hubResources...),
+				).
+				BuildHelmAgentAddon()
+			if err != nil {
+				t.Fatalf("expected no error, got err %v", err)
+			}
+
+			objects, err := agentAddon.Manifests(context.TODO(),
+				NewFakeManagedCluster("cluster1", "1.10.1"), NewFakeManagedClusterAddon("lookup", "cluster1", "", ""))
+			if err != nil {
+				t.Fatalf("expected no error, got err %v", err)
+			}
+			for _, o := range objects {
+				switch object := o.(type) {
+				case *corev1.Secret:
+					if string(object.Data["password"]) != c.expectedPassword {
+						t.Errorf("expected password %s, but got %s", c.expectedPassword, object.Data["password"])
+					}
+				case *corev1.ConfigMap:
+					if object.Data["logLevel"] != c.expectedLogLevel {
+						t.Errorf("expected log level %s, but got %s", c.expectedLogLevel, object.Data["logLevel"])
+					}
+				default:
+					t.Errorf("unexpected object %T", o)
+				}
+			}
+		})
+	}
+}
+
+func TestJSONPathFields(t *testing.T) {
+	cases := []struct {
+		path           string
+		expectedFields []string
+	}{
+		{path: ".status.readyReplicas", expectedFields: []string{"status", "readyReplicas"}},
+		{path: "{.data}", expectedFields: []string{"data"}},
+		{path: `.status.conditions[?(@.type=="Available")].status`},
+		{path: "status"},
+	}
+	for _, c := range cases {
+		fields, ok := jsonPathFields(c.path)
+		if ok != (c.expectedFields != nil) || len(fields) != len(c.expectedFields) {
+			t.Errorf("expected fields %v of path %s, but got %v", c.expectedFields, c.path, fields)
+		}
+	}
+}
+
+func TestHelmAgentAddonLookupStrict(t *testing.T) {
+	_, err := NewAgentAddonFactory("lookup", templateFS, "testmanifests/lookup").
+		WithHelmEngineStrict().
+		WithHelmLookupFuncs(HelmLookupFromHubResources(dynamicfake.NewSimpleDynamicClient(runtime.NewScheme()))).
+		BuildHelmAgentAddon()
+	if err == nil {
+		t.Errorf("expected error with the strict mode and the lookup funcs, but got nil")
+	}
+}
@@ -0,0 +1,298 @@
+package addonfactory
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/kustomize/api/konfig"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/yaml"
+
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+
+	"open-cluster-management.io/addon-framework/pkg/agent"
+	"open-cluster-management.io/addon-framework/pkg/utils"
+)
+
+const (
+	// KustomizeBuiltinValuesFileName is the file written into every directory of the kustomization when the
+	// kustomize agentAddon is rendered. The file contains a ConfigMap named KustomizeBuiltinValuesName whose data
+	// are the builtin values of the addon (ClusterName, AddonInstallNamespace, InstallMode, HubKubeConfigSecret
+	// and ManagedKubeConfigSecret), so it can be the source of the replacements in the kustomization.
+	//
+	// The file should be added to the resources of only one kustomization in the build, e.g. the base. The
+	// ConfigMap is a local config, so it is not included in the manifests of the addon.
+	KustomizeBuiltinValuesFileName = "addon-builtin-values.yaml"
+
+	// KustomizeBuiltinValuesName is the name of the ConfigMap of the builtin values.
+	KustomizeBuiltinValuesName = "addon-builtin-values"
+
+	// kustomizeRoot is the root directory of the kustomization files in the in-memory file system.
+	kustomizeRoot = "/kustomize"
+)
+
+// KustomizeOverlayFunc returns the overlay directory to build for the cluster, the directory is relative to the
+// kustomization directory of the factory. An empty string means there is no matched overlay.
+type KustomizeOverlayFunc func(cluster *clusterv1.ManagedCluster,
+	addon *addonapiv1beta1.ManagedClusterAddOn, installMode string) (string, error)
+
+// KustomizeOverlayByInstallMode selects the overlay by the install mode of the addon.
+func KustomizeOverlayByInstallMode(overlays map[string]string) KustomizeOverlayFunc {
+	return func(_ *clusterv1.ManagedCluster, _ *addonapiv1beta1.ManagedClusterAddOn, installMode string) (string, error) {
+		return overlays[installMode], nil
+	}
+}
+
+// KustomizeOverlayByClusterLabel selects the overlay by the value of the given label of the cluster.
+func KustomizeOverlayByClusterLabel(labelKey string, overlays map[string]string) KustomizeOverlayFunc {
+	return func(cluster *clusterv1.ManagedCluster, _ *addonapiv1beta1.ManagedClusterAddOn, _ string) (string, error) {
+		value, ok := cluster.Labels[labelKey]
+		if !ok {
+			return "", nil
+		}
+		return overlays[value], nil
+	}
+}
+
+// KustomizeOverlayByClusterClaim selects the overlay by the value of the given cluster claim in the status
+// of the cluster.
+func KustomizeOverlayByClusterClaim(claimName string, overlays map[string]string) KustomizeOverlayFunc {
+	return func(cluster *clusterv1.ManagedCluster, _ *addonapiv1beta1.ManagedClusterAddOn, _ string) (string, error) {
+		for _, claim := range cluster.Status.ClusterClaims {
+			if claim.Name == claimName {
+				return overlays[claim.Value], nil
+			}
+		}
+		return "", nil
+	}
+}
+
+type KustomizeAgentAddon struct {
+	decoder                        runtime.Decoder
+	dir                            string
+	files                          map[string][]byte
+	overlayFuncs                   []KustomizeOverlayFunc
+	agentAddonOptions              agent.AgentAddonOptions
+	trimCRDDescription             bool
+	workloadConfigFuncs            []WorkloadConfigFunc
+	deploymentConfigMutationGetter utils.AddOnDeploymentConfigGetter
+}
+
+func newKustomizeAgentAddon(factory *AgentAddonFactory, files map[string][]byte) *KustomizeAgentAddon {
+	return &KustomizeAgentAddon{
+		decoder:                        serializer.NewCodecFactory(factory.scheme).UniversalDeserializer(),
+		dir:                            path.Clean(factory.dir),
+		files:                          files,
+		overlayFuncs:                   factory.kustomizeOverlayFuncs,
+		agentAddonOptions:              factory.agentAddonOptions,
+		trimCRDDescription:             factory.trimCRDDescription,
+		workloadConfigFuncs:            factory.workloadConfigFuncs,
+		deploymentConfigMutationGetter: factory.deploymentConfigMutationGetter,
+	}
+}
+
+func (a *KustomizeAgentAddon) Manifests(
+	ctx context.Context,
+	cluster *clusterv1.ManagedCluster,
+	addon *addonapiv1beta1.ManagedClusterAddOn) ([]runtime.Object, error) {
+	builtinValues, err := a.getBuiltinValues(ctx, cluster, addon)
+	if err != nil {
+		return nil, err
+	}
+
+	overlay, err := a.overlay(cluster, addon, builtinValues.InstallMode)
+	if err != nil {
+		return nil, err
+	}
+
+	fSys, err := a.fileSystem(builtinValues, addon)
+	if err != nil {
+		return nil, err
+	}
+	resMap, err := krusty.MakeKustomizer(krusty.MakeDefaultOptions()).Run(fSys, path.Join(kustomizeRoot, overlay))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build the kustomization %s: %v", path.Join(a.dir, overlay), err)
+	}
+
+	var objects []runtime.Object
+	for _, res := range resMap.Resources() {
+		raw, err := res.AsYAML()
+		if err != nil {
+			return nil, err
+		}
+		// only the identity of the resource is logged, since the resource may contain the sensitive data.
+		klog.V(4).Infof("rendered kustomize resource: %s %s/%s", res.GetKind(), res.GetNamespace(), res.GetName())
+		object, _, err := a.decoder.Decode(raw, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, object)
+	}
+
+	if err := applyAddOnDeploymentConfig(objects, a.deploymentConfigMutationGetter, addon); err != nil {
+		return nil, err
+	}
+	workloadConfig, err := getWorkloadConfig(a.workloadConfigFuncs, cluster, addon)
+	if err != nil {
+		return nil, err
+	}
+	applyWorkloadConfig(objects, workloadConfig)
+
+	if a.trimCRDDescription {
+		objects = trimCRDDescription(objects)
+	}
+	return objects, nil
+}
+
+func (a *KustomizeAgentAddon) GetAgentAddonOptions() agent.AgentAddonOptions {
+	return a.agentAddonOptions
+}
+
+// overlay returns the overlay directory selected by the first overlay func which matches the cluster.
+func (a *KustomizeAgentAddon) overlay(cluster *clusterv1.ManagedCluster,
+	addon *addonapiv1beta1.ManagedClusterAddOn, installMode string) (string, error) {
+	for _, overlayFunc := range a.overlayFuncs {
+		overlay, err := overlayFunc(cluster, addon, installMode)
+		if err != nil {
+			return "", err
+		}
+		if len(overlay) == 0 {
+			continue
+		}
+		overlay = path.Clean(overlay)
+		if path.IsAbs(overlay) || strings.HasPrefix(overlay, "..") {
+			return "", fmt.Errorf("overlay %q is not in the kustomization directory", overlay)
+		}
+		return overlay, nil
+	}
+	return "", nil
+}
+
+// fileSystem returns an in-memory file system with the kustomization files, and the builtin values file in
+// every directory.
+func (a *KustomizeAgentAddon) fileSystem(builtinValues *templateBuiltinValues,
+	addon *addonapiv1beta1.ManagedClusterAddOn) (filesys.FileSystem, error) {
+	defaultValues := a.getDefaultValues(addon)
+	builtinValuesConfigMap := &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        KustomizeBuiltinValuesName,
+			Annotations: map[string]string{konfig.IgnoredByKustomizeAnnotation: "true"},
+		},
+		Data: map[string]string{
+			"ClusterName":             builtinValues.ClusterName,
+			"AddonInstallNamespace":   builtinValues.AddonInstallNamespace,
+			"InstallMode":             builtinValues.InstallMode,
+			"HubKubeConfigSecret":     defaultValues.HubKubeConfigSecret,
+			"ManagedKubeConfigSecret": defaultValues.ManagedKubeConfigSecret,
+		},
+	}
+	builtinValuesData, err := yaml.Marshal(builtinValuesConfigMap)
+	if err != nil {
+		return nil, err
+	}
+
+	fSys := filesys.MakeFsInMemory()
+	dirs := map[string]bool{kustomizeRoot: true}
+	for name, data := range a.files {
+		filePath := path.Join(kustomizeRoot, name)
+		if err := fSys.WriteFile(filePath, data); err != nil {
+			return nil, err
+		}
+		dirs[path.Dir(filePath)] = true
+	}
+	for dir := range dirs {
+		if err := fSys.WriteFile(path.Join(dir, KustomizeBuiltinValuesFileName), builtinValuesData); err != nil {
+			return nil, err
+		}
+	}
+	return fSys, nil
+}
+
+func (a *KustomizeAgentAddon) getBuiltinValues(
+	ctx context.Context,
+	cluster *clusterv1.ManagedCluster,
+	addon *addonapiv1beta1.ManagedClusterAddOn) (*templateBuiltinValues, error) {
+	builtinValues := &templateBuiltinValues{}
+	builtinValues.ClusterName = cluster.GetName()
+
+	// In v1beta1, InstallNamespace field is removed from ManagedClusterAddOnSpec
+	// First try to get from annotation
+	installNamespace := addon.Annotations[addonapiv1beta1.InstallNamespaceAnnotation]
+	if len(installNamespace) == 0 {
+		installNamespace = AddonDefaultInstallNamespace
+	}
+
+	// If agentInstallNamespace function is provided, use it (may get from AddOnDeploymentConfig)
+	if a.agentAddonOptions.AgentInstallNamespace != nil {
+		ns, err := a.agentAddonOptions.AgentInstallNamespace(ctx, addon)
+		if err != nil {
+			klog.Errorf("failed to get agent install namespace for addon %s: %v", addon.Name, err)
+			return nil, err
+		}
+		if len(ns) > 0 {
+			installNamespace = ns
+		}
+	}
+	builtinValues.AddonInstallNamespace = installNamespace
+
+	builtinValues.InstallMode, _ = a.agentAddonOptions.HostedModeInfoFunc(addon, cluster)
+
+	return builtinValues, nil
+}
+
+func (a *KustomizeAgentAddon) getDefaultValues(addon *addonapiv1beta1.ManagedClusterAddOn) *templateDefaultValues {
+	defaultValues := &templateDefaultValues{}
+
+	if a.agentAddonOptions.Registration != nil {
+		defaultValues.HubKubeConfigSecret = fmt.Sprintf("%s-hub-kubeconfig", a.agentAddonOptions.AddonName)
+	}
+
+	defaultValues.ManagedKubeConfigSecret = fmt.Sprintf("%s-managed-kubeconfig", addon.Name)
+
+	return defaultValues
+}
+
+// loadKustomizationFiles returns the files in the kustomization directory of the fs, the names of the files
+// are relative to the directory.
+func loadKustomizationFiles(kustomizeFS embed.FS, dir string) (map[string][]byte, error) {
+	dir = path.Clean(dir)
+	files, err := getFiles(kustomizeFS)
+	if err != nil {
+		return nil, err
+	}
+
+	kustomizationFiles := map[string][]byte{}
+	for _, file := range files {
+		name := file
+		if dir != "." {
+			if !strings.HasPrefix(file, dir+"/") {
+				continue
+			}
+			name = strings.TrimPrefix(file, dir+"/")
+		}
+		data, err := fs.ReadFile(kustomizeFS, file)
+		if err != nil {
+			return nil, err
+		}
+		kustomizationFiles[name] = data
+	}
+
+	for _, name := range konfig.RecognizedKustomizationFileNames() {
+		if _, ok := kustomizationFiles[name]; ok {
+			return kustomizationFiles, nil
+		}
+	}
+	return nil, fmt.Errorf("there is no kustomization file in %s", dir)
+}
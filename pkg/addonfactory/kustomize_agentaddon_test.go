@@ -0,0 +1,157 @@
+package addonfactory
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
+)
+
+func TestKustomizeAddon_Manifests(t *testing.T) {
+	hostedModeInfo := func(addon *addonapiv1beta1.ManagedClusterAddOn, _ *clusterv1.ManagedCluster) (string, string) {
+		return constants.InstallModeHosted, "hosting"
+	}
+
+	cases := []struct {
+		name                     string
+		dir                      string
+		installNamespace         string
+		clusterLabels            map[string]string
+		clusterClaims            []clusterv1.ManagedClusterClaim
+		hostedModeInfoFunc       func(*addonapiv1beta1.ManagedClusterAddOn, *clusterv1.ManagedCluster) (string, string)
+		overlayFuncs             []KustomizeOverlayFunc
+		expectedInstallNamespace string
+		expectedReplicas         int32
+		expectedBuildErr         bool
+		expectedErr              bool
+	}{
+		{
+			name:                     "build the kustomization directory",
+			dir:                      "testmanifests/kustomize",
+			installNamespace:         "myNs",
+			expectedInstallNamespace: "myNs",
+			expectedReplicas:         1,
+		},
+		{
+			name:                     "build the base",
+			dir:                      "testmanifests/kustomize/base",
+			expectedInstallNamespace: AddonDefaultInstallNamespace,
+			expectedReplicas:         1,
+		},
+		{
+			name:               "overlay by install mode",
+			dir:                "testmanifests/kustomize",
+			hostedModeInfoFunc: hostedModeInfo,
+			overlayFuncs: []KustomizeOverlayFunc{
+				KustomizeOverlayByInstallMode(map[string]string{constants.InstallModeHosted: "overlays/hosted"}),
+			},
+			expectedInstallNamespace: AddonDefaultInstallNamespace,
+			expectedReplicas:         2,
+		},
+		{
+			name:          "overlay by cluster label",
+			dir:           "testmanifests/kustomize",
+			clusterLabels: map[string]string{"tier": "large"},
+			overlayFuncs: []KustomizeOverlayFunc{
+				KustomizeOverlayByInstallMode(map[string]string{constants.InstallModeHosted: "overlays/none"}),
+				KustomizeOverlayByClusterLabel("tier", map[string]string{"large": "overlays/hosted"}),
+			},
+			expectedInstallNamespace: AddonDefaultInstallNamespace,
+			expectedReplicas:         2,
+		},
+		{
+			name:          "overlay by cluster claim",
+			dir:           "testmanifests/kustomize",
+			clusterClaims: []clusterv1.ManagedClusterClaim{{Name: "platform.open-cluster-management.io", Value: "AWS"}},
+			overlayFuncs: []KustomizeOverlayFunc{
+				KustomizeOverlayByClusterClaim("platform.open-cluster-management.io", map[string]string{"AWS": "overlays/hosted"}),
+			},
+			expectedInstallNamespace: AddonDefaultInstallNamespace,
+			expectedReplicas:         2,
+		},
+		{
+			name: "overlay out of the kustomization directory",
+			dir:  "testmanifests/kustomize/overlays",
+			overlayFuncs: []KustomizeOverlayFunc{
+				KustomizeOverlayByClusterLabel("tier", map[string]string{"large": "../base"}),
+			},
+			clusterLabels:    map[string]string{"tier": "large"},
+			expectedBuildErr: true,
+		},
+		{
+			name: "overlay not found",
+			dir:  "testmanifests/kustomize",
+			overlayFuncs: []KustomizeOverlayFunc{
+				KustomizeOverlayByClusterLabel("tier", map[string]string{"large": "overlays/large"}),
+			},
+			clusterLabels: map[string]string{"tier": "large"},
+			expectedErr:   true,
+		},
+		{
+			name:             "no kustomization file",
+			dir:              "testmanifests/template",
+			expectedBuildErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cluster := NewFakeManagedCluster("cluster1", "1.10.1")
+			cluster.Labels = c.clusterLabels
+			cluster.Status.ClusterClaims = c.clusterClaims
+			addon := NewFakeManagedClusterAddon("helloworld", "cluster1", c.installNamespace, "")
+
+			factory := NewAgentAddonFactory("helloworld", templateFS, c.dir).
+				WithKustomizeOverlayFuncs(c.overlayFuncs...)
+			if c.hostedModeInfoFunc != nil {
+				factory = factory.WithAgentHostedInfoFn(c.hostedModeInfoFunc)
+			}
+			agentAddon, err := factory.BuildKustomizeAgentAddon()
+			if c.expectedBuildErr {
+				// the overlay is validated when the manifests are rendered.
+				if err == nil {
+					_, err = agentAddon.Manifests(context.TODO(), cluster, addon)
+				}
+				if err == nil {
+					t.Errorf("expected error, but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got err %v", err)
+			}
+
+			objects, err := agentAddon.Manifests(context.TODO(), cluster, addon)
+			if c.expectedErr {
+				if err == nil {
+					t.Errorf("expected error, but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got err %v", err)
+			}
+
+			if len(objects) != 1 {
+				t.Fatalf("expected 1 object, but got %v", objects)
+			}
+			deployment, ok := objects[0].(*appsv1.Deployment)
+			if !ok {
+				t.Fatalf("expected deployment, but got %T", objects[0])
+			}
+			if deployment.Namespace != c.expectedInstallNamespace {
+				t.Errorf("expected namespace %s, but got %s", c.expectedInstallNamespace, deployment.Namespace)
+			}
+			if *deployment.Spec.Replicas != c.expectedReplicas {
+				t.Errorf("expected replicas %d, but got %d", c.expectedReplicas, *deployment.Spec.Replicas)
+			}
+			if args := deployment.Spec.Template.Spec.Containers[0].Args; args[2] != "cluster1" {
+				t.Errorf("expected cluster name is replaced, but got %v", args)
+			}
+		})
+	}
+}
@@ -11,8 +11,9 @@ import (
 	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
 	clusterv1 "open-cluster-management.io/api/cluster/v1"
 
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
 	"open-cluster-management.io/addon-framework/pkg/agent"
-	"open-cluster-management.io/addon-framework/pkg/assets"
+	"open-cluster-management.io/addon-framework/pkg/utils"
 )
 
 // templateBuiltinValues includes the built-in values for template agentAddon.
@@ -38,49 +39,102 @@ type templateFile struct {
 }
 
 type TemplateAgentAddon struct {
-	decoder            runtime.Decoder
-	templateFiles      []templateFile
-	getValuesFuncs     []GetValuesFunc
-	agentAddonOptions  agent.AgentAddonOptions
-	trimCRDDescription bool
+	decoder                        runtime.Decoder
+	templateFiles                  []templateFile
+	getValuesFuncs                 []GetValuesFunc
+	agentAddonOptions              agent.AgentAddonOptions
+	trimCRDDescription             bool
+	workloadConfigFuncs            []WorkloadConfigFunc
+	deploymentConfigMutationGetter utils.AddOnDeploymentConfigGetter
+	templateEngine                 TemplateEngine
+	validateFuncs                  []ValuesValidateFunc
+	secretValuesFuncs              []SecretValuesFunc
 }
 
 func newTemplateAgentAddon(factory *AgentAddonFactory) *TemplateAgentAddon {
-	return &TemplateAgentAddon{
-		decoder:            serializer.NewCodecFactory(factory.scheme).UniversalDeserializer(),
-		getValuesFuncs:     factory.getValuesFuncs,
-		agentAddonOptions:  factory.agentAddonOptions,
-		trimCRDDescription: factory.trimCRDDescription,
+	agentAddon := &TemplateAgentAddon{
+		decoder:                        serializer.NewCodecFactory(factory.scheme).UniversalDeserializer(),
+		getValuesFuncs:                 factory.getValuesFuncs,
+		agentAddonOptions:              factory.agentAddonOptions,
+		trimCRDDescription:             factory.trimCRDDescription,
+		workloadConfigFuncs:            factory.workloadConfigFuncs,
+		deploymentConfigMutationGetter: factory.deploymentConfigMutationGetter,
+		templateEngine:                 factory.templateEngine,
+		validateFuncs:                  valuesValidateFuncs(factory, true),
+		secretValuesFuncs:              factory.secretValuesFuncs,
 	}
+	agentAddon.agentAddonOptions.ManifestWorkAnnotations = manifestWorkAnnotations(factory, agentAddon)
+	return agentAddon
 }
 
 func (a *TemplateAgentAddon) Manifests(
 	ctx context.Context,
 	cluster *clusterv1.ManagedCluster,
 	addon *addonapiv1beta1.ManagedClusterAddOn) ([]runtime.Object, error) {
+	secrets, err := getSecretValues(a.secretValuesFuncs, cluster, addon)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := a.renderManifests(cluster, addon, secrets)
+	if err != nil {
+		// the errors of the template engine and the values validation may contain the secret values.
+		return nil, secrets.redactError(err)
+	}
+	return objects, nil
+}
+
+func (a *TemplateAgentAddon) renderManifests(
+	cluster *clusterv1.ManagedCluster,
+	addon *addonapiv1beta1.ManagedClusterAddOn,
+	secrets *secretValues) ([]runtime.Object, error) {
 	var objects []runtime.Object
 
-	configValues, err := a.getValues(cluster, addon)
+	configValues, err := a.getValues(cluster, addon, secrets, nil)
 	if err != nil {
 		return objects, err
 	}
+	if err := validateValues(a.validateFuncs, configValues); err != nil {
+		return nil, err
+	}
 
-	for _, file := range a.templateFiles {
-		if len(file.content) == 0 {
-			continue
-		}
-		klog.V(4).Infof("rendered template: %v", file.content)
-		raw := assets.MustCreateAssetFromTemplate(file.name, file.content, configValues).Data
-		object, _, err := a.decoder.Decode(raw, nil, nil)
+	renderedFiles, err := renderTemplateFiles(a.templateEngine, a.templateFiles, configValues)
+	if err != nil {
+		return nil, &agent.ManifestsRenderError{Reason: constants.ManifestsRenderedReasonTemplateRenderFailed, Err: err}
+	}
+
+	for _, file := range renderedFiles {
+		klog.V(4).Infof("rendered template: %s", secrets.redact(string(file.content)))
+		documents, err := splitYAMLDocuments(file.content)
 		if err != nil {
-			if runtime.IsMissingKind(err) {
-				klog.V(4).Infof("Skipping template %v, reason: %v", file.name, err)
-				continue
+			return nil, &agent.ManifestsRenderError{
+				Reason: constants.ManifestsRenderedReasonTemplateRenderFailed,
+				Err:    fmt.Errorf("failed to read the rendered template %s: %v", file.name, err),
 			}
-			return nil, err
 		}
-		objects = append(objects, object)
+		for _, raw := range documents {
+			object, _, err := a.decoder.Decode(raw, nil, nil)
+			if err != nil {
+				if runtime.IsMissingKind(err) {
+					klog.V(4).Infof("Skipping template %v, reason: %v", file.name, err)
+					continue
+				}
+				return nil, &agent.ManifestsRenderError{
+					Reason: constants.ManifestsRenderedReasonTemplateRenderFailed,
+					Err:    fmt.Errorf("failed to decode the rendered template %s: %v", file.name, err),
+				}
+			}
+			objects = append(objects, object)
+		}
+	}
+
+	if err := applyAddOnDeploymentConfig(objects, a.deploymentConfigMutationGetter, addon); err != nil {
+		return nil, err
 	}
+	workloadConfig, err := getWorkloadConfig(a.workloadConfigFuncs, cluster, addon)
+	if err != nil {
+		return nil, err
+	}
+	applyWorkloadConfig(objects, workloadConfig)
 
 	if a.trimCRDDescription {
 		objects = trimCRDDescription(objects)
@@ -92,13 +146,36 @@ func (a *TemplateAgentAddon) GetAgentAddonOptions() agent.AgentAddonOptions {
 	return a.agentAddonOptions
 }
 
+// ValuesReport returns the final merged values of the template files on the cluster, and the source of each
+// leaf key.
+func (a *TemplateAgentAddon) ValuesReport(
+	_ context.Context,
+	cluster *clusterv1.ManagedCluster,
+	addon *addonapiv1beta1.ManagedClusterAddOn) (*ValuesReport, error) {
+	secrets, err := getSecretValues(a.secretValuesFuncs, cluster, addon)
+	if err != nil {
+		return nil, err
+	}
+	provenance := newValuesProvenance()
+	values, err := a.getValues(cluster, addon, secrets, provenance)
+	if err != nil {
+		return nil, secrets.redactError(err)
+	}
+	return provenance.report(values, ValuesSourceDefault)
+}
+
+// getValues returns the values to render the template files, the secret values override the values of the
+// getValuesFuncs. The sources of the values are recorded in the provenance if it is not nil.
 func (a *TemplateAgentAddon) getValues(
 	cluster *clusterv1.ManagedCluster,
-	addon *addonapiv1beta1.ManagedClusterAddOn) (Values, error) {
+	addon *addonapiv1beta1.ManagedClusterAddOn,
+	secrets *secretValues,
+	provenance *valuesProvenance) (Values, error) {
 	overrideValues := map[string]interface{}{}
 
 	defaultValues := a.getDefaultValues(cluster, addon)
 	overrideValues = MergeValues(overrideValues, defaultValues)
+	provenance.record(ValuesSourceDefault, defaultValues)
 
 	for i := 0; i < len(a.getValuesFuncs); i++ {
 		if a.getValuesFuncs[i] != nil {
@@ -107,13 +184,19 @@ func (a *TemplateAgentAddon) getValues(
 				return overrideValues, err
 			}
 			overrideValues = MergeValues(overrideValues, userValues)
+			provenance.record(getValuesFuncSource(i, a.getValuesFuncs[i]), userValues)
 		}
 	}
+	for i, values := range secrets.values {
+		overrideValues = MergeValues(overrideValues, values)
+		provenance.record(getSecretValuesFuncSource(i), values)
+	}
 	builtinValues, err := a.getBuiltinValues(cluster, addon)
 	if err != nil {
 		return overrideValues, err
 	}
 	overrideValues = MergeValues(overrideValues, builtinValues)
+	provenance.record(ValuesSourceBuiltin, builtinValues)
 
 	return overrideValues, nil
 }
@@ -0,0 +1,170 @@
+package addonfactory
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/sprig/v3"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	sigsyaml "sigs.k8s.io/yaml"
+
+	"open-cluster-management.io/addon-framework/pkg/assets"
+)
+
+// TemplateEngine is the engine to render the template files of the template agentAddon.
+type TemplateEngine string
+
+const (
+	// TemplateEngineDefault renders each template file by text/template with the functions of the assets package.
+	TemplateEngineDefault TemplateEngine = "Default"
+
+	// TemplateEngineSprig renders the template files by text/template with the Sprig functions, and the include,
+	// tpl, required, toYaml and fromYaml functions in the same way as helm. The template files whose names start
+	// with "_" are the partials, the named templates defined in them can be used in all the template files, and
+	// they are not rendered as manifests. Note that the files whose names start with "_" are only embedded with
+	// the "all:" prefix in the go:embed directive.
+	TemplateEngineSprig TemplateEngine = "Sprig"
+)
+
+// includeMaxDepth is the max depth of the nested include and tpl calls, to stop the recursive templates.
+const includeMaxDepth = 1000
+
+// renderTemplateFiles renders the template files with the values by the engine, and returns the rendered
+// content of each file which is not a partial.
+func renderTemplateFiles(engine TemplateEngine, files []templateFile, values Values) ([]templateFile, error) {
+	switch engine {
+	case TemplateEngineDefault, "":
+		var rendered []templateFile
+		for _, file := range files {
+			if len(file.content) == 0 {
+				continue
+			}
+			asset, err := assets.CreateAssetFromTemplate(file.name, file.content, values)
+			if err != nil {
+				return nil, fmt.Errorf("failed to render template %s: %v", file.name, err)
+			}
+			rendered = append(rendered, templateFile{name: file.name, content: asset.Data})
+		}
+		return rendered, nil
+	case TemplateEngineSprig:
+		return renderSprigTemplateFiles(files, values)
+	}
+	return nil, fmt.Errorf("unsupported template engine %q", engine)
+}
+
+func renderSprigTemplateFiles(files []templateFile, values Values) ([]templateFile, error) {
+	root := template.New("")
+	root.Funcs(sprigFuncMap(root))
+	for _, file := range files {
+		if _, err := root.New(file.name).Parse(string(file.content)); err != nil {
+			return nil, fmt.Errorf("failed to parse template %s: %v", file.name, err)
+		}
+	}
+
+	var rendered []templateFile
+	for _, file := range files {
+		if isPartialTemplate(file.name) || len(file.content) == 0 {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := root.ExecuteTemplate(&buf, file.name, values); err != nil {
+			return nil, fmt.Errorf("failed to render template %s: %v", file.name, err)
+		}
+		rendered = append(rendered, templateFile{name: file.name, content: buf.Bytes()})
+	}
+	return rendered, nil
+}
+
+func isPartialTemplate(name string) bool {
+	return strings.HasPrefix(path.Base(name), "_")
+}
+
+// sprigFuncMap returns the Sprig functions without the functions reading the environment variables, and the
+// functions to include the named templates of the root template.
+func sprigFuncMap(root *template.Template) template.FuncMap {
+	funcMap := sprig.TxtFuncMap()
+	delete(funcMap, "env")
+	delete(funcMap, "expandenv")
+
+	depth := 0
+	funcMap["include"] = func(name string, data interface{}) (string, error) {
+		if depth >= includeMaxDepth {
+			return "", fmt.Errorf("rendering template %s has a nested reference more than %d times", name, includeMaxDepth)
+		}
+		depth++
+		defer func() { depth-- }()
+
+		var buf bytes.Buffer
+		if err := root.ExecuteTemplate(&buf, name, data); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+	funcMap["tpl"] = func(text string, data interface{}) (string, error) {
+		if depth >= includeMaxDepth {
+			return "", fmt.Errorf("rendering tpl has a nested reference more than %d times", includeMaxDepth)
+		}
+		depth++
+		defer func() { depth-- }()
+
+		t, err := root.Clone()
+		if err != nil {
+			return "", err
+		}
+		if _, err := t.New("tpl").Parse(text); err != nil {
+			return "", err
+		}
+		var buf bytes.Buffer
+		if err := t.ExecuteTemplate(&buf, "tpl", data); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+	funcMap["required"] = func(message string, value interface{}) (interface{}, error) {
+		if value == nil {
+			return nil, fmt.Errorf("%s", message)
+		}
+		if s, ok := value.(string); ok && len(s) == 0 {
+			return nil, fmt.Errorf("%s", message)
+		}
+		return value, nil
+	}
+	funcMap["toYaml"] = func(value interface{}) string {
+		data, err := sigsyaml.Marshal(value)
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSuffix(string(data), "\n")
+	}
+	funcMap["fromYaml"] = func(text string) map[string]interface{} {
+		m := map[string]interface{}{}
+		if err := sigsyaml.Unmarshal([]byte(text), &m); err != nil {
+			m["Error"] = err.Error()
+		}
+		return m
+	}
+	return funcMap
+}
+
+// splitYAMLDocuments splits the rendered content into the yaml documents, the empty documents are ignored.
+func splitYAMLDocuments(content []byte) ([][]byte, error) {
+	var documents [][]byte
+	reader := yaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(content)))
+	for {
+		document, err := reader.Read()
+		if err == io.EOF {
+			return documents, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(document)) != 0 {
+			documents = append(documents, document)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package addonfactory
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
+	"open-cluster-management.io/addon-framework/pkg/agent"
+)
+
+//go:embed all:testmanifests/sprig
+var sprigTemplateFS embed.FS
+
+func TestTemplateAddonSprigManifests(t *testing.T) {
+	cases := []struct {
+		name                 string
+		values               Values
+		expectedGreeting     string
+		expectedNodeSelector string
+	}{
+		{
+			name:                 "default values",
+			expectedGreeting:     "hello cluster1",
+			expectedNodeSelector: "{}\n",
+		},
+		{
+			name: "render values by tpl and toYaml",
+			values: Values{
+				"Greeting":     "hi {{ .AddonInstallNamespace }}",
+				"NodeSelector": map[string]interface{}{"host": "ssd"},
+			},
+			expectedGreeting:     "hi open-cluster-management-agent-addon",
+			expectedNodeSelector: "host: ssd\n",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			agentAddon, err := NewAgentAddonFactory("helloworld", sprigTemplateFS, "testmanifests/sprig").
+				WithTemplateEngine(TemplateEngineSprig).
+				WithGetValuesFuncs(func(*clusterv1.ManagedCluster, *addonapiv1beta1.ManagedClusterAddOn) (Values, error) {
+					return c.values, nil
+				}).
+				BuildTemplateAgentAddon()
+			if err != nil {
+				t.Fatalf("expected no error, got err %v", err)
+			}
+
+			objects, err := agentAddon.Manifests(context.TODO(),
+				NewFakeManagedCluster("cluster1", "1.10.1"), NewFakeManagedClusterAddon("helloworld", "cluster1", "", ""))
+			if err != nil {
+				t.Fatalf("expected no error, got err %v", err)
+			}
+			if len(objects) != 2 {
+				t.Fatalf("expected 2 objects, but got %v", len(objects))
+			}
+
+			for _, o := range objects {
+				switch object := o.(type) {
+				case *corev1.ServiceAccount:
+					if object.Labels["cluster"] != "CLUSTER1" || object.Labels["app"] != "helloworld" {
+						t.Errorf("expected the labels from the partial, but got %v", object.Labels)
+					}
+				case *corev1.ConfigMap:
+					if object.Data["greeting"] != c.expectedGreeting {
+						t.Errorf("expected greeting %q, but got %q", c.expectedGreeting, object.Data["greeting"])
+					}
+					if object.Data["nodeSelector"] != c.expectedNodeSelector {
+						t.Errorf("expected nodeSelector %q, but got %q", c.expectedNodeSelector, object.Data["nodeSelector"])
+					}
+				default:
+					t.Errorf("unexpected object %T", o)
+				}
+			}
+		})
+	}
+}
+
+func TestTemplateAddonRenderError(t *testing.T) {
+	agentAddon, err := NewAgentAddonFactory("helloworld", sprigTemplateFS, "testmanifests/sprig").
+		WithTemplateEngine(TemplateEngineSprig).
+		BuildTemplateAgentAddon()
+	if err != nil {
+		t.Fatalf("expected no error, got err %v", err)
+	}
+	templateAddon := agentAddon.(*TemplateAgentAddon)
+	templateAddon.templateFiles = append(templateAddon.templateFiles, templateFile{
+		name:    "testmanifests/sprig/required.yaml",
+		content: []byte(`image: {{ required "Image is required" .Image }}`),
+	})
+
+	_, err = agentAddon.Manifests(context.TODO(),
+		NewFakeManagedCluster("cluster1", "1.10.1"), NewFakeManagedClusterAddon("helloworld", "cluster1", "", ""))
+	var renderErr *agent.ManifestsRenderError
+	if !errors.As(err, &renderErr) || renderErr.Reason != constants.ManifestsRenderedReasonTemplateRenderFailed {
+		t.Fatalf("expected render error with reason %s, but got %v", constants.ManifestsRenderedReasonTemplateRenderFailed, err)
+	}
+	if !strings.Contains(err.Error(), "Image is required") {
+		t.Errorf("expected the message of required, but got %v", err)
+	}
+
+	if _, err := NewAgentAddonFactory("helloworld", sprigTemplateFS, "testmanifests/sprig").
+		WithTemplateEngine("Unknown").
+		BuildTemplateAgentAddon(); err == nil {
+		t.Errorf("expected unsupported template engine error")
+	}
+}
+
+func TestRenderTemplateFiles(t *testing.T) {
+	cases := []struct {
+		name            string
+		engine          TemplateEngine
+		files           []templateFile
+		expectedContent []string
+		expectedErr     bool
+	}{
+		{
+			name:            "default engine",
+			engine:          TemplateEngineDefault,
+			files:           []templateFile{{name: "a.yaml", content: []byte("name: {{ .Name }}")}, {name: "b.yaml"}},
+			expectedContent: []string{"name: test"},
+		},
+		{
+			name:        "default engine returns error instead of panic",
+			engine:      TemplateEngineDefault,
+			files:       []templateFile{{name: "a.yaml", content: []byte("name: {{ .Name.Missing }}")}},
+			expectedErr: true,
+		},
+		{
+			name:        "default engine parse error",
+			engine:      TemplateEngineDefault,
+			files:       []templateFile{{name: "a.yaml", content: []byte("name: {{ .Name ")}},
+			expectedErr: true,
+		},
+		{
+			name:   "sprig engine with partials",
+			engine: TemplateEngineSprig,
+			files: []templateFile{
+				{name: "dir/_helpers.tpl", content: []byte(`{{ define "name" }}{{ .Name | upper }}{{ end }}`)},
+				{name: "dir/a.yaml", content: []byte(`name: {{ include "name" . }}`)},
+			},
+			expectedContent: []string{"name: TEST"},
+		},
+		{
+			name:        "sprig engine without env functions",
+			engine:      TemplateEngineSprig,
+			files:       []templateFile{{name: "a.yaml", content: []byte(`home: {{ env "HOME" }}`)}},
+			expectedErr: true,
+		},
+		{
+			name:   "sprig engine stops recursive include",
+			engine: TemplateEngineSprig,
+			files: []templateFile{
+				{name: "_helpers.tpl", content: []byte(`{{ define "loop" }}{{ include "loop" . }}{{ end }}`)},
+				{name: "a.yaml", content: []byte(`{{ include "loop" . }}`)},
+			},
+			expectedErr: true,
+		},
+		{
+			name:        "unsupported engine",
+			engine:      "Unknown",
+			files:       []templateFile{{name: "a.yaml", content: []byte("name: test")}},
+			expectedErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rendered, err := renderTemplateFiles(c.engine, c.files, Values{"Name": "test"})
+			if c.expectedErr {
+				if err == nil {
+					t.Errorf("expected error, but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got err %v", err)
+			}
+			var contents []string
+			for _, file := range rendered {
+				contents = append(contents, string(file.content))
+			}
+			if strings.Join(contents, ",") != strings.Join(c.expectedContent, ",") {
+				t.Errorf("expected content %v, but got %v", c.expectedContent, contents)
+			}
+		})
+	}
+}
+
+func TestSplitYAMLDocuments(t *testing.T) {
+	documents, err := splitYAMLDocuments([]byte("---\na: 1\n---\n# comment\n---\n\n---\nb: 2\n"))
+	if err != nil {
+		t.Fatalf("expected no error, got err %v", err)
+	}
+	if len(documents) != 3 {
+		t.Errorf("expected 3 documents, but got %d: %q", len(documents), documents)
+	}
+}
@@ -0,0 +1,4 @@
+{{- define "sprig.labels" -}}
+app: {{ .AddonName | default "helloworld" }}
+cluster: {{ .ClusterName | upper }}
+{{- end }}
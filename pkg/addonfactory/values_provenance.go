@@ -0,0 +1,176 @@
+package addonfactory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"reflect"
+	goruntime "runtime"
+	"sort"
+	"strings"
+
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
+	"open-cluster-management.io/addon-framework/pkg/agent"
+)
+
+const (
+	// ValuesSourceChart is the source of the values from the values.yaml of the chart and its subcharts.
+	ValuesSourceChart = "Chart"
+	// ValuesSourceDefault is the source of the default values of the agentAddon, e.g. HubKubeConfigSecret.
+	ValuesSourceDefault = "Default"
+	// ValuesSourceBuiltin is the source of the builtin values of the agentAddon, e.g. ClusterName.
+	ValuesSourceBuiltin = "Builtin"
+
+	secretValuesFuncsSourcePrefix = "SecretValuesFuncs["
+)
+
+// ValuesReport is the final merged values of an addon on a cluster, and the source of each leaf key of the values.
+type ValuesReport struct {
+	// Values is the final merged values which are used to render the manifests.
+	Values Values `json:"values"`
+
+	// Sources maps the path of each leaf key in the values to the source of its value. The path is the keys from
+	// the root joined by ".", e.g. "global.imageOverrides.agentImage", and the lists are leaves. The source is one
+	// of ValuesSourceChart, ValuesSourceDefault, ValuesSourceBuiltin, "GetValuesFuncs[<index>](<func name>)"
+	// for the values returned by the GetValuesFuncs, e.g. the values from the AddOnDeploymentConfig, or
+	// "SecretValuesFuncs[<index>]" for the values returned by the SecretValuesFuncs, which are redacted.
+	Sources map[string]string `json:"sources"`
+}
+
+// ValuesReporter reports the final merged values of an addon and their sources, both the helm and template
+// agentAddons implement it.
+type ValuesReporter interface {
+	ValuesReport(ctx context.Context, cluster *clusterv1.ManagedCluster,
+		addon *addonapiv1beta1.ManagedClusterAddOn) (*ValuesReport, error)
+}
+
+// valuesProvenance records the source of each leaf key when the values are merged by MergeValues, the source
+// recorded later overrides the earlier one in the same way as the values.
+type valuesProvenance struct {
+	sources map[string]string
+}
+
+func newValuesProvenance() *valuesProvenance {
+	return &valuesProvenance{sources: map[string]string{}}
+}
+
+// record records the source of the leaf keys in the values, it does nothing if the provenance is nil.
+func (p *valuesProvenance) record(source string, values Values) {
+	if p == nil {
+		return
+	}
+	// the typed maps and structs are normalized, so the leaf keys are the same as in the normalized values.
+	if normalized, err := JsonStructToValues(values); err == nil {
+		values = normalized
+	}
+	walkValuesLeaves("", values, func(leaf string, _ map[string]interface{}, _ string) {
+		p.sources[leaf] = source
+	})
+}
+
+// report returns the report of the final values, the source of the leaf keys which are not recorded is the
+// defaultSource. The values from the SecretValuesFuncs are redacted.
+func (p *valuesProvenance) report(values Values, defaultSource string) (*ValuesReport, error) {
+	normalized, err := JsonStructToValues(values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to normalize values: %w", err)
+	}
+
+	report := &ValuesReport{Values: normalized, Sources: map[string]string{}}
+	walkValuesLeaves("", normalized, func(leaf string, parent map[string]interface{}, key string) {
+		source, ok := p.sources[leaf]
+		if !ok {
+			source = defaultSource
+		}
+		report.Sources[leaf] = source
+		if strings.HasPrefix(source, secretValuesFuncsSourcePrefix) {
+			parent[key] = redactedValue
+		}
+	})
+	return report, nil
+}
+
+// walkValuesLeaves calls the fn with the path of each leaf key in the values in order, and the map and the key
+// of the leaf.
+func walkValuesLeaves(prefix string, values map[string]interface{},
+	fn func(leaf string, parent map[string]interface{}, key string)) {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		leaf := k
+		if len(prefix) > 0 {
+			leaf = prefix + "." + k
+		}
+		if child, ok := values[k].(map[string]interface{}); ok && len(child) > 0 {
+			walkValuesLeaves(leaf, child, fn)
+			continue
+		}
+		fn(leaf, values, k)
+	}
+}
+
+// getValuesFuncSource returns the source of the values returned by the GetValuesFunc at the index.
+func getValuesFuncSource(index int, fn GetValuesFunc) string {
+	name := "unknown"
+	if f := goruntime.FuncForPC(reflect.ValueOf(fn).Pointer()); f != nil {
+		name = path.Base(f.Name())
+	}
+	return fmt.Sprintf("GetValuesFuncs[%d](%s)", index, name)
+}
+
+// getSecretValuesFuncSource returns the source of the values returned by the SecretValuesFunc at the index.
+func getSecretValuesFuncSource(index int) string {
+	return fmt.Sprintf("%s%d]", secretValuesFuncsSourcePrefix, index)
+}
+
+// manifestWorkAnnotations returns the ManifestWorkAnnotationsFunc of the helm or template agentAddon, the deploy
+// manifestWorks are annotated with the values report generated by the reporter if the values provenance annotation
+// is enabled. The report is generated when the annotations are built instead of being kept for each addon, so
+// nothing is left behind once the addon is deleted. The deploy manifestWorks are marked by the
+// SensitiveDataAnnotationKey annotation if the addon has secret values. The annotations are merged into the ManifestWorkAnnotations of the factory, and it returns the
+// ManifestWorkAnnotations of the factory if neither is enabled.
+func manifestWorkAnnotations(factory *AgentAddonFactory, reporter ValuesReporter) agent.ManifestWorkAnnotationsFunc {
+	annotationsFunc := factory.agentAddonOptions.ManifestWorkAnnotations
+	if !factory.valuesProvenanceAnnotation && len(factory.secretValuesFuncs) == 0 {
+		return annotationsFunc
+	}
+
+	provenanceEnabled := factory.valuesProvenanceAnnotation
+	sensitive := len(factory.secretValuesFuncs) > 0
+	return func(ctx context.Context, cluster *clusterv1.ManagedCluster,
+		addon *addonapiv1beta1.ManagedClusterAddOn) (map[string]string, error) {
+		annotations := map[string]string{}
+		if annotationsFunc != nil {
+			userAnnotations, err := annotationsFunc(ctx, cluster, addon)
+			if err != nil {
+				return nil, err
+			}
+			for k, v := range userAnnotations {
+				annotations[k] = v
+			}
+		}
+		if sensitive {
+			annotations[constants.SensitiveDataAnnotationKey] = "true"
+		}
+		if provenanceEnabled {
+			report, err := reporter.ValuesReport(ctx, cluster, addon)
+			if err != nil {
+				return nil, err
+			}
+			data, err := json.Marshal(report)
+			if err != nil {
+				return nil, err
+			}
+			annotations[constants.ValuesProvenanceAnnotationKey] = string(data)
+		}
+		return annotations, nil
+	}
+}
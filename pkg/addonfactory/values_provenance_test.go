@@ -0,0 +1,155 @@
+package addonfactory
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	clusterv1alpha1 "open-cluster-management.io/api/cluster/v1alpha1"
+
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
+	"open-cluster-management.io/addon-framework/pkg/agent"
+)
+
+func TestValuesReport(t *testing.T) {
+	imageValues := func(*clusterv1.ManagedCluster, *addonapiv1beta1.ManagedClusterAddOn) (Values, error) {
+		return Values{"global": map[string]interface{}{
+			"imageOverrides": map[string]interface{}{"testImage": "quay.io/testimage:v1"},
+		}}, nil
+	}
+	configValues := func(*clusterv1.ManagedCluster, *addonapiv1beta1.ManagedClusterAddOn) (Values, error) {
+		return Values{
+			"managedKubeConfigSecret": "external-managed-kubeconfig",
+			"Image":                   "quay.io/testimage:v2",
+			"HubKubeConfigSecret":     "external-hub-kubeconfig",
+			// the builtin values can not be overridden.
+			"clusterName": "cluster2",
+			"ClusterName": "cluster2",
+		}, nil
+	}
+
+	testScheme := runtime.NewScheme()
+	_ = clusterv1alpha1.Install(testScheme)
+	_ = apiextensionsv1.AddToScheme(testScheme)
+	_ = scheme.AddToScheme(testScheme)
+	userAnnotations := func(context.Context, *clusterv1.ManagedCluster,
+		*addonapiv1beta1.ManagedClusterAddOn) (map[string]string, error) {
+		return map[string]string{"example.io/owner": "test"}, nil
+	}
+
+	cases := []struct {
+		name            string
+		build           func() (agent.AgentAddon, error)
+		expectedValues  map[string]interface{}
+		expectedSources map[string]string
+	}{
+		{
+			name: "helm agentAddon",
+			build: func() (agent.AgentAddon, error) {
+				return NewAgentAddonFactory("test", chartFS, "testmanifests/chart").
+					WithScheme(testScheme).
+					WithGetValuesFuncs(imageValues, configValues).
+					WithValuesProvenanceAnnotation().
+					WithManifestWorkAnnotations(userAnnotations).
+					BuildHelmAgentAddon()
+			},
+			expectedValues: map[string]interface{}{
+				"global.imageOverrides.testImage": "quay.io/testimage:v1",
+				"managedKubeConfigSecret":         "external-managed-kubeconfig",
+				"clusterName":                     "cluster1",
+				"org":                             "open-cluster-management",
+			},
+			expectedSources: map[string]string{
+				"global.imageOverrides.testImage": "GetValuesFuncs[0](",
+				"managedKubeConfigSecret":         "GetValuesFuncs[1](",
+				"clusterName":                     ValuesSourceBuiltin,
+				"org":                             ValuesSourceChart,
+				"resources.limits.memory":         ValuesSourceChart,
+			},
+		},
+		{
+			name: "template agentAddon",
+			build: func() (agent.AgentAddon, error) {
+				return NewAgentAddonFactory("test", templateFS, "testmanifests/template").
+					WithScheme(testScheme).
+					WithGetValuesFuncs(imageValues, configValues).
+					WithValuesProvenanceAnnotation().
+					WithManifestWorkAnnotations(userAnnotations).
+					BuildTemplateAgentAddon()
+			},
+			expectedValues: map[string]interface{}{
+				"Image":                   "quay.io/testimage:v2",
+				"HubKubeConfigSecret":     "external-hub-kubeconfig",
+				"ManagedKubeConfigSecret": "test-managed-kubeconfig",
+				"ClusterName":             "cluster1",
+			},
+			expectedSources: map[string]string{
+				"global.imageOverrides.testImage": "GetValuesFuncs[0](",
+				"Image":                           "GetValuesFuncs[1](",
+				"HubKubeConfigSecret":             "GetValuesFuncs[1](",
+				"ManagedKubeConfigSecret":         ValuesSourceDefault,
+				"ClusterName":                     ValuesSourceBuiltin,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			agentAddon, err := c.build()
+			if err != nil {
+				t.Fatalf("expected no error, got err %v", err)
+			}
+
+			cluster := NewFakeManagedCluster("cluster1", "1.10.1")
+			addon := NewFakeManagedClusterAddon("test", "cluster1", "", "")
+			report, err := agentAddon.(ValuesReporter).ValuesReport(context.TODO(), cluster, addon)
+			if err != nil {
+				t.Fatalf("expected no error, got err %v", err)
+			}
+			for leaf, expected := range c.expectedValues {
+				if value := lookupLeaf(report.Values, leaf); value != expected {
+					t.Errorf("expected value %v of %s, but got %v", expected, leaf, value)
+				}
+			}
+			for leaf, expected := range c.expectedSources {
+				if source := report.Sources[leaf]; !strings.HasPrefix(source, expected) {
+					t.Errorf("expected source %s of %s, but got %s", expected, leaf, source)
+				}
+			}
+
+			// the report is generated again when the annotations of the deploy manifestWorks are built.
+			annotations, err := agentAddon.GetAgentAddonOptions().ManifestWorkAnnotations(context.TODO(), cluster, addon)
+			if err != nil {
+				t.Fatalf("expected no error, got err %v", err)
+			}
+			if annotations["example.io/owner"] != "test" {
+				t.Errorf("expected the annotations of the factory are kept, but got %v", annotations)
+			}
+			annotated := &ValuesReport{}
+			if err := json.Unmarshal([]byte(annotations[constants.ValuesProvenanceAnnotationKey]), annotated); err != nil {
+				t.Fatalf("expected the values report in the annotation, got err %v", err)
+			}
+			if len(annotated.Sources) != len(report.Sources) {
+				t.Errorf("expected the sources %v in the annotation, but got %v", report.Sources, annotated.Sources)
+			}
+		})
+	}
+}
+
+func lookupLeaf(values map[string]interface{}, leaf string) interface{} {
+	keys := strings.Split(leaf, ".")
+	for _, k := range keys[:len(keys)-1] {
+		child, ok := values[k].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		values = child
+	}
+	return values[keys[len(keys)-1]]
+}
@@ -0,0 +1,163 @@
+package addonfactory
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+
+	"open-cluster-management.io/addon-framework/pkg/agent"
+	"open-cluster-management.io/addon-framework/pkg/utils"
+)
+
+// redactedValue replaces the sensitive values in the logs, the errors and the values report.
+const redactedValue = "<redacted>"
+
+// SecretValuesFunc returns the sensitive values of the addon, e.g. the registry pull secrets or the API keys.
+// The values are merged in the same way as the values of GetValuesFunc, but the string values in them are
+// redacted from the logs of the agentAddon, the errors reported on the ManagedClusterAddOn and the ValuesReport.
+type SecretValuesFunc func(cluster *clusterv1.ManagedCluster,
+	addon *addonapiv1beta1.ManagedClusterAddOn) (Values, error)
+
+// SecretToValuesFunc transforms the Secret object into Values object.
+type SecretToValuesFunc func(secret corev1.Secret) (Values, error)
+
+// ToSecretValues transforms the values in yaml or json format in the utils.SecretValuesKey of the Secret data
+// into Values object, for example: the data of one Secret is:
+//
+//	{
+//	 values.yaml: "global:\n  imagePullSecret: regcred\n  apiKey: xxx",
+//	}
+//
+// after transformed, the Values will be:
+// map[global:map[apiKey:xxx imagePullSecret:regcred]]
+func ToSecretValues(secret corev1.Secret) (Values, error) {
+	data, ok := secret.Data[utils.SecretValuesKey]
+	if !ok {
+		return nil, nil
+	}
+	values := Values{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		// the error of yaml.Unmarshal may contain the data, so it is not returned.
+		return nil, fmt.Errorf("failed to parse the values of secret %s/%s", secret.Namespace, secret.Name)
+	}
+	return values, nil
+}
+
+// GetSecretValues uses SecretValuesConfigGetter to get the Secrets referenced by the config references of the
+// addon (utils.SecretValuesConfigGVR), then uses SecretToValuesFunc to transform the Secrets to Values object.
+// ToSecretValues is used if no toValuesFuncs is set. If there are multiple Secrets in the config references, the
+// big index object will override the one from small index. The Secrets can only be referenced in the cluster
+// namespace of the addon, use GetSecretValuesFromNamespaces to allow the other namespaces. Note that the addon
+// should support the config type by WithConfigGVRs(utils.SecretValuesConfigGVR), and the addon manager is
+// required to have the permission to get, list and watch the Secrets on the hub. The config controllers cache
+// all the Secrets on the hub once the config type is supported, see utils.SecretValuesConfigGVR, so the getter
+// returned by utils.NewSecretValuesConfigListerGetter is preferred.
+func GetSecretValues(getter utils.SecretValuesConfigGetter, toValuesFuncs ...SecretToValuesFunc) SecretValuesFunc {
+	return GetSecretValuesFromNamespaces(getter, nil, toValuesFuncs...)
+}
+
+// GetSecretValuesFromNamespaces is the same as GetSecretValues, except that the Secrets can also be referenced in
+// the allowedNamespaces, e.g. the namespace of the default configs of the ClusterManagementAddOn.
+func GetSecretValuesFromNamespaces(getter utils.SecretValuesConfigGetter, allowedNamespaces []string,
+	toValuesFuncs ...SecretToValuesFunc) SecretValuesFunc {
+	if len(toValuesFuncs) == 0 {
+		toValuesFuncs = []SecretToValuesFunc{ToSecretValues}
+	}
+	return func(cluster *clusterv1.ManagedCluster, addon *addonapiv1beta1.ManagedClusterAddOn) (Values, error) {
+		var lastValues = Values{}
+		secrets, err := utils.GetDesiredSecretValuesConfigs(context.TODO(), addon, getter, allowedNamespaces...)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, secret := range secrets {
+			for _, toValuesFunc := range toValuesFuncs {
+				values, err := toValuesFunc(*secret)
+				if err != nil {
+					return nil, err
+				}
+				lastValues = MergeValues(lastValues, values)
+			}
+		}
+		return lastValues, nil
+	}
+}
+
+// secretValues is the values returned by the SecretValuesFuncs of the agentAddon in the order of the funcs, and
+// the replacer of the string values in them.
+type secretValues struct {
+	values   []Values
+	replacer *strings.Replacer
+}
+
+// getSecretValues calls the secretValuesFuncs, the values are normalized to be merged with the other values. The
+// errors of the funcs are not wrapped with the values, since they may contain the values.
+func getSecretValues(secretValuesFuncs []SecretValuesFunc,
+	cluster *clusterv1.ManagedCluster, addon *addonapiv1beta1.ManagedClusterAddOn) (*secretValues, error) {
+	secrets := &secretValues{}
+	var sensitive []string
+	for i, secretValuesFunc := range secretValuesFuncs {
+		if secretValuesFunc == nil {
+			secrets.values = append(secrets.values, nil)
+			continue
+		}
+		values, err := secretValuesFunc(cluster, addon)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the values of secret values func %d: %v", i, err)
+		}
+		normalized, err := JsonStructToValues(values)
+		if err != nil {
+			return nil, fmt.Errorf("failed to normalize the values of secret values func %d", i)
+		}
+		secrets.values = append(secrets.values, normalized)
+		walkValuesLeaves("", normalized, func(_ string, parent map[string]interface{}, key string) {
+			if s, ok := parent[key].(string); ok && len(s) > 0 {
+				// the values are often base64 encoded in the data of the Secrets.
+				sensitive = append(sensitive, s, base64.StdEncoding.EncodeToString([]byte(s)))
+			}
+		})
+	}
+
+	if len(sensitive) == 0 {
+		return secrets, nil
+	}
+	// the longer values are replaced first, so a value is not partially replaced by its substring.
+	sort.Slice(sensitive, func(i, j int) bool { return len(sensitive[i]) > len(sensitive[j]) })
+	var oldnew []string
+	for _, s := range sensitive {
+		oldnew = append(oldnew, s, redactedValue)
+	}
+	secrets.replacer = strings.NewReplacer(oldnew...)
+	return secrets, nil
+}
+
+// redact replaces the secret values in the text.
+func (s *secretValues) redact(text string) string {
+	if s == nil || s.replacer == nil {
+		return text
+	}
+	return s.replacer.Replace(text)
+}
+
+// redactError replaces the secret values in the message of the error, the reason of the ManifestsRenderError
+// is kept.
+func (s *secretValues) redactError(err error) error {
+	if err == nil || s == nil || s.replacer == nil {
+		return err
+	}
+	redacted := errors.New(s.redact(err.Error()))
+	var renderErr *agent.ManifestsRenderError
+	if errors.As(err, &renderErr) {
+		return &agent.ManifestsRenderError{Reason: renderErr.Reason, Err: redacted}
+	}
+	return redacted
+}
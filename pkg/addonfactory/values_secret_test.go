@@ -0,0 +1,233 @@
+package addonfactory
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubeinformers "k8s.io/client-go/informers"
+	fakekube "k8s.io/client-go/kubernetes/fake"
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	clusterv1alpha1 "open-cluster-management.io/api/cluster/v1alpha1"
+
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/addontesting"
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
+	"open-cluster-management.io/addon-framework/pkg/agent"
+	"open-cluster-management.io/addon-framework/pkg/utils"
+)
+
+func newSecretValuesAddon(secretNames ...string) *addonapiv1beta1.ManagedClusterAddOn {
+	return newNamespacedSecretValuesAddon("cluster1", secretNames...)
+}
+
+func newNamespacedSecretValuesAddon(namespace string, secretNames ...string) *addonapiv1beta1.ManagedClusterAddOn {
+	addon := NewFakeManagedClusterAddon("test", "cluster1", "", "")
+	for _, name := range secretNames {
+		addon.Status.ConfigReferences = append(addon.Status.ConfigReferences, addonapiv1beta1.ConfigReference{
+			ConfigGroupResource: addonapiv1beta1.ConfigGroupResource{Group: "", Resource: "secrets"},
+			DesiredConfig: &addonapiv1beta1.ConfigSpecHash{
+				ConfigReferent: addonapiv1beta1.ConfigReferent{Namespace: namespace, Name: name},
+				SpecHash:       "dummy",
+			},
+		})
+	}
+	return addon
+}
+
+func newValuesSecret(name, values string) *corev1.Secret {
+	return newNamespacedValuesSecret("cluster1", name, values)
+}
+
+func newNamespacedValuesSecret(namespace, name, values string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Data:       map[string][]byte{utils.SecretValuesKey: []byte(values)},
+	}
+}
+
+func TestGetSecretValues(t *testing.T) {
+	cases := []struct {
+		name              string
+		addon             *addonapiv1beta1.ManagedClusterAddOn
+		allowedNamespaces []string
+		secrets           []runtime.Object
+		expectedValues    Values
+		expectErr         bool
+	}{
+		{
+			name:           "no secret values config",
+			addon:          addontesting.NewAddon("test", "cluster1"),
+			expectedValues: Values{},
+		},
+		{
+			name:  "multiple secrets",
+			addon: newSecretValuesAddon("secret1", "secret2"),
+			secrets: []runtime.Object{
+				newValuesSecret("secret1", "global:\n  apiKey: key1\n  imagePullSecret: regcred"),
+				newValuesSecret("secret2", "global:\n  apiKey: key2"),
+			},
+			expectedValues: Values{"global": map[string]interface{}{"apiKey": "key2", "imagePullSecret": "regcred"}},
+		},
+		{
+			name:      "secret in the other cluster namespace",
+			addon:     newNamespacedSecretValuesAddon("cluster2", "secret1"),
+			secrets:   []runtime.Object{newNamespacedValuesSecret("cluster2", "secret1", "global:\n  apiKey: key1")},
+			expectErr: true,
+		},
+		{
+			name:              "secret in the allowed namespace",
+			addon:             newNamespacedSecretValuesAddon("addon-configs", "secret1"),
+			allowedNamespaces: []string{"addon-configs"},
+			secrets: []runtime.Object{
+				newNamespacedValuesSecret("addon-configs", "secret1", "global:\n  apiKey: key1"),
+			},
+			expectedValues: Values{"global": map[string]interface{}{"apiKey": "key1"}},
+		},
+		{
+			name:      "secret not found",
+			addon:     newSecretValuesAddon("secret1"),
+			expectErr: true,
+		},
+		{
+			name:      "invalid values",
+			addon:     newSecretValuesAddon("secret1"),
+			secrets:   []runtime.Object{newValuesSecret("secret1", "apiKey: [key1")},
+			expectErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			kubeClient := fakekube.NewSimpleClientset(c.secrets...)
+			secretInformer := kubeinformers.NewSharedInformerFactory(kubeClient, 10*time.Minute).Core().V1().Secrets()
+			for _, secret := range c.secrets {
+				if err := secretInformer.Informer().GetStore().Add(secret); err != nil {
+					t.Fatal(err)
+				}
+			}
+			getter := utils.NewSecretValuesConfigListerGetter(secretInformer.Lister())
+			values, err := GetSecretValuesFromNamespaces(getter, c.allowedNamespaces)(
+				NewFakeManagedCluster("cluster1", "1.10.1"), c.addon)
+			if c.expectErr {
+				if err == nil {
+					t.Errorf("expected error, but got nil")
+				}
+				if err != nil && strings.Contains(err.Error(), "key1") {
+					t.Errorf("expected the secret values are not in the error, but got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got err %v", err)
+			}
+			if fmt.Sprint(values) != fmt.Sprint(c.expectedValues) {
+				t.Errorf("expected values %v, but got %v", c.expectedValues, values)
+			}
+		})
+	}
+}
+
+func TestSecretValuesRedaction(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clusterv1alpha1.Install(scheme)
+
+	apiKey := "my-api-key"
+	agentAddon, err := NewAgentAddonFactory("test", templateFS, "testmanifests/template").
+		WithScheme(scheme).
+		WithValuesProvenanceAnnotation().
+		WithSecretValuesFuncs(func(*clusterv1.ManagedCluster, *addonapiv1beta1.ManagedClusterAddOn) (Values, error) {
+			return Values{"Image": apiKey}, nil
+		}).
+		BuildTemplateAgentAddon()
+	if err != nil {
+		t.Fatalf("expected no error, got err %v", err)
+	}
+
+	cluster := NewFakeManagedCluster("cluster1", "1.10.1")
+	addon := NewFakeManagedClusterAddon("test", "cluster1", "", "")
+
+	// the secret values are used to render the manifests.
+	objects, err := agentAddon.Manifests(context.TODO(), cluster, addon)
+	if err != nil {
+		t.Fatalf("expected no error, got err %v", err)
+	}
+	rendered := false
+	for _, obj := range objects {
+		if strings.Contains(fmt.Sprintf("%v", obj), apiKey) {
+			rendered = true
+		}
+	}
+	if !rendered {
+		t.Errorf("expected the secret value is rendered in the manifests")
+	}
+
+	// the secret values are redacted in the values report.
+	report, err := agentAddon.(ValuesReporter).ValuesReport(context.TODO(), cluster, addon)
+	if err != nil {
+		t.Fatalf("expected no error, got err %v", err)
+	}
+	if report.Values["Image"] != redactedValue {
+		t.Errorf("expected the secret value is redacted, but got %v", report.Values["Image"])
+	}
+	if report.Sources["Image"] != "SecretValuesFuncs[0]" {
+		t.Errorf("expected the source SecretValuesFuncs[0], but got %s", report.Sources["Image"])
+	}
+
+	// the deploy manifestWorks are marked as sensitive.
+	annotations, err := agentAddon.GetAgentAddonOptions().ManifestWorkAnnotations(context.TODO(), cluster, addon)
+	if err != nil {
+		t.Fatalf("expected no error, got err %v", err)
+	}
+	if annotations[constants.SensitiveDataAnnotationKey] != "true" {
+		t.Errorf("expected the sensitive data annotation, but got %v", annotations)
+	}
+	if strings.Contains(annotations[constants.ValuesProvenanceAnnotationKey], apiKey) {
+		t.Errorf("expected the secret value is not in the provenance annotation")
+	}
+}
+
+func TestRedactSecretValues(t *testing.T) {
+	secrets, err := getSecretValues([]SecretValuesFunc{
+		func(*clusterv1.ManagedCluster, *addonapiv1beta1.ManagedClusterAddOn) (Values, error) {
+			return Values{"global": map[string]interface{}{"apiKey": "key", "token": "key-token"}}, nil
+		},
+		nil,
+	}, NewFakeManagedCluster("cluster1", "1.10.1"), NewFakeManagedClusterAddon("test", "cluster1", "", ""))
+	if err != nil {
+		t.Fatalf("expected no error, got err %v", err)
+	}
+	if len(secrets.values) != 2 {
+		t.Errorf("expected the values of 2 funcs, but got %d", len(secrets.values))
+	}
+
+	text := fmt.Sprintf("apiKey: key, token: key-token, data: %s", base64.StdEncoding.EncodeToString([]byte("key-token")))
+	expected := "apiKey: <redacted>, token: <redacted>, data: <redacted>"
+	if redacted := secrets.redact(text); redacted != expected {
+		t.Errorf("expected %q, but got %q", expected, redacted)
+	}
+
+	err = secrets.redactError(&agent.ManifestsRenderError{
+		Reason: constants.ManifestsRenderedReasonTemplateRenderFailed,
+		Err:    fmt.Errorf("failed to render with key-token"),
+	})
+	var renderErr *agent.ManifestsRenderError
+	if !errors.As(err, &renderErr) || renderErr.Reason != constants.ManifestsRenderedReasonTemplateRenderFailed {
+		t.Errorf("expected the reason of the render error is kept, but got %v", err)
+	}
+	if strings.Contains(err.Error(), "key-token") {
+		t.Errorf("expected the secret value is redacted from the error, but got %v", err)
+	}
+
+	var nilSecrets *secretValues
+	if nilSecrets.redact(text) != text {
+		t.Errorf("expected the text is not changed by nil secret values")
+	}
+}
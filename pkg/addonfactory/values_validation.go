@@ -0,0 +1,137 @@
+package addonfactory
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
+	"open-cluster-management.io/addon-framework/pkg/agent"
+)
+
+// ValuesValidateFunc validates the final merged values of the helm or template agentAddon before the manifests
+// are rendered. For the helm agentAddon, the values include the values.yaml of the chart.
+type ValuesValidateFunc func(values Values) error
+
+// valuesValidator is implemented by the typed values which validate themselves after they are decoded.
+type valuesValidator interface {
+	Validate() error
+}
+
+// TypedValuesValidateFunc returns a ValuesValidateFunc which decodes the values into the Go struct T by the json
+// tags of its fields. The values are invalid if they have the keys unknown to T or the types mismatching the
+// fields of T. If *T has a "Validate() error" method, it is called to validate the decoded values.
+//
+// Since the values of the helm agentAddon include the global values, the values.yaml of the chart and its
+// subcharts and the builtin values, use WithTypedValues instead for the helm agentAddon, which ignores the keys
+// unknown to T.
+func TypedValuesValidateFunc[T any]() ValuesValidateFunc {
+	return func(values Values) error {
+		return validateTypedValues[T](values, true)
+	}
+}
+
+// typedValuesValidateFunc validates the values against a Go struct, the keys unknown to the struct are rejected
+// only if disallowUnknownFields is true.
+type typedValuesValidateFunc func(values Values, disallowUnknownFields bool) error
+
+func validateTypedValues[T any](values Values, disallowUnknownFields bool) error {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+
+	typed := new(T)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if disallowUnknownFields {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(typed); err != nil {
+		return fmt.Errorf("values can not be decoded into %T: %v", *typed, err)
+	}
+	if validator, ok := interface{}(typed).(valuesValidator); ok {
+		return validator.Validate()
+	}
+	return nil
+}
+
+// JSONSchemaValuesValidateFunc returns a ValuesValidateFunc which validates the values against the JSON schema.
+// The references to other schemas in the schema are only loaded from the local files.
+func JSONSchemaValuesValidateFunc(schema []byte) (ValuesValidateFunc, error) {
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(schema))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the values schema: %v", err)
+	}
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource("file:///values.schema.json", doc); err != nil {
+		return nil, err
+	}
+	compiled, err := compiler.Compile("file:///values.schema.json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile the values schema: %v", err)
+	}
+
+	return func(values Values) error {
+		data, err := json.Marshal(values)
+		if err != nil {
+			return err
+		}
+		// the values are unmarshalled with json.Number, so the numbers are validated without losing precision.
+		instance, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		return compiled.Validate(instance)
+	}, nil
+}
+
+// WithTypedValues validates the final merged values of the helm or template agentAddon built by the factory
+// against the Go struct T, see TypedValuesValidateFunc. The keys unknown to T are rejected for the template
+// agentAddon, and ignored for the helm agentAddon since its values include the values of the chart which are not
+// set by the addon, so T only needs to declare the values the addon cares about. It is a function instead of a
+// method of the factory since a method can not have type parameters, e.g.
+//
+//	agentAddon, err := addonfactory.WithTypedValues[HelloWorldValues](
+//		addonfactory.NewAgentAddonFactory(addonName, FS, "manifests/charts/helloworld")).
+//		BuildHelmAgentAddon()
+func WithTypedValues[T any](f *AgentAddonFactory) *AgentAddonFactory {
+	f.typedValuesValidateFuncs = append(f.typedValuesValidateFuncs, validateTypedValues[T])
+	return f
+}
+
+// valuesValidateFuncs returns the ValuesValidateFuncs of the factory and the funcs validating the typed values
+// added by WithTypedValues, the typed values reject the unknown keys only if disallowUnknownFields is true.
+func valuesValidateFuncs(f *AgentAddonFactory, disallowUnknownFields bool) []ValuesValidateFunc {
+	validateFuncs := append([]ValuesValidateFunc{}, f.valuesValidateFuncs...)
+	for _, validateTyped := range f.typedValuesValidateFuncs {
+		validateTyped := validateTyped
+		validateFuncs = append(validateFuncs, func(values Values) error {
+			return validateTyped(values, disallowUnknownFields)
+		})
+	}
+	return validateFuncs
+}
+
+// validateValues validates the values by all the validateFuncs, the errors are returned as a ManifestsRenderError,
+// so the addon is not deployed with the invalid values and the reason is reported on the ManagedClusterAddOn.
+func validateValues(validateFuncs []ValuesValidateFunc, values Values) error {
+	var errs []error
+	for _, validate := range validateFuncs {
+		if validate == nil {
+			continue
+		}
+		if err := validate(values); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return &agent.ManifestsRenderError{
+		Reason: constants.ManifestsRenderedReasonValuesInvalid,
+		Err:    fmt.Errorf("values are invalid: %v", utilerrors.NewAggregate(errs)),
+	}
+}
@@ -0,0 +1,253 @@
+package addonfactory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	clusterv1alpha1 "open-cluster-management.io/api/cluster/v1alpha1"
+
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
+	"open-cluster-management.io/addon-framework/pkg/agent"
+)
+
+type templateTestValues struct {
+	ClusterName             string
+	AddonInstallNamespace   string
+	InstallMode             string
+	HubKubeConfigSecret     string
+	ManagedKubeConfigSecret string
+	Image                   string
+	NodeSelector            map[string]string
+}
+
+func (v *templateTestValues) Validate() error {
+	if len(v.Image) == 0 {
+		return fmt.Errorf("image is required")
+	}
+	return nil
+}
+
+func TestTemplateAddonTypedValues(t *testing.T) {
+	cases := []struct {
+		name          string
+		values        Values
+		expectedValid bool
+	}{
+		{
+			name: "valid values",
+			values: Values{
+				"Image":        "quay.io/helloworld:latest",
+				"NodeSelector": map[string]string{"host": "ssd"},
+			},
+			expectedValid: true,
+		},
+		{
+			name:   "unknown key",
+			values: Values{"Image": "quay.io/helloworld:latest", "Imagee": "quay.io/helloworld:v1"},
+		},
+		{
+			name:   "mismatched type",
+			values: Values{"Image": "quay.io/helloworld:latest", "NodeSelector": "host=ssd"},
+		},
+		{
+			name: "invalid by the Validate method",
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	_ = clusterv1alpha1.Install(scheme)
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			agentAddon, err := WithTypedValues[templateTestValues](
+				NewAgentAddonFactory("test", templateFS, "testmanifests/template")).
+				WithScheme(scheme).
+				WithGetValuesFuncs(func(*clusterv1.ManagedCluster, *addonapiv1beta1.ManagedClusterAddOn) (Values, error) {
+					return c.values, nil
+				}).
+				BuildTemplateAgentAddon()
+			if err != nil {
+				t.Fatalf("expected no error, got err %v", err)
+			}
+
+			_, err = agentAddon.Manifests(context.TODO(),
+				NewFakeManagedCluster("cluster1", "1.10.1"), NewFakeManagedClusterAddon("test", "cluster1", "", ""))
+			if c.expectedValid {
+				if err != nil {
+					t.Errorf("expected no error, got err %v", err)
+				}
+				return
+			}
+			var renderErr *agent.ManifestsRenderError
+			if !errors.As(err, &renderErr) || renderErr.Reason != constants.ManifestsRenderedReasonValuesInvalid {
+				t.Errorf("expected render error with reason %s, but got %v", constants.ManifestsRenderedReasonValuesInvalid, err)
+			}
+		})
+	}
+}
+
+type helmTestValues struct {
+	Org    string `json:"org"`
+	Global struct {
+		ImageOverrides struct {
+			TestImage string `json:"testImage"`
+		} `json:"imageOverrides"`
+	} `json:"global"`
+}
+
+func (v *helmTestValues) Validate() error {
+	if len(v.Global.ImageOverrides.TestImage) == 0 {
+		return fmt.Errorf("testImage is required")
+	}
+	return nil
+}
+
+func TestHelmAddonTypedValues(t *testing.T) {
+	cases := []struct {
+		name          string
+		values        Values
+		expectedValid bool
+	}{
+		{
+			// the values of the chart, the global values and the builtin values unknown to the struct are ignored.
+			name:          "default values of the chart",
+			expectedValid: true,
+		},
+		{
+			name: "valid values",
+			values: Values{"global": map[string]interface{}{
+				"imageOverrides": map[string]interface{}{"testImage": "quay.io/testimage:v1"},
+			}},
+			expectedValid: true,
+		},
+		{
+			name:   "mismatched type",
+			values: Values{"org": map[string]interface{}{"name": "open-cluster-management"}},
+		},
+		{
+			name: "invalid by the Validate method",
+			values: Values{"global": map[string]interface{}{
+				"imageOverrides": map[string]interface{}{"testImage": ""},
+			}},
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	_ = clusterv1alpha1.Install(scheme)
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			agentAddon, err := WithTypedValues[helmTestValues](
+				NewAgentAddonFactory("test", chartFS, "testmanifests/chart")).
+				WithScheme(scheme).
+				WithGetValuesFuncs(func(*clusterv1.ManagedCluster, *addonapiv1beta1.ManagedClusterAddOn) (Values, error) {
+					return c.values, nil
+				}).
+				BuildHelmAgentAddon()
+			if err != nil {
+				t.Fatalf("expected no error, got err %v", err)
+			}
+
+			_, err = agentAddon.Manifests(context.TODO(),
+				NewFakeManagedCluster("cluster1", "1.10.1"), NewFakeManagedClusterAddon("test", "cluster1", "", ""))
+			if c.expectedValid {
+				if err != nil {
+					t.Errorf("expected no error, got err %v", err)
+				}
+				return
+			}
+			var renderErr *agent.ManifestsRenderError
+			if !errors.As(err, &renderErr) || renderErr.Reason != constants.ManifestsRenderedReasonValuesInvalid {
+				t.Errorf("expected render error with reason %s, but got %v", constants.ManifestsRenderedReasonValuesInvalid, err)
+			}
+		})
+	}
+}
+
+func TestHelmAddonJSONSchemaValues(t *testing.T) {
+	validateFunc, err := JSONSchemaValuesValidateFunc([]byte(`{
+  "type": "object",
+  "required": ["global"],
+  "properties": {
+    "global": {
+      "type": "object",
+      "properties": {
+        "imageOverrides": {
+          "type": "object",
+          "properties": {
+            "testImage": {"type": "string", "pattern": "^quay.io/"}
+          }
+        }
+      }
+    }
+  }
+}`))
+	if err != nil {
+		t.Fatalf("expected no error, got err %v", err)
+	}
+
+	scheme := runtime.NewScheme()
+	_ = clusterv1alpha1.Install(scheme)
+
+	cases := []struct {
+		name          string
+		image         string
+		expectedValid bool
+	}{
+		{
+			name:          "default values of the chart",
+			expectedValid: true,
+		},
+		{
+			name:          "valid image",
+			image:         "quay.io/testimage:v1",
+			expectedValid: true,
+		},
+		{
+			name:  "invalid image",
+			image: "docker.io/testimage:v1",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			agentAddon, err := NewAgentAddonFactory("test", chartFS, "testmanifests/chart").
+				WithScheme(scheme).
+				WithValuesValidateFuncs(validateFunc).
+				WithGetValuesFuncs(func(*clusterv1.ManagedCluster, *addonapiv1beta1.ManagedClusterAddOn) (Values, error) {
+					if len(c.image) == 0 {
+						return nil, nil
+					}
+					return Values{"global": map[string]interface{}{
+						"imageOverrides": map[string]interface{}{"testImage": c.image},
+					}}, nil
+				}).
+				BuildHelmAgentAddon()
+			if err != nil {
+				t.Fatalf("expected no error, got err %v", err)
+			}
+
+			_, err = agentAddon.Manifests(context.TODO(),
+				NewFakeManagedCluster("cluster1", "1.10.1"), NewFakeManagedClusterAddon("test", "cluster1", "", ""))
+			if c.expectedValid {
+				if err != nil {
+					t.Errorf("expected no error, got err %v", err)
+				}
+				return
+			}
+			var renderErr *agent.ManifestsRenderError
+			if !errors.As(err, &renderErr) || renderErr.Reason != constants.ManifestsRenderedReasonValuesInvalid {
+				t.Errorf("expected render error with reason %s, but got %v", constants.ManifestsRenderedReasonValuesInvalid, err)
+			}
+		})
+	}
+
+	if _, err := JSONSchemaValuesValidateFunc([]byte(`{"type": 1}`)); err == nil {
+		t.Errorf("expected invalid schema error")
+	}
+}
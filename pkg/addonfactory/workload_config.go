@@ -0,0 +1,320 @@
+package addonfactory
+
+import (
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
+	"open-cluster-management.io/addon-framework/pkg/agent"
+	"open-cluster-management.io/addon-framework/pkg/utils"
+)
+
+// The names of the customized variables in the AddOnDeploymentConfig which are transformed into the
+// WorkloadConfig by GetAddOnDeploymentConfigWorkloadConfig. The names are prefixed by "workload." so they do not
+// conflict with the variables used by the charts and templates of the addons. Except the priorityClassName, the
+// values of the variables are in yaml or json format.
+const (
+	// AffinityVariableName is the name of the variable of the corev1.Affinity of the pods.
+	AffinityVariableName = "workload.affinity"
+	// TopologySpreadConstraintsVariableName is the name of the variable of the list of the
+	// corev1.TopologySpreadConstraint of the pods.
+	TopologySpreadConstraintsVariableName = "workload.topologySpreadConstraints"
+	// PriorityClassNameVariableName is the name of the variable of the priority class name of the pods.
+	PriorityClassNameVariableName = "workload.priorityClassName"
+	// PodSecurityContextVariableName is the name of the variable of the corev1.PodSecurityContext of the pods.
+	PodSecurityContextVariableName = "workload.podSecurityContext"
+	// SecurityContextVariableName is the name of the variable of the corev1.SecurityContext of the containers.
+	SecurityContextVariableName = "workload.securityContext"
+	// PodLabelsVariableName is the name of the variable of the extra labels of the workloads and their pods.
+	PodLabelsVariableName = "workload.podLabels"
+	// PodAnnotationsVariableName is the name of the variable of the extra annotations of the workloads and
+	// their pods.
+	PodAnnotationsVariableName = "workload.podAnnotations"
+	// EnvVariableName is the name of the variable of the list of the extra corev1.EnvVar of the containers.
+	EnvVariableName = "workload.env"
+)
+
+// WorkloadConfig is the scheduling and security configuration applied to all the Deployments and DaemonSets in
+// the manifests of the agentAddon, so the chart or template authors do not need to template each of them.
+type WorkloadConfig struct {
+	// Affinity replaces the affinity of the pods if it is set.
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+	// TopologySpreadConstraints replaces the topology spread constraints of the pods if it is set.
+	TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+	// PriorityClassName replaces the priority class name of the pods if it is set.
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+	// PodSecurityContext replaces the security context of the pods if it is set.
+	PodSecurityContext *corev1.PodSecurityContext `json:"podSecurityContext,omitempty"`
+	// SecurityContext is merged into the security context of the containers and init containers if it is set,
+	// the fields set in it replace the ones of the containers.
+	SecurityContext *corev1.SecurityContext `json:"securityContext,omitempty"`
+	// Labels are added to the labels of the workloads and their pod templates, the selectors are not changed.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Annotations are added to the annotations of the workloads and their pod templates.
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Env is added to the env of the containers and init containers, the env var with the same name is replaced.
+	Env []corev1.EnvVar `json:"env,omitempty"`
+}
+
+// WorkloadConfigFunc returns the WorkloadConfig of the addon on the cluster, it returns nil if there is no config.
+type WorkloadConfigFunc func(cluster *clusterv1.ManagedCluster,
+	addon *addonapiv1beta1.ManagedClusterAddOn) (*WorkloadConfig, error)
+
+// ToWorkloadConfig transforms the customized variables of the AddOnDeploymentConfig into WorkloadConfig, the
+// variables are named by AffinityVariableName, PriorityClassNameVariableName, etc. It returns a
+// ManifestsRenderError if a variable can not be parsed, so the error is reported by the ManifestsRendered
+// condition of the addon.
+// for example: the spec of one AddOnDeploymentConfig is:
+//
+//	{
+//	 customizedVariables: [
+//	   {name: "workload.priorityClassName", value: "system-cluster-critical"},
+//	   {name: "workload.podLabels", value: "{\"team\": \"ocm\"}"},
+//	 ],
+//	}
+//
+// after transformed, the WorkloadConfig will be:
+// {PriorityClassName: system-cluster-critical, Labels: map[team:ocm]}
+func ToWorkloadConfig(config addonapiv1beta1.AddOnDeploymentConfig) (*WorkloadConfig, error) {
+	workloadConfig := &WorkloadConfig{}
+	for _, variable := range config.Spec.CustomizedVariables {
+		var err error
+		switch variable.Name {
+		case AffinityVariableName:
+			err = parseWorkloadVariable(variable, &workloadConfig.Affinity)
+		case TopologySpreadConstraintsVariableName:
+			err = parseWorkloadVariable(variable, &workloadConfig.TopologySpreadConstraints)
+		case PriorityClassNameVariableName:
+			workloadConfig.PriorityClassName = variable.Value
+		case PodSecurityContextVariableName:
+			err = parseWorkloadVariable(variable, &workloadConfig.PodSecurityContext)
+		case SecurityContextVariableName:
+			err = parseWorkloadVariable(variable, &workloadConfig.SecurityContext)
+		case PodLabelsVariableName:
+			err = parseWorkloadVariable(variable, &workloadConfig.Labels)
+		case PodAnnotationsVariableName:
+			err = parseWorkloadVariable(variable, &workloadConfig.Annotations)
+		case EnvVariableName:
+			err = parseWorkloadVariable(variable, &workloadConfig.Env)
+		}
+		if err != nil {
+			return nil, &agent.ManifestsRenderError{
+				Reason: constants.ManifestsRenderedReasonWorkloadConfigInvalid,
+				Err: fmt.Errorf("invalid customized variable %s of AddOnDeploymentConfig %s/%s: %v",
+					variable.Name, config.Namespace, config.Name, err),
+			}
+		}
+	}
+	return workloadConfig, nil
+}
+
+// parseWorkloadVariable parses the value of the customized variable into the field.
+func parseWorkloadVariable[T any](variable addonapiv1beta1.CustomizedVariable, field *T) error {
+	var value T
+	if err := yaml.UnmarshalStrict([]byte(variable.Value), &value); err != nil {
+		return err
+	}
+	*field = value
+	return nil
+}
+
+// GetAddOnDeploymentConfigWorkloadConfig uses AddOnDeploymentConfigGetter to get the AddOnDeploymentConfig object,
+// then uses ToWorkloadConfig to transform it into WorkloadConfig. It returns nil if the addon has no
+// AddOnDeploymentConfig.
+func GetAddOnDeploymentConfigWorkloadConfig(getter utils.AddOnDeploymentConfigGetter) WorkloadConfigFunc {
+	return func(cluster *clusterv1.ManagedCluster, addon *addonapiv1beta1.ManagedClusterAddOn) (*WorkloadConfig, error) {
+		addOnDeploymentConfig, err := utils.GetDesiredAddOnDeploymentConfig(addon, getter)
+		if err != nil {
+			return nil, err
+		}
+		if addOnDeploymentConfig == nil {
+			return nil, nil
+		}
+		return ToWorkloadConfig(*addOnDeploymentConfig)
+	}
+}
+
+// getWorkloadConfig merges the WorkloadConfigs returned by the funcs, the config of the big index func overrides
+// the one of the small index func. The labels, annotations and env are merged by the keys and names.
+func getWorkloadConfig(workloadConfigFuncs []WorkloadConfigFunc,
+	cluster *clusterv1.ManagedCluster, addon *addonapiv1beta1.ManagedClusterAddOn) (*WorkloadConfig, error) {
+	var merged *WorkloadConfig
+	for _, workloadConfigFunc := range workloadConfigFuncs {
+		if workloadConfigFunc == nil {
+			continue
+		}
+		config, err := workloadConfigFunc(cluster, addon)
+		if err != nil {
+			return nil, err
+		}
+		if config == nil {
+			continue
+		}
+		if merged == nil {
+			merged = &WorkloadConfig{}
+		}
+		if config.Affinity != nil {
+			merged.Affinity = config.Affinity
+		}
+		if len(config.TopologySpreadConstraints) > 0 {
+			merged.TopologySpreadConstraints = config.TopologySpreadConstraints
+		}
+		if len(config.PriorityClassName) > 0 {
+			merged.PriorityClassName = config.PriorityClassName
+		}
+		if config.PodSecurityContext != nil {
+			merged.PodSecurityContext = config.PodSecurityContext
+		}
+		if config.SecurityContext != nil {
+			merged.SecurityContext = config.SecurityContext
+		}
+		merged.Labels = mergeStringMap(merged.Labels, config.Labels)
+		merged.Annotations = mergeStringMap(merged.Annotations, config.Annotations)
+		merged.Env = mergeEnv(merged.Env, config.Env)
+	}
+	return merged, nil
+}
+
+// applyWorkloadConfig applies the WorkloadConfig to the Deployments and DaemonSets in the objects.
+func applyWorkloadConfig(objects []runtime.Object, config *WorkloadConfig) {
+	if config == nil {
+		return
+	}
+	for _, o := range objects {
+		switch object := o.(type) {
+		case *appsv1.Deployment:
+			applyWorkloadConfigToPodTemplate(&object.ObjectMeta, &object.Spec.Template, config)
+		case *appsv1.DaemonSet:
+			applyWorkloadConfigToPodTemplate(&object.ObjectMeta, &object.Spec.Template, config)
+		}
+	}
+}
+
+func applyWorkloadConfigToPodTemplate(workloadMeta *metav1.ObjectMeta, template *corev1.PodTemplateSpec,
+	config *WorkloadConfig) {
+	workloadMeta.Labels = mergeStringMap(workloadMeta.Labels, config.Labels)
+	workloadMeta.Annotations = mergeStringMap(workloadMeta.Annotations, config.Annotations)
+	template.Labels = mergeStringMap(template.Labels, config.Labels)
+	template.Annotations = mergeStringMap(template.Annotations, config.Annotations)
+
+	podSpec := &template.Spec
+	if config.Affinity != nil {
+		podSpec.Affinity = config.Affinity.DeepCopy()
+	}
+	if len(config.TopologySpreadConstraints) > 0 {
+		podSpec.TopologySpreadConstraints = nil
+		for _, constraint := range config.TopologySpreadConstraints {
+			podSpec.TopologySpreadConstraints = append(podSpec.TopologySpreadConstraints, *constraint.DeepCopy())
+		}
+	}
+	if len(config.PriorityClassName) > 0 {
+		podSpec.PriorityClassName = config.PriorityClassName
+	}
+	if config.PodSecurityContext != nil {
+		podSpec.SecurityContext = config.PodSecurityContext.DeepCopy()
+	}
+
+	for _, containers := range [][]corev1.Container{podSpec.InitContainers, podSpec.Containers} {
+		for i := range containers {
+			if config.SecurityContext != nil {
+				containers[i].SecurityContext = mergeSecurityContext(containers[i].SecurityContext,
+					config.SecurityContext)
+			}
+			containers[i].Env = mergeEnv(containers[i].Env, config.Env)
+		}
+	}
+}
+
+// mergeSecurityContext returns the security context with the fields set in the override replaced, the other
+// fields of the original are kept.
+func mergeSecurityContext(original, override *corev1.SecurityContext) *corev1.SecurityContext {
+	merged := &corev1.SecurityContext{}
+	if original != nil {
+		merged = original.DeepCopy()
+	}
+	override = override.DeepCopy()
+	if override.Capabilities != nil {
+		merged.Capabilities = override.Capabilities
+	}
+	if override.Privileged != nil {
+		merged.Privileged = override.Privileged
+	}
+	if override.SELinuxOptions != nil {
+		merged.SELinuxOptions = override.SELinuxOptions
+	}
+	if override.WindowsOptions != nil {
+		merged.WindowsOptions = override.WindowsOptions
+	}
+	if override.RunAsUser != nil {
+		merged.RunAsUser = override.RunAsUser
+	}
+	if override.RunAsGroup != nil {
+		merged.RunAsGroup = override.RunAsGroup
+	}
+	if override.RunAsNonRoot != nil {
+		merged.RunAsNonRoot = override.RunAsNonRoot
+	}
+	if override.ReadOnlyRootFilesystem != nil {
+		merged.ReadOnlyRootFilesystem = override.ReadOnlyRootFilesystem
+	}
+	if override.AllowPrivilegeEscalation != nil {
+		merged.AllowPrivilegeEscalation = override.AllowPrivilegeEscalation
+	}
+	if override.ProcMount != nil {
+		merged.ProcMount = override.ProcMount
+	}
+	if override.SeccompProfile != nil {
+		merged.SeccompProfile = override.SeccompProfile
+	}
+	if override.AppArmorProfile != nil {
+		merged.AppArmorProfile = override.AppArmorProfile
+	}
+	return merged
+}
+
+// mergeStringMap returns the map with the keys of the override added, it returns the original map if the
+// override is empty.
+func mergeStringMap(original, override map[string]string) map[string]string {
+	if len(override) == 0 {
+		return original
+	}
+	merged := make(map[string]string, len(original)+len(override))
+	for k, v := range original {
+		merged[k] = v
+	}
+	for k, v := range override {
+		merged[k] = v
+	}
+	return merged
+}
+
+// mergeEnv returns the env with the env vars of the override added, the env var with the same name is replaced
+// in place.
+func mergeEnv(original, override []corev1.EnvVar) []corev1.EnvVar {
+	if len(override) == 0 {
+		return original
+	}
+	merged := append([]corev1.EnvVar{}, original...)
+	for _, env := range override {
+		replaced := false
+		for i := range merged {
+			if merged[i].Name == env.Name {
+				merged[i] = *env.DeepCopy()
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			merged = append(merged, *env.DeepCopy())
+		}
+	}
+	return merged
+}
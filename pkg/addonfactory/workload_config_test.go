@@ -0,0 +1,231 @@
+package addonfactory
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+	fakeaddon "open-cluster-management.io/api/client/addon/clientset/versioned/fake"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	clusterv1alpha1 "open-cluster-management.io/api/cluster/v1alpha1"
+
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
+	"open-cluster-management.io/addon-framework/pkg/agent"
+	"open-cluster-management.io/addon-framework/pkg/utils"
+)
+
+func TestToWorkloadConfig(t *testing.T) {
+	cases := []struct {
+		name           string
+		variables      []addonapiv1beta1.CustomizedVariable
+		expectedConfig *WorkloadConfig
+		expectedErr    string
+	}{
+		{
+			name:           "no variables",
+			expectedConfig: &WorkloadConfig{},
+		},
+		{
+			name: "all variables",
+			variables: []addonapiv1beta1.CustomizedVariable{
+				{Name: "Image", Value: "quay.io/helloworld:latest"},
+				{Name: PriorityClassNameVariableName, Value: "system-cluster-critical"},
+				{Name: AffinityVariableName, Value: `{"nodeAffinity": {"requiredDuringSchedulingIgnoredDuringExecution": {
+"nodeSelectorTerms": [{"matchExpressions": [{"key": "arch", "operator": "In", "values": ["amd64"]}]}]}}}`},
+				{Name: TopologySpreadConstraintsVariableName, Value: `[{"maxSkew": 1, "topologyKey": "zone",
+"whenUnsatisfiable": "DoNotSchedule"}]`},
+				{Name: PodSecurityContextVariableName, Value: "runAsNonRoot: true"},
+				{Name: SecurityContextVariableName, Value: `{"readOnlyRootFilesystem": true}`},
+				{Name: PodLabelsVariableName, Value: `{"team": "ocm"}`},
+				{Name: PodAnnotationsVariableName, Value: `{"owner": "ocm"}`},
+				{Name: EnvVariableName, Value: `[{"name": "LOG_LEVEL", "value": "debug"}]`},
+			},
+			expectedConfig: &WorkloadConfig{
+				Affinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+					RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+						NodeSelectorTerms: []corev1.NodeSelectorTerm{{MatchExpressions: []corev1.NodeSelectorRequirement{
+							{Key: "arch", Operator: corev1.NodeSelectorOpIn, Values: []string{"amd64"}},
+						}}},
+					},
+				}},
+				TopologySpreadConstraints: []corev1.TopologySpreadConstraint{
+					{MaxSkew: 1, TopologyKey: "zone", WhenUnsatisfiable: corev1.DoNotSchedule},
+				},
+				PriorityClassName:  "system-cluster-critical",
+				PodSecurityContext: &corev1.PodSecurityContext{RunAsNonRoot: boolPtr(true)},
+				SecurityContext:    &corev1.SecurityContext{ReadOnlyRootFilesystem: boolPtr(true)},
+				Labels:             map[string]string{"team": "ocm"},
+				Annotations:        map[string]string{"owner": "ocm"},
+				Env:                []corev1.EnvVar{{Name: "LOG_LEVEL", Value: "debug"}},
+			},
+		},
+		{
+			name: "unknown field",
+			variables: []addonapiv1beta1.CustomizedVariable{
+				{Name: PodLabelsVariableName, Value: `{"team": "ocm"}`},
+				{Name: PodSecurityContextVariableName, Value: `{"runAsNonRooot": true}`},
+			},
+			expectedErr: "invalid customized variable workload.podSecurityContext",
+		},
+		{
+			name: "invalid type",
+			variables: []addonapiv1beta1.CustomizedVariable{
+				{Name: EnvVariableName, Value: `LOG_LEVEL=debug`},
+			},
+			expectedErr: "invalid customized variable workload.env",
+		},
+		{
+			name: "variables without the prefix are not workload config",
+			variables: []addonapiv1beta1.CustomizedVariable{
+				{Name: "env", Value: "production"},
+				{Name: "podLabels", Value: `{"team": "ocm"}`},
+			},
+			expectedConfig: &WorkloadConfig{},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			config, err := ToWorkloadConfig(addonapiv1beta1.AddOnDeploymentConfig{
+				Spec: addonapiv1beta1.AddOnDeploymentConfigSpec{CustomizedVariables: c.variables},
+			})
+			if len(c.expectedErr) > 0 {
+				var renderErr *agent.ManifestsRenderError
+				if !errors.As(err, &renderErr) || renderErr.Reason != constants.ManifestsRenderedReasonWorkloadConfigInvalid ||
+					!strings.Contains(err.Error(), c.expectedErr) {
+					t.Errorf("expected ManifestsRenderError %q, but got %v", c.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got err %v", err)
+			}
+			if !equality.Semantic.DeepEqual(config, c.expectedConfig) {
+				t.Errorf("expected config %v, but got %v", c.expectedConfig, config)
+			}
+		})
+	}
+}
+
+func TestTemplateAddonWorkloadConfig(t *testing.T) {
+	addon := NewFakeManagedClusterAddon("test", "cluster1", "", "")
+	addon.Status.ConfigReferences = []addonapiv1beta1.ConfigReference{
+		{
+			ConfigGroupResource: addonapiv1beta1.ConfigGroupResource{
+				Group:    "addon.open-cluster-management.io",
+				Resource: "addondeploymentconfigs",
+			},
+			DesiredConfig: &addonapiv1beta1.ConfigSpecHash{
+				ConfigReferent: addonapiv1beta1.ConfigReferent{Namespace: "cluster1", Name: "config"},
+				SpecHash:       "dummy",
+			},
+		},
+	}
+	config := &addonapiv1beta1.AddOnDeploymentConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "cluster1"},
+		Spec: addonapiv1beta1.AddOnDeploymentConfigSpec{
+			CustomizedVariables: []addonapiv1beta1.CustomizedVariable{
+				{Name: "Image", Value: "quay.io/helloworld:latest"},
+				{Name: PriorityClassNameVariableName, Value: "low"},
+				{Name: PodLabelsVariableName, Value: `{"team": "ocm"}`},
+				{Name: EnvVariableName, Value: `[{"name": "LOG_LEVEL", "value": "debug"}]`},
+			},
+		},
+	}
+	getter := utils.NewAddOnDeploymentConfigGetter(fakeaddon.NewSimpleClientset(config))
+
+	scheme := runtime.NewScheme()
+	_ = clusterv1alpha1.Install(scheme)
+	agentAddon, err := NewAgentAddonFactory("test", templateFS, "testmanifests/template").
+		WithScheme(scheme).
+		WithGetValuesFuncs(GetAddOnDeploymentConfigValues(getter, ToAddOnDeploymentConfigValues)).
+		WithWorkloadConfigFuncs(
+			GetAddOnDeploymentConfigWorkloadConfig(getter),
+			func(*clusterv1.ManagedCluster, *addonapiv1beta1.ManagedClusterAddOn) (*WorkloadConfig, error) {
+				return &WorkloadConfig{
+					PriorityClassName: "system-cluster-critical",
+					Env:               []corev1.EnvVar{{Name: "LOG_LEVEL", Value: "info"}},
+				}, nil
+			},
+		).
+		BuildTemplateAgentAddon()
+	if err != nil {
+		t.Fatalf("expected no error, got err %v", err)
+	}
+
+	objects, err := agentAddon.Manifests(context.TODO(), NewFakeManagedCluster("cluster1", "1.10.1"), addon)
+	if err != nil {
+		t.Fatalf("expected no error, got err %v", err)
+	}
+
+	var deployment *appsv1.Deployment
+	for _, obj := range objects {
+		if d, ok := obj.(*appsv1.Deployment); ok {
+			deployment = d
+		}
+	}
+	if deployment == nil {
+		t.Fatalf("expected the deployment in the manifests")
+	}
+	if deployment.Labels["team"] != "ocm" || deployment.Spec.Template.Labels["team"] != "ocm" {
+		t.Errorf("expected the labels are added, but got %v and %v", deployment.Labels, deployment.Spec.Template.Labels)
+	}
+	if _, ok := deployment.Spec.Selector.MatchLabels["team"]; ok {
+		t.Errorf("expected the selector is not changed, but got %v", deployment.Spec.Selector.MatchLabels)
+	}
+	if deployment.Spec.Template.Spec.PriorityClassName != "system-cluster-critical" {
+		t.Errorf("expected the priority class is overridden, but got %s", deployment.Spec.Template.Spec.PriorityClassName)
+	}
+	env := deployment.Spec.Template.Spec.Containers[0].Env
+	if len(env) != 1 || env[0].Value != "info" {
+		t.Errorf("expected the env is merged by name, but got %v", env)
+	}
+}
+
+func TestMergeSecurityContext(t *testing.T) {
+	cases := []struct {
+		name     string
+		original *corev1.SecurityContext
+		override *corev1.SecurityContext
+		expected *corev1.SecurityContext
+	}{
+		{
+			name:     "no security context",
+			override: &corev1.SecurityContext{ReadOnlyRootFilesystem: boolPtr(true)},
+			expected: &corev1.SecurityContext{ReadOnlyRootFilesystem: boolPtr(true)},
+		},
+		{
+			name: "fields are merged",
+			original: &corev1.SecurityContext{
+				ReadOnlyRootFilesystem: boolPtr(false),
+				Capabilities:           &corev1.Capabilities{Add: []corev1.Capability{"NET_ADMIN"}},
+			},
+			override: &corev1.SecurityContext{ReadOnlyRootFilesystem: boolPtr(true), RunAsNonRoot: boolPtr(true)},
+			expected: &corev1.SecurityContext{
+				ReadOnlyRootFilesystem: boolPtr(true),
+				RunAsNonRoot:           boolPtr(true),
+				Capabilities:           &corev1.Capabilities{Add: []corev1.Capability{"NET_ADMIN"}},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			merged := mergeSecurityContext(c.original, c.override)
+			if !equality.Semantic.DeepEqual(merged, c.expected) {
+				t.Errorf("expected security context %v, but got %v", c.expected, merged)
+			}
+		})
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
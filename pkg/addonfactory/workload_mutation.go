@@ -0,0 +1,105 @@
+package addonfactory
+
+import (
+	"fmt"
+	"regexp"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+
+	"open-cluster-management.io/addon-framework/pkg/utils"
+)
+
+// workloadPodTemplate is the pod template of a workload in the manifests, and the resource and name of the
+// workload which identify its containers in the format of "<resource>:<name>:<container name>".
+type workloadPodTemplate struct {
+	resource string
+	name     string
+	template *corev1.PodTemplateSpec
+}
+
+// getWorkloadPodTemplates returns the pod templates of the Deployments, DaemonSets, StatefulSets and Jobs in the
+// objects.
+func getWorkloadPodTemplates(objects []runtime.Object) []workloadPodTemplate {
+	var templates []workloadPodTemplate
+	for _, o := range objects {
+		switch object := o.(type) {
+		case *appsv1.Deployment:
+			templates = append(templates, workloadPodTemplate{"deployments", object.Name, &object.Spec.Template})
+		case *appsv1.DaemonSet:
+			templates = append(templates, workloadPodTemplate{"daemonsets", object.Name, &object.Spec.Template})
+		case *appsv1.StatefulSet:
+			templates = append(templates, workloadPodTemplate{"statefulsets", object.Name, &object.Spec.Template})
+		case *batchv1.Job:
+			templates = append(templates, workloadPodTemplate{"jobs", object.Name, &object.Spec.Template})
+		}
+	}
+	return templates
+}
+
+// applyAddOnDeploymentConfig applies the AddOnDeploymentConfig of the addon to the workloads in the objects
+// directly, so the settings take effect without the chart or templates using the values:
+//   - the resource requirements are set to the containers matched by the container ID regex, see
+//     GetRegexResourceRequirements. The last matched requirement is used if multiple requirements match.
+//   - the nodeSelector and tolerations of the nodePlacement replace the ones of the pods if they are set.
+//   - the images of the containers are overridden by the registries, see OverrideImage.
+//
+// It does nothing if the getter is nil or the addon has no AddOnDeploymentConfig.
+func applyAddOnDeploymentConfig(objects []runtime.Object, getter utils.AddOnDeploymentConfigGetter,
+	addon *addonapiv1beta1.ManagedClusterAddOn) error {
+	if getter == nil {
+		return nil
+	}
+	config, err := utils.GetDesiredAddOnDeploymentConfig(addon, getter)
+	if err != nil {
+		return err
+	}
+	if config == nil {
+		return nil
+	}
+
+	requirements, err := GetRegexResourceRequirements(config.Spec.ResourceRequirements)
+	if err != nil {
+		return err
+	}
+	regexps := make([]*regexp.Regexp, 0, len(requirements))
+	for _, requirement := range requirements {
+		r, err := regexp.Compile(requirement.ContainerIDRegex)
+		if err != nil {
+			return fmt.Errorf("invalid container ID regex %s: %v", requirement.ContainerIDRegex, err)
+		}
+		regexps = append(regexps, r)
+	}
+
+	for _, workload := range getWorkloadPodTemplates(objects) {
+		podSpec := &workload.template.Spec
+		if config.Spec.NodePlacement != nil {
+			if len(config.Spec.NodePlacement.NodeSelector) > 0 {
+				podSpec.NodeSelector = mergeStringMap(nil, config.Spec.NodePlacement.NodeSelector)
+			}
+			if len(config.Spec.NodePlacement.Tolerations) > 0 {
+				podSpec.Tolerations = nil
+				for _, toleration := range config.Spec.NodePlacement.Tolerations {
+					podSpec.Tolerations = append(podSpec.Tolerations, *toleration.DeepCopy())
+				}
+			}
+		}
+
+		for _, containers := range [][]corev1.Container{podSpec.InitContainers, podSpec.Containers} {
+			for i := range containers {
+				containerID := fmt.Sprintf("%s:%s:%s", workload.resource, workload.name, containers[i].Name)
+				for j, r := range regexps {
+					if r.MatchString(containerID) {
+						containers[i].Resources = *requirements[j].ResourcesRaw.DeepCopy()
+					}
+				}
+				containers[i].Image = OverrideImage(config.Spec.Registries, containers[i].Image)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package addonfactory
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+	fakeaddon "open-cluster-management.io/api/client/addon/clientset/versioned/fake"
+
+	"open-cluster-management.io/addon-framework/pkg/utils"
+)
+
+func TestApplyAddOnDeploymentConfig(t *testing.T) {
+	newPodTemplate := func(containerName string) corev1.PodTemplateSpec {
+		return corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+			NodeSelector: map[string]string{"kubernetes.io/os": "linux"},
+			Containers: []corev1.Container{
+				{Name: containerName, Image: "quay.io/open-cluster-management/addon-agent:v1"},
+			},
+		}}
+	}
+	newObjects := func() []runtime.Object {
+		return []runtime.Object{
+			&appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "agent"},
+				Spec:       appsv1.DeploymentSpec{Template: newPodTemplate("agent")},
+			},
+			&appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "store"},
+				Spec:       appsv1.StatefulSetSpec{Template: newPodTemplate("store")},
+			},
+			&batchv1.Job{
+				ObjectMeta: metav1.ObjectMeta{Name: "cleanup"},
+				Spec:       batchv1.JobSpec{Template: newPodTemplate("cleanup")},
+			},
+		}
+	}
+
+	agentResources := corev1.ResourceRequirements{
+		Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+	}
+	allResources := corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("128Mi")},
+	}
+	tolerations := []corev1.Toleration{{Key: "node-role.kubernetes.io/infra", Operator: corev1.TolerationOpExists}}
+
+	addon := NewFakeManagedClusterAddon("test", "cluster1", "", "")
+	addon.Status.ConfigReferences = []addonapiv1beta1.ConfigReference{
+		{
+			ConfigGroupResource: addonapiv1beta1.ConfigGroupResource{
+				Group:    "addon.open-cluster-management.io",
+				Resource: "addondeploymentconfigs",
+			},
+			DesiredConfig: &addonapiv1beta1.ConfigSpecHash{
+				ConfigReferent: addonapiv1beta1.ConfigReferent{Namespace: "cluster1", Name: "config"},
+				SpecHash:       "dummy",
+			},
+		},
+	}
+	config := &addonapiv1beta1.AddOnDeploymentConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "cluster1"},
+		Spec: addonapiv1beta1.AddOnDeploymentConfigSpec{
+			NodePlacement: &addonapiv1beta1.NodePlacement{Tolerations: tolerations},
+			ResourceRequirements: []addonapiv1beta1.ContainerResourceRequirements{
+				{ContainerID: "*:*:*", Resources: allResources},
+				{ContainerID: "deployments:agent:*", Resources: agentResources},
+			},
+			Registries: []addonapiv1beta1.ImageMirror{
+				{Source: "quay.io/open-cluster-management", Mirror: "mirror.example.com/ocm"},
+			},
+		},
+	}
+	getter := utils.NewAddOnDeploymentConfigGetter(fakeaddon.NewSimpleClientset(config))
+
+	cases := []struct {
+		name              string
+		getter            utils.AddOnDeploymentConfigGetter
+		addon             *addonapiv1beta1.ManagedClusterAddOn
+		expectedResources map[string]corev1.ResourceRequirements
+		expectedImage     string
+		expectMutated     bool
+	}{
+		{
+			name:          "mutation is disabled",
+			addon:         addon,
+			expectedImage: "quay.io/open-cluster-management/addon-agent:v1",
+		},
+		{
+			name:          "no AddOnDeploymentConfig",
+			getter:        getter,
+			addon:         NewFakeManagedClusterAddon("test", "cluster1", "", ""),
+			expectedImage: "quay.io/open-cluster-management/addon-agent:v1",
+		},
+		{
+			name:   "mutated by AddOnDeploymentConfig",
+			getter: getter,
+			addon:  addon,
+			expectedResources: map[string]corev1.ResourceRequirements{
+				"agent":   agentResources,
+				"store":   allResources,
+				"cleanup": allResources,
+			},
+			expectedImage: "mirror.example.com/ocm/addon-agent:v1",
+			expectMutated: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			objects := newObjects()
+			if err := applyAddOnDeploymentConfig(objects, c.getter, c.addon); err != nil {
+				t.Fatalf("expected no error, got err %v", err)
+			}
+
+			workloads := getWorkloadPodTemplates(objects)
+			if len(workloads) != 3 {
+				t.Fatalf("expected 3 workloads, but got %d", len(workloads))
+			}
+			for _, workload := range workloads {
+				podSpec := workload.template.Spec
+				container := podSpec.Containers[0]
+				if !equality.Semantic.DeepEqual(container.Resources, c.expectedResources[container.Name]) {
+					t.Errorf("expected resources %v of %s, but got %v",
+						c.expectedResources[container.Name], container.Name, container.Resources)
+				}
+				if container.Image != c.expectedImage {
+					t.Errorf("expected image %s, but got %s", c.expectedImage, container.Image)
+				}
+				// the nodeSelector is not set in the config, so it is kept.
+				if podSpec.NodeSelector["kubernetes.io/os"] != "linux" {
+					t.Errorf("expected the nodeSelector is kept, but got %v", podSpec.NodeSelector)
+				}
+				if c.expectMutated != equality.Semantic.DeepEqual(podSpec.Tolerations, tolerations) {
+					t.Errorf("expected tolerations mutated %v, but got %v", c.expectMutated, podSpec.Tolerations)
+				}
+			}
+		})
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic/dynamicinformer"
 	kubeinformers "k8s.io/client-go/informers"
+	coordinationv1informers "k8s.io/client-go/informers/coordination/v1"
+	corev1informers "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 
@@ -38,6 +40,18 @@ type Option struct {
 	// are fully ready, avoiding unnecessary errors and retries.
 	// See https://github.com/open-cluster-management-io/ocm/issues/1181 for more context.
 	TemplateBasedAddOn bool
+
+	// DryRun configures whether the addon deploy controller runs in dry-run mode. In dry-run mode the
+	// manifestWorks of the addons are not applied or deleted, instead the diffs against the existing
+	// manifestWorks are logged and recorded in the "addon.open-cluster-management.io/dry-run-diff"
+	// annotation of the ManagedClusterAddOn, so the changes of a new addon version can be previewed
+	// before rolling it out.
+	//
+	// Note that the pre-delete hook manifestWorks are not applied either. The finalizers of the hooks are
+	// not added and the last known good specs of the RollbackOption are neither recorded nor applied in
+	// dry-run mode, while the deleting addons which already have the hook finalizers are kept until the
+	// dry-run mode is disabled.
+	DryRun bool
 }
 
 // OptionFunc is a function that modifies Option.
@@ -50,6 +64,13 @@ func WithTemplateMode(enabled bool) OptionFunc {
 	}
 }
 
+// WithDryRun returns an OptionFunc that sets the dry-run mode.
+func WithDryRun(enabled bool) OptionFunc {
+	return func(option *Option) {
+		option.DryRun = enabled
+	}
+}
+
 // WithOption returns an OptionFunc that applies the given Option struct.
 func WithOption(opt *Option) OptionFunc {
 	return func(option *Option) {
@@ -67,6 +88,7 @@ type BaseAddonManagerImpl struct {
 	config             *rest.Config
 	syncContexts       []factory.SyncContext
 	templateBasedAddOn bool
+	dryRun             bool
 }
 
 // NewBaseAddonManagerImpl creates a new BaseAddonManagerImpl instance with the given config.
@@ -86,6 +108,7 @@ func (a *BaseAddonManagerImpl) ApplyOptionFuncs(optionFuncs ...OptionFunc) {
 		fn(option)
 	}
 	a.templateBasedAddOn = option.TemplateBasedAddOn
+	a.dryRun = option.DryRun
 }
 
 func (a *BaseAddonManagerImpl) GetConfig() *rest.Config {
@@ -138,20 +161,41 @@ func (a *BaseAddonManagerImpl) StartWithInformers(ctx context.Context,
 		return err
 	}
 
+	// the secrets are only watched when the rollback is enabled, since they are used to record the last
+	// known good spec of the addon manifestWorks. The leases are only watched when the addon lease on the hub
+	// is probed. The manifest overrides are only watched when the manifest override config is supported.
+	var secretInformers corev1informers.SecretInformer
+	var leaseInformers coordinationv1informers.LeaseInformer
+	var manifestOverrideInformers kubeinformers.GenericInformer
 	for _, agentImpl := range a.addonAgents {
 		for _, configGVR := range agentImpl.GetAgentAddonOptions().SupportedConfigGVRs {
 			a.addonConfigs[configGVR] = true
+			if configGVR == utils.ManifestOverrideConfigGVR {
+				manifestOverrideInformers = dynamicInformers.ForResource(configGVR)
+			}
+		}
+		if agentImpl.GetAgentAddonOptions().RollbackOption != nil {
+			secretInformers = kubeInformers.Core().V1().Secrets()
+		}
+		if healthProber := agentImpl.GetAgentAddonOptions().HealthProber; healthProber != nil &&
+			healthProber.Type == agent.HealthProberTypeLeaseAndWork {
+			leaseInformers = kubeInformers.Coordination().V1().Leases()
 		}
 	}
 
 	deployController := agentdeploy.NewAddonDeployController(
 		workClient,
 		addonClient,
+		kubeClient,
 		clusterInformers.Cluster().V1().ManagedClusters(),
 		addonInformers.Addon().V1beta1().ManagedClusterAddOns(),
 		workInformers,
+		secretInformers,
+		leaseInformers,
+		manifestOverrideInformers,
 		a.addonAgents,
 		mcaFilterFunc,
+		a.dryRun,
 	)
 
 	registrationController := registration.NewAddonRegistrationController(
@@ -2,6 +2,7 @@ package constants
 
 import (
 	"fmt"
+	"strings"
 
 	addonv1beta1 "open-cluster-management.io/api/addon/v1beta1"
 	clusterv1 "open-cluster-management.io/api/cluster/v1"
@@ -13,6 +14,147 @@ const (
 	InstallModeBuiltinValueKey = "InstallMode"
 	InstallModeHosted          = "Hosted"
 	InstallModeDefault         = "Default"
+
+	// DryRunDiffAnnotationKey is the annotation key on the addon to record the diffs of the addon manifestWorks
+	// when the addon manager runs in dry-run mode, the value is a json map from the work namespace/name to the diff.
+	DryRunDiffAnnotationKey = "addon.open-cluster-management.io/dry-run-diff"
+
+	// ValuesProvenanceAnnotationKey is the annotation key of the deploy manifestWorks to record the final merged
+	// values of the addon and the source of each leaf key, the value is the json of addonfactory.ValuesReport.
+	ValuesProvenanceAnnotationKey = "addon.open-cluster-management.io/values-provenance"
+
+	// SensitiveDataAnnotationKey is the annotation key of the deploy and hook manifestWorks to mark that the
+	// manifests contain the sensitive data, e.g. the values from the Secrets. The patches of the manifestWorks are
+	// redacted in the dry run mode, and the specs of the manifestWorks are not recorded as the last known good
+	// specs for the rollback. The rendered manifests of the agentAddons with the sensitive data are only logged
+	// with the sensitive values redacted, and the sensitive values are redacted in the values provenance.
+	SensitiveDataAnnotationKey = "addon.open-cluster-management.io/sensitive-data"
+
+	// ReleaseRevisionAnnotationKey is the annotation key of the deploy manifestWorks of the helm agentAddon to
+	// record the Release.Revision of the chart they are rendered with.
+	ReleaseRevisionAnnotationKey = "addon.open-cluster-management.io/release-revision"
+	// ReleaseValuesHashAnnotationKey is the annotation key of the deploy manifestWorks of the helm agentAddon to
+	// record the hash of the chart and the values of the release, the Release.Revision is increased once the hash
+	// is changed.
+	ReleaseValuesHashAnnotationKey = "addon.open-cluster-management.io/release-values-hash"
+
+	// HealthHistoryAnnotationKey is the annotation key on the addon to record the bounded history of the
+	// transitions of the Available condition, it is only set when the FlapDetection of the addon is set.
+	HealthHistoryAnnotationKey = "addon.open-cluster-management.io/health-history"
+)
+
+const (
+	// AddonConditionRollout is the condition type of the addon to represent the rollout status of the changed
+	// manifests on the cluster, it is only set when the RolloutStrategy of the addon is set.
+	AddonConditionRollout = "ManifestRollout"
+
+	// RolloutReasonPending means the cluster is waiting for the rollouts on other clusters to complete.
+	RolloutReasonPending = "RolloutPending"
+	// RolloutReasonHeld means the rollout is held since it failed on too many clusters.
+	RolloutReasonHeld = "RolloutHeld"
+	// RolloutReasonProgressing means the changed manifests are rolling out to the cluster.
+	RolloutReasonProgressing = "RolloutProgressing"
+	// RolloutReasonFailed means the addon became unavailable after the changed manifests are applied.
+	RolloutReasonFailed = "RolloutFailed"
+	// RolloutReasonSucceeded means the addon is available after the changed manifests are applied.
+	RolloutReasonSucceeded = "RolloutSucceeded"
+)
+
+const (
+	// AddonConditionManifestsRendered is the condition type of the addon to represent whether the manifests of
+	// the addon can be rendered. It is set to false when the agentAddon returns a ManifestsRenderError, and it is
+	// set back to true once the manifests are rendered.
+	AddonConditionManifestsRendered = "ManifestsRendered"
+
+	// ManifestsRenderedReasonRendered means the manifests of the addon are rendered.
+	ManifestsRenderedReasonRendered = "ManifestsRendered"
+	// ManifestsRenderedReasonValuesSchemaInvalid means the values of the addon do not meet the values.schema.json
+	// of the chart or its subcharts.
+	ManifestsRenderedReasonValuesSchemaInvalid = "ValuesSchemaInvalid"
+	// ManifestsRenderedReasonTemplateRenderFailed means the template files of the addon can not be rendered.
+	ManifestsRenderedReasonTemplateRenderFailed = "TemplateRenderFailed"
+	// ManifestsRenderedReasonValuesInvalid means the values of the addon are rejected by the values validators
+	// of the agentAddon.
+	ManifestsRenderedReasonValuesInvalid = "ValuesInvalid"
+	// ManifestsRenderedReasonWorkloadConfigInvalid means the customized variables of the workload config in the
+	// AddOnDeploymentConfig of the addon can not be parsed.
+	ManifestsRenderedReasonWorkloadConfigInvalid = "WorkloadConfigInvalid"
+)
+
+const (
+	// AddonConditionRolledBack is the condition type of the addon to represent whether the deploy manifestWorks
+	// are rolled back to the last known good spec, it is only set when the RollbackOption of the addon is set.
+	AddonConditionRolledBack = "RolledBack"
+
+	// RollbackReasonRolledBack means the deploy manifestWorks are rolled back to the last known good spec.
+	RollbackReasonRolledBack = "RolledBackToLastKnownGood"
+	// RollbackReasonManifestsChanged means the manifests are changed after the rollback and applied.
+	RollbackReasonManifestsChanged = "ManifestsChanged"
+	// RollbackReasonSpecTooLarge means the spec of a deploy manifestWork is too large to be recorded as the
+	// last known good spec, so the manifestWork can not be rolled back to it.
+	RollbackReasonSpecTooLarge = "LastKnownGoodSpecTooLarge"
+
+	// WorkSpecHashAnnotationKey is the annotation key of the deploy manifestWork to record the hash of the
+	// spec rendered from the addon manifests, it is only set when the RollbackOption of the addon is set.
+	WorkSpecHashAnnotationKey = "addon.open-cluster-management.io/spec-hash"
+)
+
+const (
+	// AddonPostInstallHookAnnotationKey is the annotation key of the hook resources which are run after the
+	// addon manifests are installed and available.
+	AddonPostInstallHookAnnotationKey = "addon.open-cluster-management.io/addon-post-install"
+	// AddonPreUpgradeHookAnnotationKey is the annotation key of the hook resources which are run before the
+	// changed addon manifests are applied.
+	AddonPreUpgradeHookAnnotationKey = "addon.open-cluster-management.io/addon-pre-upgrade"
+	// AddonPostUpgradeHookAnnotationKey is the annotation key of the hook resources which are run after the
+	// changed addon manifests are applied and available.
+	AddonPostUpgradeHookAnnotationKey = "addon.open-cluster-management.io/addon-post-upgrade"
+
+	// AddonConditionPostInstallHookCompleted is the condition type of the addon to represent whether the
+	// post-install hook manifestWork is completed.
+	AddonConditionPostInstallHookCompleted = "PostInstallHookManifestCompleted"
+	// AddonConditionPreUpgradeHookCompleted is the condition type of the addon to represent whether the
+	// pre-upgrade hook manifestWork is completed.
+	AddonConditionPreUpgradeHookCompleted = "PreUpgradeHookManifestCompleted"
+	// AddonConditionPostUpgradeHookCompleted is the condition type of the addon to represent whether the
+	// post-upgrade hook manifestWork is completed.
+	AddonConditionPostUpgradeHookCompleted = "PostUpgradeHookManifestCompleted"
+
+	// ManifestsHashAnnotationKey is the annotation key of the deploy and hook manifestWorks to record the hash
+	// of the addon manifests they are built from, it is only set when the addon has lifecycle hooks.
+	ManifestsHashAnnotationKey = "addon.open-cluster-management.io/manifests-hash"
+	// InstalledManifestsHashAnnotationKey is the annotation key of the deploy manifestWorks to record the hash
+	// of the addon manifests when the addon is installed, it is only set when the addon has lifecycle hooks.
+	InstalledManifestsHashAnnotationKey = "addon.open-cluster-management.io/installed-manifests-hash"
+)
+
+const (
+	// HookStatusJSONPathAnnotationKey is the annotation key of a hook resource to set the JSONPath of the status
+	// field which represents the completion of the hook resource, e.g. ".status.phase". It is required for the
+	// hook resources other than Job and Pod.
+	HookStatusJSONPathAnnotationKey = "addon.open-cluster-management.io/hook-status-jsonpath"
+	// HookCompletedValueAnnotationKey is the annotation key of a hook resource to set the value of the status
+	// field when the hook resource is completed.
+	HookCompletedValueAnnotationKey = "addon.open-cluster-management.io/hook-completed-value"
+	// HookFailedValueAnnotationKey is the annotation key of a hook resource to set the value of the status
+	// field when the hook resource is failed, it is optional.
+	HookFailedValueAnnotationKey = "addon.open-cluster-management.io/hook-failed-value"
+
+	// PreDeleteHookTimeoutAnnotationKey is the annotation key of the addon to override the PreDeleteHookTimeout
+	// of the addon, the value is a duration string, e.g. "10m". The timeout is disabled if the value is "0".
+	PreDeleteHookTimeoutAnnotationKey = "addon.open-cluster-management.io/pre-delete-hook-timeout"
+
+	// AddonConditionHookManifestFailed is the condition type of the addon to represent whether the pre-delete
+	// hook manifestWork is failed. The addon is deleted without waiting for the failed hook.
+	AddonConditionHookManifestFailed = "HookManifestFailed"
+)
+
+const (
+	// DeployWaveAnnotationKey is the annotation key of the addon manifests to set the deploy wave of the manifest,
+	// the value is an integer and defaults to 0. The manifests of each wave are deployed by separate manifestWorks,
+	// and the manifestWorks of a wave are applied after the manifestWorks of the previous waves are available.
+	// The deploy manifestWorks of a wave are also annotated with the wave.
+	DeployWaveAnnotationKey = "addon.open-cluster-management.io/deploy-wave"
 )
 
 // DeployWorkNamePrefix returns the prefix of the work name for the addon
@@ -20,11 +162,26 @@ func DeployWorkNamePrefix(addonName string) string {
 	return fmt.Sprintf("addon-%s-deploy", addonName)
 }
 
+// DeployWaveWorkNamePrefix returns the prefix of the work name of the given deploy wave, the works of wave 0
+// use the deploy work name prefix directly.
+func DeployWaveWorkNamePrefix(deployWorkNamePrefix string, wave int) string {
+	if wave == 0 {
+		return deployWorkNamePrefix
+	}
+	return fmt.Sprintf("%s-wave-%d", deployWorkNamePrefix, wave)
+}
+
 // DeployHostingWorkNamePrefix returns the prefix of the work name on hosting cluster for the addon
 func DeployHostingWorkNamePrefix(addonNamespace, addonName string) string {
 	return fmt.Sprintf("%s-hosting-%s", DeployWorkNamePrefix(addonName), addonNamespace)
 }
 
+// LastKnownGoodSecretName returns the name of the Secret recording the last known good spec of the
+// deploy manifestWork
+func LastKnownGoodSecretName(workName string) string {
+	return fmt.Sprintf("%s-last-known-good", workName)
+}
+
 // PreDeleteHookWorkName return the name of pre-delete work for the addon
 func PreDeleteHookWorkName(addonName string) string {
 	return fmt.Sprintf("addon-%s-pre-delete", addonName)
@@ -35,6 +192,51 @@ func PreDeleteHookHostingWorkName(addonNamespace, addonName string) string {
 	return fmt.Sprintf("%s-hosting-%s", PreDeleteHookWorkName(addonName), addonNamespace)
 }
 
+// PostInstallHookWorkName return the name of post-install work for the addon
+func PostInstallHookWorkName(addonName string) string {
+	return fmt.Sprintf("addon-%s-post-install", addonName)
+}
+
+// PostInstallHookHostingWorkName return the name of post-install work on hosting cluster for the addon
+func PostInstallHookHostingWorkName(addonNamespace, addonName string) string {
+	return fmt.Sprintf("%s-hosting-%s", PostInstallHookWorkName(addonName), addonNamespace)
+}
+
+// PreUpgradeHookWorkName return the name of pre-upgrade work for the addon
+func PreUpgradeHookWorkName(addonName string) string {
+	return fmt.Sprintf("addon-%s-pre-upgrade", addonName)
+}
+
+// PreUpgradeHookHostingWorkName return the name of pre-upgrade work on hosting cluster for the addon
+func PreUpgradeHookHostingWorkName(addonNamespace, addonName string) string {
+	return fmt.Sprintf("%s-hosting-%s", PreUpgradeHookWorkName(addonName), addonNamespace)
+}
+
+// PostUpgradeHookWorkName return the name of post-upgrade work for the addon
+func PostUpgradeHookWorkName(addonName string) string {
+	return fmt.Sprintf("addon-%s-post-upgrade", addonName)
+}
+
+// PostUpgradeHookHostingWorkName return the name of post-upgrade work on hosting cluster for the addon
+func PostUpgradeHookHostingWorkName(addonNamespace, addonName string) string {
+	return fmt.Sprintf("%s-hosting-%s", PostUpgradeHookWorkName(addonName), addonNamespace)
+}
+
+// IsHookWorkName returns true if the work name is the name of a hook work of the addon
+func IsHookWorkName(addonName, workName string) bool {
+	for _, prefix := range []string{
+		PreDeleteHookWorkName(addonName),
+		PostInstallHookWorkName(addonName),
+		PreUpgradeHookWorkName(addonName),
+		PostUpgradeHookWorkName(addonName),
+	} {
+		if strings.HasPrefix(workName, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 // GetHostedModeInfo returns addon installation mode and hosting cluster name.
 func GetHostedModeInfo(addon *addonv1beta1.ManagedClusterAddOn, _ *clusterv1.ManagedCluster) (string, string) {
 	if len(addon.Annotations) == 0 {
@@ -68,3 +270,42 @@ func GetHostedManifestLocation(labels, annotations map[string]string) (string, b
 		return "", true, fmt.Errorf("not supported manifest location: %s", manifestLocation)
 	}
 }
+
+const (
+	// DegradedReasonLeaseUnhealthy means the workloads of the addon are available but the lease of the addon
+	// is not fresh, it is set on the Degraded condition by the HealthProberTypeLeaseAndWork.
+	DegradedReasonLeaseUnhealthy = "LeaseUnhealthy"
+	// DegradedReasonWorkUnhealthy means the lease of the addon is fresh but the workloads of the addon are not
+	// available, it is set on the Degraded condition by the HealthProberTypeLeaseAndWork.
+	DegradedReasonWorkUnhealthy = "WorkUnhealthy"
+	// DegradedReasonNotDegraded means the lease and the workloads of the addon are both healthy or both unhealthy.
+	DegradedReasonNotDegraded = "NotDegraded"
+)
+
+const (
+	// AddonConditionWorkloadProgressing is the condition type of the addon to represent whether the workloads of
+	// the addon are rolling out, it is set by the work based health probers from the observedGeneration and the
+	// updated replicas of the workloads. It is not the Progressing condition of the addon, which represents
+	// the rollout of the addon configurations.
+	AddonConditionWorkloadProgressing = "WorkloadProgressing"
+
+	// WorkloadProgressingReasonRollingOut means the workloads of the addon are rolling out within the progress
+	// deadline, the Available condition of the addon is kept true during the rollout.
+	WorkloadProgressingReasonRollingOut = "RollingOut"
+	// WorkloadProgressingReasonCompleted means the rollout of the workloads of the addon is completed.
+	WorkloadProgressingReasonCompleted = "RolloutCompleted"
+	// WorkloadProgressingReasonDeadlineExceeded means the rollout of the workloads of the addon exceeds the
+	// progress deadline.
+	WorkloadProgressingReasonDeadlineExceeded = "ProgressDeadlineExceeded"
+)
+
+const (
+	// AddonConditionFlapping is the condition type of the addon to represent whether the Available condition of
+	// the addon transitions frequently, it is only set when the FlapDetection of the addon is set.
+	AddonConditionFlapping = "Flapping"
+
+	// FlappingReasonFlapping means the Available condition transitions too many times in the window.
+	FlappingReasonFlapping = "AvailabilityFlapping"
+	// FlappingReasonStable means the Available condition does not transition too many times in the window.
+	FlappingReasonStable = "AvailabilityStable"
+)
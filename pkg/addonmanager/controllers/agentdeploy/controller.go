@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strings"
 
+	coordinationv1 "k8s.io/api/coordination/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
@@ -12,6 +13,11 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	errorsutil "k8s.io/apimachinery/pkg/util/errors"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/informers"
+	coordinationv1informers "k8s.io/client-go/informers/coordination/v1"
+	corev1informers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	coordinationv1listers "k8s.io/client-go/listers/coordination/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
@@ -24,6 +30,7 @@ import (
 	clusterlister "open-cluster-management.io/api/client/cluster/listers/cluster/v1"
 	workv1client "open-cluster-management.io/api/client/work/clientset/versioned"
 	workinformers "open-cluster-management.io/api/client/work/informers/externalversions/work/v1"
+	worklister "open-cluster-management.io/api/client/work/listers/work/v1"
 	clusterv1 "open-cluster-management.io/api/cluster/v1"
 	workapiv1 "open-cluster-management.io/api/work/v1"
 	workapplier "open-cluster-management.io/sdk-go/pkg/apis/work/v1/applier"
@@ -50,38 +57,54 @@ type addonDeployController struct {
 	managedClusterAddonLister  addonlisterv1beta1.ManagedClusterAddOnLister
 	managedClusterAddonIndexer cache.Indexer
 	workIndexer                cache.Indexer
+	workLister                 worklister.ManifestWorkLister
 	agentAddons                map[string]agent.AgentAddon
 	queue                      workqueue.TypedRateLimitingInterface[string]
 	mcaFilterFunc              utils.ManagedClusterAddOnFilterFunc
+	rolloutGate                *rolloutGate
+	rollbackStore              *rollbackStore
+	leaseLister                coordinationv1listers.LeaseLister
+	healthHistoryRecorder      *healthHistoryRecorder
+	// dryRun makes the controller record the diffs of the manifestWorks on the addon
+	// instead of applying or deleting them.
+	dryRun bool
 }
 
 func NewAddonDeployController(
 	workClient workv1client.Interface,
 	addonClient addonclient.Interface,
+	kubeClient kubernetes.Interface,
 	clusterInformers clusterinformers.ManagedClusterInformer,
 	addonInformers addoninformerv1beta1.ManagedClusterAddOnInformer,
 	workInformers workinformers.ManifestWorkInformer,
+	secretInformers corev1informers.SecretInformer,
+	leaseInformers coordinationv1informers.LeaseInformer,
+	manifestOverrideInformers informers.GenericInformer,
 	agentAddons map[string]agent.AgentAddon,
 	mcaFilterFunc utils.ManagedClusterAddOnFilterFunc,
+	dryRun bool,
 ) factory.Controller {
 	syncCtx := factory.NewSyncContext(controllerName)
 
 	c := &addonDeployController{
-		queue:       syncCtx.Queue(),
-		workApplier: workapplier.NewWorkApplierWithTypedClient(workClient, workInformers.Lister()),
-		// the default manifest limit in a work is 500k
-		// TODO: make the limit configurable
-		workBuilder:                workbuilder.NewWorkBuilder().WithManifestsLimit(500 * 1024),
+		queue:                      syncCtx.Queue(),
+		workApplier:                workapplier.NewWorkApplierWithTypedClient(workClient, workInformers.Lister()),
+		workBuilder:                newWorkBuilder(),
 		addonClient:                addonClient,
 		managedClusterLister:       clusterInformers.Lister(),
 		managedClusterAddonLister:  addonInformers.Lister(),
 		managedClusterAddonIndexer: addonInformers.Informer().GetIndexer(),
 		workIndexer:                workInformers.Informer().GetIndexer(),
-		agentAddons:                agentAddons,
+		workLister:                 workInformers.Lister(),
+		rolloutGate:                newRolloutGate(addonInformers.Lister()),
+		rollbackStore:              newRollbackStore(kubeClient, secretInformers),
+		agentAddons:                withManifestOverrides(agentAddons, manifestOverrideInformers),
 		mcaFilterFunc:              mcaFilterFunc,
+		dryRun:                     dryRun,
 	}
 
 	c.setClusterInformerHandler(clusterInformers)
+	c.setAddonInformerHandler(addonInformers)
 
 	f := factory.New().WithSyncContext(syncCtx).
 		WithFilteredEventsInformersQueueKeysFunc(
@@ -126,7 +149,7 @@ func NewAddonDeployController(
 				}
 
 				if strings.HasPrefix(accessor.GetName(), constants.DeployWorkNamePrefix(addonName)) ||
-					strings.HasPrefix(accessor.GetName(), constants.PreDeleteHookWorkName(addonName)) {
+					constants.IsHookWorkName(addonName, accessor.GetName()) {
 					return true
 				}
 				return false
@@ -136,9 +159,49 @@ func NewAddonDeployController(
 		WithBareInformers(clusterInformers.Informer()).
 		WithSync(c.sync)
 
+	// manifestOverrideInformers is only set when the manifest override config is supported by any addon, the
+	// addons are enqueued by the addon config controller once the configs are changed.
+	if manifestOverrideInformers != nil {
+		f = f.WithBareInformers(manifestOverrideInformers.Informer())
+	}
+
+	// leaseInformers is only set when the addon lease on the hub is probed by any addon.
+	if leaseInformers != nil {
+		c.leaseLister = leaseInformers.Lister()
+		c.setLeaseInformerHandler(leaseInformers)
+		f = f.WithBareInformers(leaseInformers.Informer())
+	}
+
+	// secretInformers is only set when the rollback is enabled by any addon.
+	if secretInformers != nil {
+		f = f.WithFilteredEventsInformersQueueKeysFunc(
+			func(obj runtime.Object) []string {
+				accessor, _ := meta.Accessor(obj)
+				return []string{fmt.Sprintf("%s/%s", accessor.GetNamespace(), accessor.GetLabels()[addonapiv1beta1.AddonLabelKey])}
+			},
+			func(obj interface{}) bool {
+				accessor, _ := meta.Accessor(obj)
+				addonName, ok := accessor.GetLabels()[addonapiv1beta1.AddonLabelKey]
+				if !ok {
+					return false
+				}
+				return strings.HasPrefix(accessor.GetName(), constants.DeployWorkNamePrefix(addonName)) &&
+					strings.HasSuffix(accessor.GetName(), constants.LastKnownGoodSecretName(""))
+			},
+			secretInformers.Informer(),
+		)
+	}
+
 	return f.ToController(controllerName)
 }
 
+// newWorkBuilder returns the work builder used to split the addon manifests into manifestWorks.
+func newWorkBuilder() *workbuilder.WorkBuilder {
+	// the default manifest limit in a work is 500k
+	// TODO: make the limit configurable
+	return workbuilder.NewWorkBuilder().WithManifestsLimit(500 * 1024)
+}
+
 func (c addonDeployController) setClusterInformerHandler(clusterInformers clusterinformers.ManagedClusterInformer) {
 	var filters []func(old, new *clusterv1.ManagedCluster) bool
 	for _, addon := range c.agentAddons {
@@ -176,6 +239,138 @@ func (c addonDeployController) setClusterInformerHandler(clusterInformers cluste
 	}
 }
 
+// setAddonInformerHandler records the transitions of the Available condition of the addons with the flap
+// detection enabled once the addons are updated, since several updates of an addon may be coalesced into one
+// reconcile.
+func (c *addonDeployController) setAddonInformerHandler(addonInformers addoninformerv1beta1.ManagedClusterAddOnInformer) {
+	enabled := false
+	for _, addon := range c.agentAddons {
+		if addon.GetAgentAddonOptions().FlapDetection != nil {
+			enabled = true
+			break
+		}
+	}
+	if !enabled {
+		return
+	}
+
+	c.healthHistoryRecorder = newHealthHistoryRecorder()
+	_, err := addonInformers.Informer().AddEventHandler(
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {},
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				oldAddon, ook := oldObj.(*addonapiv1beta1.ManagedClusterAddOn)
+				newAddon, nok := newObj.(*addonapiv1beta1.ManagedClusterAddOn)
+				if !ook || !nok {
+					return
+				}
+				agentAddon, ok := c.agentAddons[newAddon.Name]
+				if !ok || agentAddon.GetAgentAddonOptions().FlapDetection == nil {
+					return
+				}
+
+				newCondition := meta.FindStatusCondition(newAddon.Status.Conditions,
+					addonapiv1beta1.ManagedClusterAddOnConditionAvailable)
+				if newCondition == nil {
+					return
+				}
+				oldCondition := meta.FindStatusCondition(oldAddon.Status.Conditions,
+					addonapiv1beta1.ManagedClusterAddOnConditionAvailable)
+				if oldCondition != nil && oldCondition.Status == newCondition.Status &&
+					oldCondition.LastTransitionTime.Equal(&newCondition.LastTransitionTime) {
+					return
+				}
+
+				_, _, historyLimit := flapDetectionDefaults(agentAddon.GetAgentAddonOptions().FlapDetection)
+				c.healthHistoryRecorder.record(fmt.Sprintf("%s/%s", newAddon.Namespace, newAddon.Name),
+					availableTransition{
+						Status: newCondition.Status,
+						Reason: newCondition.Reason,
+						Time:   newCondition.LastTransitionTime,
+					}, historyLimit)
+			},
+			DeleteFunc: func(obj interface{}) {
+				key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+				if err != nil {
+					utilruntime.HandleError(err)
+					return
+				}
+				c.healthHistoryRecorder.forget(key)
+			},
+		},
+	)
+	if err != nil {
+		utilruntime.HandleError(err)
+	}
+}
+
+// setLeaseInformerHandler enqueues the addon once its lease on the hub is created or deleted, or is renewed
+// while the addon is not available, so the lease becoming fresh is probed without waiting for the resync.
+// The lease becoming stale is probed by the healthCheckSyncer, which requeues the addon when the lease is
+// going to be stale.
+func (c *addonDeployController) setLeaseInformerHandler(leaseInformers coordinationv1informers.LeaseInformer) {
+	_, err := leaseInformers.Informer().AddEventHandler(
+		cache.FilteringResourceEventHandler{
+			FilterFunc: func(obj interface{}) bool {
+				accessor, err := meta.Accessor(obj)
+				if err != nil {
+					// the tombstone of the deleted lease is handled by the DeleteFunc.
+					return true
+				}
+				agentAddon, ok := c.agentAddons[accessor.GetName()]
+				if !ok {
+					return false
+				}
+				healthProber := agentAddon.GetAgentAddonOptions().HealthProber
+				return healthProber != nil && healthProber.Type == agent.HealthProberTypeLeaseAndWork
+			},
+			Handler: cache.ResourceEventHandlerFuncs{
+				AddFunc: func(obj interface{}) {
+					c.enqueueAddOnByLease(obj)
+				},
+				UpdateFunc: func(oldObj, newObj interface{}) {
+					accessor, _ := meta.Accessor(newObj)
+					addon, err := c.managedClusterAddonLister.ManagedClusterAddOns(accessor.GetNamespace()).Get(
+						accessor.GetName())
+					if err != nil {
+						return
+					}
+					if meta.IsStatusConditionTrue(addon.Status.Conditions,
+						addonapiv1beta1.ManagedClusterAddOnConditionAvailable) {
+						return
+					}
+					c.enqueueAddOnByLease(newObj)
+				},
+				DeleteFunc: func(obj interface{}) {
+					c.enqueueAddOnByLease(obj)
+				},
+			},
+		},
+	)
+	if err != nil {
+		utilruntime.HandleError(err)
+	}
+}
+
+func (c *addonDeployController) enqueueAddOnByLease(obj interface{}) {
+	// the lease of the addon is in the cluster namespace with the same name as the addon.
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	_, addonName, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	if _, ok := c.agentAddons[addonName]; !ok {
+		return
+	}
+	klog.V(5).Infof("Enqueue addon %s by lease", key)
+	c.queue.Add(key)
+}
+
 func (c *addonDeployController) enqueueAddOnsByCluster() func(obj interface{}) {
 	return func(obj interface{}) {
 		accessor, _ := meta.Accessor(obj)
@@ -218,6 +413,20 @@ func (c *addonDeployController) getWorksByAddonFn(index string) func(addonName,
 	}
 }
 
+func (c *addonDeployController) getWork(workNamespace, workName string) (*workapiv1.ManifestWork, error) {
+	return c.workLister.ManifestWorks(workNamespace).Get(workName)
+}
+
+// getLeaseFn returns nil if the leases are not watched, so the lease is not probed.
+func (c *addonDeployController) getLeaseFn() func(namespace, name string) (*coordinationv1.Lease, error) {
+	if c.leaseLister == nil {
+		return nil
+	}
+	return func(namespace, name string) (*coordinationv1.Lease, error) {
+		return c.leaseLister.Leases(namespace).Get(name)
+	}
+}
+
 func (c *addonDeployController) sync(ctx context.Context, syncCtx factory.SyncContext, key string) error {
 	klog.V(4).Infof("%s sync addon key %s", controllerName, key)
 	clusterName, addonName, err := cache.SplitMetaNamespaceKey(key)
@@ -233,7 +442,10 @@ func (c *addonDeployController) sync(ctx context.Context, syncCtx factory.SyncCo
 
 	addon, err := c.managedClusterAddonLister.ManagedClusterAddOns(clusterName).Get(addonName)
 	if errors.IsNotFound(err) {
-		// need to find a way to clean up cache by addon
+		// clean up the rollout status cached for the deleted addon.
+		if agentAddon.GetAgentAddonOptions().RolloutStrategy != nil {
+			c.rolloutGate.forget(addonName, clusterName)
+		}
 		return nil
 	}
 	if err != nil {
@@ -253,21 +465,50 @@ func (c *addonDeployController) sync(ctx context.Context, syncCtx factory.SyncCo
 	if errors.IsNotFound(err) {
 		// the managedCluster is nil in this case,and sync cannot handle nil managedCluster.
 		// TODO: consider to force delete the addon and its deploy manifestWorks.
+		if agentAddon.GetAgentAddonOptions().RolloutStrategy != nil {
+			c.rolloutGate.forget(addonName, clusterName)
+		}
 		return nil
 	}
 	if err != nil {
 		return err
 	}
 
+	var applyWork applyWorkFunc = c.applyWork
+	deleteWork := c.workApplier.Delete
+	if c.dryRun {
+		applyWork = c.dryRunApplyWork
+		// the addon is captured to record the deleted works on the addon copy updated by the syncers.
+		deleteWork = func(ctx context.Context, workNamespace, workName string) error {
+			return c.dryRunDeleteWork(ctx, addon, workNamespace, workName)
+		}
+	}
+	deployApplyWork := c.rolloutApplyWorkFunc(agentAddon.GetAgentAddonOptions().RolloutStrategy, applyWork)
+	rollbackStore := c.rollbackStore
+	if c.dryRun {
+		// the last known good specs are neither recorded nor applied in dry-run mode.
+		rollbackStore = nil
+	} else {
+		// the rollback is applied before the rollout gate, so the rollout gate only sees the rolled back works.
+		deployApplyWork = c.rollbackApplyWorkFunc(agentAddon.GetAgentAddonOptions().RollbackOption, deployApplyWork)
+	}
+
+	oldAddon := addon
+	addon = addon.DeepCopy()
+	if c.dryRun {
+		// the diffs are recorded again by the syncers in each reconcile.
+		delete(addon.Annotations, constants.DryRunDiffAnnotationKey)
+	}
+
 	syncers := []addonDeploySyncer{
 		&defaultSyncer{
 			buildWorks: c.buildDeployManifestWorksFunc(
 				newAddonWorksBuilder(agentAddon.GetAgentAddonOptions().HostedModeEnabled, c.workBuilder),
 				addonapiv1beta1.ManagedClusterAddOnManifestApplied,
 			),
-			applyWork:      c.applyWork,
+			applyWork:      deployApplyWork,
 			getWorkByAddon: c.getWorksByAddonFn(index.ManifestWorkByAddon),
-			deleteWork:     c.workApplier.Delete,
+			deleteWork:     deleteWork,
 			agentAddon:     agentAddon,
 		},
 		&hostedSyncer{
@@ -275,8 +516,8 @@ func (c *addonDeployController) sync(ctx context.Context, syncCtx factory.SyncCo
 				newHostingAddonWorksBuilder(agentAddon.GetAgentAddonOptions().HostedModeEnabled, c.workBuilder),
 				addonapiv1beta1.ManagedClusterAddOnHostingManifestApplied,
 			),
-			applyWork:      c.applyWork,
-			deleteWork:     c.workApplier.Delete,
+			applyWork:      deployApplyWork,
+			deleteWork:     deleteWork,
 			getCluster:     c.managedClusterLister.Get,
 			getWorkByAddon: c.getWorksByAddonFn(index.ManifestWorkByHostedAddon),
 			agentAddon:     agentAddon},
@@ -285,27 +526,64 @@ func (c *addonDeployController) sync(ctx context.Context, syncCtx factory.SyncCo
 				newAddonWorksBuilder(agentAddon.GetAgentAddonOptions().HostedModeEnabled, c.workBuilder),
 				addonapiv1beta1.ManagedClusterAddOnManifestApplied,
 			),
-			applyWork:  c.applyWork,
+			lifecycleHooks: &lifecycleHookRunner{
+				buildWorks: c.buildLifecycleHookManifestWorksFunc(
+					newAddonWorksBuilder(agentAddon.GetAgentAddonOptions().HostedModeEnabled, c.workBuilder),
+					addonapiv1beta1.ManagedClusterAddOnManifestApplied,
+				),
+				applyWork:      applyWork,
+				deleteWork:     deleteWork,
+				getWork:        c.getWork,
+				getWorkByAddon: c.getWorksByAddonFn(index.ManifestWorkByAddon),
+				appliedType:    addonapiv1beta1.ManagedClusterAddOnManifestApplied,
+			},
+			applyWork:  applyWork,
+			deleteWork: deleteWork,
 			agentAddon: agentAddon},
 		&hostedHookSyncer{
 			buildWorks: c.buildHookManifestWorkFunc(
 				newHostingAddonWorksBuilder(agentAddon.GetAgentAddonOptions().HostedModeEnabled, c.workBuilder),
 				addonapiv1beta1.ManagedClusterAddOnHostingManifestApplied,
 			),
-			applyWork:      c.applyWork,
-			deleteWork:     c.workApplier.Delete,
+			applyWork:      applyWork,
+			deleteWork:     deleteWork,
 			getCluster:     c.managedClusterLister.Get,
 			getWorkByAddon: c.getWorksByAddonFn(index.ManifestWorkHookByHostedAddon),
-			agentAddon:     agentAddon},
+			lifecycleHooks: &lifecycleHookRunner{
+				buildWorks: c.buildLifecycleHookManifestWorksFunc(
+					newHostingAddonWorksBuilder(agentAddon.GetAgentAddonOptions().HostedModeEnabled, c.workBuilder),
+					addonapiv1beta1.ManagedClusterAddOnHostingManifestApplied,
+				),
+				applyWork:      applyWork,
+				deleteWork:     deleteWork,
+				getWork:        c.getWork,
+				getWorkByAddon: c.getWorksByAddonFn(index.ManifestWorkByHostedAddon),
+				appliedType:    addonapiv1beta1.ManagedClusterAddOnHostingManifestApplied,
+			},
+			agentAddon: agentAddon},
 		&healthCheckSyncer{
 			getWorkByAddon:       c.getWorksByAddonFn(index.ManifestWorkByAddon),
 			getWorkByHostedAddon: c.getWorksByAddonFn(index.ManifestWorkByHostedAddon),
+			getLease:             c.getLeaseFn(),
+			agentAddon:           agentAddon,
+		},
+		&healthHistorySyncer{
+			agentAddon: agentAddon,
+			recorder:   c.healthHistoryRecorder,
+		},
+		&rollbackSyncer{
+			getWorkByAddon: c.getWorksByAddonFn(index.ManifestWorkByAddon),
+			store:          rollbackStore,
+			agentAddon:     agentAddon,
+		},
+		&rolloutSyncer{
+			getWorkByAddon:       c.getWorksByAddonFn(index.ManifestWorkByAddon),
+			getWorkByHostedAddon: c.getWorksByAddonFn(index.ManifestWorkByHostedAddon),
+			gate:                 c.rolloutGate,
 			agentAddon:           agentAddon,
 		},
 	}
 
-	oldAddon := addon
-	addon = addon.DeepCopy()
 	var errs []error
 	for _, s := range syncers {
 		var err error
@@ -314,6 +592,10 @@ func (c *addonDeployController) sync(ctx context.Context, syncCtx factory.SyncCo
 			errs = append(errs, err)
 		}
 	}
+	if c.dryRun {
+		keepDryRunConditions(addon, oldAddon)
+		keepDryRunFinalizers(addon, oldAddon)
+	}
 
 	if err = c.updateAddon(ctx, addon, oldAddon); err != nil {
 		return fmt.Errorf("failed to update addon %s/%s: %w", addon.Namespace, addon.Name, err)
@@ -321,7 +603,7 @@ func (c *addonDeployController) sync(ctx context.Context, syncCtx factory.SyncCo
 	return errorsutil.NewAggregate(errs)
 }
 
-// updateAddon updates finalizers and conditions of addon.
+// updateAddon updates finalizers, conditions and annotations of addon.
 // to avoid conflict updateAddon updates finalizers firstly if finalizers has change.
 func (c *addonDeployController) updateAddon(ctx context.Context, new, old *addonapiv1beta1.ManagedClusterAddOn) error {
 	if !equality.Semantic.DeepEqual(new.GetFinalizers(), old.GetFinalizers()) {
@@ -341,6 +623,14 @@ func (c *addonDeployController) updateAddon(ctx context.Context, new, old *addon
 	if err != nil {
 		return fmt.Errorf("failed to update addon status: %w", err)
 	}
+
+	// the annotations are only changed in dry-run mode or when the health history is recorded. They are patched
+	// after the status without the resourceVersion, since the resourceVersion is changed if the status is patched.
+	_, err = addonPatcher.WithOptions(patcher.PatchOptions{IgnoreResourceVersion: true}).PatchLabelAnnotations(
+		ctx, new, new.ObjectMeta, old.ObjectMeta)
+	if err != nil {
+		return fmt.Errorf("failed to update addon annotations: %w", err)
+	}
 	return nil
 }
 
@@ -414,6 +704,7 @@ func (c *addonDeployController) buildDeployManifestWorksFunc(addonWorkBuilder *a
 		}
 
 		objects, err := agentAddon.Manifests(ctx, cluster, addon)
+		setManifestsRenderedCondition(addon, err)
 		if err != nil {
 			meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
 				Type:    appliedType,
@@ -436,13 +727,17 @@ func (c *addonDeployController) buildDeployManifestWorksFunc(addonWorkBuilder *a
 		if err != nil {
 			return nil, nil, fmt.Errorf("get manifest config option error: %v", err)
 		}
+		workAnnotations, err := getManifestWorkAnnotations(ctx, agentAddon, cluster, addon)
+		if err != nil {
+			return nil, nil, fmt.Errorf("get manifestwork annotations error: %v", err)
+		}
 
 		existingWorksCopy := []workapiv1.ManifestWork{}
 		for _, work := range existingWorks {
 			existingWorksCopy = append(existingWorksCopy, *work)
 		}
 		appliedWorks, deleteWorks, err = addonWorkBuilder.BuildDeployWorks(
-			mode, workNamespace, addon, existingWorksCopy, objects, manifestOptions)
+			mode, workNamespace, addon, existingWorksCopy, objects, manifestOptions, workAnnotations)
 		if err != nil {
 			meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
 				Type:    appliedType,
@@ -452,6 +747,17 @@ func (c *addonDeployController) buildDeployManifestWorksFunc(addonWorkBuilder *a
 			})
 			return nil, nil, err
 		}
+
+		wait, err := c.waitForPreUpgradeHook(addonWorkBuilder, mode, workNamespace, addon, existingWorks, appliedWorks, objects)
+		if err != nil {
+			return nil, nil, err
+		}
+		if wait {
+			klog.InfoS("Waiting for the pre-upgrade hook to complete before updating the manifestWorks",
+				"addonNamespace", addon.Namespace, "addonName", addon.Name)
+			return nil, nil, nil
+		}
+
 		if len(appliedWorks) == 0 {
 			meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
 				Type:    appliedType,
@@ -460,7 +766,7 @@ func (c *addonDeployController) buildDeployManifestWorksFunc(addonWorkBuilder *a
 				Message: "no manifest need to apply",
 			})
 		}
-		return appliedWorks, deleteWorks, nil
+		return filterDeployWaves(addon, appliedWorks, existingWorks), deleteWorks, nil
 	}
 }
 
@@ -488,6 +794,7 @@ func (c *addonDeployController) buildHookManifestWorkFunc(addonWorkBuilder *addo
 		}
 
 		objects, err := agentAddon.Manifests(ctx, cluster, addon)
+		setManifestsRenderedCondition(addon, err)
 		if err != nil {
 			meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
 				Type:    appliedType,
@@ -518,6 +825,11 @@ func (c *addonDeployController) buildHookManifestWorkFunc(addonWorkBuilder *addo
 			})
 			return nil, err
 		}
+		workAnnotations, err := getManifestWorkAnnotations(ctx, agentAddon, cluster, addon)
+		if err != nil {
+			return nil, fmt.Errorf("get manifestwork annotations error: %v", err)
+		}
+		setSensitiveDataAnnotation(workAnnotations, hookWork)
 		return hookWork, nil
 	}
 }
@@ -6,11 +6,13 @@ import (
 
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
 
 	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
 	clusterv1 "open-cluster-management.io/api/cluster/v1"
 	workapiv1 "open-cluster-management.io/api/work/v1"
 
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
 	"open-cluster-management.io/addon-framework/pkg/agent"
 	"open-cluster-management.io/sdk-go/pkg/basecontroller/factory"
 )
@@ -19,7 +21,9 @@ type defaultHookSyncer struct {
 	buildWorks buildDeployHookFunc
 	applyWork  func(ctx context.Context, appliedType string,
 		work *workapiv1.ManifestWork, addon *addonapiv1beta1.ManagedClusterAddOn) (*workapiv1.ManifestWork, error)
-	agentAddon agent.AgentAddon
+	deleteWork     func(ctx context.Context, workNamespace, workName string) error
+	lifecycleHooks *lifecycleHookRunner
+	agentAddon     agent.AgentAddon
 }
 
 func (s *defaultHookSyncer) sync(ctx context.Context,
@@ -28,6 +32,14 @@ func (s *defaultHookSyncer) sync(ctx context.Context,
 	addon *addonapiv1beta1.ManagedClusterAddOn) (*addonapiv1beta1.ManagedClusterAddOn, error) {
 	deployWorkNamespace := addon.Namespace
 
+	// the post-install, pre-upgrade and post-upgrade hooks are run until the addon is deleting.
+	if addon.DeletionTimestamp.IsZero() {
+		if _, err := s.lifecycleHooks.sync(ctx, deployWorkNamespace,
+			constants.DeployWorkNamePrefix(addon.Name), cluster, addon); err != nil {
+			return addon, err
+		}
+	}
+
 	hookWork, err := s.buildWorks(ctx, deployWorkNamespace, cluster, addon)
 	if err != nil {
 		return addon, err
@@ -46,6 +58,25 @@ func (s *defaultHookSyncer) sync(ctx context.Context,
 		return addon, nil
 	}
 
+	// the failure of the hook is reported by the HookManifestFailed condition, and the addon is deleted
+	// after the condition is reported.
+	if meta.IsStatusConditionTrue(addon.Status.Conditions, constants.AddonConditionHookManifestFailed) {
+		addonRemoveFinalizer(addon, addonapiv1beta1.AddonPreDeleteHookFinalizer)
+		return addon, nil
+	}
+
+	if timeLeft, ok := preDeleteHookTimeLeft(s.agentAddon, addon); ok {
+		if timeLeft <= 0 {
+			if err := s.deleteWork(ctx, deployWorkNamespace, hookWork.Name); err != nil {
+				return addon, err
+			}
+			recordHookTimeout(ctx, syncCtx, addon, hookWork)
+			addonRemoveFinalizer(addon, addonapiv1beta1.AddonPreDeleteHookFinalizer)
+			return addon, nil
+		}
+		syncCtx.Queue().AddAfter(fmt.Sprintf("%s/%s", addon.Namespace, addon.Name), timeLeft)
+	}
+
 	// will deploy the pre-delete hook manifestWork when the addon is deleting
 	hookWork, err = s.applyWork(ctx, addonapiv1beta1.ManagedClusterAddOnManifestApplied, hookWork, addon)
 	if err != nil {
@@ -53,7 +84,12 @@ func (s *defaultHookSyncer) sync(ctx context.Context,
 	}
 
 	// TODO: will surface more message here
-	if hookWorkIsCompleted(hookWork) {
+	completed, failed := hookWorkStatus(hookWork)
+	if failed {
+		setHookFailedCondition(ctx, syncCtx, addon, hookWork)
+		return addon, nil
+	}
+	if completed {
 		meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
 			Type:    addonapiv1beta1.ManagedClusterAddOnHookManifestCompleted,
 			Status:  metav1.ConditionTrue,
@@ -74,3 +110,34 @@ func (s *defaultHookSyncer) sync(ctx context.Context,
 
 	return addon, nil
 }
+
+// setHookFailedCondition reports the failure of the pre-delete hook manifestWork by the HookManifestFailed
+// condition and an event.
+func setHookFailedCondition(ctx context.Context, syncCtx factory.SyncContext,
+	addon *addonapiv1beta1.ManagedClusterAddOn, hookWork *workapiv1.ManifestWork) {
+	syncCtx.Recorder().Warningf(ctx, "AddonHookFailed",
+		"The pre-delete hook manifestWork %s/%s of addon %s is failed, the addon is deleted without the hook",
+		hookWork.Namespace, hookWork.Name, addon.Name)
+	meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
+		Type:    addonapiv1beta1.ManagedClusterAddOnHookManifestCompleted,
+		Status:  metav1.ConditionFalse,
+		Reason:  "HookManifestIsFailed",
+		Message: fmt.Sprintf("hook manifestWork %v is failed.", hookWork.Name),
+	})
+	meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
+		Type:    constants.AddonConditionHookManifestFailed,
+		Status:  metav1.ConditionTrue,
+		Reason:  "HookManifestIsFailed",
+		Message: fmt.Sprintf("hook manifestWork %v is failed.", hookWork.Name),
+	})
+}
+
+// recordHookTimeout records an event when the pre-delete hook manifestWork times out.
+func recordHookTimeout(ctx context.Context, syncCtx factory.SyncContext,
+	addon *addonapiv1beta1.ManagedClusterAddOn, hookWork *workapiv1.ManifestWork) {
+	klog.InfoS("The pre-delete hook manifestWork times out, delete the addon without the hook",
+		"addonNamespace", addon.Namespace, "addonName", addon.Name, "workName", hookWork.Name)
+	syncCtx.Recorder().Warningf(ctx, "AddonHookTimeout",
+		"The pre-delete hook manifestWork %s/%s of addon %s times out, the addon is deleted without the hook",
+		hookWork.Namespace, hookWork.Name, addon.Name)
+}
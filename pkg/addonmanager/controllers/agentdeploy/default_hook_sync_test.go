@@ -9,6 +9,7 @@ import (
 
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	clienttesting "k8s.io/client-go/testing"
 	"k8s.io/client-go/tools/cache"
@@ -58,6 +59,17 @@ func getDeployWork() *workapiv1.ManifestWork {
 	return work
 }
 
+func newHookWorkflow() *unstructured.Unstructured {
+	workflow := addontesting.NewUnstructured("argoproj.io/v1alpha1", "Workflow", "default", "test")
+	workflow.SetAnnotations(map[string]string{
+		addonapiv1beta1.AddonPreDeleteHookAnnotationKey: "",
+		constants.HookStatusJSONPathAnnotationKey:       ".status.phase",
+		constants.HookCompletedValueAnnotationKey:       "Succeeded",
+		constants.HookFailedValueAnnotationKey:          "Failed",
+	})
+	return workflow
+}
+
 func TestDefaultHookReconcile(t *testing.T) {
 	cases := []struct {
 		name                 string
@@ -252,6 +264,12 @@ func TestDefaultHookReconcile(t *testing.T) {
 								{
 									Type: workapiv1.WellKnownStatusType,
 								},
+								{
+									Type: workapiv1.JSONPathsType,
+									JsonPaths: []workapiv1.JsonPath{
+										{Name: "JobFailed", Path: `.conditions[?(@.type=="Failed")].status`},
+									},
+								},
 							},
 						},
 					}
@@ -333,6 +351,12 @@ func TestDefaultHookReconcile(t *testing.T) {
 								{
 									Type: workapiv1.WellKnownStatusType,
 								},
+								{
+									Type: workapiv1.JSONPathsType,
+									JsonPaths: []workapiv1.JsonPath{
+										{Name: "JobFailed", Path: `.conditions[?(@.type=="Failed")].status`},
+									},
+								},
 							},
 						},
 					}
@@ -416,6 +440,138 @@ func TestDefaultHookReconcile(t *testing.T) {
 			validateWorkActions:  addontesting.AssertNoActions,
 			validateAddonActions: addontesting.AssertNoActions,
 		},
+		{
+			name: "deploy hook manifest for a deleting addon with finalizer, failed",
+			key:  "cluster1/test",
+			addon: []runtime.Object{
+				addontesting.SetAddonFinalizers(
+					addontesting.SetAddonDeletionTimestamp(
+						addontesting.NewAddonWithConditions("test", "cluster1", registrationAppliedCondition),
+						time.Now()),
+					addonapiv1beta1.AddonPreDeleteHookFinalizer),
+			},
+			cluster: []runtime.Object{addontesting.NewManagedCluster("cluster1")},
+			testaddon: &testAgent{name: "test", objects: []runtime.Object{
+				addontesting.NewUnstructured("v1", "ConfigMap", "default", "test"),
+				newHookWorkflow()}},
+			existingWork: []runtime.Object{
+				getDeployWork(),
+				func() *workapiv1.ManifestWork {
+					work, err := newAddonWorksBuilder(false, workbuilder.NewWorkBuilder()).BuildHookWork(
+						constants.InstallModeDefault, "cluster1", addontesting.NewAddon("test", "cluster1"),
+						[]runtime.Object{newHookWorkflow()})
+					if err != nil {
+						t.Fatal(err)
+					}
+					work.Status.Conditions = []metav1.Condition{
+						{
+							Type:   workapiv1.WorkAvailable,
+							Status: metav1.ConditionTrue,
+						},
+					}
+					work.Status.ResourceStatus = workapiv1.ManifestResourceStatus{
+						Manifests: []workapiv1.ManifestCondition{
+							{
+								ResourceMeta: workapiv1.ManifestResourceMeta{
+									Group:     "argoproj.io",
+									Resource:  "workflows",
+									Name:      "test",
+									Namespace: "default",
+								},
+								StatusFeedbacks: workapiv1.StatusFeedbackResult{
+									Values: []workapiv1.FeedbackValue{
+										{
+											Name: "HookStatus",
+											Value: workapiv1.FieldValue{
+												Type:   workapiv1.String,
+												String: pointer.String("Failed"),
+											},
+										},
+									},
+								},
+							},
+						},
+					}
+					return work
+				}(),
+			},
+			validateWorkActions: addontesting.AssertNoActions,
+			validateAddonActions: func(t *testing.T, actions []clienttesting.Action) {
+				addontesting.AssertActions(t, actions, "patch")
+				patch := actions[0].(clienttesting.PatchActionImpl).Patch
+				addOn := &addonapiv1beta1.ManagedClusterAddOn{}
+				err := json.Unmarshal(patch, addOn)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !meta.IsStatusConditionTrue(addOn.Status.Conditions, constants.AddonConditionHookManifestFailed) {
+					t.Errorf("HookManifestFailed condition should be true, but got %v.", addOn.Status.Conditions)
+				}
+			},
+		},
+		{
+			name: "deleting addon with failed hook manifest",
+			key:  "cluster1/test",
+			addon: []runtime.Object{
+				addontesting.SetAddonFinalizers(
+					addontesting.SetAddonDeletionTimestamp(
+						addontesting.NewAddonWithConditions("test", "cluster1", registrationAppliedCondition,
+							metav1.Condition{
+								Type:   constants.AddonConditionHookManifestFailed,
+								Status: metav1.ConditionTrue,
+								Reason: "HookManifestIsFailed",
+							}),
+						time.Now()),
+					addonapiv1beta1.AddonPreDeleteHookFinalizer),
+			},
+			cluster: []runtime.Object{addontesting.NewManagedCluster("cluster1")},
+			testaddon: &testAgent{name: "test", objects: []runtime.Object{
+				addontesting.NewUnstructured("v1", "ConfigMap", "default", "test"),
+				newHookWorkflow()}},
+			existingWork:        []runtime.Object{getDeployWork()},
+			validateWorkActions: addontesting.AssertNoActions,
+			validateAddonActions: func(t *testing.T, actions []clienttesting.Action) {
+				addontesting.AssertActions(t, actions, "update")
+				actual := actions[0].(clienttesting.UpdateActionImpl).Object
+				addOn := actual.(*addonapiv1beta1.ManagedClusterAddOn)
+				if addonHasFinalizer(addOn, addonapiv1beta1.AddonPreDeleteHookFinalizer) {
+					t.Errorf("the preDeleteHookFinalizer should be removed.")
+				}
+			},
+		},
+		{
+			name: "deleting addon with pre-delete hook timeout",
+			key:  "cluster1/test",
+			addon: []runtime.Object{
+				func() runtime.Object {
+					addon := addontesting.NewAddonWithConditions("test", "cluster1", registrationAppliedCondition)
+					addon.SetAnnotations(map[string]string{constants.PreDeleteHookTimeoutAnnotationKey: "10m"})
+					addon.SetFinalizers([]string{addonapiv1beta1.AddonPreDeleteHookFinalizer})
+					addon.DeletionTimestamp = &metav1.Time{Time: time.Now().Add(-time.Hour)}
+					return addon
+				}(),
+			},
+			cluster: []runtime.Object{addontesting.NewManagedCluster("cluster1")},
+			testaddon: &testAgent{name: "test", objects: []runtime.Object{
+				addontesting.NewUnstructured("v1", "ConfigMap", "default", "test"),
+				addontesting.NewHookJob("test", "default")}},
+			existingWork: []runtime.Object{getDeployWork()},
+			validateWorkActions: func(t *testing.T, actions []clienttesting.Action) {
+				addontesting.AssertActions(t, actions, "delete")
+				deleteAction := actions[0].(clienttesting.DeleteActionImpl)
+				if deleteAction.Name != constants.PreDeleteHookWorkName("test") {
+					t.Errorf("expected the hook work is deleted, but got %s", deleteAction.Name)
+				}
+			},
+			validateAddonActions: func(t *testing.T, actions []clienttesting.Action) {
+				addontesting.AssertActions(t, actions, "update")
+				actual := actions[0].(clienttesting.UpdateActionImpl).Object
+				addOn := actual.(*addonapiv1beta1.ManagedClusterAddOn)
+				if addonHasFinalizer(addOn, addonapiv1beta1.AddonPreDeleteHookFinalizer) {
+					t.Errorf("the preDeleteHookFinalizer should be removed.")
+				}
+			},
+		},
 	}
 
 	for _, c := range cases {
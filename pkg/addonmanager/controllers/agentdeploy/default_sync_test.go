@@ -10,6 +10,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	clienttesting "k8s.io/client-go/testing"
 	"k8s.io/client-go/tools/cache"
 	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
@@ -25,6 +26,7 @@ import (
 	workbuilder "open-cluster-management.io/sdk-go/pkg/apis/work/v1/builder"
 
 	"open-cluster-management.io/addon-framework/pkg/addonmanager/addontesting"
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
 	"open-cluster-management.io/addon-framework/pkg/agent"
 	"open-cluster-management.io/addon-framework/pkg/index"
 )
@@ -57,6 +59,11 @@ type testAgent struct {
 	healthProber       *agent.HealthProber
 	ManifestConfigs    []workapiv1.ManifestConfigOption
 	ConfigCheckEnabled bool
+	rolloutStrategy    *agent.RolloutStrategy
+	rollbackOption     *agent.RollbackOption
+	flapDetection      *agent.FlapDetectionOption
+	configGVRs         []schema.GroupVersionResource
+	workAnnotations    map[string]string
 }
 
 func (t *testAgent) Manifests(ctx context.Context, cluster *clusterv1.ManagedCluster, addon *addonapiv1beta1.ManagedClusterAddOn) ([]runtime.Object, error) {
@@ -65,10 +72,18 @@ func (t *testAgent) Manifests(ctx context.Context, cluster *clusterv1.ManagedClu
 
 func (t *testAgent) GetAgentAddonOptions() agent.AgentAddonOptions {
 	return agent.AgentAddonOptions{
-		AddonName:          t.name,
-		HealthProber:       t.healthProber,
-		ManifestConfigs:    t.ManifestConfigs,
-		ConfigCheckEnabled: t.ConfigCheckEnabled,
+		AddonName:           t.name,
+		HealthProber:        t.healthProber,
+		ManifestConfigs:     t.ManifestConfigs,
+		ConfigCheckEnabled:  t.ConfigCheckEnabled,
+		RolloutStrategy:     t.rolloutStrategy,
+		RollbackOption:      t.rollbackOption,
+		FlapDetection:       t.flapDetection,
+		SupportedConfigGVRs: t.configGVRs,
+		ManifestWorkAnnotations: func(context.Context, *clusterv1.ManagedCluster,
+			*addonapiv1beta1.ManagedClusterAddOn) (map[string]string, error) {
+			return t.workAnnotations, nil
+		},
 	}
 }
 
@@ -255,6 +270,63 @@ func TestDefaultReconcile(t *testing.T) {
 				}
 			},
 		},
+		{
+			name:    "get render error when run manifest from agent",
+			key:     "cluster1/test",
+			addon:   []runtime.Object{addontesting.NewAddonWithConditions("test", "cluster1", registrationAppliedCondition)},
+			cluster: []runtime.Object{addontesting.NewManagedCluster("cluster1")},
+			testaddon: &testAgent{
+				name: "test",
+				err: &agent.ManifestsRenderError{
+					Reason: constants.ManifestsRenderedReasonValuesSchemaInvalid,
+					Err:    fmt.Errorf("replicas: must be >= 1"),
+				},
+			},
+			validateWorkActions: addontesting.AssertNoActions,
+			validateAddonActions: func(t *testing.T, actions []clienttesting.Action) {
+				addontesting.AssertActions(t, actions, "patch")
+				patch := actions[0].(clienttesting.PatchActionImpl).Patch
+				addOn := &addonapiv1beta1.ManagedClusterAddOn{}
+				err := json.Unmarshal(patch, addOn)
+				if err != nil {
+					t.Fatal(err)
+				}
+				cond := meta.FindStatusCondition(addOn.Status.Conditions, constants.AddonConditionManifestsRendered)
+				if cond == nil || cond.Status != metav1.ConditionFalse ||
+					cond.Reason != constants.ManifestsRenderedReasonValuesSchemaInvalid {
+					t.Errorf("Condition is not correct: %v", addOn.Status.Conditions)
+				}
+			},
+		},
+		{
+			name: "reset rendered condition when manifests are rendered",
+			key:  "cluster1/test",
+			addon: []runtime.Object{addontesting.NewAddonWithConditions("test", "cluster1", registrationAppliedCondition,
+				metav1.Condition{
+					Type:   constants.AddonConditionManifestsRendered,
+					Status: metav1.ConditionFalse,
+					Reason: constants.ManifestsRenderedReasonValuesSchemaInvalid,
+				})},
+			cluster: []runtime.Object{addontesting.NewManagedCluster("cluster1")},
+			testaddon: &testAgent{name: "test", objects: []runtime.Object{
+				addontesting.NewUnstructured("v1", "ConfigMap", "default", "test"),
+			}},
+			validateWorkActions: func(t *testing.T, actions []clienttesting.Action) {
+				addontesting.AssertActions(t, actions, "create")
+			},
+			validateAddonActions: func(t *testing.T, actions []clienttesting.Action) {
+				addontesting.AssertActions(t, actions, "patch")
+				patch := actions[0].(clienttesting.PatchActionImpl).Patch
+				addOn := &addonapiv1beta1.ManagedClusterAddOn{}
+				err := json.Unmarshal(patch, addOn)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !meta.IsStatusConditionTrue(addOn.Status.Conditions, constants.AddonConditionManifestsRendered) {
+					t.Errorf("Condition is not correct: %v", addOn.Status.Conditions)
+				}
+			},
+		},
 		{
 			name:    "deploy manifests for an addon when ConfigCheckEnabled is true",
 			key:     "cluster1/test",
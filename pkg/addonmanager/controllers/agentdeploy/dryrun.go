@@ -0,0 +1,248 @@
+package agentdeploy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/klog/v2"
+
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+	workapiv1 "open-cluster-management.io/api/work/v1"
+	workapplier "open-cluster-management.io/sdk-go/pkg/apis/work/v1/applier"
+
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
+	"open-cluster-management.io/addon-framework/pkg/utils"
+)
+
+// ManifestWorkOperation is the operation the addon deploy controller would do on a manifestWork.
+type ManifestWorkOperation string
+
+const (
+	ManifestWorkOperationCreate    ManifestWorkOperation = "Create"
+	ManifestWorkOperationUpdate    ManifestWorkOperation = "Update"
+	ManifestWorkOperationUnchanged ManifestWorkOperation = "Unchanged"
+	ManifestWorkOperationDelete    ManifestWorkOperation = "Delete"
+)
+
+// dryRunConditionTypes are the conditions of the addon which represent the result of applying the
+// manifestWorks, they are left untouched in dry-run mode since the manifestWorks are not applied.
+var dryRunConditionTypes = []string{
+	addonapiv1beta1.ManagedClusterAddOnManifestApplied,
+	addonapiv1beta1.ManagedClusterAddOnHostingManifestApplied,
+	constants.AddonConditionRollout,
+	constants.AddonConditionRolledBack,
+}
+
+const (
+	// the max length of the patch recorded in the addon annotation, the full patch is only logged.
+	maxDryRunPatchLength = 4096
+
+	// the patch of the work with the SensitiveDataAnnotationKey annotation is replaced by redactedPatch.
+	redactedPatch = "<redacted>"
+)
+
+// ManifestWorkDiff is the diff between the desired manifestWork and the existing manifestWork computed
+// in dry-run mode.
+type ManifestWorkDiff struct {
+	// Operation is the operation that would be done on the manifestWork.
+	Operation ManifestWorkOperation `json:"operation"`
+
+	// SpecHash is the hash of the desired manifestWork spec.
+	SpecHash string `json:"specHash,omitempty"`
+
+	// ExistingSpecHash is the hash of the existing manifestWork spec, it is empty if the work does not exist.
+	ExistingSpecHash string `json:"existingSpecHash,omitempty"`
+
+	// Patch is the json merge patch that would be applied on the existing manifestWork.
+	Patch string `json:"patch,omitempty"`
+
+	// PatchTruncated is true if the patch is too long and truncated.
+	PatchTruncated bool `json:"patchTruncated,omitempty"`
+}
+
+// DiffManifestWork computes the diff between the desired work and the existing work in the same way as the
+// work applier. The existing work is nil if it does not exist.
+func DiffManifestWork(work, existingWork *workapiv1.ManifestWork) (*ManifestWorkDiff, error) {
+	specHash, err := getWorkSpecHash(work)
+	if err != nil {
+		return nil, err
+	}
+	diff := &ManifestWorkDiff{SpecHash: specHash}
+
+	if existingWork == nil {
+		diff.Operation = ManifestWorkOperationCreate
+		return diff, nil
+	}
+
+	diff.ExistingSpecHash, err = getWorkSpecHash(existingWork)
+	if err != nil {
+		return nil, err
+	}
+
+	if workapplier.ManifestWorkEqual(work, existingWork) {
+		diff.Operation = ManifestWorkOperationUnchanged
+		return diff, nil
+	}
+
+	oldData, err := json.Marshal(&workapiv1.ManifestWork{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:          existingWork.Labels,
+			Annotations:     existingWork.Annotations,
+			OwnerReferences: existingWork.OwnerReferences,
+		},
+		Spec: existingWork.Spec,
+	})
+	if err != nil {
+		return nil, err
+	}
+	newData, err := json.Marshal(&workapiv1.ManifestWork{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:          work.Labels,
+			Annotations:     work.Annotations,
+			OwnerReferences: work.OwnerReferences,
+		},
+		Spec: work.Spec,
+	})
+	if err != nil {
+		return nil, err
+	}
+	patch, err := jsonpatch.CreateMergePatch(oldData, newData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create patch for work %s/%s: %w", work.Namespace, work.Name, err)
+	}
+
+	diff.Operation = ManifestWorkOperationUpdate
+	diff.Patch = string(patch)
+	return diff, nil
+}
+
+func getWorkSpecHash(work *workapiv1.ManifestWork) (string, error) {
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(work)
+	if err != nil {
+		return "", err
+	}
+	return utils.GetSpecHash(&unstructured.Unstructured{Object: obj})
+}
+
+// dryRunApplyWork computes the diff of the work instead of applying it, the diff is logged and recorded
+// in the DryRunDiffAnnotationKey annotation of the addon. It returns the existing work, or the desired work
+// if the work does not exist, so the syncers can continue to check the work status.
+func (c *addonDeployController) dryRunApplyWork(ctx context.Context, appliedType string,
+	work *workapiv1.ManifestWork, addon *addonapiv1beta1.ManagedClusterAddOn) (*workapiv1.ManifestWork, error) {
+	existingWork, err := c.workLister.ManifestWorks(work.Namespace).Get(work.Name)
+	switch {
+	case errors.IsNotFound(err):
+		existingWork = nil
+	case err != nil:
+		return nil, err
+	}
+
+	diff, err := DiffManifestWork(work, existingWork)
+	if err != nil {
+		return nil, err
+	}
+	// the patch of the work with the sensitive data, e.g. the values from the Secrets, is not logged or recorded.
+	if _, ok := work.Annotations[constants.SensitiveDataAnnotationKey]; ok && len(diff.Patch) > 0 {
+		diff.Patch = redactedPatch
+	}
+
+	klog.InfoS("Dry run to apply addon manifestWork", "addonNamespace", addon.Namespace, "addonName", addon.Name,
+		"workNamespace", work.Namespace, "workName", work.Name, "operation", diff.Operation, "patch", diff.Patch)
+
+	if err := setDryRunDiff(addon, work.Namespace, work.Name, diff); err != nil {
+		return nil, err
+	}
+
+	if existingWork == nil {
+		return work, nil
+	}
+	return existingWork, nil
+}
+
+// dryRunDeleteWork records the work to delete in the DryRunDiffAnnotationKey annotation of the addon instead of
+// deleting it, nothing is recorded if the work does not exist.
+func (c *addonDeployController) dryRunDeleteWork(ctx context.Context, addon *addonapiv1beta1.ManagedClusterAddOn,
+	workNamespace, workName string) error {
+	existingWork, err := c.workLister.ManifestWorks(workNamespace).Get(workName)
+	switch {
+	case errors.IsNotFound(err):
+		return nil
+	case err != nil:
+		return err
+	}
+
+	existingSpecHash, err := getWorkSpecHash(existingWork)
+	if err != nil {
+		return err
+	}
+
+	klog.InfoS("Dry run to delete addon manifestWork", "addonNamespace", addon.Namespace, "addonName", addon.Name,
+		"workNamespace", workNamespace, "workName", workName)
+
+	return setDryRunDiff(addon, workNamespace, workName, &ManifestWorkDiff{
+		Operation:        ManifestWorkOperationDelete,
+		ExistingSpecHash: existingSpecHash,
+	})
+}
+
+// keepDryRunConditions resets the conditions of dryRunConditionTypes to the ones of the old addon.
+func keepDryRunConditions(addon, oldAddon *addonapiv1beta1.ManagedClusterAddOn) {
+	for _, conditionType := range dryRunConditionTypes {
+		if condition := meta.FindStatusCondition(oldAddon.Status.Conditions, conditionType); condition != nil {
+			meta.SetStatusCondition(&addon.Status.Conditions, *condition)
+			continue
+		}
+		meta.RemoveStatusCondition(&addon.Status.Conditions, conditionType)
+	}
+}
+
+// keepDryRunFinalizers drops the finalizers added by the syncers. In dry-run mode the hook and the hosting
+// manifestWorks are never applied, so the finalizers would block the deletion of the addon forever. The
+// finalizers added before the dry-run mode are still removed to let the addon be deleted.
+func keepDryRunFinalizers(addon, oldAddon *addonapiv1beta1.ManagedClusterAddOn) {
+	var finalizers []string
+	for _, f := range addon.Finalizers {
+		if addonHasFinalizer(oldAddon, f) {
+			finalizers = append(finalizers, f)
+		}
+	}
+	if len(finalizers) != len(addon.Finalizers) {
+		addon.SetFinalizers(finalizers)
+	}
+}
+
+func setDryRunDiff(addon *addonapiv1beta1.ManagedClusterAddOn, workNamespace, workName string,
+	diff *ManifestWorkDiff) error {
+	diffs := map[string]*ManifestWorkDiff{}
+	if data, ok := addon.Annotations[constants.DryRunDiffAnnotationKey]; ok {
+		if err := json.Unmarshal([]byte(data), &diffs); err != nil {
+			klog.Warningf("failed to unmarshal the dry run diff of addon %s/%s, override it: %v",
+				addon.Namespace, addon.Name, err)
+			diffs = map[string]*ManifestWorkDiff{}
+		}
+	}
+
+	recorded := *diff
+	if len(recorded.Patch) > maxDryRunPatchLength {
+		recorded.Patch = recorded.Patch[:maxDryRunPatchLength]
+		recorded.PatchTruncated = true
+	}
+	diffs[fmt.Sprintf("%s/%s", workNamespace, workName)] = &recorded
+
+	data, err := json.Marshal(diffs)
+	if err != nil {
+		return err
+	}
+	if addon.Annotations == nil {
+		addon.Annotations = map[string]string{}
+	}
+	addon.Annotations[constants.DryRunDiffAnnotationKey] = string(data)
+	return nil
+}
@@ -0,0 +1,382 @@
+package agentdeploy
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+	fakeaddon "open-cluster-management.io/api/client/addon/clientset/versioned/fake"
+	addoninformers "open-cluster-management.io/api/client/addon/informers/externalversions"
+	fakecluster "open-cluster-management.io/api/client/cluster/clientset/versioned/fake"
+	clusterv1informers "open-cluster-management.io/api/client/cluster/informers/externalversions"
+	fakework "open-cluster-management.io/api/client/work/clientset/versioned/fake"
+	workinformers "open-cluster-management.io/api/client/work/informers/externalversions"
+	workapiv1 "open-cluster-management.io/api/work/v1"
+	workapplier "open-cluster-management.io/sdk-go/pkg/apis/work/v1/applier"
+	workbuilder "open-cluster-management.io/sdk-go/pkg/apis/work/v1/builder"
+
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/addontesting"
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
+	"open-cluster-management.io/addon-framework/pkg/agent"
+	"open-cluster-management.io/addon-framework/pkg/index"
+)
+
+func TestDiffManifestWork(t *testing.T) {
+	work := addontesting.NewManifestWork("test", "cluster1",
+		addontesting.NewUnstructured("v1", "ConfigMap", "default", "test"))
+
+	cases := []struct {
+		name              string
+		existingWork      *workapiv1.ManifestWork
+		expectedOperation ManifestWorkOperation
+		expectPatch       bool
+	}{
+		{
+			name:              "work not exist",
+			expectedOperation: ManifestWorkOperationCreate,
+		},
+		{
+			name:              "work unchanged",
+			existingWork:      work.DeepCopy(),
+			expectedOperation: ManifestWorkOperationUnchanged,
+		},
+		{
+			name: "work changed",
+			existingWork: addontesting.NewManifestWork("test", "cluster1",
+				addontesting.NewUnstructured("v1", "ConfigMap", "default", "test1")),
+			expectedOperation: ManifestWorkOperationUpdate,
+			expectPatch:       true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			diff, err := DiffManifestWork(work, c.existingWork)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff.Operation != c.expectedOperation {
+				t.Errorf("expected operation %s, but got %s", c.expectedOperation, diff.Operation)
+			}
+			if len(diff.SpecHash) == 0 {
+				t.Errorf("expected spec hash is set")
+			}
+			if c.existingWork != nil && len(diff.ExistingSpecHash) == 0 {
+				t.Errorf("expected existing spec hash is set")
+			}
+			if c.expectPatch != (len(diff.Patch) != 0) {
+				t.Errorf("expected patch %v, but got %q", c.expectPatch, diff.Patch)
+			}
+		})
+	}
+}
+
+func TestDryRunReconcile(t *testing.T) {
+	cases := []struct {
+		name               string
+		existingWork       []runtime.Object
+		hookObjects        []runtime.Object
+		workAnnotations    map[string]string
+		expectedOperations map[string]ManifestWorkOperation
+		expectedPatch      string
+	}{
+		{
+			name: "deploy work not exist",
+			expectedOperations: map[string]ManifestWorkOperation{
+				"cluster1/addon-test-deploy-0": ManifestWorkOperationCreate,
+			},
+		},
+		{
+			name: "deploy work changed",
+			existingWork: []runtime.Object{func() *workapiv1.ManifestWork {
+				work := addontesting.NewManifestWork("addon-test-deploy-0", "cluster1",
+					addontesting.NewUnstructured("v1", "ConfigMap", "default", "test1"))
+				work.SetLabels(map[string]string{addonapiv1beta1.AddonLabelKey: "test"})
+				return work
+			}()},
+			expectedOperations: map[string]ManifestWorkOperation{
+				"cluster1/addon-test-deploy-0": ManifestWorkOperationUpdate,
+			},
+		},
+		{
+			name: "stale deploy work deleted",
+			existingWork: []runtime.Object{
+				func() *workapiv1.ManifestWork {
+					work := addontesting.NewManifestWork("addon-test-deploy-0", "cluster1",
+						addontesting.NewUnstructured("v1", "ConfigMap", "default", "test"))
+					work.SetLabels(map[string]string{addonapiv1beta1.AddonLabelKey: "test"})
+					return work
+				}(),
+				func() *workapiv1.ManifestWork {
+					work := addontesting.NewManifestWork("addon-test-deploy-1", "cluster1",
+						addontesting.NewUnstructured("v1", "ConfigMap", "default", "test1"))
+					work.SetLabels(map[string]string{addonapiv1beta1.AddonLabelKey: "test"})
+					return work
+				}(),
+			},
+			expectedOperations: map[string]ManifestWorkOperation{
+				"cluster1/addon-test-deploy-0": ManifestWorkOperationUpdate,
+				"cluster1/addon-test-deploy-1": ManifestWorkOperationDelete,
+			},
+		},
+		{
+			name: "deploy work changed with pre-upgrade hook",
+			existingWork: []runtime.Object{func() *workapiv1.ManifestWork {
+				work := addontesting.NewManifestWork("addon-test-deploy-0", "cluster1",
+					addontesting.NewUnstructured("v1", "ConfigMap", "default", "test1"))
+				work.SetLabels(map[string]string{addonapiv1beta1.AddonLabelKey: "test"})
+				work.SetAnnotations(map[string]string{constants.ManifestsHashAnnotationKey: "old"})
+				return work
+			}()},
+			hookObjects: []runtime.Object{
+				newLifecycleHookJob("pre-upgrade", constants.AddonPreUpgradeHookAnnotationKey),
+			},
+			expectedOperations: map[string]ManifestWorkOperation{
+				"cluster1/addon-test-deploy-0":                         ManifestWorkOperationUpdate,
+				"cluster1/" + constants.PreUpgradeHookWorkName("test"): ManifestWorkOperationCreate,
+			},
+		},
+		{
+			name: "deploy work with sensitive data changed",
+			existingWork: []runtime.Object{func() *workapiv1.ManifestWork {
+				work := addontesting.NewManifestWork("addon-test-deploy-0", "cluster1",
+					addontesting.NewUnstructured("v1", "ConfigMap", "default", "test1"))
+				work.SetLabels(map[string]string{addonapiv1beta1.AddonLabelKey: "test"})
+				return work
+			}()},
+			workAnnotations: map[string]string{constants.SensitiveDataAnnotationKey: "true"},
+			expectedOperations: map[string]ManifestWorkOperation{
+				"cluster1/addon-test-deploy-0": ManifestWorkOperationUpdate,
+			},
+			expectedPatch: redactedPatch,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			addon := addontesting.NewAddonWithConditions("test", "cluster1", registrationAppliedCondition)
+			testAddon := &testAgent{name: "test", objects: append([]runtime.Object{
+				addontesting.NewUnstructured("v1", "ConfigMap", "default", "test"),
+			}, c.hookObjects...), workAnnotations: c.workAnnotations}
+
+			fakeWorkClient := fakework.NewSimpleClientset(c.existingWork...)
+			fakeClusterClient := fakecluster.NewSimpleClientset(addontesting.NewManagedCluster("cluster1"))
+			fakeAddonClient := fakeaddon.NewSimpleClientset(addon)
+
+			workInformerFactory := workinformers.NewSharedInformerFactory(fakeWorkClient, 10*time.Minute)
+			addonInformers := addoninformers.NewSharedInformerFactory(fakeAddonClient, 10*time.Minute)
+			clusterInformers := clusterv1informers.NewSharedInformerFactory(fakeClusterClient, 10*time.Minute)
+
+			err := workInformerFactory.Work().V1().ManifestWorks().Informer().AddIndexers(
+				cache.Indexers{
+					index.ManifestWorkByAddon:           index.IndexManifestWorkByAddon,
+					index.ManifestWorkByHostedAddon:     index.IndexManifestWorkByHostedAddon,
+					index.ManifestWorkHookByHostedAddon: index.IndexManifestWorkHookByHostedAddon,
+				},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := clusterInformers.Cluster().V1().ManagedClusters().Informer().GetStore().Add(
+				addontesting.NewManagedCluster("cluster1")); err != nil {
+				t.Fatal(err)
+			}
+			if err := addonInformers.Addon().V1beta1().ManagedClusterAddOns().Informer().GetStore().Add(addon); err != nil {
+				t.Fatal(err)
+			}
+			for _, obj := range c.existingWork {
+				if err := workInformerFactory.Work().V1().ManifestWorks().Informer().GetStore().Add(obj); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			controller := addonDeployController{
+				workApplier:               workapplier.NewWorkApplierWithTypedClient(fakeWorkClient, workInformerFactory.Work().V1().ManifestWorks().Lister()),
+				workBuilder:               workbuilder.NewWorkBuilder(),
+				addonClient:               fakeAddonClient,
+				managedClusterLister:      clusterInformers.Cluster().V1().ManagedClusters().Lister(),
+				managedClusterAddonLister: addonInformers.Addon().V1beta1().ManagedClusterAddOns().Lister(),
+				workIndexer:               workInformerFactory.Work().V1().ManifestWorks().Informer().GetIndexer(),
+				workLister:                workInformerFactory.Work().V1().ManifestWorks().Lister(),
+				agentAddons:               map[string]agent.AgentAddon{testAddon.name: testAddon},
+				dryRun:                    true,
+			}
+
+			syncContext := addontesting.NewFakeSyncContext(t)
+			if err := controller.sync(context.TODO(), syncContext, "cluster1/test"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			addontesting.AssertNoActions(t, fakeWorkClient.Actions())
+
+			var annotationPatch []byte
+			for _, action := range fakeAddonClient.Actions() {
+				patchAction, ok := action.(clienttesting.PatchActionImpl)
+				if !ok {
+					continue
+				}
+				if patchAction.GetSubresource() == "" {
+					annotationPatch = patchAction.Patch
+					continue
+				}
+				// the conditions of applying the works are not set since the works are not applied.
+				statusAddon := &addonapiv1beta1.ManagedClusterAddOn{}
+				if err := json.Unmarshal(patchAction.Patch, statusAddon); err != nil {
+					t.Fatal(err)
+				}
+				if cond := meta.FindStatusCondition(statusAddon.Status.Conditions,
+					addonapiv1beta1.ManagedClusterAddOnManifestApplied); cond != nil {
+					t.Errorf("expected no ManifestApplied condition in dry-run mode, but got %v", cond)
+				}
+			}
+			if annotationPatch == nil {
+				t.Fatalf("expected the annotations of the addon are patched, but got %v", fakeAddonClient.Actions())
+			}
+
+			patchedAddon := &addonapiv1beta1.ManagedClusterAddOn{}
+			if err := json.Unmarshal(annotationPatch, patchedAddon); err != nil {
+				t.Fatal(err)
+			}
+			diffs := map[string]*ManifestWorkDiff{}
+			if err := json.Unmarshal([]byte(patchedAddon.Annotations[constants.DryRunDiffAnnotationKey]), &diffs); err != nil {
+				t.Fatal(err)
+			}
+			if len(diffs) != len(c.expectedOperations) {
+				t.Errorf("expected diffs %v, but got %v", c.expectedOperations, diffs)
+			}
+			for key, operation := range c.expectedOperations {
+				if diffs[key] == nil || diffs[key].Operation != operation {
+					t.Errorf("expected operation %s of work %s, but got %v", operation, key, diffs[key])
+				}
+				if len(c.expectedPatch) > 0 && diffs[key] != nil && diffs[key].Patch != c.expectedPatch {
+					t.Errorf("expected patch %q of work %s, but got %q", c.expectedPatch, key, diffs[key].Patch)
+				}
+			}
+		})
+	}
+}
+
+func TestDryRunSideEffects(t *testing.T) {
+	appliedWork := func() *workapiv1.ManifestWork {
+		work := addontesting.NewManifestWork("addon-test-deploy-0", "cluster1",
+			addontesting.NewUnstructured("v1", "ConfigMap", "default", "test"))
+		work.SetLabels(map[string]string{addonapiv1beta1.AddonLabelKey: "test"})
+		work.SetAnnotations(map[string]string{constants.WorkSpecHashAnnotationKey: "good"})
+		work.Generation = 1
+		work.Status.Conditions = []metav1.Condition{
+			{Type: workapiv1.WorkApplied, Status: metav1.ConditionTrue, ObservedGeneration: 1},
+		}
+		return work
+	}
+
+	cases := []struct {
+		name         string
+		objects      []runtime.Object
+		existingWork []runtime.Object
+		secrets      []runtime.Object
+		rollback     bool
+	}{
+		{
+			name:    "rolled back spec is not applied",
+			objects: []runtime.Object{addontesting.NewUnstructured("v1", "ConfigMap", "default", "test")},
+			secrets: []runtime.Object{newLastKnownGoodSecret(map[string]string{
+				"hash":        "good",
+				"rolled-back": "bad",
+			})},
+			rollback: true,
+		},
+		{
+			name:         "last known good spec is not recorded",
+			objects:      []runtime.Object{addontesting.NewUnstructured("v1", "ConfigMap", "default", "test")},
+			existingWork: []runtime.Object{appliedWork()},
+			rollback:     true,
+		},
+		{
+			name: "pre-delete hook finalizer is not added",
+			objects: []runtime.Object{
+				addontesting.NewUnstructured("v1", "ConfigMap", "default", "test"),
+				newHookWorkflow(),
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			addon := addontesting.NewAddonWithConditions("test", "cluster1", registrationAppliedCondition,
+				metav1.Condition{
+					Type:   addonapiv1beta1.ManagedClusterAddOnConditionAvailable,
+					Status: metav1.ConditionTrue,
+					Reason: "test",
+				})
+			testAddon := &testAgent{name: "test", objects: c.objects}
+			if c.rollback {
+				testAddon.rollbackOption = &agent.RollbackOption{}
+			}
+
+			fakeWorkClient := fakework.NewSimpleClientset(c.existingWork...)
+			fakeAddonClient := fakeaddon.NewSimpleClientset(addon)
+			workInformerFactory := workinformers.NewSharedInformerFactory(fakeWorkClient, 10*time.Minute)
+			addonInformers := addoninformers.NewSharedInformerFactory(fakeAddonClient, 10*time.Minute)
+			clusterInformers := clusterv1informers.NewSharedInformerFactory(
+				fakecluster.NewSimpleClientset(), 10*time.Minute)
+
+			err := workInformerFactory.Work().V1().ManifestWorks().Informer().AddIndexers(
+				cache.Indexers{
+					index.ManifestWorkByAddon:           index.IndexManifestWorkByAddon,
+					index.ManifestWorkByHostedAddon:     index.IndexManifestWorkByHostedAddon,
+					index.ManifestWorkHookByHostedAddon: index.IndexManifestWorkHookByHostedAddon,
+				},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := clusterInformers.Cluster().V1().ManagedClusters().Informer().GetStore().Add(
+				addontesting.NewManagedCluster("cluster1")); err != nil {
+				t.Fatal(err)
+			}
+			if err := addonInformers.Addon().V1beta1().ManagedClusterAddOns().Informer().GetStore().Add(addon); err != nil {
+				t.Fatal(err)
+			}
+			for _, obj := range c.existingWork {
+				if err := workInformerFactory.Work().V1().ManifestWorks().Informer().GetStore().Add(obj); err != nil {
+					t.Fatal(err)
+				}
+			}
+			store, kubeClient := newTestRollbackStore(t, c.secrets...)
+
+			controller := addonDeployController{
+				workApplier:               workapplier.NewWorkApplierWithTypedClient(fakeWorkClient, workInformerFactory.Work().V1().ManifestWorks().Lister()),
+				workBuilder:               workbuilder.NewWorkBuilder(),
+				addonClient:               fakeAddonClient,
+				managedClusterLister:      clusterInformers.Cluster().V1().ManagedClusters().Lister(),
+				managedClusterAddonLister: addonInformers.Addon().V1beta1().ManagedClusterAddOns().Lister(),
+				workIndexer:               workInformerFactory.Work().V1().ManifestWorks().Informer().GetIndexer(),
+				workLister:                workInformerFactory.Work().V1().ManifestWorks().Lister(),
+				rollbackStore:             store,
+				agentAddons:               map[string]agent.AgentAddon{testAddon.name: testAddon},
+				dryRun:                    true,
+			}
+
+			syncContext := addontesting.NewFakeSyncContext(t)
+			if err := controller.sync(context.TODO(), syncContext, "cluster1/test"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			addontesting.AssertNoActions(t, fakeWorkClient.Actions())
+			addontesting.AssertNoActions(t, kubeClient.Actions())
+			for _, action := range fakeAddonClient.Actions() {
+				if action.GetVerb() == "update" {
+					t.Errorf("expected the finalizers of the addon are not updated, but got %v", action)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package agentdeploy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	"open-cluster-management.io/sdk-go/pkg/basecontroller/factory"
+
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
+	"open-cluster-management.io/addon-framework/pkg/agent"
+)
+
+const (
+	defaultFlapTransitions  = 4
+	defaultFlapWindow       = 10 * time.Minute
+	defaultFlapHistoryLimit = 10
+)
+
+// availableTransition is a transition of the Available condition of the addon recorded in the
+// HealthHistoryAnnotationKey annotation.
+type availableTransition struct {
+	Status metav1.ConditionStatus `json:"status"`
+	Reason string                 `json:"reason,omitempty"`
+	Time   metav1.Time            `json:"time"`
+}
+
+// healthHistoryRecorder records the transitions of the Available condition of the addons observed by the addon
+// informer, since several updates of the addon may be coalesced into one reconcile.
+type healthHistoryRecorder struct {
+	lock        sync.Mutex
+	transitions map[string][]availableTransition
+}
+
+func newHealthHistoryRecorder() *healthHistoryRecorder {
+	return &healthHistoryRecorder{transitions: map[string][]availableTransition{}}
+}
+
+// record records the transition of the addon with the key, at most limit transitions are kept for each addon.
+func (r *healthHistoryRecorder) record(key string, transition availableTransition, limit int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	transitions := append(r.transitions[key], transition)
+	if len(transitions) > limit {
+		transitions = transitions[len(transitions)-limit:]
+	}
+	r.transitions[key] = transitions
+}
+
+// get returns the recorded transitions of the addon with the key. The transitions are not removed once they
+// are returned, since the history may fail to be saved, and they are skipped by the syncer once they are saved.
+func (r *healthHistoryRecorder) get(key string) []availableTransition {
+	if r == nil {
+		return nil
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]availableTransition{}, r.transitions[key]...)
+}
+
+func (r *healthHistoryRecorder) forget(key string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.transitions, key)
+}
+
+// healthHistorySyncer records the transitions of the Available condition of the addon, and sets the Flapping
+// condition of the addon. It runs after the healthCheckSyncer, so the transitions set by the work based health
+// probers are recorded in the same reconcile. The transitions set by others, e.g. the lease prober of the
+// registration agent, are recorded by the recorder once the addon is updated. A transition which is neither
+// reconciled nor observed by the recorder is derived from the change of the LastTransitionTime.
+type healthHistorySyncer struct {
+	agentAddon agent.AgentAddon
+	recorder   *healthHistoryRecorder
+}
+
+func (s *healthHistorySyncer) sync(ctx context.Context,
+	syncCtx factory.SyncContext,
+	cluster *clusterv1.ManagedCluster,
+	addon *addonapiv1beta1.ManagedClusterAddOn) (*addonapiv1beta1.ManagedClusterAddOn, error) {
+	option := s.agentAddon.GetAgentAddonOptions().FlapDetection
+	if option == nil {
+		return addon, nil
+	}
+
+	available := meta.FindStatusCondition(addon.Status.Conditions, addonapiv1beta1.ManagedClusterAddOnConditionAvailable)
+	if available == nil {
+		return addon, nil
+	}
+
+	transitions, window, historyLimit := flapDetectionDefaults(option)
+
+	history := getHealthHistory(addon)
+	recorded := len(history)
+	observed := append(s.recorder.get(fmt.Sprintf("%s/%s", addon.Namespace, addon.Name)), availableTransition{
+		Status: available.Status,
+		Reason: available.Reason,
+		Time:   available.LastTransitionTime,
+	})
+	for _, transition := range observed {
+		history = appendTransition(history, transition)
+	}
+	if len(history) != recorded {
+		if len(history) > historyLimit {
+			history = history[len(history)-historyLimit:]
+		}
+		if err := setHealthHistory(addon, history); err != nil {
+			return addon, err
+		}
+	}
+
+	// the first record in the history is not counted since its previous status is unknown.
+	now := time.Now()
+	count := 0
+	var earliest time.Time
+	for i := 1; i < len(history); i++ {
+		if history[i].Time.Add(window).After(now) {
+			if count == 0 {
+				earliest = history[i].Time.Time
+			}
+			count++
+		}
+	}
+
+	if count < transitions {
+		meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
+			Type:    constants.AddonConditionFlapping,
+			Status:  metav1.ConditionFalse,
+			Reason:  constants.FlappingReasonStable,
+			Message: fmt.Sprintf("The Available condition changed %d times in the last %s", count, window),
+		})
+		return addon, nil
+	}
+
+	message := fmt.Sprintf("The Available condition changed %d times in the last %s", count, window)
+	if !meta.IsStatusConditionTrue(addon.Status.Conditions, constants.AddonConditionFlapping) {
+		syncCtx.Recorder().Warningf(ctx, "AddonFlapping", "The addon %s/%s is flapping: %s",
+			addon.Namespace, addon.Name, message)
+	}
+	meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
+		Type:    constants.AddonConditionFlapping,
+		Status:  metav1.ConditionTrue,
+		Reason:  constants.FlappingReasonFlapping,
+		Message: message,
+	})
+	// requeue the addon when the earliest transition in the window expires, so the Flapping condition is
+	// reset if the addon becomes stable.
+	syncCtx.Queue().AddAfter(fmt.Sprintf("%s/%s", addon.Namespace, addon.Name), time.Until(earliest.Add(window)))
+	return addon, nil
+}
+
+// appendTransition appends the transition to the history if it is newer than the last record of the history.
+// The history is recorded with the precision of seconds. If the status of the transition is the same as the
+// last record but the transition time is changed, the status is changed and then changed back, so the missed
+// transition is recorded at the same time. The missed transition is not recorded if the last status is Unknown,
+// since the missed status can not be known.
+func appendTransition(history []availableTransition, transition availableTransition) []availableTransition {
+	if len(history) == 0 {
+		return append(history, transition)
+	}
+	last := history[len(history)-1]
+	switch {
+	case transition.Time.Unix() < last.Time.Unix():
+		return history
+	case transition.Status != last.Status:
+		return append(history, transition)
+	case transition.Time.Unix() == last.Time.Unix():
+		return history
+	case last.Status == metav1.ConditionTrue:
+		return append(history, availableTransition{Status: metav1.ConditionFalse, Time: transition.Time}, transition)
+	case last.Status == metav1.ConditionFalse:
+		return append(history, availableTransition{Status: metav1.ConditionTrue, Time: transition.Time}, transition)
+	default:
+		return append(history, transition)
+	}
+}
+
+func flapDetectionDefaults(option *agent.FlapDetectionOption) (transitions int, window time.Duration, historyLimit int) {
+	transitions, window, historyLimit = option.Transitions, option.Window, option.HistoryLimit
+	if transitions <= 0 {
+		transitions = defaultFlapTransitions
+	}
+	if window <= 0 {
+		window = defaultFlapWindow
+	}
+	if historyLimit <= 0 {
+		historyLimit = defaultFlapHistoryLimit
+	}
+	// the first record is not a transition, so one more record is kept to count the transitions.
+	if historyLimit <= transitions {
+		historyLimit = transitions + 1
+	}
+	return transitions, window, historyLimit
+}
+
+func getHealthHistory(addon *addonapiv1beta1.ManagedClusterAddOn) []availableTransition {
+	data, ok := addon.Annotations[constants.HealthHistoryAnnotationKey]
+	if !ok {
+		return nil
+	}
+	var history []availableTransition
+	if err := json.Unmarshal([]byte(data), &history); err != nil {
+		klog.Warningf("failed to unmarshal the health history of addon %s/%s, override it: %v",
+			addon.Namespace, addon.Name, err)
+		return nil
+	}
+	return history
+}
+
+func setHealthHistory(addon *addonapiv1beta1.ManagedClusterAddOn, history []availableTransition) error {
+	data, err := json.Marshal(history)
+	if err != nil {
+		return err
+	}
+	if addon.Annotations == nil {
+		addon.Annotations = map[string]string{}
+	}
+	addon.Annotations[constants.HealthHistoryAnnotationKey] = string(data)
+	return nil
+}
@@ -0,0 +1,153 @@
+package agentdeploy
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/addontesting"
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
+	"open-cluster-management.io/addon-framework/pkg/agent"
+)
+
+func TestHealthHistorySync(t *testing.T) {
+	now := time.Now()
+	newHistory := func(ages ...time.Duration) []availableTransition {
+		var history []availableTransition
+		status := metav1.ConditionTrue
+		for _, age := range ages {
+			history = append(history, availableTransition{Status: status, Time: metav1.NewTime(now.Add(-age))})
+			if status == metav1.ConditionTrue {
+				status = metav1.ConditionFalse
+			} else {
+				status = metav1.ConditionTrue
+			}
+		}
+		return history
+	}
+	newAddon := func(status metav1.ConditionStatus, age time.Duration,
+		history []availableTransition) *addonapiv1beta1.ManagedClusterAddOn {
+		addon := addontesting.NewAddonWithConditions("test", "cluster1", metav1.Condition{
+			Type:               addonapiv1beta1.ManagedClusterAddOnConditionAvailable,
+			Status:             status,
+			Reason:             addonapiv1beta1.AddonAvailableReasonProbeAvailable,
+			LastTransitionTime: metav1.NewTime(now.Add(-age)),
+		})
+		if history != nil {
+			data, _ := json.Marshal(history)
+			addon.Annotations = map[string]string{constants.HealthHistoryAnnotationKey: string(data)}
+		}
+		return addon
+	}
+
+	option := &agent.FlapDetectionOption{Transitions: 3, Window: 10 * time.Minute, HistoryLimit: 5}
+	cases := []struct {
+		name             string
+		option           *agent.FlapDetectionOption
+		addon            *addonapiv1beta1.ManagedClusterAddOn
+		observed         []availableTransition
+		expectedHistory  int
+		expectedFlapping metav1.ConditionStatus
+	}{
+		{
+			name:  "flap detection is disabled",
+			addon: newAddon(metav1.ConditionTrue, 0, nil),
+		},
+		{
+			name:             "first record",
+			option:           option,
+			addon:            newAddon(metav1.ConditionTrue, 0, nil),
+			expectedHistory:  1,
+			expectedFlapping: metav1.ConditionFalse,
+		},
+		{
+			name:             "status is not changed",
+			option:           option,
+			addon:            newAddon(metav1.ConditionFalse, 2*time.Minute, newHistory(time.Hour, 2*time.Minute)),
+			expectedHistory:  2,
+			expectedFlapping: metav1.ConditionFalse,
+		},
+		{
+			name:             "addon is flapping",
+			option:           option,
+			addon:            newAddon(metav1.ConditionFalse, 0, newHistory(time.Hour, 3*time.Minute, 2*time.Minute)),
+			expectedHistory:  4,
+			expectedFlapping: metav1.ConditionTrue,
+		},
+		{
+			name:             "transitions are out of the window",
+			option:           option,
+			addon:            newAddon(metav1.ConditionFalse, 0, newHistory(3*time.Hour, 2*time.Hour, time.Hour)),
+			expectedHistory:  4,
+			expectedFlapping: metav1.ConditionFalse,
+		},
+		{
+			name:   "history is bounded",
+			option: option,
+			addon: newAddon(metav1.ConditionFalse, 0, newHistory(5*time.Hour, 4*time.Hour, 3*time.Hour,
+				2*time.Hour, time.Hour)),
+			expectedHistory:  5,
+			expectedFlapping: metav1.ConditionFalse,
+		},
+		{
+			name:             "coalesced transitions are derived from the transition time",
+			option:           option,
+			addon:            newAddon(metav1.ConditionTrue, 0, newHistory(time.Hour, 3*time.Minute, 2*time.Minute)),
+			expectedHistory:  5,
+			expectedFlapping: metav1.ConditionTrue,
+		},
+		{
+			name:   "coalesced transitions are observed",
+			option: option,
+			addon:  newAddon(metav1.ConditionFalse, time.Minute, newHistory(time.Hour)),
+			observed: []availableTransition{
+				{Status: metav1.ConditionFalse, Time: metav1.NewTime(now.Add(-3 * time.Minute))},
+				{Status: metav1.ConditionTrue, Time: metav1.NewTime(now.Add(-2 * time.Minute))},
+				{Status: metav1.ConditionFalse, Time: metav1.NewTime(now.Add(-time.Minute))},
+			},
+			expectedHistory:  4,
+			expectedFlapping: metav1.ConditionTrue,
+		},
+		{
+			name:             "observed transitions are already recorded",
+			option:           option,
+			addon:            newAddon(metav1.ConditionFalse, 2*time.Minute, newHistory(time.Hour, 2*time.Minute)),
+			observed:         newHistory(3*time.Minute, 2*time.Minute),
+			expectedHistory:  2,
+			expectedFlapping: metav1.ConditionFalse,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			recorder := newHealthHistoryRecorder()
+			for _, transition := range c.observed {
+				recorder.record("cluster1/test", transition, defaultFlapHistoryLimit)
+			}
+			syncer := &healthHistorySyncer{
+				agentAddon: &testAgent{name: "test", flapDetection: c.option},
+				recorder:   recorder,
+			}
+			addon, err := syncer.sync(context.TODO(), addontesting.NewFakeSyncContext(t), nil, c.addon)
+			if err != nil {
+				t.Fatalf("expected no error, but got %v", err)
+			}
+
+			if history := getHealthHistory(addon); len(history) != c.expectedHistory {
+				t.Errorf("expected %d records in the history, but got %v", c.expectedHistory, history)
+			}
+			flapping := meta.FindStatusCondition(addon.Status.Conditions, constants.AddonConditionFlapping)
+			switch {
+			case len(c.expectedFlapping) == 0 && flapping != nil:
+				t.Errorf("expected no flapping condition, but got %v", flapping)
+			case len(c.expectedFlapping) != 0 && (flapping == nil || flapping.Status != c.expectedFlapping):
+				t.Errorf("expected flapping condition %s, but got %v", c.expectedFlapping, flapping)
+			}
+		})
+	}
+}
@@ -4,9 +4,13 @@ import (
 	"context"
 	"fmt"
 	"regexp"
+	"slices"
 	"strings"
+	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
@@ -23,9 +27,22 @@ import (
 type healthCheckSyncer struct {
 	getWorkByAddon       func(addonName, addonNamespace string) ([]*workapiv1.ManifestWork, error)
 	getWorkByHostedAddon func(addonName, addonNamespace string) ([]*workapiv1.ManifestWork, error)
-	agentAddon           agent.AgentAddon
+	// getLease gets the lease of the addon on the hub, it is only used by the HealthProberTypeLeaseAndWork.
+	getLease   func(namespace, name string) (*coordinationv1.Lease, error)
+	agentAddon agent.AgentAddon
 }
 
+const (
+	// defaultLeaseGracePeriodFactor is the multiple of the lease duration after the last renew time of the lease
+	// when the lease is considered as stale by the HealthProberTypeLeaseAndWork, it is the same as the
+	// registration agent.
+	defaultLeaseGracePeriodFactor = 5
+	// defaultLeaseDurationSeconds is used if the lease duration is not set on the lease.
+	defaultLeaseDurationSeconds = 60
+	// defaultProgressDeadline is the same as the default progressDeadlineSeconds of the deployments.
+	defaultProgressDeadline = 10 * time.Minute
+)
+
 func (s *healthCheckSyncer) sync(ctx context.Context,
 	syncCtx factory.SyncContext,
 	cluster *clusterv1.ManagedCluster,
@@ -39,39 +56,64 @@ func (s *healthCheckSyncer) sync(ctx context.Context,
 
 	switch s.agentAddon.GetAgentAddonOptions().HealthProber.Type {
 	case agent.HealthProberTypeWork, agent.HealthProberTypeNone,
-		agent.HealthProberTypeDeploymentAvailability, agent.HealthProberTypeWorkloadAvailability:
+		agent.HealthProberTypeDeploymentAvailability, agent.HealthProberTypeWorkloadAvailability,
+		agent.HealthProberTypeLeaseAndWork:
 		expectedHealthCheckMode = addonapiv1beta1.HealthCheckModeCustomized
 	case agent.HealthProberTypeLease:
 		expectedHealthCheckMode = addonapiv1beta1.HealthCheckModeLease
 	default:
 		expectedHealthCheckMode = addonapiv1beta1.HealthCheckModeLease
+		if _, ok := agent.GetHealthProberPlugin(s.agentAddon.GetAgentAddonOptions().HealthProber.Type); ok {
+			expectedHealthCheckMode = addonapiv1beta1.HealthCheckModeCustomized
+		}
 	}
 
 	if expectedHealthCheckMode != addon.Status.HealthCheck.Mode {
 		addon.Status.HealthCheck.Mode = expectedHealthCheckMode
 	}
 
-	err := s.probeAddonStatus(ctx, cluster, addon)
+	if s.agentAddon.GetAgentAddonOptions().HealthProber.Type == agent.HealthProberTypeLeaseAndWork {
+		err := s.probeLeaseAndWorkAddonStatus(ctx, syncCtx, cluster, addon)
+		return addon, err
+	}
+
+	err := s.probeAddonStatus(ctx, syncCtx, cluster, addon)
 	return addon, err
 }
 
 func (s *healthCheckSyncer) probeAddonStatus(
-	ctx context.Context,
+	ctx context.Context, syncCtx factory.SyncContext,
 	cluster *clusterv1.ManagedCluster,
 	addon *addonapiv1beta1.ManagedClusterAddOn) error {
 	switch s.agentAddon.GetAgentAddonOptions().HealthProber.Type {
 	case agent.HealthProberTypeWork:
-		return s.probeWorkAddonStatus(ctx, cluster, addon)
+		return s.probeWorkAddonStatus(ctx, syncCtx, cluster, addon)
 	case agent.HealthProberTypeDeploymentAvailability:
-		return s.probeDeploymentAvailabilityAddonStatus(ctx, cluster, addon)
+		return s.probeDeploymentAvailabilityAddonStatus(ctx, syncCtx, cluster, addon)
 	case agent.HealthProberTypeWorkloadAvailability:
-		return s.probeWorkloadAvailabilityAddonStatus(ctx, cluster, addon)
+		return s.probeWorkloadAvailabilityAddonStatus(ctx, syncCtx, cluster, addon)
 	default:
+		return s.probePluginAddonStatus(ctx, syncCtx, cluster, addon)
+	}
+}
+
+// probePluginAddonStatus probes the addon by the HealthProberPlugin registered for the custom prober type.
+func (s *healthCheckSyncer) probePluginAddonStatus(
+	ctx context.Context, syncCtx factory.SyncContext,
+	cluster *clusterv1.ManagedCluster, addon *addonapiv1beta1.ManagedClusterAddOn) error {
+	if _, ok := agent.GetHealthProberPlugin(s.agentAddon.GetAgentAddonOptions().HealthProber.Type); !ok {
+		return nil
+	}
+
+	// wait for the addon manifest applied
+	if meta.FindStatusCondition(addon.Status.Conditions, addonapiv1beta1.ManagedClusterAddOnManifestApplied) == nil {
 		return nil
 	}
+
+	return s.probeAddonStatusByWorks(ctx, syncCtx, cluster, addon)
 }
 func (s *healthCheckSyncer) probeWorkAddonStatus(
-	ctx context.Context,
+	ctx context.Context, syncCtx factory.SyncContext,
 	cluster *clusterv1.ManagedCluster,
 	addon *addonapiv1beta1.ManagedClusterAddOn) error {
 	if s.agentAddon.GetAgentAddonOptions().HealthProber.Type != agent.HealthProberTypeWork {
@@ -93,17 +135,17 @@ func (s *healthCheckSyncer) probeWorkAddonStatus(
 		return nil
 	}
 
-	return s.probeAddonStatusByWorks(ctx, cluster, addon)
+	return s.probeAddonStatusByWorks(ctx, syncCtx, cluster, addon)
 }
 
 func (s *healthCheckSyncer) probeDeploymentAvailabilityAddonStatus(
-	ctx context.Context,
+	ctx context.Context, syncCtx factory.SyncContext,
 	cluster *clusterv1.ManagedCluster, addon *addonapiv1beta1.ManagedClusterAddOn) error {
-	return s.probeWorkloadAvailabilityAddonStatus(ctx, cluster, addon)
+	return s.probeWorkloadAvailabilityAddonStatus(ctx, syncCtx, cluster, addon)
 }
 
 func (s *healthCheckSyncer) probeWorkloadAvailabilityAddonStatus(
-	ctx context.Context,
+	ctx context.Context, syncCtx factory.SyncContext,
 	cluster *clusterv1.ManagedCluster, addon *addonapiv1beta1.ManagedClusterAddOn) error {
 
 	proberType := s.agentAddon.GetAgentAddonOptions().HealthProber.Type
@@ -117,11 +159,159 @@ func (s *healthCheckSyncer) probeWorkloadAvailabilityAddonStatus(
 		return nil
 	}
 
-	return s.probeAddonStatusByWorks(ctx, cluster, addon)
+	return s.probeAddonStatusByWorks(ctx, syncCtx, cluster, addon)
+}
+
+// probeLeaseAndWorkAddonStatus probes the addon by both the lease of the addon on the hub and the addon
+// manifestWorks. The addon is available only if both of them are healthy, and it is degraded if only one of
+// them is healthy. The addon is requeued when the lease is going to be stale, since there is no event of it.
+func (s *healthCheckSyncer) probeLeaseAndWorkAddonStatus(
+	ctx context.Context, syncCtx factory.SyncContext,
+	cluster *clusterv1.ManagedCluster, addon *addonapiv1beta1.ManagedClusterAddOn) error {
+	// wait for the addon manifest applied
+	if meta.FindStatusCondition(addon.Status.Conditions, addonapiv1beta1.ManagedClusterAddOnManifestApplied) == nil {
+		return nil
+	}
+
+	if cluster != nil {
+		clusterAvailableCondition := meta.FindStatusCondition(cluster.Status.Conditions,
+			clusterv1.ManagedClusterConditionAvailable)
+		if clusterAvailableCondition != nil && clusterAvailableCondition.Status == metav1.ConditionUnknown {
+			// the registration agent will set all addon status to unknown
+			return nil
+		}
+	}
+
+	// probe the workloads on a copy of the addon, so the Available condition of the work is not set on the addon.
+	probed := addon.DeepCopy()
+	if err := s.probeAddonStatusByWorks(ctx, syncCtx, cluster, probed); err != nil {
+		return err
+	}
+	if progressing := meta.FindStatusCondition(probed.Status.Conditions,
+		constants.AddonConditionWorkloadProgressing); progressing != nil {
+		meta.SetStatusCondition(&addon.Status.Conditions, *progressing)
+	}
+	workCondition := meta.FindStatusCondition(probed.Status.Conditions,
+		addonapiv1beta1.ManagedClusterAddOnConditionAvailable)
+	if workCondition == nil {
+		return nil
+	}
+
+	leaseCondition, staleAfter, err := s.probeLease(addon)
+	if err != nil {
+		return err
+	}
+	if staleAfter > 0 {
+		syncCtx.Queue().AddAfter(fmt.Sprintf("%s/%s", addon.Namespace, addon.Name), staleAfter)
+	}
+
+	leaseHealthy := leaseCondition.Status == metav1.ConditionTrue
+	workHealthy := workCondition.Status == metav1.ConditionTrue
+	message := fmt.Sprintf("lease: %s; work: %s", leaseCondition.Message, workCondition.Message)
+
+	switch {
+	case leaseHealthy && workHealthy:
+		meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
+			Type:    addonapiv1beta1.ManagedClusterAddOnConditionAvailable,
+			Status:  metav1.ConditionTrue,
+			Reason:  addonapiv1beta1.AddonAvailableReasonProbeAvailable,
+			Message: fmt.Sprintf("%s add-on is available.", addon.Name),
+		})
+	case leaseHealthy:
+		meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
+			Type:    addonapiv1beta1.ManagedClusterAddOnConditionAvailable,
+			Status:  workCondition.Status,
+			Reason:  workCondition.Reason,
+			Message: message,
+		})
+	default:
+		meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
+			Type:    addonapiv1beta1.ManagedClusterAddOnConditionAvailable,
+			Status:  metav1.ConditionFalse,
+			Reason:  leaseCondition.Reason,
+			Message: message,
+		})
+	}
+
+	switch {
+	// the addon is not degraded if the workloads are not probed yet.
+	case leaseHealthy && workCondition.Status == metav1.ConditionFalse:
+		meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
+			Type:    addonapiv1beta1.ManagedClusterAddOnConditionDegraded,
+			Status:  metav1.ConditionTrue,
+			Reason:  constants.DegradedReasonWorkUnhealthy,
+			Message: workCondition.Message,
+		})
+	case !leaseHealthy && workHealthy:
+		meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
+			Type:    addonapiv1beta1.ManagedClusterAddOnConditionDegraded,
+			Status:  metav1.ConditionTrue,
+			Reason:  constants.DegradedReasonLeaseUnhealthy,
+			Message: leaseCondition.Message,
+		})
+	default:
+		meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
+			Type:    addonapiv1beta1.ManagedClusterAddOnConditionDegraded,
+			Status:  metav1.ConditionFalse,
+			Reason:  constants.DegradedReasonNotDegraded,
+			Message: message,
+		})
+	}
+	return nil
+}
+
+// probeLease returns the condition of the lease of the addon on the hub, and the duration after which the lease
+// is going to be stale if it is fresh.
+func (s *healthCheckSyncer) probeLease(
+	addon *addonapiv1beta1.ManagedClusterAddOn) (metav1.Condition, time.Duration, error) {
+	if s.getLease == nil {
+		return metav1.Condition{
+			Status:  metav1.ConditionFalse,
+			Reason:  addonapiv1beta1.AddonAvailableReasonLeaseLeaseNotFound,
+			Message: "The lease is not probed",
+		}, 0, nil
+	}
+
+	lease, err := s.getLease(addon.Namespace, addon.Name)
+	switch {
+	case errors.IsNotFound(err):
+		return metav1.Condition{
+			Status:  metav1.ConditionFalse,
+			Reason:  addonapiv1beta1.AddonAvailableReasonLeaseLeaseNotFound,
+			Message: fmt.Sprintf("The lease %s/%s is not found", addon.Namespace, addon.Name),
+		}, 0, nil
+	case err != nil:
+		return metav1.Condition{}, 0, err
+	}
+
+	leaseDurationSeconds := int32(defaultLeaseDurationSeconds)
+	if lease.Spec.LeaseDurationSeconds != nil && *lease.Spec.LeaseDurationSeconds > 0 {
+		leaseDurationSeconds = *lease.Spec.LeaseDurationSeconds
+	}
+	gracePeriod := time.Duration(defaultLeaseGracePeriodFactor*leaseDurationSeconds) * time.Second
+	if leaseProber := s.agentAddon.GetAgentAddonOptions().HealthProber.LeaseProber; leaseProber != nil &&
+		leaseProber.GracePeriod > 0 {
+		gracePeriod = leaseProber.GracePeriod
+	}
+
+	if lease.Spec.RenewTime != nil {
+		if staleAfter := time.Until(lease.Spec.RenewTime.Add(gracePeriod)); staleAfter > 0 {
+			return metav1.Condition{
+				Status:  metav1.ConditionTrue,
+				Reason:  addonapiv1beta1.AddonAvailableReasonLeaseLeaseUpdated,
+				Message: fmt.Sprintf("The lease %s/%s is updated", addon.Namespace, addon.Name),
+			}, staleAfter, nil
+		}
+	}
+	return metav1.Condition{
+		Status:  metav1.ConditionFalse,
+		Reason:  addonapiv1beta1.AddonAvailableReasonLeaseUpdateStopped,
+		Message: fmt.Sprintf("The lease %s/%s is not updated in %s", addon.Namespace, addon.Name, gracePeriod),
+	}, 0, nil
 }
 
 func (s *healthCheckSyncer) probeAddonStatusByWorks(
-	ctx context.Context,
+	ctx context.Context, syncCtx factory.SyncContext,
 	cluster *clusterv1.ManagedCluster, addon *addonapiv1beta1.ManagedClusterAddOn) error {
 
 	if cluster != nil {
@@ -158,6 +348,7 @@ func (s *healthCheckSyncer) probeAddonStatusByWorks(
 	}
 
 	manifestConditions := []workapiv1.ManifestCondition{}
+	deployWorks := []*workapiv1.ManifestWork{}
 	for _, work := range addonManifestWorks {
 		if !strings.HasPrefix(work.Name, constants.DeployWorkNamePrefix(addon.Name)) {
 			continue
@@ -184,9 +375,17 @@ func (s *healthCheckSyncer) probeAddonStatusByWorks(
 		}
 
 		manifestConditions = append(manifestConditions, work.Status.ResourceStatus.Manifests...)
+		deployWorks = append(deployWorks, work)
 	}
 
-	probeFields, healthChecker, err := s.analyzeWorkProber(ctx, s.agentAddon, cluster, addon)
+	if plugin, ok := agent.GetHealthProberPlugin(s.agentAddon.GetAgentAddonOptions().HealthProber.Type); ok {
+		condition := plugin.Probe(deployWorks, cluster, addon)
+		condition.Type = addonapiv1beta1.ManagedClusterAddOnConditionAvailable
+		meta.SetStatusCondition(&addon.Status.Conditions, condition)
+		return nil
+	}
+
+	probeFields, healthChecker, workloads, err := s.analyzeWorkProber(ctx, s.agentAddon, cluster, addon)
 	if err != nil {
 		// should not happen, return
 		return err
@@ -223,8 +422,23 @@ func (s *healthCheckSyncer) probeAddonStatusByWorks(
 	// If we have fieldResults but some probes are empty, still proceed with healthChecker
 	// This allows partial probe results to be considered valid
 
+	rollingOut := s.probeWorkloadProgressing(syncCtx, addon, fieldResults, workloads)
+
 	if healthChecker != nil {
 		if err := healthChecker(fieldResults, cluster, addon); err != nil {
+			// keep the addon available while the workloads are rolling out within the progress deadline, only
+			// if the other workloads are healthy.
+			if len(rollingOut) > 0 && meta.IsStatusConditionTrue(addon.Status.Conditions,
+				addonapiv1beta1.ManagedClusterAddOnConditionAvailable) &&
+				healthChecker(excludeFieldResults(fieldResults, rollingOut), cluster, addon) == nil {
+				meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
+					Type:    addonapiv1beta1.ManagedClusterAddOnConditionAvailable,
+					Status:  metav1.ConditionTrue,
+					Reason:  addonapiv1beta1.AddonAvailableReasonProbeAvailable,
+					Message: fmt.Sprintf("%s add-on is available while the workloads are rolling out: %v", addon.Name, err),
+				})
+				return nil
+			}
 			meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
 				Type:    addonapiv1beta1.ManagedClusterAddOnConditionAvailable,
 				Status:  metav1.ConditionFalse,
@@ -244,29 +458,144 @@ func (s *healthCheckSyncer) probeAddonStatusByWorks(
 	return nil
 }
 
+// probeWorkloadProgressing sets the WorkloadProgressing condition of the addon from the rollout status of the
+// workloads, and returns the workloads which are rolling out within the progress deadline. The deployments are
+// rolled out within their own progress deadline which is checked by the deployment controller, and the other
+// workloads are rolled out within the ProgressDeadline of the health prober since the WorkloadProgressing
+// condition is set. The addon is requeued at the deadline since the workloads may be stuck without any status
+// change.
+func (s *healthCheckSyncer) probeWorkloadProgressing(syncCtx factory.SyncContext,
+	addon *addonapiv1beta1.ManagedClusterAddOn, fieldResults []agent.FieldResult,
+	workloads []utils.WorkloadMetadata) []workapiv1.ResourceIdentifier {
+	progressDeadline := defaultProgressDeadline
+	if deadline := s.agentAddon.GetAgentAddonOptions().HealthProber.ProgressDeadline; deadline > 0 {
+		progressDeadline = deadline
+	}
+
+	var inProgress, deadlineExceeded, timedInProgress []string
+	var rollingOut, timedRollingOut []workapiv1.ResourceIdentifier
+	probed := false
+	requeueAfter := progressDeadline
+	for _, result := range fieldResults {
+		status, ok := utils.GetWorkloadRolloutStatus(result, workloads)
+		if !ok {
+			continue
+		}
+		probed = true
+		switch {
+		case status.DeadlineExceeded:
+			deadlineExceeded = append(deadlineExceeded, status.Message)
+		case status.InProgress && status.ProgressDeadline > 0:
+			inProgress = append(inProgress, status.Message)
+			rollingOut = append(rollingOut, status.ResourceIdentifier)
+			requeueAfter = min(requeueAfter, status.ProgressDeadline)
+		case status.InProgress:
+			inProgress = append(inProgress, status.Message)
+			timedInProgress = append(timedInProgress, status.Message)
+			timedRollingOut = append(timedRollingOut, status.ResourceIdentifier)
+		}
+	}
+	if !probed {
+		return nil
+	}
+
+	existing := meta.FindStatusCondition(addon.Status.Conditions, constants.AddonConditionWorkloadProgressing)
+
+	switch {
+	case len(deadlineExceeded) > 0:
+		meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
+			Type:    constants.AddonConditionWorkloadProgressing,
+			Status:  metav1.ConditionFalse,
+			Reason:  constants.WorkloadProgressingReasonDeadlineExceeded,
+			Message: strings.Join(deadlineExceeded, "; "),
+		})
+		return nil
+	case len(inProgress) > 0:
+		// the rollout stays failed until it is completed once the deadline is exceeded.
+		if existing != nil && existing.Reason == constants.WorkloadProgressingReasonDeadlineExceeded {
+			return nil
+		}
+		if len(timedInProgress) > 0 {
+			startTime := time.Now()
+			if existing != nil && existing.Status == metav1.ConditionTrue {
+				startTime = existing.LastTransitionTime.Time
+			}
+			remaining := time.Until(startTime.Add(progressDeadline))
+			if remaining <= 0 {
+				meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
+					Type:   constants.AddonConditionWorkloadProgressing,
+					Status: metav1.ConditionFalse,
+					Reason: constants.WorkloadProgressingReasonDeadlineExceeded,
+					Message: fmt.Sprintf("rollout exceeds the progress deadline %s: %s",
+						progressDeadline, strings.Join(timedInProgress, "; ")),
+				})
+				return nil
+			}
+			requeueAfter = min(requeueAfter, remaining)
+			rollingOut = append(rollingOut, timedRollingOut...)
+		}
+		meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
+			Type:    constants.AddonConditionWorkloadProgressing,
+			Status:  metav1.ConditionTrue,
+			Reason:  constants.WorkloadProgressingReasonRollingOut,
+			Message: strings.Join(inProgress, "; "),
+		})
+		syncCtx.Queue().AddAfter(fmt.Sprintf("%s/%s", addon.Namespace, addon.Name), requeueAfter)
+		return rollingOut
+	default:
+		meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
+			Type:    constants.AddonConditionWorkloadProgressing,
+			Status:  metav1.ConditionFalse,
+			Reason:  constants.WorkloadProgressingReasonCompleted,
+			Message: "The rollout of the workloads is completed",
+		})
+		return nil
+	}
+}
+
+// excludeFieldResults returns the field results of the resources other than the given resources.
+func excludeFieldResults(fieldResults []agent.FieldResult,
+	identifiers []workapiv1.ResourceIdentifier) []agent.FieldResult {
+	var results []agent.FieldResult
+	for _, result := range fieldResults {
+		if !slices.Contains(identifiers, result.ResourceIdentifier) {
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// analyzeWorkProber returns the probe fields and the health checker of the health prober, together with the
+// workloads filtered from the manifests if the availability of all the workloads is probed.
 // TODO: use wildcard to refactor analyzeDeploymentWorkProber and analyzeWorkloadsWorkProber
 func (s *healthCheckSyncer) analyzeWorkProber(
 	ctx context.Context,
 	agentAddon agent.AgentAddon,
 	cluster *clusterv1.ManagedCluster,
 	addon *addonapiv1beta1.ManagedClusterAddOn,
-) ([]agent.ProbeField, agent.AddonHealthCheckerFunc, error) {
+) ([]agent.ProbeField, agent.AddonHealthCheckerFunc, []utils.WorkloadMetadata, error) {
 
 	switch agentAddon.GetAgentAddonOptions().HealthProber.Type {
 	case agent.HealthProberTypeWork:
 		workProber := agentAddon.GetAgentAddonOptions().HealthProber.WorkProber
 		if workProber != nil {
-			return workProber.ProbeFields, workProber.HealthChecker, nil
+			return workProber.ProbeFields, workProber.HealthChecker, nil, nil
 		}
-		return nil, nil, fmt.Errorf("work prober is not configured")
+		return nil, nil, nil, fmt.Errorf("work prober is not configured")
 	case agent.HealthProberTypeDeploymentAvailability:
 		probeFields, heathChecker, err := s.analyzeDeploymentWorkProber(ctx, agentAddon, cluster, addon)
-		return probeFields, heathChecker, err
+		return probeFields, heathChecker, nil, err
 	case agent.HealthProberTypeWorkloadAvailability:
-		probeFields, heathChecker, err := s.analyzeWorkloadsWorkProber(ctx, agentAddon, cluster, addon)
-		return probeFields, heathChecker, err
+		return s.analyzeWorkloadsWorkProber(ctx, agentAddon, cluster, addon)
+	case agent.HealthProberTypeLeaseAndWork:
+		workProber := agentAddon.GetAgentAddonOptions().HealthProber.WorkProber
+		if workProber != nil {
+			return workProber.ProbeFields, workProber.HealthChecker, nil, nil
+		}
+		return s.analyzeWorkloadsWorkProber(ctx, agentAddon, cluster, addon)
 	default:
-		return nil, nil, fmt.Errorf("unsupported health prober type %s", agentAddon.GetAgentAddonOptions().HealthProber.Type)
+		return nil, nil, nil, fmt.Errorf("unsupported health prober type %s",
+			agentAddon.GetAgentAddonOptions().HealthProber.Type)
 	}
 }
 
@@ -304,12 +633,12 @@ func (s *healthCheckSyncer) analyzeWorkloadsWorkProber(
 	agentAddon agent.AgentAddon,
 	cluster *clusterv1.ManagedCluster,
 	addon *addonapiv1beta1.ManagedClusterAddOn,
-) ([]agent.ProbeField, agent.AddonHealthCheckerFunc, error) {
+) ([]agent.ProbeField, agent.AddonHealthCheckerFunc, []utils.WorkloadMetadata, error) {
 	probeFields := []agent.ProbeField{}
 
 	manifests, err := agentAddon.Manifests(ctx, cluster, addon)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	workloads := utils.FilterWorkloads(manifests)
@@ -331,7 +660,7 @@ func (s *healthCheckSyncer) analyzeWorkloadsWorkProber(
 		})
 	}
 
-	return probeFields, utils.WorkloadAvailabilityHealthChecker, nil
+	return probeFields, utils.NewWorkloadAvailabilityHealthChecker(workloads), workloads, nil
 }
 
 func findResultsByIdentifier(identifier workapiv1.ResourceIdentifier,
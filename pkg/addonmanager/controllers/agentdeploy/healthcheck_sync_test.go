@@ -6,13 +6,17 @@ import (
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
+	coordinationv1 "k8s.io/api/coordination/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/ptr"
 	"open-cluster-management.io/addon-framework/pkg/addonmanager/addontesting"
 	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
 	"open-cluster-management.io/addon-framework/pkg/agent"
@@ -1327,6 +1331,78 @@ func TestHealthCheckReconcile(t *testing.T) {
 				Message: "test add-on is available.",
 			},
 		},
+		{
+			name: "Health check mode is job succeeded plugin and probe check fail",
+			testAddon: &healthCheckTestAgent{name: "test",
+				health: &agent.HealthProber{Type: agent.HealthProberTypeJobSucceeded}},
+			addon: addontesting.NewAddonWithConditions("test", "cluster1", manifestAppliedCondition),
+			existingWork: []runtime.Object{
+				&v1.ManifestWork{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "addon-test-deploy-01",
+						Namespace: "cluster1",
+						Labels: map[string]string{
+							"open-cluster-management.io/addon-name": "test",
+						},
+					},
+					Spec: v1.ManifestWorkSpec{
+						ManifestConfigs: []v1.ManifestConfigOption{
+							{
+								ResourceIdentifier: v1.ResourceIdentifier{
+									Group:     "batch",
+									Resource:  "jobs",
+									Name:      "test-job",
+									Namespace: "default",
+								},
+							},
+						},
+					},
+					Status: v1.ManifestWorkStatus{
+						ResourceStatus: v1.ManifestResourceStatus{
+							Manifests: []v1.ManifestCondition{
+								{
+									ResourceMeta: v1.ManifestResourceMeta{
+										Group:     "batch",
+										Resource:  "jobs",
+										Name:      "test-job",
+										Namespace: "default",
+									},
+									StatusFeedbacks: v1.StatusFeedbackResult{
+										Values: []v1.FeedbackValue{
+											{
+												Name:  "Complete",
+												Value: v1.FieldValue{String: ptr.To("False")},
+											},
+										},
+									},
+								},
+							},
+						},
+						Conditions: []metav1.Condition{
+							{
+								Type:   v1.WorkAvailable,
+								Status: metav1.ConditionTrue,
+							},
+						},
+					},
+				},
+			},
+			expectedErr:             nil,
+			expectedHealthCheckMode: addonapiv1beta1.HealthCheckModeCustomized,
+			expectAvailableCondition: metav1.Condition{
+				Type:   addonapiv1beta1.ManagedClusterAddOnConditionAvailable,
+				Status: metav1.ConditionFalse,
+				Reason: addonapiv1beta1.AddonAvailableReasonProbeUnavailable,
+			},
+		},
+		{
+			name: "Health check mode is unregistered plugin",
+			testAddon: &healthCheckTestAgent{name: "test",
+				health: &agent.HealthProber{Type: "Unregistered"}},
+			addon:                   addontesting.NewAddonWithConditions("test", "cluster1", manifestAppliedCondition),
+			expectedErr:             nil,
+			expectedHealthCheckMode: addonapiv1beta1.HealthCheckModeLease,
+		},
 	}
 
 	for _, c := range cases {
@@ -1412,3 +1488,333 @@ func newDeploymentsCheckAllProber(deployments ...types.NamespacedName) *agent.He
 		},
 	}
 }
+
+func TestLeaseAndWorkHealthCheck(t *testing.T) {
+	newWork := func(readyReplicas int64) *v1.ManifestWork {
+		return &v1.ManifestWork{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "addon-test-deploy-01",
+				Namespace: "cluster1",
+				Labels: map[string]string{
+					"open-cluster-management.io/addon-name": "test",
+				},
+			},
+			Status: v1.ManifestWorkStatus{
+				ResourceStatus: v1.ManifestResourceStatus{
+					Manifests: []v1.ManifestCondition{
+						{
+							ResourceMeta: v1.ManifestResourceMeta{
+								Group:     "apps",
+								Resource:  "deployments",
+								Name:      "test-deployment",
+								Namespace: "default",
+							},
+							StatusFeedbacks: v1.StatusFeedbackResult{
+								Values: []v1.FeedbackValue{
+									{Name: "Replicas", Value: v1.FieldValue{Integer: boolPtr(1)}},
+									{Name: "ReadyReplicas", Value: v1.FieldValue{Integer: boolPtr(readyReplicas)}},
+								},
+							},
+						},
+					},
+				},
+				Conditions: []metav1.Condition{
+					{Type: v1.WorkAvailable, Status: metav1.ConditionTrue},
+				},
+			},
+		}
+	}
+	newLease := func(renewTime time.Time) *coordinationv1.Lease {
+		return &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "cluster1"},
+			Spec:       coordinationv1.LeaseSpec{RenewTime: &metav1.MicroTime{Time: renewTime}},
+		}
+	}
+
+	cases := []struct {
+		name              string
+		leaseProber       *agent.LeaseHealthProber
+		lease             *coordinationv1.Lease
+		work              *v1.ManifestWork
+		expectedAvailable metav1.Condition
+		expectedDegraded  metav1.Condition
+	}{
+		{
+			name:  "lease is fresh and workloads are available",
+			lease: newLease(time.Now()),
+			work:  newWork(1),
+			expectedAvailable: metav1.Condition{
+				Status:  metav1.ConditionTrue,
+				Reason:  addonapiv1beta1.AddonAvailableReasonProbeAvailable,
+				Message: "test add-on is available.",
+			},
+			expectedDegraded: metav1.Condition{
+				Status: metav1.ConditionFalse,
+				Reason: constants.DegradedReasonNotDegraded,
+			},
+		},
+		{
+			name:        "lease is stale and workloads are available",
+			leaseProber: &agent.LeaseHealthProber{GracePeriod: time.Minute},
+			lease:       newLease(time.Now().Add(-2 * time.Minute)),
+			work:        newWork(1),
+			expectedAvailable: metav1.Condition{
+				Status: metav1.ConditionFalse,
+				Reason: addonapiv1beta1.AddonAvailableReasonLeaseUpdateStopped,
+				Message: "lease: The lease cluster1/test is not updated in 1m0s; " +
+					"work: test add-on is available.",
+			},
+			expectedDegraded: metav1.Condition{
+				Status: metav1.ConditionTrue,
+				Reason: constants.DegradedReasonLeaseUnhealthy,
+			},
+		},
+		{
+			name:  "lease is fresh and workloads are unavailable",
+			lease: newLease(time.Now()),
+			work:  newWork(0),
+			expectedAvailable: metav1.Condition{
+				Status: metav1.ConditionFalse,
+				Reason: addonapiv1beta1.AddonAvailableReasonProbeUnavailable,
+			},
+			expectedDegraded: metav1.Condition{
+				Status: metav1.ConditionTrue,
+				Reason: constants.DegradedReasonWorkUnhealthy,
+			},
+		},
+		{
+			name: "lease is not found and workloads are unavailable",
+			work: newWork(0),
+			expectedAvailable: metav1.Condition{
+				Status: metav1.ConditionFalse,
+				Reason: addonapiv1beta1.AddonAvailableReasonLeaseLeaseNotFound,
+			},
+			expectedDegraded: metav1.Condition{
+				Status: metav1.ConditionFalse,
+				Reason: constants.DegradedReasonNotDegraded,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			testAddon := &healthCheckTestAgent{name: "test", health: &agent.HealthProber{
+				Type:        agent.HealthProberTypeLeaseAndWork,
+				LeaseProber: c.leaseProber,
+			}}
+			syncer := healthCheckSyncer{
+				getWorkByAddon: func(addonName, addonNamespace string) ([]*v1.ManifestWork, error) {
+					return []*v1.ManifestWork{c.work}, nil
+				},
+				getLease: func(namespace, name string) (*coordinationv1.Lease, error) {
+					if c.lease == nil {
+						return nil, errors.NewNotFound(schema.GroupResource{Resource: "leases"}, name)
+					}
+					return c.lease, nil
+				},
+				agentAddon: testAddon,
+			}
+
+			addon, err := syncer.sync(context.TODO(), addontesting.NewFakeSyncContext(t), nil,
+				addontesting.NewAddonWithConditions("test", "cluster1", manifestAppliedCondition))
+			if err != nil {
+				t.Fatalf("expected no error, but got %v", err)
+			}
+			if addon.Status.HealthCheck.Mode != addonapiv1beta1.HealthCheckModeCustomized {
+				t.Errorf("expected customized health check mode, but got %s", addon.Status.HealthCheck.Mode)
+			}
+
+			available := meta.FindStatusCondition(addon.Status.Conditions,
+				addonapiv1beta1.ManagedClusterAddOnConditionAvailable)
+			if available == nil || available.Status != c.expectedAvailable.Status ||
+				available.Reason != c.expectedAvailable.Reason {
+				t.Errorf("expected available condition %v, but got %v", c.expectedAvailable, available)
+			} else if len(c.expectedAvailable.Message) != 0 && available.Message != c.expectedAvailable.Message {
+				t.Errorf("expected available message %q, but got %q", c.expectedAvailable.Message, available.Message)
+			}
+
+			degraded := meta.FindStatusCondition(addon.Status.Conditions,
+				addonapiv1beta1.ManagedClusterAddOnConditionDegraded)
+			if degraded == nil || degraded.Status != c.expectedDegraded.Status ||
+				degraded.Reason != c.expectedDegraded.Reason {
+				t.Errorf("expected degraded condition %v, but got %v", c.expectedDegraded, degraded)
+			}
+		})
+	}
+}
+
+func TestWorkloadProgressingHealthCheck(t *testing.T) {
+	newDeployment := func(readyReplicas, updatedReplicas int64, progressingReason string) v1.ManifestCondition {
+		return v1.ManifestCondition{
+			ResourceMeta: v1.ManifestResourceMeta{
+				Group:     "apps",
+				Resource:  "deployments",
+				Name:      "test-deployment",
+				Namespace: "default",
+			},
+			StatusFeedbacks: v1.StatusFeedbackResult{
+				Values: []v1.FeedbackValue{
+					{Name: "Replicas", Value: v1.FieldValue{Integer: boolPtr(1)}},
+					{Name: "ReadyReplicas", Value: v1.FieldValue{Integer: boolPtr(readyReplicas)}},
+					{Name: "ObservedGeneration", Value: v1.FieldValue{Integer: boolPtr(2)}},
+					{Name: "UpdatedReplicas", Value: v1.FieldValue{Integer: boolPtr(updatedReplicas)}},
+					{Name: "ProgressingReason", Value: v1.FieldValue{String: &progressingReason}},
+				},
+			},
+		}
+	}
+	newWork := func(numberReady, updatedNumberScheduled int64, manifests ...v1.ManifestCondition) *v1.ManifestWork {
+		return &v1.ManifestWork{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "addon-test-deploy-01",
+				Namespace: "cluster1",
+				Labels: map[string]string{
+					"open-cluster-management.io/addon-name": "test",
+				},
+			},
+			Status: v1.ManifestWorkStatus{
+				ResourceStatus: v1.ManifestResourceStatus{
+					Manifests: append([]v1.ManifestCondition{
+						{
+							ResourceMeta: v1.ManifestResourceMeta{
+								Group:     "apps",
+								Resource:  "daemonsets",
+								Name:      "test-daemonset",
+								Namespace: "default",
+							},
+							StatusFeedbacks: v1.StatusFeedbackResult{
+								Values: []v1.FeedbackValue{
+									{Name: "DesiredNumberScheduled", Value: v1.FieldValue{Integer: boolPtr(2)}},
+									{Name: "NumberReady", Value: v1.FieldValue{Integer: boolPtr(numberReady)}},
+									{Name: "ObservedGeneration", Value: v1.FieldValue{Integer: boolPtr(2)}},
+									{Name: "UpdatedNumberScheduled", Value: v1.FieldValue{Integer: boolPtr(updatedNumberScheduled)}},
+								},
+							},
+						},
+					}, manifests...),
+				},
+				Conditions: []metav1.Condition{
+					{Type: v1.WorkAvailable, Status: metav1.ConditionTrue},
+				},
+			},
+		}
+	}
+	availableCondition := metav1.Condition{
+		Type:   addonapiv1beta1.ManagedClusterAddOnConditionAvailable,
+		Status: metav1.ConditionTrue,
+		Reason: addonapiv1beta1.AddonAvailableReasonProbeAvailable,
+	}
+
+	cases := []struct {
+		name                string
+		conditions          []metav1.Condition
+		work                *v1.ManifestWork
+		expectedAvailable   metav1.ConditionStatus
+		expectedProgressing metav1.Condition
+	}{
+		{
+			name:              "available addon is rolling out",
+			conditions:        []metav1.Condition{manifestAppliedCondition, availableCondition},
+			work:              newWork(1, 1),
+			expectedAvailable: metav1.ConditionTrue,
+			expectedProgressing: metav1.Condition{
+				Status: metav1.ConditionTrue, Reason: constants.WorkloadProgressingReasonRollingOut,
+			},
+		},
+		{
+			name:              "unavailable addon is rolling out",
+			conditions:        []metav1.Condition{manifestAppliedCondition},
+			work:              newWork(1, 1),
+			expectedAvailable: metav1.ConditionFalse,
+			expectedProgressing: metav1.Condition{
+				Status: metav1.ConditionTrue, Reason: constants.WorkloadProgressingReasonRollingOut,
+			},
+		},
+		{
+			name: "rollout exceeds the progress deadline",
+			conditions: []metav1.Condition{manifestAppliedCondition, availableCondition, {
+				Type:               constants.AddonConditionWorkloadProgressing,
+				Status:             metav1.ConditionTrue,
+				Reason:             constants.WorkloadProgressingReasonRollingOut,
+				LastTransitionTime: metav1.NewTime(time.Now().Add(-time.Hour)),
+			}},
+			work:              newWork(1, 1),
+			expectedAvailable: metav1.ConditionFalse,
+			expectedProgressing: metav1.Condition{
+				Status: metav1.ConditionFalse, Reason: constants.WorkloadProgressingReasonDeadlineExceeded,
+			},
+		},
+		{
+			name:              "available addon is rolling out while the other workload is unavailable",
+			conditions:        []metav1.Condition{manifestAppliedCondition, availableCondition},
+			work:              newWork(1, 1, newDeployment(0, 1, "NewReplicaSetAvailable")),
+			expectedAvailable: metav1.ConditionFalse,
+			expectedProgressing: metav1.Condition{
+				Status: metav1.ConditionTrue, Reason: constants.WorkloadProgressingReasonRollingOut,
+			},
+		},
+		{
+			name: "deployment is rolling out within its own progress deadline",
+			conditions: []metav1.Condition{manifestAppliedCondition, availableCondition, {
+				Type:               constants.AddonConditionWorkloadProgressing,
+				Status:             metav1.ConditionTrue,
+				Reason:             constants.WorkloadProgressingReasonRollingOut,
+				LastTransitionTime: metav1.NewTime(time.Now().Add(-time.Hour)),
+			}},
+			work:              newWork(2, 2, newDeployment(0, 0, "ReplicaSetUpdated")),
+			expectedAvailable: metav1.ConditionTrue,
+			expectedProgressing: metav1.Condition{
+				Status: metav1.ConditionTrue, Reason: constants.WorkloadProgressingReasonRollingOut,
+			},
+		},
+		{
+			name:              "deployment exceeds its own progress deadline",
+			conditions:        []metav1.Condition{manifestAppliedCondition, availableCondition},
+			work:              newWork(2, 2, newDeployment(0, 0, "ProgressDeadlineExceeded")),
+			expectedAvailable: metav1.ConditionFalse,
+			expectedProgressing: metav1.Condition{
+				Status: metav1.ConditionFalse, Reason: constants.WorkloadProgressingReasonDeadlineExceeded,
+			},
+		},
+		{
+			name:              "rollout is completed",
+			conditions:        []metav1.Condition{manifestAppliedCondition, availableCondition},
+			work:              newWork(2, 2),
+			expectedAvailable: metav1.ConditionTrue,
+			expectedProgressing: metav1.Condition{
+				Status: metav1.ConditionFalse, Reason: constants.WorkloadProgressingReasonCompleted,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			syncer := healthCheckSyncer{
+				getWorkByAddon: func(addonName, addonNamespace string) ([]*v1.ManifestWork, error) {
+					return []*v1.ManifestWork{c.work}, nil
+				},
+				agentAddon: &healthCheckTestAgent{name: "test", health: &agent.HealthProber{
+					Type:             agent.HealthProberTypeWorkloadAvailability,
+					ProgressDeadline: 10 * time.Minute,
+				}},
+			}
+
+			addon, err := syncer.sync(context.TODO(), addontesting.NewFakeSyncContext(t), nil,
+				addontesting.NewAddonWithConditions("test", "cluster1", c.conditions...))
+			if err != nil {
+				t.Fatalf("expected no error, but got %v", err)
+			}
+
+			available := meta.FindStatusCondition(addon.Status.Conditions,
+				addonapiv1beta1.ManagedClusterAddOnConditionAvailable)
+			if available == nil || available.Status != c.expectedAvailable {
+				t.Errorf("expected available status %s, but got %v", c.expectedAvailable, available)
+			}
+			progressing := meta.FindStatusCondition(addon.Status.Conditions, constants.AddonConditionWorkloadProgressing)
+			if progressing == nil || progressing.Status != c.expectedProgressing.Status ||
+				progressing.Reason != c.expectedProgressing.Reason {
+				t.Errorf("expected progressing condition %v, but got %v", c.expectedProgressing, progressing)
+			}
+		})
+	}
+}
@@ -30,6 +30,8 @@ type hostedHookSyncer struct {
 
 	getCluster func(clusterName string) (*clusterv1.ManagedCluster, error)
 
+	lifecycleHooks *lifecycleHookRunner
+
 	agentAddon agent.AgentAddon
 }
 
@@ -73,12 +75,32 @@ func (s *hostedHookSyncer) sync(ctx context.Context,
 		addonRemoveFinalizer(addon, addonapiv1beta1.AddonHostingPreDeleteHookFinalizer)
 		return addon, nil
 	}
+
+	// the post-install, pre-upgrade and post-upgrade hooks are run until the addon is deleting.
+	var hasLifecycleHooks bool
+	if addon.DeletionTimestamp.IsZero() {
+		hasLifecycleHooks, err = s.lifecycleHooks.sync(ctx, hostingClusterName,
+			constants.DeployHostingWorkNamePrefix(addon.Namespace, addon.Name), cluster, addon)
+		if err != nil {
+			return addon, err
+		}
+	}
+
 	hookWork, err := s.buildWorks(ctx, hostingClusterName, cluster, addon)
 	if err != nil {
 		return addon, err
 	}
 
 	if hookWork == nil {
+		// the lifecycle hook manifestWorks on the hosting cluster are not owned by the addon, so the
+		// finalizer is kept to clean them up when the addon is deleting.
+		if hasLifecycleHooks {
+			addonAddFinalizer(addon, addonapiv1beta1.AddonHostingPreDeleteHookFinalizer)
+			return addon, nil
+		}
+		if err = s.cleanupHookWork(ctx, addon); err != nil {
+			return addon, err
+		}
 		addonRemoveFinalizer(addon, addonapiv1beta1.AddonHostingPreDeleteHookFinalizer)
 		return addon, nil
 	}
@@ -92,11 +114,25 @@ func (s *hostedHookSyncer) sync(ctx context.Context,
 		return addon, nil
 	}
 
+	if timeLeft, ok := preDeleteHookTimeLeft(s.agentAddon, addon); ok {
+		if timeLeft <= 0 {
+			if err = s.cleanupHookWork(ctx, addon); err != nil {
+				return addon, err
+			}
+			recordHookTimeout(ctx, syncCtx, addon, hookWork)
+			addonRemoveFinalizer(addon, addonapiv1beta1.AddonHostingPreDeleteHookFinalizer)
+			return addon, nil
+		}
+		syncCtx.Queue().AddAfter(fmt.Sprintf("%s/%s", addon.Namespace, addon.Name), timeLeft)
+	}
+
 	// apply the pre-delete hook manifestWork when the addon is deleting and HookManifestCompleted condition is not true.
 	// there are 2 cases:
 	// 1. the HookManifestCompleted condition is false.
 	// 2. there is no this condition.
-	if !meta.IsStatusConditionTrue(addon.Status.Conditions, addonapiv1beta1.ManagedClusterAddOnHookManifestCompleted) {
+	// the failed hook manifestWork is cleaned up after the HookManifestFailed condition is reported.
+	if !meta.IsStatusConditionTrue(addon.Status.Conditions, addonapiv1beta1.ManagedClusterAddOnHookManifestCompleted) &&
+		!meta.IsStatusConditionTrue(addon.Status.Conditions, constants.AddonConditionHookManifestFailed) {
 		hookWork, err = s.applyWork(ctx, addonapiv1beta1.ManagedClusterAddOnHostingManifestApplied, hookWork, addon)
 		if err != nil {
 			return addon, err
@@ -113,7 +149,10 @@ func (s *hostedHookSyncer) sync(ctx context.Context,
 	}
 
 	// TODO: will surface more message here
-	if hookWorkIsCompleted(hookWork) {
+	completed, failed := hookWorkStatus(hookWork)
+	if failed {
+		setHookFailedCondition(ctx, syncCtx, addon, hookWork)
+	} else if completed {
 		meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
 			Type:    addonapiv1beta1.ManagedClusterAddOnHookManifestCompleted,
 			Status:  metav1.ConditionTrue,
@@ -255,6 +255,12 @@ func TestHostingHookReconcile(t *testing.T) {
 								{
 									Type: workapiv1.WellKnownStatusType,
 								},
+								{
+									Type: workapiv1.JSONPathsType,
+									JsonPaths: []workapiv1.JsonPath{
+										{Name: "JobFailed", Path: `.conditions[?(@.type=="Failed")].status`},
+									},
+								},
 							},
 						},
 					}
@@ -359,6 +365,12 @@ func TestHostingHookReconcile(t *testing.T) {
 								{
 									Type: workapiv1.WellKnownStatusType,
 								},
+								{
+									Type: workapiv1.JSONPathsType,
+									JsonPaths: []workapiv1.JsonPath{
+										{Name: "JobFailed", Path: `.conditions[?(@.type=="Failed")].status`},
+									},
+								},
 							},
 						},
 					}
@@ -0,0 +1,290 @@
+package agentdeploy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/klog/v2"
+
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	workapiv1 "open-cluster-management.io/api/work/v1"
+
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
+)
+
+type buildLifecycleHookFunc func(
+	ctx context.Context,
+	workNamespace string,
+	cluster *clusterv1.ManagedCluster,
+	addon *addonapiv1beta1.ManagedClusterAddOn) (map[string]*workapiv1.ManifestWork, error)
+
+func (c *addonDeployController) buildLifecycleHookManifestWorksFunc(addonWorkBuilder *addonWorksBuilder, appliedType string) buildLifecycleHookFunc {
+	return func(
+		ctx context.Context,
+		workNamespace string,
+		cluster *clusterv1.ManagedCluster,
+		addon *addonapiv1beta1.ManagedClusterAddOn) (map[string]*workapiv1.ManifestWork, error) {
+		agentAddon := c.agentAddons[addon.Name]
+		if agentAddon == nil {
+			return nil, fmt.Errorf("failed to get agentAddon")
+		}
+
+		if agentAddon.GetAgentAddonOptions().ConfigCheckEnabled &&
+			!meta.IsStatusConditionTrue(addon.Status.Conditions, addonapiv1beta1.ManagedClusterAddOnConditionConfigured) {
+			return nil, nil
+		}
+
+		objects, err := agentAddon.Manifests(ctx, cluster, addon)
+		if err != nil {
+			meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
+				Type:    appliedType,
+				Status:  metav1.ConditionFalse,
+				Reason:  addonapiv1beta1.AddonManifestAppliedReasonWorkApplyFailed,
+				Message: fmt.Sprintf("failed to get manifest from agent interface: %v", err),
+			})
+			return nil, err
+		}
+
+		// this is to retrieve the intended mode of the addon.
+		var mode string
+		if agentAddon.GetAgentAddonOptions().HostedModeInfoFunc == nil {
+			mode = constants.InstallModeDefault
+		} else {
+			mode, _ = agentAddon.GetAgentAddonOptions().HostedModeInfoFunc(addon, cluster)
+		}
+		hookWorks, err := addonWorkBuilder.BuildLifecycleHookWorks(mode, workNamespace, addon, objects)
+		if err != nil {
+			meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
+				Type:    appliedType,
+				Status:  metav1.ConditionFalse,
+				Reason:  addonapiv1beta1.AddonManifestAppliedReasonWorkApplyFailed,
+				Message: fmt.Sprintf("failed to build manifestwork: %v", err),
+			})
+			return nil, err
+		}
+		workAnnotations, err := getManifestWorkAnnotations(ctx, agentAddon, cluster, addon)
+		if err != nil {
+			return nil, fmt.Errorf("get manifestwork annotations error: %v", err)
+		}
+		for _, hookWork := range hookWorks {
+			setSensitiveDataAnnotation(workAnnotations, hookWork)
+		}
+		return hookWorks, nil
+	}
+}
+
+// waitForPreUpgradeHook returns true if the existing deploy manifestWorks are going to be upgraded while the
+// pre-upgrade hook manifestWork of the upgrade is not completed yet.
+func (c *addonDeployController) waitForPreUpgradeHook(addonWorkBuilder *addonWorksBuilder,
+	installMode, workNamespace string,
+	addon *addonapiv1beta1.ManagedClusterAddOn,
+	existingWorks, deployWorks []*workapiv1.ManifestWork,
+	objects []runtime.Object) (bool, error) {
+	if len(deployWorks) == 0 {
+		return false, nil
+	}
+	manifestsHash := deployWorks[0].Annotations[constants.ManifestsHashAnnotationKey]
+	if len(manifestsHash) == 0 {
+		return false, nil
+	}
+
+	var currentWorks []*workapiv1.ManifestWork
+	for _, work := range existingWorks {
+		if strings.HasPrefix(work.Name, addonWorkBuilder.processor.manifestWorkNamePrefix(addon.Namespace, addon.Name)) {
+			currentWorks = append(currentWorks, work)
+		}
+	}
+	// the addon is not installed yet, or the deploy manifestWorks are not changed.
+	if len(currentWorks) == 0 || deployedManifestsHash(currentWorks) == manifestsHash {
+		return false, nil
+	}
+
+	hookWorks, err := addonWorkBuilder.BuildLifecycleHookWorks(installMode, workNamespace, addon, objects)
+	if err != nil {
+		return false, err
+	}
+	hookWork, ok := hookWorks[constants.AddonPreUpgradeHookAnnotationKey]
+	if !ok {
+		return false, nil
+	}
+	// the hook manifestWork is never applied in dry-run mode, the diff of the hook manifestWork is recorded by
+	// the lifecycle hook runner and the hook is treated as completed, so the diffs of the deploy manifestWorks
+	// are recorded too.
+	if c.dryRun {
+		return false, nil
+	}
+
+	existingHookWork, err := c.workLister.ManifestWorks(workNamespace).Get(hookWork.Name)
+	switch {
+	case errors.IsNotFound(err):
+		return true, nil
+	case err != nil:
+		return false, err
+	}
+	return existingHookWork.Annotations[constants.ManifestsHashAnnotationKey] != manifestsHash ||
+		!hookWorkIsCompleted(existingHookWork), nil
+}
+
+// lifecycleHookRunner runs the post-install, pre-upgrade and post-upgrade hooks of the addon by the state of
+// the deploy manifestWorks:
+//   - the pre-upgrade hook is run once the manifests are changed, and the deploy manifestWorks are not updated
+//     until it is completed.
+//   - the post-install hook is run once the deploy manifestWorks of the installation are available.
+//   - the post-upgrade hook is run once the updated deploy manifestWorks are available.
+//
+// The hook manifestWork of a previous installation or upgrade is deleted and created again, so the hook
+// resources are run again.
+type lifecycleHookRunner struct {
+	buildWorks buildLifecycleHookFunc
+
+	applyWork func(ctx context.Context, appliedType string,
+		work *workapiv1.ManifestWork, addon *addonapiv1beta1.ManagedClusterAddOn) (*workapiv1.ManifestWork, error)
+
+	deleteWork func(ctx context.Context, workNamespace, workName string) error
+
+	getWork func(workNamespace, workName string) (*workapiv1.ManifestWork, error)
+
+	getWorkByAddon func(addonName, addonNamespace string) ([]*workapiv1.ManifestWork, error)
+
+	appliedType string
+}
+
+// sync runs the lifecycle hooks of the addon, it returns true if the addon has any lifecycle hook.
+func (r *lifecycleHookRunner) sync(ctx context.Context, workNamespace, deployWorkNamePrefix string,
+	cluster *clusterv1.ManagedCluster, addon *addonapiv1beta1.ManagedClusterAddOn) (bool, error) {
+	hookWorks, err := r.buildWorks(ctx, workNamespace, cluster, addon)
+	if err != nil {
+		return false, err
+	}
+	if len(hookWorks) == 0 {
+		return false, nil
+	}
+
+	works, err := r.getWorkByAddon(addon.Name, addon.Namespace)
+	if err != nil {
+		return true, err
+	}
+	var deployWorks []*workapiv1.ManifestWork
+	for _, work := range works {
+		if work.Namespace == workNamespace && strings.HasPrefix(work.Name, deployWorkNamePrefix) {
+			deployWorks = append(deployWorks, work)
+		}
+	}
+	// the hooks are not run until the addon is installed.
+	if len(deployWorks) == 0 {
+		return true, nil
+	}
+
+	var manifestsHash string
+	for _, hookWork := range hookWorks {
+		manifestsHash = hookWork.Annotations[constants.ManifestsHashAnnotationKey]
+	}
+	deployedHash := deployedManifestsHash(deployWorks)
+	installedHash := deployWorks[0].Annotations[constants.InstalledManifestsHashAnnotationKey]
+	available := deployedHash == manifestsHash && deployWorksAreAvailable(deployWorks)
+
+	var errs []error
+	for _, hook := range lifecycleHooks {
+		hookWork, ok := hookWorks[hook.annotationKey]
+		if !ok {
+			continue
+		}
+
+		var run bool
+		switch hook {
+		case preUpgradeHook:
+			run = deployedHash != manifestsHash
+		case postInstallHook:
+			run = available && installedHash == manifestsHash
+		case postUpgradeHook:
+			run = available && installedHash != manifestsHash
+		}
+		if !run {
+			continue
+		}
+
+		if err := r.runHook(ctx, hook, hookWork, addon); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return true, utilerrors.NewAggregate(errs)
+}
+
+func (r *lifecycleHookRunner) runHook(ctx context.Context, hook lifecycleHook,
+	hookWork *workapiv1.ManifestWork, addon *addonapiv1beta1.ManagedClusterAddOn) error {
+	existingWork, err := r.getWork(hookWork.Namespace, hookWork.Name)
+	switch {
+	case errors.IsNotFound(err):
+	case err != nil:
+		return err
+	case existingWork.Annotations[constants.ManifestsHashAnnotationKey] !=
+		hookWork.Annotations[constants.ManifestsHashAnnotationKey]:
+		// the completed job or pod is not run again if it is updated, so delete the hook manifestWork of the
+		// previous installation or upgrade and create it again after it is deleted.
+		if existingWork.DeletionTimestamp.IsZero() {
+			klog.InfoS("Delete the hook manifestWork of the previous installation or upgrade",
+				"addonNamespace", addon.Namespace, "addonName", addon.Name, "workName", hookWork.Name)
+			if err := r.deleteWork(ctx, existingWork.Namespace, existingWork.Name); err != nil {
+				return err
+			}
+		}
+		meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
+			Type:    hook.conditionType,
+			Status:  metav1.ConditionFalse,
+			Reason:  "HookManifestIsNotCompleted",
+			Message: fmt.Sprintf("waiting for the previous hook manifestWork %v to be deleted.", hookWork.Name),
+		})
+		return nil
+	}
+
+	hookWork, err = r.applyWork(ctx, r.appliedType, hookWork, addon)
+	if err != nil {
+		return err
+	}
+
+	completed, failed := hookWorkStatus(hookWork)
+	if failed {
+		meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
+			Type:    hook.conditionType,
+			Status:  metav1.ConditionFalse,
+			Reason:  "HookManifestIsFailed",
+			Message: fmt.Sprintf("hook manifestWork %v is failed.", hookWork.Name),
+		})
+		return nil
+	}
+	if completed {
+		meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
+			Type:    hook.conditionType,
+			Status:  metav1.ConditionTrue,
+			Reason:  "HookManifestIsCompleted",
+			Message: fmt.Sprintf("hook manifestWork %v is completed.", hookWork.Name),
+		})
+		return nil
+	}
+
+	meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
+		Type:    hook.conditionType,
+		Status:  metav1.ConditionFalse,
+		Reason:  "HookManifestIsNotCompleted",
+		Message: fmt.Sprintf("hook manifestWork %v is not completed.", hookWork.Name),
+	})
+	return nil
+}
+
+// deployWorksAreAvailable returns true if the latest spec of all the deploy manifestWorks is available.
+func deployWorksAreAvailable(works []*workapiv1.ManifestWork) bool {
+	for _, work := range works {
+		cond := meta.FindStatusCondition(work.Status.Conditions, workapiv1.WorkAvailable)
+		if cond == nil || cond.Status != metav1.ConditionTrue || cond.ObservedGeneration != work.Generation {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,286 @@
+package agentdeploy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+	fakeaddon "open-cluster-management.io/api/client/addon/clientset/versioned/fake"
+	addoninformers "open-cluster-management.io/api/client/addon/informers/externalversions"
+	fakecluster "open-cluster-management.io/api/client/cluster/clientset/versioned/fake"
+	clusterv1informers "open-cluster-management.io/api/client/cluster/informers/externalversions"
+	fakework "open-cluster-management.io/api/client/work/clientset/versioned/fake"
+	workinformers "open-cluster-management.io/api/client/work/informers/externalversions"
+	workapiv1 "open-cluster-management.io/api/work/v1"
+	workapplier "open-cluster-management.io/sdk-go/pkg/apis/work/v1/applier"
+	workbuilder "open-cluster-management.io/sdk-go/pkg/apis/work/v1/builder"
+
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/addontesting"
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
+	"open-cluster-management.io/addon-framework/pkg/agent"
+	"open-cluster-management.io/addon-framework/pkg/index"
+)
+
+func newLifecycleHookJob(name, annotationKey string) *unstructured.Unstructured {
+	job := addontesting.NewUnstructured("batch/v1", "Job", "default", name)
+	job.SetAnnotations(map[string]string{annotationKey: ""})
+	return job
+}
+
+func setHookWorkCompleted(work *workapiv1.ManifestWork) *workapiv1.ManifestWork {
+	work.Status.Conditions = []metav1.Condition{
+		{Type: workapiv1.WorkAvailable, Status: metav1.ConditionTrue},
+	}
+	completed := "True"
+	for _, manifestConfig := range work.Spec.ManifestConfigs {
+		identifier := manifestConfig.ResourceIdentifier
+		work.Status.ResourceStatus.Manifests = append(work.Status.ResourceStatus.Manifests, workapiv1.ManifestCondition{
+			ResourceMeta: workapiv1.ManifestResourceMeta{
+				Group: identifier.Group, Resource: identifier.Resource, Name: identifier.Name, Namespace: identifier.Namespace,
+			},
+			StatusFeedbacks: workapiv1.StatusFeedbackResult{
+				Values: []workapiv1.FeedbackValue{
+					{Name: "JobComplete", Value: workapiv1.FieldValue{Type: workapiv1.String, String: &completed}},
+				},
+			},
+		})
+	}
+	return work
+}
+
+func TestLifecycleHookReconcile(t *testing.T) {
+	objects := []runtime.Object{
+		addontesting.NewUnstructured("v1", "ConfigMap", "default", "test"),
+		newLifecycleHookJob("post-install", constants.AddonPostInstallHookAnnotationKey),
+		newLifecycleHookJob("pre-upgrade", constants.AddonPreUpgradeHookAnnotationKey),
+		newLifecycleHookJob("post-upgrade", constants.AddonPostUpgradeHookAnnotationKey),
+	}
+	addon := addontesting.NewAddonWithConditions("test", "cluster1", registrationAppliedCondition)
+	builder := newAddonWorksBuilder(false, workbuilder.NewWorkBuilder())
+	manifestsHash, err := builder.lifecycleManifestsHash(constants.InstallModeDefault, objects)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployWorkName := fmt.Sprintf("%s-%d", constants.DeployWorkNamePrefix("test"), 0)
+
+	// deployWork returns the deploy work built from the objects with the given manifests hash annotations.
+	deployWork := func(hash, installedHash string, available bool) *workapiv1.ManifestWork {
+		works, _, err := builder.BuildDeployWorks(constants.InstallModeDefault, "cluster1", addon, nil, objects, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		work := works[0]
+		work.Annotations[constants.ManifestsHashAnnotationKey] = hash
+		work.Annotations[constants.InstalledManifestsHashAnnotationKey] = installedHash
+		if available {
+			work.Status.Conditions = []metav1.Condition{
+				{Type: workapiv1.WorkAvailable, Status: metav1.ConditionTrue},
+			}
+		}
+		return work
+	}
+	// hookWork returns the completed hook work built from the objects with the given manifests hash annotation.
+	hookWork := func(hook, hash string) *workapiv1.ManifestWork {
+		works, err := builder.BuildLifecycleHookWorks(constants.InstallModeDefault, "cluster1", addon, objects)
+		if err != nil {
+			t.Fatal(err)
+		}
+		work := works[hook]
+		work.Annotations[constants.ManifestsHashAnnotationKey] = hash
+		return setHookWorkCompleted(work)
+	}
+
+	cases := []struct {
+		name               string
+		existingWork       []runtime.Object
+		expectedWorkAction map[string]string
+		expectedCondition  *metav1.Condition
+		validateWork       func(t *testing.T, work *workapiv1.ManifestWork)
+	}{
+		{
+			name:               "install",
+			expectedWorkAction: map[string]string{deployWorkName: "create"},
+			validateWork: func(t *testing.T, work *workapiv1.ManifestWork) {
+				if work.Annotations[constants.ManifestsHashAnnotationKey] != manifestsHash ||
+					work.Annotations[constants.InstalledManifestsHashAnnotationKey] != manifestsHash {
+					t.Errorf("expected the manifests hash annotations are set, but got %v", work.Annotations)
+				}
+				if len(work.Spec.Workload.Manifests) != 1 {
+					t.Errorf("expected the hook jobs are not in the deploy work, but got %d manifests",
+						len(work.Spec.Workload.Manifests))
+				}
+			},
+		},
+		{
+			name:               "installed and not available",
+			existingWork:       []runtime.Object{deployWork(manifestsHash, manifestsHash, false)},
+			expectedWorkAction: map[string]string{},
+		},
+		{
+			name:         "run post-install hook",
+			existingWork: []runtime.Object{deployWork(manifestsHash, manifestsHash, true)},
+			expectedWorkAction: map[string]string{
+				constants.PostInstallHookWorkName("test"): "create",
+			},
+			expectedCondition: &metav1.Condition{
+				Type:   constants.AddonConditionPostInstallHookCompleted,
+				Status: metav1.ConditionFalse,
+			},
+		},
+		{
+			name:         "run pre-upgrade hook before upgrade",
+			existingWork: []runtime.Object{deployWork("old", "old", true)},
+			expectedWorkAction: map[string]string{
+				constants.PreUpgradeHookWorkName("test"): "create",
+			},
+			expectedCondition: &metav1.Condition{
+				Type:   constants.AddonConditionPreUpgradeHookCompleted,
+				Status: metav1.ConditionFalse,
+			},
+		},
+		{
+			name: "upgrade after pre-upgrade hook is completed",
+			existingWork: []runtime.Object{
+				deployWork("old", "old", true),
+				hookWork(constants.AddonPreUpgradeHookAnnotationKey, manifestsHash),
+			},
+			expectedWorkAction: map[string]string{deployWorkName: "patch"},
+		},
+		{
+			name: "rerun pre-upgrade hook of the previous upgrade",
+			existingWork: []runtime.Object{
+				deployWork("old", "old", true),
+				hookWork(constants.AddonPreUpgradeHookAnnotationKey, "old"),
+			},
+			expectedWorkAction: map[string]string{constants.PreUpgradeHookWorkName("test"): "delete"},
+		},
+		{
+			name:         "run post-upgrade hook",
+			existingWork: []runtime.Object{deployWork(manifestsHash, "old", true)},
+			expectedWorkAction: map[string]string{
+				constants.PostUpgradeHookWorkName("test"): "create",
+			},
+			expectedCondition: &metav1.Condition{
+				Type:   constants.AddonConditionPostUpgradeHookCompleted,
+				Status: metav1.ConditionFalse,
+			},
+		},
+		{
+			name: "post-upgrade hook is completed",
+			existingWork: []runtime.Object{
+				deployWork(manifestsHash, "old", true),
+				hookWork(constants.AddonPostUpgradeHookAnnotationKey, manifestsHash),
+			},
+			expectedWorkAction: map[string]string{},
+			expectedCondition: &metav1.Condition{
+				Type:   constants.AddonConditionPostUpgradeHookCompleted,
+				Status: metav1.ConditionTrue,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			testAddon := &testAgent{name: "test", objects: objects}
+
+			fakeWorkClient := fakework.NewSimpleClientset(c.existingWork...)
+			fakeClusterClient := fakecluster.NewSimpleClientset(addontesting.NewManagedCluster("cluster1"))
+			fakeAddonClient := fakeaddon.NewSimpleClientset(addon)
+
+			workInformerFactory := workinformers.NewSharedInformerFactory(fakeWorkClient, 10*time.Minute)
+			addonInformers := addoninformers.NewSharedInformerFactory(fakeAddonClient, 10*time.Minute)
+			clusterInformers := clusterv1informers.NewSharedInformerFactory(fakeClusterClient, 10*time.Minute)
+
+			err := workInformerFactory.Work().V1().ManifestWorks().Informer().AddIndexers(
+				cache.Indexers{
+					index.ManifestWorkByAddon:           index.IndexManifestWorkByAddon,
+					index.ManifestWorkByHostedAddon:     index.IndexManifestWorkByHostedAddon,
+					index.ManifestWorkHookByHostedAddon: index.IndexManifestWorkHookByHostedAddon,
+				},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := clusterInformers.Cluster().V1().ManagedClusters().Informer().GetStore().Add(
+				addontesting.NewManagedCluster("cluster1")); err != nil {
+				t.Fatal(err)
+			}
+			if err := addonInformers.Addon().V1beta1().ManagedClusterAddOns().Informer().GetStore().Add(addon); err != nil {
+				t.Fatal(err)
+			}
+			for _, obj := range c.existingWork {
+				if err := workInformerFactory.Work().V1().ManifestWorks().Informer().GetStore().Add(obj); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			controller := addonDeployController{
+				workApplier:               workapplier.NewWorkApplierWithTypedClient(fakeWorkClient, workInformerFactory.Work().V1().ManifestWorks().Lister()),
+				workBuilder:               workbuilder.NewWorkBuilder(),
+				addonClient:               fakeAddonClient,
+				managedClusterLister:      clusterInformers.Cluster().V1().ManagedClusters().Lister(),
+				managedClusterAddonLister: addonInformers.Addon().V1beta1().ManagedClusterAddOns().Lister(),
+				workIndexer:               workInformerFactory.Work().V1().ManifestWorks().Informer().GetIndexer(),
+				workLister:                workInformerFactory.Work().V1().ManifestWorks().Lister(),
+				agentAddons:               map[string]agent.AgentAddon{testAddon.name: testAddon},
+			}
+
+			syncContext := addontesting.NewFakeSyncContext(t)
+			if err := controller.sync(context.TODO(), syncContext, "cluster1/test"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			workActions := map[string]string{}
+			for _, action := range fakeWorkClient.Actions() {
+				switch action := action.(type) {
+				case clienttesting.CreateActionImpl:
+					work := action.Object.(*workapiv1.ManifestWork)
+					workActions[work.Name] = action.GetVerb()
+					if c.validateWork != nil {
+						c.validateWork(t, work)
+					}
+				case clienttesting.PatchActionImpl:
+					workActions[action.Name] = action.GetVerb()
+				case clienttesting.DeleteActionImpl:
+					workActions[action.Name] = action.GetVerb()
+				}
+			}
+			if len(workActions) != len(c.expectedWorkAction) {
+				t.Errorf("expected work actions %v, but got %v", c.expectedWorkAction, workActions)
+			}
+			for name, verb := range c.expectedWorkAction {
+				if workActions[name] != verb {
+					t.Errorf("expected work %s is %s, but got %v", name, verb, workActions)
+				}
+			}
+
+			if c.expectedCondition == nil {
+				return
+			}
+			patchedAddon := &addonapiv1beta1.ManagedClusterAddOn{}
+			for _, action := range fakeAddonClient.Actions() {
+				patchAction, ok := action.(clienttesting.PatchActionImpl)
+				if !ok || patchAction.GetSubresource() != "status" {
+					continue
+				}
+				if err := json.Unmarshal(patchAction.Patch, patchedAddon); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cond := meta.FindStatusCondition(patchedAddon.Status.Conditions, c.expectedCondition.Type)
+			if cond == nil || cond.Status != c.expectedCondition.Status {
+				t.Errorf("expected condition %v, but got %v", c.expectedCondition, cond)
+			}
+		})
+	}
+}
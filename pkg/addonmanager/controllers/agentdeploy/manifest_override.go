@@ -0,0 +1,88 @@
+package agentdeploy
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+
+	"open-cluster-management.io/addon-framework/pkg/agent"
+	"open-cluster-management.io/addon-framework/pkg/utils"
+)
+
+// manifestOverrideAgentAddon wraps the agentAddon which supports the manifest override config, the patches in
+// the manifest override config of the addon are applied to the manifests of the agentAddon, before the
+// manifestWorks are built from the manifests.
+type manifestOverrideAgentAddon struct {
+	agent.AgentAddon
+	getter utils.ManifestOverrideConfigGetter
+}
+
+func (a *manifestOverrideAgentAddon) Manifests(ctx context.Context,
+	cluster *clusterv1.ManagedCluster, addon *addonapiv1beta1.ManagedClusterAddOn) ([]runtime.Object, error) {
+	objects, err := a.AgentAddon.Manifests(ctx, cluster, addon)
+	if err != nil {
+		return nil, err
+	}
+
+	patches, err := utils.GetDesiredManifestPatches(ctx, addon, a.getter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the manifest override config: %v", err)
+	}
+	return utils.ApplyManifestPatches(objects, patches)
+}
+
+type manifestOverrideGetter struct {
+	lister cache.GenericLister
+}
+
+func (g *manifestOverrideGetter) Get(_ context.Context, namespace, name string) (*unstructured.Unstructured, error) {
+	obj, err := g.lister.ByNamespace(namespace).Get(name)
+	if err != nil {
+		return nil, err
+	}
+	config, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type %T of manifestoverride %s/%s", obj, namespace, name)
+	}
+	return config, nil
+}
+
+// withManifestOverride wraps the agentAddon to apply the manifest overrides if it supports the manifest
+// override config.
+func withManifestOverride(agentAddon agent.AgentAddon, getter utils.ManifestOverrideConfigGetter) agent.AgentAddon {
+	if getter == nil {
+		return agentAddon
+	}
+	for _, gvr := range agentAddon.GetAgentAddonOptions().SupportedConfigGVRs {
+		if gvr == utils.ManifestOverrideConfigGVR {
+			return &manifestOverrideAgentAddon{
+				AgentAddon: agentAddon,
+				getter:     getter,
+			}
+		}
+	}
+	return agentAddon
+}
+
+// withManifestOverrides returns the agentAddons in which the agentAddons supporting the manifest override
+// config are wrapped to apply the manifest overrides.
+func withManifestOverrides(agentAddons map[string]agent.AgentAddon,
+	manifestOverrideInformers informers.GenericInformer) map[string]agent.AgentAddon {
+	if manifestOverrideInformers == nil {
+		return agentAddons
+	}
+
+	getter := &manifestOverrideGetter{lister: manifestOverrideInformers.Lister()}
+	wrapped := map[string]agent.AgentAddon{}
+	for name, agentAddon := range agentAddons {
+		wrapped[name] = withManifestOverride(agentAddon, getter)
+	}
+	return wrapped
+}
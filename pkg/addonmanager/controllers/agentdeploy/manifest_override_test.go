@@ -0,0 +1,126 @@
+package agentdeploy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/addontesting"
+	"open-cluster-management.io/addon-framework/pkg/agent"
+	"open-cluster-management.io/addon-framework/pkg/utils"
+)
+
+func TestManifestOverrideAgentAddon(t *testing.T) {
+	overrideConfigRef := addonapiv1beta1.ConfigReference{
+		ConfigGroupResource: addonapiv1beta1.ConfigGroupResource{
+			Group:    utils.ManifestOverrideConfigGVR.Group,
+			Resource: utils.ManifestOverrideConfigGVR.Resource,
+		},
+		DesiredConfig: &addonapiv1beta1.ConfigSpecHash{
+			ConfigReferent: addonapiv1beta1.ConfigReferent{Namespace: "cluster1", Name: "override"},
+			SpecHash:       "hash",
+		},
+	}
+	overrideConfig := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": utils.ManifestOverrideConfigGVR.GroupVersion().String(),
+		"kind":       "ManifestOverride",
+		"metadata":   map[string]interface{}{"name": "override", "namespace": "cluster1"},
+		"spec": map[string]interface{}{
+			"patches": []interface{}{
+				map[string]interface{}{
+					"target": map[string]interface{}{"kind": "ConfigMap", "name": "test"},
+					"patch":  "data:\n  key: override\n",
+				},
+			},
+		},
+	}}
+	// a ConfigMap referenced by the addon, e.g. the values of a helm addon, is not a manifest override config.
+	valuesConfigRef := addonapiv1beta1.ConfigReference{
+		ConfigGroupResource: addonapiv1beta1.ConfigGroupResource{Resource: "configmaps"},
+		DesiredConfig: &addonapiv1beta1.ConfigSpecHash{
+			ConfigReferent: addonapiv1beta1.ConfigReferent{Namespace: "cluster1", Name: "values"},
+			SpecHash:       "hash",
+		},
+	}
+
+	cases := []struct {
+		name          string
+		configGVRs    []schema.GroupVersionResource
+		configRefs    []addonapiv1beta1.ConfigReference
+		configs       []runtime.Object
+		expectedValue string
+		expectedErr   bool
+	}{
+		{
+			name:          "manifest override is not supported",
+			configRefs:    []addonapiv1beta1.ConfigReference{overrideConfigRef},
+			configs:       []runtime.Object{overrideConfig},
+			expectedValue: "value",
+		},
+		{
+			name:          "no manifest override config",
+			configGVRs:    []schema.GroupVersionResource{utils.ManifestOverrideConfigGVR},
+			expectedValue: "value",
+		},
+		{
+			name:          "configmap config is not a manifest override config",
+			configGVRs:    []schema.GroupVersionResource{utils.ManifestOverrideConfigGVR},
+			configRefs:    []addonapiv1beta1.ConfigReference{valuesConfigRef},
+			expectedValue: "value",
+		},
+		{
+			name:        "manifest override config is not found",
+			configGVRs:  []schema.GroupVersionResource{utils.ManifestOverrideConfigGVR},
+			configRefs:  []addonapiv1beta1.ConfigReference{overrideConfigRef},
+			expectedErr: true,
+		},
+		{
+			name:          "manifests are overridden",
+			configGVRs:    []schema.GroupVersionResource{utils.ManifestOverrideConfigGVR},
+			configRefs:    []addonapiv1beta1.ConfigReference{overrideConfigRef},
+			configs:       []runtime.Object{overrideConfig},
+			expectedValue: "override",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dynamicInformers := dynamicinformer.NewDynamicSharedInformerFactory(
+				fakedynamic.NewSimpleDynamicClient(runtime.NewScheme()), 10*time.Minute)
+			manifestOverrideInformers := dynamicInformers.ForResource(utils.ManifestOverrideConfigGVR)
+			for _, obj := range c.configs {
+				if err := manifestOverrideInformers.Informer().GetStore().Add(obj); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			cm := addontesting.NewUnstructured("v1", "ConfigMap", "default", "test")
+			cm.Object["data"] = map[string]interface{}{"key": "value"}
+			agentAddons := withManifestOverrides(map[string]agent.AgentAddon{
+				"test": &testAgent{name: "test", objects: []runtime.Object{cm}, configGVRs: c.configGVRs},
+			}, manifestOverrideInformers)
+
+			addon := addontesting.NewAddon("test", "cluster1")
+			addon.Status.ConfigReferences = c.configRefs
+			objects, err := agentAddons["test"].Manifests(context.TODO(), addontesting.NewManagedCluster("cluster1"), addon)
+			if c.expectedErr != (err != nil) {
+				t.Fatalf("expected error %v, but got %v", c.expectedErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			value, _, _ := unstructured.NestedString(objects[0].(*unstructured.Unstructured).Object, "data", "key")
+			if value != c.expectedValue {
+				t.Errorf("expected value %s, but got %s", c.expectedValue, value)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package agentdeploy
+
+import (
+	"context"
+	"fmt"
+
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	workapiv1 "open-cluster-management.io/api/work/v1"
+
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
+	"open-cluster-management.io/addon-framework/pkg/agent"
+	"open-cluster-management.io/addon-framework/pkg/utils"
+)
+
+// RenderedManifestWorks contains the manifestWorks of an addon rendered by RenderManifestWorks.
+type RenderedManifestWorks struct {
+	// InstallMode is the install mode of the addon, Default or Hosted.
+	InstallMode string
+
+	// HostingClusterName is the name of the hosting cluster, it is only set in Hosted mode.
+	HostingClusterName string
+
+	// DeployWorks are the manifestWorks deployed in the managed cluster namespace.
+	DeployWorks []*workapiv1.ManifestWork
+
+	// PreDeleteHookWork is the pre-delete hook manifestWork deployed in the managed cluster namespace.
+	PreDeleteHookWork *workapiv1.ManifestWork
+
+	// LifecycleHookWorks are the post-install, pre-upgrade and post-upgrade hook manifestWorks deployed in the
+	// managed cluster namespace.
+	LifecycleHookWorks []*workapiv1.ManifestWork
+
+	// HostingDeployWorks are the manifestWorks deployed in the hosting cluster namespace in Hosted mode.
+	HostingDeployWorks []*workapiv1.ManifestWork
+
+	// HostingPreDeleteHookWork is the pre-delete hook manifestWork deployed in the hosting cluster namespace
+	// in Hosted mode.
+	HostingPreDeleteHookWork *workapiv1.ManifestWork
+
+	// HostingLifecycleHookWorks are the post-install, pre-upgrade and post-upgrade hook manifestWorks deployed
+	// in the hosting cluster namespace in Hosted mode.
+	HostingLifecycleHookWorks []*workapiv1.ManifestWork
+}
+
+// RenderManifestWorks renders the manifestWorks of the addon on the given cluster in the same way as the
+// addon deploy controller, without accessing the hub. It can be used to preview the manifestWorks of an
+// addon offline, e.g. to catch the regressions of the addon manifests in the CI.
+//
+// The Configured condition of the addon is not checked even if the ConfigCheckEnabled is set, so the addon
+// configs that the agentAddon depends on should be available to the agentAddon when rendering. The manifest
+// overrides are applied by the manifestOverrideGetter if the agentAddon supports the manifest override config,
+// they are not applied if the manifestOverrideGetter is nil.
+func RenderManifestWorks(ctx context.Context, agentAddon agent.AgentAddon,
+	cluster *clusterv1.ManagedCluster, addon *addonapiv1beta1.ManagedClusterAddOn,
+	manifestOverrideGetter utils.ManifestOverrideConfigGetter) (*RenderedManifestWorks, error) {
+	if agentAddon == nil || cluster == nil || addon == nil {
+		return nil, fmt.Errorf("agentAddon, cluster and addon are required")
+	}
+	agentAddon = withManifestOverride(agentAddon, manifestOverrideGetter)
+
+	rendered := &RenderedManifestWorks{InstallMode: constants.InstallModeDefault}
+	if agentAddon.GetAgentAddonOptions().HostedModeInfoFunc != nil {
+		rendered.InstallMode, rendered.HostingClusterName = agentAddon.GetAgentAddonOptions().HostedModeInfoFunc(addon, cluster)
+	}
+
+	objects, err := agentAddon.Manifests(ctx, cluster, addon)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get manifest from agent interface: %v", err)
+	}
+
+	manifestOptions, err := getManifestConfigOption(ctx, agentAddon, cluster, addon)
+	if err != nil {
+		return nil, fmt.Errorf("get manifest config option error: %v", err)
+	}
+	workAnnotations, err := getManifestWorkAnnotations(ctx, agentAddon, cluster, addon)
+	if err != nil {
+		return nil, fmt.Errorf("get manifestwork annotations error: %v", err)
+	}
+
+	hostedModeEnabled := agentAddon.GetAgentAddonOptions().HostedModeEnabled
+	workBuilder := newAddonWorksBuilder(hostedModeEnabled, newWorkBuilder())
+	rendered.DeployWorks, _, err = workBuilder.BuildDeployWorks(
+		rendered.InstallMode, addon.Namespace, addon, nil, objects, manifestOptions, workAnnotations)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build manifestwork: %v", err)
+	}
+	rendered.PreDeleteHookWork, err = workBuilder.BuildHookWork(rendered.InstallMode, addon.Namespace, addon, objects)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build hook manifestwork: %v", err)
+	}
+	hookWorks, err := workBuilder.BuildLifecycleHookWorks(rendered.InstallMode, addon.Namespace, addon, objects)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build lifecycle hook manifestwork: %v", err)
+	}
+	rendered.LifecycleHookWorks = sortLifecycleHookWorks(hookWorks)
+	setSensitiveDataAnnotation(workAnnotations, rendered.PreDeleteHookWork)
+	setSensitiveDataAnnotation(workAnnotations, rendered.LifecycleHookWorks...)
+
+	if !hostedModeEnabled || rendered.InstallMode != constants.InstallModeHosted {
+		return rendered, nil
+	}
+	if len(rendered.HostingClusterName) == 0 {
+		return nil, fmt.Errorf("hosting cluster of addon %s/%s is not set", addon.Namespace, addon.Name)
+	}
+
+	hostingWorkBuilder := newHostingAddonWorksBuilder(hostedModeEnabled, newWorkBuilder())
+	rendered.HostingDeployWorks, _, err = hostingWorkBuilder.BuildDeployWorks(
+		rendered.InstallMode, rendered.HostingClusterName, addon, nil, objects, manifestOptions, workAnnotations)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build hosting manifestwork: %v", err)
+	}
+	rendered.HostingPreDeleteHookWork, err = hostingWorkBuilder.BuildHookWork(
+		rendered.InstallMode, rendered.HostingClusterName, addon, objects)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build hosting hook manifestwork: %v", err)
+	}
+	hookWorks, err = hostingWorkBuilder.BuildLifecycleHookWorks(
+		rendered.InstallMode, rendered.HostingClusterName, addon, objects)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build hosting lifecycle hook manifestwork: %v", err)
+	}
+	rendered.HostingLifecycleHookWorks = sortLifecycleHookWorks(hookWorks)
+	setSensitiveDataAnnotation(workAnnotations, rendered.HostingPreDeleteHookWork)
+	setSensitiveDataAnnotation(workAnnotations, rendered.HostingLifecycleHookWorks...)
+
+	return rendered, nil
+}
+
+// sortLifecycleHookWorks returns the lifecycle hook manifestWorks in the order of post-install, pre-upgrade
+// and post-upgrade.
+func sortLifecycleHookWorks(hookWorks map[string]*workapiv1.ManifestWork) []*workapiv1.ManifestWork {
+	var works []*workapiv1.ManifestWork
+	for _, hook := range lifecycleHooks {
+		if work, ok := hookWorks[hook.annotationKey]; ok {
+			works = append(works, work)
+		}
+	}
+	return works
+}
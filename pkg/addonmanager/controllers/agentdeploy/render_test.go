@@ -0,0 +1,203 @@
+package agentdeploy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	workapiv1 "open-cluster-management.io/api/work/v1"
+
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/addontesting"
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
+	"open-cluster-management.io/addon-framework/pkg/agent"
+	"open-cluster-management.io/addon-framework/pkg/utils"
+)
+
+func TestRenderManifestWorks(t *testing.T) {
+	cases := []struct {
+		name           string
+		agentAddon     agent.AgentAddon
+		cluster        *clusterv1.ManagedCluster
+		addon          *addonapiv1beta1.ManagedClusterAddOn
+		getter         utils.ManifestOverrideConfigGetter
+		expectErr      bool
+		validateResult func(t *testing.T, rendered *RenderedManifestWorks)
+	}{
+		{
+			name:       "manifests error",
+			cluster:    addontesting.NewManagedCluster("cluster1"),
+			addon:      addontesting.NewAddon("test", "cluster1"),
+			agentAddon: &testAgent{name: "test", err: fmt.Errorf("failed to render")},
+			expectErr:  true,
+		},
+		{
+			name:    "default mode",
+			cluster: addontesting.NewManagedCluster("cluster1"),
+			addon:   addontesting.NewAddon("test", "cluster1"),
+			agentAddon: &testAgent{name: "test", objects: []runtime.Object{
+				addontesting.NewUnstructured("v1", "ConfigMap", "default", "test"),
+				addontesting.NewHookJob("test", "default"),
+			}},
+			validateResult: func(t *testing.T, rendered *RenderedManifestWorks) {
+				if rendered.InstallMode != constants.InstallModeDefault {
+					t.Errorf("expected default install mode, but got %s", rendered.InstallMode)
+				}
+				assertRenderedWork(t, rendered.DeployWorks, "cluster1",
+					fmt.Sprintf("%s-0", constants.DeployWorkNamePrefix("test")))
+				assertRenderedWork(t, []*workapiv1.ManifestWork{rendered.PreDeleteHookWork}, "cluster1",
+					constants.PreDeleteHookWorkName("test"))
+				if len(rendered.HostingDeployWorks) != 0 || rendered.HostingPreDeleteHookWork != nil {
+					t.Errorf("expected no hosting works, but got %v, %v",
+						rendered.HostingDeployWorks, rendered.HostingPreDeleteHookWork)
+				}
+			},
+		},
+		{
+			name:    "manifest overrides",
+			cluster: addontesting.NewManagedCluster("cluster1"),
+			addon: func() *addonapiv1beta1.ManagedClusterAddOn {
+				addon := addontesting.NewAddon("test", "cluster1")
+				addon.Status.ConfigReferences = []addonapiv1beta1.ConfigReference{{
+					ConfigGroupResource: addonapiv1beta1.ConfigGroupResource{
+						Group:    utils.ManifestOverrideConfigGVR.Group,
+						Resource: utils.ManifestOverrideConfigGVR.Resource,
+					},
+					DesiredConfig: &addonapiv1beta1.ConfigSpecHash{
+						ConfigReferent: addonapiv1beta1.ConfigReferent{Namespace: "cluster1", Name: "override"},
+						SpecHash:       "hash",
+					},
+				}}
+				return addon
+			}(),
+			agentAddon: &testAgent{name: "test", objects: []runtime.Object{
+				addontesting.NewUnstructured("v1", "ConfigMap", "default", "test"),
+			}, configGVRs: []schema.GroupVersionResource{utils.ManifestOverrideConfigGVR}},
+			getter: testManifestOverrideGetter{&unstructured.Unstructured{Object: map[string]interface{}{
+				"metadata": map[string]interface{}{"name": "override", "namespace": "cluster1"},
+				"spec": map[string]interface{}{
+					"patches": []interface{}{
+						map[string]interface{}{
+							"target": map[string]interface{}{"kind": "ConfigMap", "name": "test"},
+							"patch":  "data:\n  key: override\n",
+						},
+					},
+				},
+			}}},
+			validateResult: func(t *testing.T, rendered *RenderedManifestWorks) {
+				assertRenderedWork(t, rendered.DeployWorks, "cluster1",
+					fmt.Sprintf("%s-0", constants.DeployWorkNamePrefix("test")))
+				if manifests := rendered.DeployWorks[0].Spec.Workload.Manifests; len(manifests) != 1 ||
+					!strings.Contains(string(manifests[0].Raw), `"key":"override"`) {
+					t.Errorf("expected the manifest is overridden, but got %v", manifests)
+				}
+			},
+		},
+		{
+			name:    "manifestWork annotations",
+			cluster: addontesting.NewManagedCluster("cluster1"),
+			addon:   addontesting.NewAddon("test", "cluster1"),
+			agentAddon: &testAgent{
+				name:            "test",
+				objects:         []runtime.Object{addontesting.NewUnstructured("v1", "ConfigMap", "default", "test")},
+				workAnnotations: map[string]string{constants.ValuesProvenanceAnnotationKey: "{}"},
+			},
+			validateResult: func(t *testing.T, rendered *RenderedManifestWorks) {
+				assertRenderedWork(t, rendered.DeployWorks, "cluster1",
+					fmt.Sprintf("%s-0", constants.DeployWorkNamePrefix("test")))
+				if value := rendered.DeployWorks[0].Annotations[constants.ValuesProvenanceAnnotationKey]; value != "{}" {
+					t.Errorf("expected the values provenance annotation, but got %q", value)
+				}
+			},
+		},
+		{
+			name:    "hook work with sensitive data",
+			cluster: addontesting.NewManagedCluster("cluster1"),
+			addon:   addontesting.NewAddon("test", "cluster1"),
+			agentAddon: &testAgent{
+				name: "test",
+				objects: []runtime.Object{
+					addontesting.NewUnstructured("v1", "ConfigMap", "default", "test"),
+					addontesting.NewHookJob("test", "default"),
+				},
+				workAnnotations: map[string]string{constants.SensitiveDataAnnotationKey: "true"},
+			},
+			validateResult: func(t *testing.T, rendered *RenderedManifestWorks) {
+				assertRenderedWork(t, []*workapiv1.ManifestWork{rendered.PreDeleteHookWork}, "cluster1",
+					constants.PreDeleteHookWorkName("test"))
+				if _, ok := rendered.PreDeleteHookWork.Annotations[constants.SensitiveDataAnnotationKey]; !ok {
+					t.Errorf("expected the sensitive data annotation on the hook work, but got %v",
+						rendered.PreDeleteHookWork.Annotations)
+				}
+			},
+		},
+		{
+			name:    "hosted mode",
+			cluster: addontesting.NewManagedCluster("cluster1"),
+			addon:   addontesting.NewHostedModeAddon("test", "cluster1", "cluster2"),
+			agentAddon: &testHostedAgent{name: "test", objects: []runtime.Object{
+				addontesting.NewUnstructured("v1", "ConfigMap", "default", "test"),
+				addontesting.NewHostingUnstructured("v1", "Deployment", "default", "test"),
+				addontesting.NewHostedHookJob("test", "default"),
+			}},
+			validateResult: func(t *testing.T, rendered *RenderedManifestWorks) {
+				if rendered.InstallMode != constants.InstallModeHosted || rendered.HostingClusterName != "cluster2" {
+					t.Errorf("expected hosted install mode on cluster2, but got %s, %s",
+						rendered.InstallMode, rendered.HostingClusterName)
+				}
+				assertRenderedWork(t, rendered.DeployWorks, "cluster1",
+					fmt.Sprintf("%s-0", constants.DeployWorkNamePrefix("test")))
+				if rendered.PreDeleteHookWork != nil {
+					t.Errorf("expected no pre-delete hook work on the managed cluster, but got %v",
+						rendered.PreDeleteHookWork)
+				}
+				assertRenderedWork(t, rendered.HostingDeployWorks, "cluster2",
+					fmt.Sprintf("%s-0", constants.DeployHostingWorkNamePrefix("cluster1", "test")))
+				assertRenderedWork(t, []*workapiv1.ManifestWork{rendered.HostingPreDeleteHookWork}, "cluster2",
+					constants.PreDeleteHookHostingWorkName("cluster1", "test"))
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rendered, err := RenderManifestWorks(context.TODO(), c.agentAddon, c.cluster, c.addon, c.getter)
+			if c.expectErr {
+				if err == nil {
+					t.Errorf("expected error, but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			c.validateResult(t, rendered)
+		})
+	}
+}
+
+type testManifestOverrideGetter []*unstructured.Unstructured
+
+func (g testManifestOverrideGetter) Get(_ context.Context, namespace, name string) (*unstructured.Unstructured, error) {
+	for _, config := range g {
+		if config.GetNamespace() == namespace && config.GetName() == name {
+			return config, nil
+		}
+	}
+	return nil, fmt.Errorf("manifestoverride %s/%s is not found", namespace, name)
+}
+
+func assertRenderedWork(t *testing.T, works []*workapiv1.ManifestWork, namespace, name string) {
+	if len(works) != 1 || works[0] == nil {
+		t.Fatalf("expected 1 work, but got %v", works)
+	}
+	if works[0].Namespace != namespace || works[0].Name != name {
+		t.Errorf("expected work %s/%s, but got %s/%s", namespace, name, works[0].Namespace, works[0].Name)
+	}
+}
@@ -0,0 +1,397 @@
+package agentdeploy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	corev1informers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	corev1lister "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
+
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	workapiv1 "open-cluster-management.io/api/work/v1"
+	"open-cluster-management.io/sdk-go/pkg/basecontroller/factory"
+
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
+	"open-cluster-management.io/addon-framework/pkg/agent"
+)
+
+const (
+	// the keys in the last known good Secret of a deploy manifestWork, the spec is gzip compressed.
+	lastKnownGoodSpecKey = "spec"
+	lastKnownGoodHashKey = "hash"
+	// rolledBackHashKey is the spec hash of the work which is rolled back.
+	rolledBackHashKey = "rolled-back"
+	// appliedHashKey and appliedTimeKey are the changed spec hash of the work and when it is observed to
+	// be applied, the grace period of the rollback starts from the applied time.
+	appliedHashKey = "applied-hash"
+	appliedTimeKey = "applied-time"
+
+	// maxLastKnownGoodSpecSize is the max size of the compressed last known good spec, which leaves room for
+	// the other keys and the metadata in the 1MiB limit of a Secret.
+	maxLastKnownGoodSpecSize = 900 * 1024
+)
+
+// rollbackStore reads and writes the last known good Secrets of the deploy manifestWorks. Each deploy
+// manifestWork has its own Secret, so the size of a Secret is bounded by the size of a work. The specs are
+// recorded in Secrets rather than ConfigMaps since the manifests may contain Secrets of the addon agent.
+type rollbackStore struct {
+	kubeClient   kubernetes.Interface
+	secretLister corev1lister.SecretLister
+}
+
+func newRollbackStore(kubeClient kubernetes.Interface, secretInformers corev1informers.SecretInformer) *rollbackStore {
+	if secretInformers == nil {
+		return nil
+	}
+	return &rollbackStore{
+		kubeClient:   kubeClient,
+		secretLister: secretInformers.Lister(),
+	}
+}
+
+// get returns the data of the last known good Secret of the work, it is empty if the Secret does not exist.
+func (s *rollbackStore) get(addon *addonapiv1beta1.ManagedClusterAddOn, workName string) (map[string]string, error) {
+	secret, err := s.secretLister.Secrets(addon.Namespace).Get(constants.LastKnownGoodSecretName(workName))
+	switch {
+	case errors.IsNotFound(err):
+		return map[string]string{}, nil
+	case err != nil:
+		return nil, err
+	}
+	data := map[string]string{}
+	for k, v := range secret.Data {
+		data[k] = string(v)
+	}
+	return data, nil
+}
+
+// update mutates the data of the last known good Secret of the work, the Secret is created if it does not
+// exist. The Secret is owned by the addon, so it is deleted with the addon.
+func (s *rollbackStore) update(ctx context.Context, addon *addonapiv1beta1.ManagedClusterAddOn, workName string,
+	mutate func(data map[string]string)) error {
+	name := constants.LastKnownGoodSecretName(workName)
+	secret, err := s.secretLister.Secrets(addon.Namespace).Get(name)
+	if errors.IsNotFound(err) {
+		data := map[string]string{}
+		mutate(data)
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: addon.Namespace,
+				Labels: map[string]string{
+					addonapiv1beta1.AddonLabelKey: addon.Name,
+				},
+				OwnerReferences: []metav1.OwnerReference{
+					*metav1.NewControllerRef(addon, schema.GroupVersionKind{
+						Group:   addonapiv1beta1.GroupName,
+						Version: addonapiv1beta1.GroupVersion.Version,
+						Kind:    "ManagedClusterAddOn",
+					}),
+				},
+			},
+			Type: corev1.SecretTypeOpaque,
+			Data: toSecretData(data),
+		}
+		_, err = s.kubeClient.CoreV1().Secrets(addon.Namespace).Create(ctx, secret, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	data := map[string]string{}
+	for k, v := range secret.Data {
+		data[k] = string(v)
+	}
+	mutate(data)
+	secretData := toSecretData(data)
+	if equality.Semantic.DeepEqual(secretData, secret.Data) {
+		return nil
+	}
+	secret = secret.DeepCopy()
+	secret.Data = secretData
+	_, err = s.kubeClient.CoreV1().Secrets(addon.Namespace).Update(ctx, secret, metav1.UpdateOptions{})
+	return err
+}
+
+func toSecretData(data map[string]string) map[string][]byte {
+	secretData := make(map[string][]byte, len(data))
+	for k, v := range data {
+		secretData[k] = []byte(v)
+	}
+	return secretData
+}
+
+// encodeSpec returns the gzip compressed json of the work spec, since the spec of a work with CRDs may be
+// larger than the limit of a Secret.
+func encodeSpec(spec workapiv1.ManifestWorkSpec) (string, error) {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(data); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func decodeSpec(data string) (*workapiv1.ManifestWorkSpec, error) {
+	reader, err := gzip.NewReader(strings.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	raw, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	spec := &workapiv1.ManifestWorkSpec{}
+	if err := json.Unmarshal(raw, spec); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// isSensitiveWork returns true if the manifests of the work contain the sensitive data, the spec of the
+// work is not recorded, so the work is not rolled back.
+func isSensitiveWork(work *workapiv1.ManifestWork) bool {
+	_, ok := work.Annotations[constants.SensitiveDataAnnotationKey]
+	return ok
+}
+
+// rollbackApplyWorkFunc wraps the applyWork with the rollback option of the addon. The deploy manifestWorks
+// in the cluster namespace are annotated with the hash of the spec rendered from the addon manifests, and
+// the last known good spec is applied instead if the rendered spec has been rolled back.
+func (c *addonDeployController) rollbackApplyWorkFunc(option *agent.RollbackOption, applyWork applyWorkFunc) applyWorkFunc {
+	if option == nil || c.rollbackStore == nil {
+		return applyWork
+	}
+
+	return func(ctx context.Context, appliedType string,
+		work *workapiv1.ManifestWork, addon *addonapiv1beta1.ManagedClusterAddOn) (*workapiv1.ManifestWork, error) {
+		if work.Namespace != addon.Namespace || isSensitiveWork(work) {
+			return applyWork(ctx, appliedType, work, addon)
+		}
+
+		specHash, err := getWorkSpecHash(work)
+		if err != nil {
+			return nil, err
+		}
+		data, err := c.rollbackStore.get(addon, work.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		work = work.DeepCopy()
+		if work.Annotations == nil {
+			work.Annotations = map[string]string{}
+		}
+		work.Annotations[constants.WorkSpecHashAnnotationKey] = specHash
+
+		rolledBackHash, rolledBack := data[rolledBackHashKey]
+		switch {
+		case !rolledBack:
+		case rolledBackHash == specHash:
+			spec, err := decodeSpec(data[lastKnownGoodSpecKey])
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode the last known good spec of work %s/%s: %w",
+					work.Namespace, work.Name, err)
+			}
+			work.Spec = *spec
+			work.Annotations[constants.WorkSpecHashAnnotationKey] = data[lastKnownGoodHashKey]
+		default:
+			// the manifests are changed after the rollback, apply the changed manifests.
+			if err := c.rollbackStore.update(ctx, addon, work.Name, func(data map[string]string) {
+				delete(data, rolledBackHashKey)
+			}); err != nil {
+				return nil, err
+			}
+			meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
+				Type:    constants.AddonConditionRolledBack,
+				Status:  metav1.ConditionFalse,
+				Reason:  constants.RollbackReasonManifestsChanged,
+				Message: "The changed manifests are applied after the rollback",
+			})
+		}
+
+		return applyWork(ctx, appliedType, work, addon)
+	}
+}
+
+// rollbackSyncer records the last known good spec of the deploy manifestWorks when the addon is available,
+// and rolls back the deploy manifestWorks if the addon is unavailable longer than the grace period after
+// the changed manifests are applied.
+type rollbackSyncer struct {
+	getWorkByAddon func(addonName, addonNamespace string) ([]*workapiv1.ManifestWork, error)
+	store          *rollbackStore
+	agentAddon     agent.AgentAddon
+}
+
+func (s *rollbackSyncer) sync(ctx context.Context,
+	syncCtx factory.SyncContext,
+	cluster *clusterv1.ManagedCluster,
+	addon *addonapiv1beta1.ManagedClusterAddOn) (*addonapiv1beta1.ManagedClusterAddOn, error) {
+	option := s.agentAddon.GetAgentAddonOptions().RollbackOption
+	if option == nil || s.store == nil || !addon.DeletionTimestamp.IsZero() {
+		return addon, nil
+	}
+
+	available := meta.FindStatusCondition(addon.Status.Conditions, addonapiv1beta1.ManagedClusterAddOnConditionAvailable)
+	if available == nil || available.Status == metav1.ConditionUnknown {
+		return addon, nil
+	}
+
+	currentWorks, err := s.getWorkByAddon(addon.Name, addon.Namespace)
+	if err != nil {
+		return addon, err
+	}
+	var works []*workapiv1.ManifestWork
+	for _, work := range currentWorks {
+		if !strings.HasPrefix(work.Name, constants.DeployWorkNamePrefix(addon.Name)) {
+			continue
+		}
+		if len(work.Annotations[constants.WorkSpecHashAnnotationKey]) == 0 || isSensitiveWork(work) {
+			continue
+		}
+		// wait until the work agent applies the latest spec of the work.
+		cond := meta.FindStatusCondition(work.Status.Conditions, workapiv1.WorkApplied)
+		if cond == nil || cond.ObservedGeneration != work.Generation {
+			return addon, nil
+		}
+		works = append(works, work)
+	}
+	if len(works) == 0 {
+		return addon, nil
+	}
+
+	if available.Status == metav1.ConditionTrue {
+		var tooLargeWorks []string
+		for _, work := range works {
+			specHash := work.Annotations[constants.WorkSpecHashAnnotationKey]
+			data, err := s.store.get(addon, work.Name)
+			if err != nil {
+				return addon, err
+			}
+			if data[lastKnownGoodHashKey] == specHash {
+				continue
+			}
+			spec, err := encodeSpec(work.Spec)
+			if err != nil {
+				return addon, err
+			}
+			// the previous last known good spec is kept if the spec is too large to be recorded.
+			if len(spec) > maxLastKnownGoodSpecSize {
+				tooLargeWorks = append(tooLargeWorks, work.Name)
+				continue
+			}
+			if err := s.store.update(ctx, addon, work.Name, func(data map[string]string) {
+				data[lastKnownGoodSpecKey] = spec
+				data[lastKnownGoodHashKey] = specHash
+				delete(data, appliedHashKey)
+				delete(data, appliedTimeKey)
+			}); err != nil {
+				return addon, err
+			}
+		}
+		if len(tooLargeWorks) > 0 {
+			meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
+				Type:   constants.AddonConditionRolledBack,
+				Status: metav1.ConditionFalse,
+				Reason: constants.RollbackReasonSpecTooLarge,
+				Message: fmt.Sprintf("The spec of the manifestWorks %s is larger than %d bytes after compressed, "+
+					"it is not recorded as the last known good spec", strings.Join(tooLargeWorks, ","),
+					maxLastKnownGoodSpecSize),
+			})
+		}
+		return addon, nil
+	}
+
+	// the addon is unavailable, roll back the works changed from the last known good spec once the grace
+	// period passes since the changed works are applied and the addon becomes unavailable.
+	var changedWorks []*workapiv1.ManifestWork
+	var wait time.Duration
+	for _, work := range works {
+		specHash := work.Annotations[constants.WorkSpecHashAnnotationKey]
+		data, err := s.store.get(addon, work.Name)
+		if err != nil {
+			return addon, err
+		}
+		lastKnownGoodHash, ok := data[lastKnownGoodHashKey]
+		if !ok || lastKnownGoodHash == specHash {
+			continue
+		}
+		if _, rolledBack := data[rolledBackHashKey]; rolledBack {
+			continue
+		}
+
+		appliedTime, err := time.Parse(time.RFC3339, data[appliedTimeKey])
+		if data[appliedHashKey] != specHash || err != nil {
+			appliedTime = time.Now()
+			if err := s.store.update(ctx, addon, work.Name, func(data map[string]string) {
+				data[appliedHashKey] = specHash
+				data[appliedTimeKey] = appliedTime.Format(time.RFC3339)
+			}); err != nil {
+				return addon, err
+			}
+		}
+		if available.LastTransitionTime.Time.After(appliedTime) {
+			appliedTime = available.LastTransitionTime.Time
+		}
+		if elapsed := time.Since(appliedTime); elapsed < option.GracePeriod {
+			if wait == 0 || option.GracePeriod-elapsed < wait {
+				wait = option.GracePeriod - elapsed
+			}
+			continue
+		}
+		changedWorks = append(changedWorks, work)
+	}
+	if wait > 0 {
+		syncCtx.Queue().AddAfter(fmt.Sprintf("%s/%s", addon.Namespace, addon.Name), wait)
+	}
+	if len(changedWorks) == 0 {
+		return addon, nil
+	}
+
+	for _, work := range changedWorks {
+		specHash := work.Annotations[constants.WorkSpecHashAnnotationKey]
+		if err := s.store.update(ctx, addon, work.Name, func(data map[string]string) {
+			data[rolledBackHashKey] = specHash
+		}); err != nil {
+			return addon, err
+		}
+	}
+
+	klog.InfoS("Roll back the addon manifestWorks to the last known good spec",
+		"addonNamespace", addon.Namespace, "addonName", addon.Name)
+	syncCtx.Recorder().Warningf(ctx, "AddonRolledBack",
+		"The manifestWorks of addon %s on cluster %s are rolled back since the addon is unavailable: %s",
+		addon.Name, addon.Namespace, available.Message)
+	meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
+		Type:   constants.AddonConditionRolledBack,
+		Status: metav1.ConditionTrue,
+		Reason: constants.RollbackReasonRolledBack,
+		Message: fmt.Sprintf("The manifestWorks are rolled back to the last known good spec since the addon "+
+			"is unavailable for more than %s after the changed manifests are applied", option.GracePeriod),
+	})
+	return addon, nil
+}
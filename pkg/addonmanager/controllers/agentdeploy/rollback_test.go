@@ -0,0 +1,322 @@
+package agentdeploy
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"math/rand"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubeinformers "k8s.io/client-go/informers"
+	fakekube "k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+	workapiv1 "open-cluster-management.io/api/work/v1"
+
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/addontesting"
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
+	"open-cluster-management.io/addon-framework/pkg/agent"
+)
+
+func newLastKnownGoodSecret(data map[string]string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      constants.LastKnownGoodSecretName("addon-test-deploy-0"),
+			Namespace: "cluster1",
+			Labels:    map[string]string{addonapiv1beta1.AddonLabelKey: "test"},
+		},
+		Data: toSecretData(data),
+	}
+}
+
+func newTestRollbackStore(t *testing.T, objects ...runtime.Object) (*rollbackStore, *fakekube.Clientset) {
+	kubeClient := fakekube.NewSimpleClientset(objects...)
+	kubeInformers := kubeinformers.NewSharedInformerFactory(kubeClient, 10*time.Minute)
+	for _, obj := range objects {
+		if err := kubeInformers.Core().V1().Secrets().Informer().GetStore().Add(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return newRollbackStore(kubeClient, kubeInformers.Core().V1().Secrets()), kubeClient
+}
+
+func TestRollbackApplyWork(t *testing.T) {
+	desiredWork := addontesting.NewManifestWork("addon-test-deploy-0", "cluster1",
+		addontesting.NewUnstructured("v1", "ConfigMap", "default", "test"))
+	desiredHash, err := getWorkSpecHash(desiredWork)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lastKnownGoodWork := addontesting.NewManifestWork("addon-test-deploy-0", "cluster1",
+		addontesting.NewUnstructured("v1", "ConfigMap", "default", "test1"))
+	lastKnownGoodSpec, err := encodeSpec(lastKnownGoodWork.Spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name                string
+		secrets             []runtime.Object
+		expectedHash        string
+		expectedSpec        workapiv1.ManifestWorkSpec
+		expectedKubeActions []string
+		expectedCondition   *metav1.Condition
+	}{
+		{
+			name:         "not rolled back",
+			expectedHash: desiredHash,
+			expectedSpec: desiredWork.Spec,
+		},
+		{
+			name: "rolled back",
+			secrets: []runtime.Object{newLastKnownGoodSecret(map[string]string{
+				"spec":        lastKnownGoodSpec,
+				"hash":        "good",
+				"rolled-back": desiredHash,
+			})},
+			expectedHash: "good",
+			expectedSpec: lastKnownGoodWork.Spec,
+		},
+		{
+			name: "manifests changed after rolled back",
+			secrets: []runtime.Object{newLastKnownGoodSecret(map[string]string{
+				"spec":        lastKnownGoodSpec,
+				"hash":        "good",
+				"rolled-back": "bad",
+			})},
+			expectedHash:        desiredHash,
+			expectedSpec:        desiredWork.Spec,
+			expectedKubeActions: []string{"update"},
+			expectedCondition: &metav1.Condition{
+				Type:   constants.AddonConditionRolledBack,
+				Status: metav1.ConditionFalse,
+				Reason: constants.RollbackReasonManifestsChanged,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			store, kubeClient := newTestRollbackStore(t, c.secrets...)
+			controller := &addonDeployController{rollbackStore: store}
+
+			var appliedWork *workapiv1.ManifestWork
+			applyWork := controller.rollbackApplyWorkFunc(&agent.RollbackOption{},
+				func(ctx context.Context, appliedType string,
+					work *workapiv1.ManifestWork, addon *addonapiv1beta1.ManagedClusterAddOn) (*workapiv1.ManifestWork, error) {
+					appliedWork = work
+					return work, nil
+				})
+
+			addon := addontesting.NewAddon("test", "cluster1")
+			if _, err := applyWork(context.TODO(), addonapiv1beta1.ManagedClusterAddOnManifestApplied,
+				desiredWork.DeepCopy(), addon); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if appliedWork.Annotations[constants.WorkSpecHashAnnotationKey] != c.expectedHash {
+				t.Errorf("expected spec hash %s, but got %s",
+					c.expectedHash, appliedWork.Annotations[constants.WorkSpecHashAnnotationKey])
+			}
+			if !specEqual(appliedWork.Spec, c.expectedSpec) {
+				t.Errorf("expected spec %v, but got %v", c.expectedSpec, appliedWork.Spec)
+			}
+			addontesting.AssertActions(t, kubeClient.Actions(), c.expectedKubeActions...)
+
+			cond := meta.FindStatusCondition(addon.Status.Conditions, constants.AddonConditionRolledBack)
+			switch {
+			case c.expectedCondition == nil && cond != nil:
+				t.Errorf("expected no rolled back condition, but got %v", cond)
+			case c.expectedCondition != nil && (cond == nil || cond.Reason != c.expectedCondition.Reason):
+				t.Errorf("expected rolled back condition %v, but got %v", c.expectedCondition, cond)
+			}
+		})
+	}
+}
+
+func specEqual(a, b workapiv1.ManifestWorkSpec) bool {
+	aData, _ := json.Marshal(a)
+	bData, _ := json.Marshal(b)
+	return string(aData) == string(bData)
+}
+
+func TestRollbackSyncer(t *testing.T) {
+	availableCondition := func(status metav1.ConditionStatus, since time.Duration) metav1.Condition {
+		return metav1.Condition{
+			Type:               addonapiv1beta1.ManagedClusterAddOnConditionAvailable,
+			Status:             status,
+			Reason:             "test",
+			LastTransitionTime: metav1.NewTime(time.Now().Add(-since)),
+		}
+	}
+	appliedTime := func(since time.Duration) string {
+		return time.Now().Add(-since).Format(time.RFC3339)
+	}
+	appliedWork := func(specHash string) *workapiv1.ManifestWork {
+		work := addontesting.NewManifestWork("addon-test-deploy-0", "cluster1",
+			addontesting.NewUnstructured("v1", "ConfigMap", "default", "test"))
+		work.Annotations = map[string]string{constants.WorkSpecHashAnnotationKey: specHash}
+		work.Generation = 1
+		work.Status.Conditions = []metav1.Condition{
+			{Type: workapiv1.WorkApplied, Status: metav1.ConditionTrue, ObservedGeneration: 1},
+		}
+		return work
+	}
+
+	cases := []struct {
+		name                string
+		available           metav1.Condition
+		work                *workapiv1.ManifestWork
+		secrets             []runtime.Object
+		expectedKubeActions []string
+		expectedRolledBack  bool
+		expectedReason      string
+		validateSecret      func(t *testing.T, data map[string]string)
+	}{
+		{
+			name:                "record last known good spec",
+			available:           availableCondition(metav1.ConditionTrue, time.Minute),
+			work:                appliedWork("good"),
+			expectedKubeActions: []string{"create"},
+			validateSecret: func(t *testing.T, data map[string]string) {
+				spec, err := decodeSpec(data["spec"])
+				if data["hash"] != "good" || err != nil || len(spec.Workload.Manifests) != 1 {
+					t.Errorf("expected last known good spec is recorded, but got %v, %v", data, err)
+				}
+			},
+		},
+		{
+			name:      "spec is too large to be recorded",
+			available: availableCondition(metav1.ConditionTrue, time.Minute),
+			work: func() *workapiv1.ManifestWork {
+				// the random data is not compressible.
+				data := make([]byte, maxLastKnownGoodSpecSize)
+				rand.New(rand.NewSource(1)).Read(data)
+				configMap := addontesting.NewUnstructured("v1", "ConfigMap", "default", "large")
+				configMap.Object["binaryData"] = map[string]interface{}{
+					"data": base64.StdEncoding.EncodeToString(data),
+				}
+				work := addontesting.NewManifestWork("addon-test-deploy-0", "cluster1", configMap)
+				work.Annotations = map[string]string{constants.WorkSpecHashAnnotationKey: "large"}
+				work.Status.Conditions = []metav1.Condition{
+					{Type: workapiv1.WorkApplied, Status: metav1.ConditionTrue},
+				}
+				return work
+			}(),
+			expectedReason: constants.RollbackReasonSpecTooLarge,
+		},
+		{
+			name:      "last known good spec is recorded",
+			available: availableCondition(metav1.ConditionTrue, time.Minute),
+			work:      appliedWork("good"),
+			secrets:   []runtime.Object{newLastKnownGoodSecret(map[string]string{"hash": "good"})},
+		},
+		{
+			name:      "sensitive work is not recorded",
+			available: availableCondition(metav1.ConditionTrue, time.Minute),
+			work: func() *workapiv1.ManifestWork {
+				work := appliedWork("good")
+				work.Annotations[constants.SensitiveDataAnnotationKey] = "true"
+				return work
+			}(),
+		},
+		{
+			name:      "unavailable within grace period",
+			available: availableCondition(metav1.ConditionFalse, time.Second),
+			work:      appliedWork("bad"),
+			secrets: []runtime.Object{newLastKnownGoodSecret(map[string]string{
+				"hash": "good", "applied-hash": "bad", "applied-time": appliedTime(time.Hour),
+			})},
+		},
+		{
+			name:                "unavailable before the changed manifests are applied",
+			available:           availableCondition(metav1.ConditionFalse, time.Hour),
+			work:                appliedWork("bad"),
+			secrets:             []runtime.Object{newLastKnownGoodSecret(map[string]string{"hash": "good"})},
+			expectedKubeActions: []string{"update"},
+			validateSecret: func(t *testing.T, data map[string]string) {
+				if data["applied-hash"] != "bad" || len(data["applied-time"]) == 0 {
+					t.Errorf("expected the applied time is recorded, but got %v", data)
+				}
+			},
+		},
+		{
+			name:      "changed manifests applied within grace period",
+			available: availableCondition(metav1.ConditionFalse, time.Hour),
+			work:      appliedWork("bad"),
+			secrets: []runtime.Object{newLastKnownGoodSecret(map[string]string{
+				"hash": "good", "applied-hash": "bad", "applied-time": appliedTime(time.Second),
+			})},
+		},
+		{
+			name:      "no last known good spec",
+			available: availableCondition(metav1.ConditionFalse, time.Hour),
+			work:      appliedWork("bad"),
+		},
+		{
+			name:      "roll back",
+			available: availableCondition(metav1.ConditionFalse, time.Hour),
+			work:      appliedWork("bad"),
+			secrets: []runtime.Object{newLastKnownGoodSecret(map[string]string{
+				"hash": "good", "applied-hash": "bad", "applied-time": appliedTime(time.Hour),
+			})},
+			expectedKubeActions: []string{"update"},
+			expectedRolledBack:  true,
+			validateSecret: func(t *testing.T, data map[string]string) {
+				if data["rolled-back"] != "bad" {
+					t.Errorf("expected the spec is rolled back, but got %v", data)
+				}
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			store, kubeClient := newTestRollbackStore(t, c.secrets...)
+			syncer := &rollbackSyncer{
+				getWorkByAddon: func(addonName, addonNamespace string) ([]*workapiv1.ManifestWork, error) {
+					return []*workapiv1.ManifestWork{c.work}, nil
+				},
+				store:      store,
+				agentAddon: &testAgent{name: "test", rollbackOption: &agent.RollbackOption{GracePeriod: time.Minute}},
+			}
+
+			addon := addontesting.NewAddonWithConditions("test", "cluster1", c.available)
+			addon, err := syncer.sync(context.TODO(), addontesting.NewFakeSyncContext(t),
+				addontesting.NewManagedCluster("cluster1"), addon)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			addontesting.AssertActions(t, kubeClient.Actions(), c.expectedKubeActions...)
+			if c.validateSecret != nil {
+				var secret *corev1.Secret
+				switch action := kubeClient.Actions()[0].(type) {
+				case clienttesting.CreateActionImpl:
+					secret = action.Object.(*corev1.Secret)
+				case clienttesting.UpdateActionImpl:
+					secret = action.Object.(*corev1.Secret)
+				}
+				data := map[string]string{}
+				for k, v := range secret.Data {
+					data[k] = string(v)
+				}
+				c.validateSecret(t, data)
+			}
+			if meta.IsStatusConditionTrue(addon.Status.Conditions, constants.AddonConditionRolledBack) != c.expectedRolledBack {
+				t.Errorf("expected rolled back %v, but got %v", c.expectedRolledBack, addon.Status.Conditions)
+			}
+			if len(c.expectedReason) != 0 {
+				cond := meta.FindStatusCondition(addon.Status.Conditions, constants.AddonConditionRolledBack)
+				if cond == nil || cond.Reason != c.expectedReason {
+					t.Errorf("expected rolled back reason %s, but got %v", c.expectedReason, cond)
+				}
+			}
+		})
+	}
+}
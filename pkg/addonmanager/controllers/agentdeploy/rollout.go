@@ -0,0 +1,357 @@
+package agentdeploy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+	addonlisterv1beta1 "open-cluster-management.io/api/client/addon/listers/addon/v1beta1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	workapiv1 "open-cluster-management.io/api/work/v1"
+	workapplier "open-cluster-management.io/sdk-go/pkg/apis/work/v1/applier"
+	"open-cluster-management.io/sdk-go/pkg/basecontroller/factory"
+
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
+	"open-cluster-management.io/addon-framework/pkg/agent"
+)
+
+const defaultRolloutMinAvailableTime = time.Minute
+
+type applyWorkFunc func(ctx context.Context, appliedType string,
+	work *workapiv1.ManifestWork, addon *addonapiv1beta1.ManagedClusterAddOn) (*workapiv1.ManifestWork, error)
+
+// rolloutGate admits the clusters to roll out the changed manifests of an addon by its RolloutStrategy.
+// The rollout status of each cluster is kept in the rollout condition of the addon.
+type rolloutGate struct {
+	sync.Mutex
+	addonLister addonlisterv1beta1.ManagedClusterAddOnLister
+	// reasons caches the rollout reasons set on the addons by the controller, since the addon lister
+	// may not be synced when the other addons are reconciled. It is keyed by addon name and cluster name.
+	reasons map[string]map[string]string
+	// works caches the updated manifestWorks, the rollout of a cluster is not completed until the work
+	// agent applies these generations. It is keyed by addon namespace/name and work namespace/name.
+	works map[string]map[string]*gatedWork
+}
+
+// gatedWork is a manifestWork updated by the rollout gate.
+type gatedWork struct {
+	generation int64
+	// observedTime is when the work agent is observed to apply the generation.
+	observedTime time.Time
+}
+
+func newRolloutGate(addonLister addonlisterv1beta1.ManagedClusterAddOnLister) *rolloutGate {
+	return &rolloutGate{
+		addonLister: addonLister,
+		reasons:     map[string]map[string]string{},
+		works:       map[string]map[string]*gatedWork{},
+	}
+}
+
+// admit returns true if the changed manifests can be rolled out to the cluster of the addon. The
+// clusters which are rolling out or failed are always admitted, so the fixed manifests can reach them.
+func (g *rolloutGate) admit(addon *addonapiv1beta1.ManagedClusterAddOn, strategy *agent.RolloutStrategy) (bool, error) {
+	g.Lock()
+	defer g.Unlock()
+
+	switch g.reason(addon) {
+	case constants.RolloutReasonProgressing, constants.RolloutReasonFailed:
+		return true, nil
+	}
+
+	reasons, err := g.listReasons(addon.Name)
+	if err != nil {
+		return false, err
+	}
+	var progressing, failed int
+	for cluster, reason := range reasons {
+		if cluster == addon.Namespace {
+			continue
+		}
+		switch reason {
+		case constants.RolloutReasonProgressing:
+			progressing++
+		case constants.RolloutReasonFailed:
+			failed++
+		}
+	}
+
+	switch {
+	case failed > strategy.MaxUnavailable:
+		g.setCondition(addon, constants.RolloutReasonHeld,
+			fmt.Sprintf("The rollout is held since it failed on %d clusters", failed))
+		return false, nil
+	case strategy.MaxConcurrency > 0 && progressing+failed >= strategy.MaxConcurrency:
+		g.setCondition(addon, constants.RolloutReasonPending,
+			fmt.Sprintf("Waiting for the rollout on %d clusters to complete", progressing+failed))
+		return false, nil
+	}
+
+	g.setCondition(addon, constants.RolloutReasonProgressing, "The changed manifests are rolling out")
+	return true, nil
+}
+
+// transit sets the rollout condition of the addon and caches it.
+func (g *rolloutGate) transit(addon *addonapiv1beta1.ManagedClusterAddOn, reason, message string) {
+	g.Lock()
+	defer g.Unlock()
+	g.setCondition(addon, reason, message)
+}
+
+func (g *rolloutGate) setCondition(addon *addonapiv1beta1.ManagedClusterAddOn, reason, message string) {
+	status := metav1.ConditionFalse
+	if reason == constants.RolloutReasonSucceeded {
+		status = metav1.ConditionTrue
+	}
+	meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
+		Type:    constants.AddonConditionRollout,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	})
+
+	if _, ok := g.reasons[addon.Name]; !ok {
+		g.reasons[addon.Name] = map[string]string{}
+	}
+	g.reasons[addon.Name][addon.Namespace] = reason
+}
+
+// reason returns the rollout reason of the addon, the cached reason takes precedence.
+func (g *rolloutGate) reason(addon *addonapiv1beta1.ManagedClusterAddOn) string {
+	if reason, ok := g.reasons[addon.Name][addon.Namespace]; ok {
+		return reason
+	}
+	cond := meta.FindStatusCondition(addon.Status.Conditions, constants.AddonConditionRollout)
+	if cond == nil {
+		return ""
+	}
+	return cond.Reason
+}
+
+// listReasons returns the rollout reasons of the addons with the given name keyed by the cluster name.
+func (g *rolloutGate) listReasons(addonName string) (map[string]string, error) {
+	addons, err := g.addonLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	reasons := map[string]string{}
+	for _, addon := range addons {
+		if addon.Name != addonName || !addon.DeletionTimestamp.IsZero() {
+			continue
+		}
+		reasons[addon.Namespace] = g.reason(addon)
+	}
+	return reasons, nil
+}
+
+// waitingClusters returns the clusters on which the rollout of the addon is pending or held.
+func (g *rolloutGate) waitingClusters(addonName string) ([]string, error) {
+	g.Lock()
+	defer g.Unlock()
+
+	reasons, err := g.listReasons(addonName)
+	if err != nil {
+		return nil, err
+	}
+	var clusters []string
+	for cluster, reason := range reasons {
+		if reason == constants.RolloutReasonPending || reason == constants.RolloutReasonHeld {
+			clusters = append(clusters, cluster)
+		}
+	}
+	return clusters, nil
+}
+
+// forget removes the cached rollout status of the addon on the cluster, it is called once the addon or
+// the cluster is deleted.
+func (g *rolloutGate) forget(addonName, clusterName string) {
+	g.Lock()
+	defer g.Unlock()
+	if reasons, ok := g.reasons[addonName]; ok {
+		delete(reasons, clusterName)
+		if len(reasons) == 0 {
+			delete(g.reasons, addonName)
+		}
+	}
+	delete(g.works, fmt.Sprintf("%s/%s", clusterName, addonName))
+}
+
+func (g *rolloutGate) setGeneration(addon *addonapiv1beta1.ManagedClusterAddOn, work *workapiv1.ManifestWork) {
+	g.Lock()
+	defer g.Unlock()
+	addonKey := fmt.Sprintf("%s/%s", addon.Namespace, addon.Name)
+	if _, ok := g.works[addonKey]; !ok {
+		g.works[addonKey] = map[string]*gatedWork{}
+	}
+	g.works[addonKey][fmt.Sprintf("%s/%s", work.Namespace, work.Name)] = &gatedWork{generation: work.Generation}
+}
+
+// workUpdated returns true and the time when the work agent is observed to apply the latest spec of the
+// work. For the work which is not updated by the rollout gate, e.g. the addon manager restarts, the time
+// is when it is observed first.
+func (g *rolloutGate) workUpdated(addon *addonapiv1beta1.ManagedClusterAddOn, work *workapiv1.ManifestWork) (bool, time.Time) {
+	g.Lock()
+	defer g.Unlock()
+	addonKey, workKey := fmt.Sprintf("%s/%s", addon.Namespace, addon.Name), fmt.Sprintf("%s/%s", work.Namespace, work.Name)
+	gated, ok := g.works[addonKey][workKey]
+	if ok && work.Generation < gated.generation {
+		return false, time.Time{}
+	}
+	cond := meta.FindStatusCondition(work.Status.Conditions, workapiv1.WorkApplied)
+	if cond == nil || cond.ObservedGeneration != work.Generation {
+		return false, time.Time{}
+	}
+
+	if !ok || gated.generation != work.Generation || gated.observedTime.IsZero() {
+		if _, ok := g.works[addonKey]; !ok {
+			g.works[addonKey] = map[string]*gatedWork{}
+		}
+		gated = &gatedWork{generation: work.Generation, observedTime: time.Now()}
+		g.works[addonKey][workKey] = gated
+	}
+	return true, gated.observedTime
+}
+
+// rolloutApplyWorkFunc wraps the applyWork with the rollout strategy of the addon, the changed deploy
+// manifestWorks are only applied after the cluster is admitted by the rollout gate.
+func (c *addonDeployController) rolloutApplyWorkFunc(strategy *agent.RolloutStrategy, applyWork applyWorkFunc) applyWorkFunc {
+	if strategy == nil {
+		return applyWork
+	}
+
+	return func(ctx context.Context, appliedType string,
+		work *workapiv1.ManifestWork, addon *addonapiv1beta1.ManagedClusterAddOn) (*workapiv1.ManifestWork, error) {
+		existingWork, err := c.workLister.ManifestWorks(work.Namespace).Get(work.Name)
+		switch {
+		case errors.IsNotFound(err):
+			return applyWork(ctx, appliedType, work, addon)
+		case err != nil:
+			return nil, err
+		}
+
+		if workapplier.ManifestWorkEqual(work, existingWork) {
+			return applyWork(ctx, appliedType, work, addon)
+		}
+
+		admitted, err := c.rolloutGate.admit(addon, strategy)
+		if err != nil {
+			return nil, err
+		}
+		if !admitted {
+			klog.V(4).InfoS("The rollout of addon manifestWork is not admitted",
+				"addonNamespace", addon.Namespace, "addonName", addon.Name, "workName", work.Name)
+			return existingWork, nil
+		}
+
+		appliedWork, err := applyWork(ctx, appliedType, work, addon)
+		if err != nil {
+			return appliedWork, err
+		}
+		if appliedWork != nil {
+			c.rolloutGate.setGeneration(addon, appliedWork)
+		}
+		return appliedWork, nil
+	}
+}
+
+// rolloutSyncer completes the rollout of the addon on the cluster by the Available condition of the addon
+// after the updated deploy manifestWorks are applied by the work agent.
+type rolloutSyncer struct {
+	getWorkByAddon       func(addonName, addonNamespace string) ([]*workapiv1.ManifestWork, error)
+	getWorkByHostedAddon func(addonName, addonNamespace string) ([]*workapiv1.ManifestWork, error)
+	gate                 *rolloutGate
+	agentAddon           agent.AgentAddon
+}
+
+func (s *rolloutSyncer) sync(ctx context.Context,
+	syncCtx factory.SyncContext,
+	cluster *clusterv1.ManagedCluster,
+	addon *addonapiv1beta1.ManagedClusterAddOn) (*addonapiv1beta1.ManagedClusterAddOn, error) {
+	if s.agentAddon.GetAgentAddonOptions().RolloutStrategy == nil || !addon.DeletionTimestamp.IsZero() {
+		return addon, nil
+	}
+
+	cond := meta.FindStatusCondition(addon.Status.Conditions, constants.AddonConditionRollout)
+	if cond == nil ||
+		(cond.Reason != constants.RolloutReasonProgressing && cond.Reason != constants.RolloutReasonFailed) {
+		return addon, nil
+	}
+
+	works, err := s.getWorkByAddon(addon.Name, addon.Namespace)
+	if err != nil {
+		return addon, err
+	}
+	hostedWorks, err := s.getWorkByHostedAddon(addon.Name, addon.Namespace)
+	if err != nil {
+		return addon, err
+	}
+	// observedTime is when the work agent is observed to apply all the updated deploy manifestWorks.
+	var observedTime time.Time
+	for _, work := range append(works, hostedWorks...) {
+		if !strings.HasPrefix(work.Name, constants.DeployWorkNamePrefix(addon.Name)) {
+			continue
+		}
+		updated, workObservedTime := s.gate.workUpdated(addon, work)
+		if !updated {
+			return addon, nil
+		}
+		if workObservedTime.After(observedTime) {
+			observedTime = workObservedTime
+		}
+	}
+
+	var available *metav1.Condition
+	if prober := s.agentAddon.GetAgentAddonOptions().HealthProber; prober != nil && prober.Type == agent.HealthProberTypeNone {
+		// the availability of the addon is not probed, consider it available once the manifests are applied.
+		available = &metav1.Condition{Status: metav1.ConditionTrue}
+	} else {
+		available = meta.FindStatusCondition(addon.Status.Conditions, addonapiv1beta1.ManagedClusterAddOnConditionAvailable)
+	}
+	if available == nil {
+		return addon, nil
+	}
+
+	// the Available condition set before the updated manifestWorks are applied does not reflect the
+	// updated manifests, so it is only counted after it stays unchanged for the MinAvailableTime.
+	if available.LastTransitionTime.Time.Before(observedTime) {
+		minAvailableTime := s.agentAddon.GetAgentAddonOptions().RolloutStrategy.MinAvailableTime
+		if minAvailableTime <= 0 {
+			minAvailableTime = defaultRolloutMinAvailableTime
+		}
+		if wait := time.Until(observedTime.Add(minAvailableTime)); wait > 0 {
+			syncCtx.Queue().AddAfter(fmt.Sprintf("%s/%s", addon.Namespace, addon.Name), wait)
+			return addon, nil
+		}
+	}
+
+	switch available.Status {
+	case metav1.ConditionTrue:
+		s.gate.transit(addon, constants.RolloutReasonSucceeded, "The changed manifests are rolled out")
+		// the rollout on the waiting clusters may be admitted now.
+		clusters, err := s.gate.waitingClusters(addon.Name)
+		if err != nil {
+			return addon, err
+		}
+		for _, clusterName := range clusters {
+			syncCtx.Queue().Add(fmt.Sprintf("%s/%s", clusterName, addon.Name))
+		}
+	case metav1.ConditionFalse:
+		if cond.Reason != constants.RolloutReasonFailed {
+			syncCtx.Recorder().Warningf(ctx, "AddonRolloutFailed",
+				"The rollout of addon %s failed on cluster %s: %s", addon.Name, addon.Namespace, available.Message)
+		}
+		s.gate.transit(addon, constants.RolloutReasonFailed,
+			fmt.Sprintf("The addon is unavailable after the changed manifests are applied: %s", available.Message))
+	}
+
+	return addon, nil
+}
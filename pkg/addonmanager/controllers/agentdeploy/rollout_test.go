@@ -0,0 +1,326 @@
+package agentdeploy
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+	fakeaddon "open-cluster-management.io/api/client/addon/clientset/versioned/fake"
+	addoninformers "open-cluster-management.io/api/client/addon/informers/externalversions"
+	fakecluster "open-cluster-management.io/api/client/cluster/clientset/versioned/fake"
+	clusterv1informers "open-cluster-management.io/api/client/cluster/informers/externalversions"
+	fakework "open-cluster-management.io/api/client/work/clientset/versioned/fake"
+	workinformers "open-cluster-management.io/api/client/work/informers/externalversions"
+	workapiv1 "open-cluster-management.io/api/work/v1"
+	workapplier "open-cluster-management.io/sdk-go/pkg/apis/work/v1/applier"
+	workbuilder "open-cluster-management.io/sdk-go/pkg/apis/work/v1/builder"
+
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/addontesting"
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
+	"open-cluster-management.io/addon-framework/pkg/agent"
+	"open-cluster-management.io/addon-framework/pkg/index"
+)
+
+func newRolloutCondition(reason string) metav1.Condition {
+	status := metav1.ConditionFalse
+	if reason == constants.RolloutReasonSucceeded {
+		status = metav1.ConditionTrue
+	}
+	return metav1.Condition{Type: constants.AddonConditionRollout, Status: status, Reason: reason}
+}
+
+func newOutdatedDeployWork() *workapiv1.ManifestWork {
+	work := addontesting.NewManifestWork("addon-test-deploy-0", "cluster1",
+		addontesting.NewUnstructured("v1", "ConfigMap", "default", "test1"))
+	work.SetLabels(map[string]string{addonapiv1beta1.AddonLabelKey: "test"})
+	return work
+}
+
+func TestRolloutReconcile(t *testing.T) {
+	cases := []struct {
+		name                  string
+		strategy              *agent.RolloutStrategy
+		existingWork          []runtime.Object
+		otherAddons           []runtime.Object
+		expectedWorkActions   []string
+		expectedRolloutReason string
+	}{
+		{
+			name:                "create work without rollout gate",
+			strategy:            &agent.RolloutStrategy{MaxConcurrency: 1},
+			otherAddons:         []runtime.Object{addontesting.NewAddonWithConditions("test", "cluster2", newRolloutCondition(constants.RolloutReasonProgressing))},
+			expectedWorkActions: []string{"create"},
+		},
+		{
+			name:                  "rollout is admitted",
+			strategy:              &agent.RolloutStrategy{MaxConcurrency: 1},
+			existingWork:          []runtime.Object{newOutdatedDeployWork()},
+			otherAddons:           []runtime.Object{addontesting.NewAddonWithConditions("test", "cluster2", newRolloutCondition(constants.RolloutReasonSucceeded))},
+			expectedWorkActions:   []string{"patch"},
+			expectedRolloutReason: constants.RolloutReasonProgressing,
+		},
+		{
+			name:                  "rollout is pending",
+			strategy:              &agent.RolloutStrategy{MaxConcurrency: 1},
+			existingWork:          []runtime.Object{newOutdatedDeployWork()},
+			otherAddons:           []runtime.Object{addontesting.NewAddonWithConditions("test", "cluster2", newRolloutCondition(constants.RolloutReasonProgressing))},
+			expectedRolloutReason: constants.RolloutReasonPending,
+		},
+		{
+			name:                  "rollout is held",
+			strategy:              &agent.RolloutStrategy{MaxConcurrency: 2},
+			existingWork:          []runtime.Object{newOutdatedDeployWork()},
+			otherAddons:           []runtime.Object{addontesting.NewAddonWithConditions("test", "cluster2", newRolloutCondition(constants.RolloutReasonFailed))},
+			expectedRolloutReason: constants.RolloutReasonHeld,
+		},
+		{
+			name:                  "rollout is admitted within max unavailable",
+			strategy:              &agent.RolloutStrategy{MaxConcurrency: 2, MaxUnavailable: 1},
+			existingWork:          []runtime.Object{newOutdatedDeployWork()},
+			otherAddons:           []runtime.Object{addontesting.NewAddonWithConditions("test", "cluster2", newRolloutCondition(constants.RolloutReasonFailed))},
+			expectedWorkActions:   []string{"patch"},
+			expectedRolloutReason: constants.RolloutReasonProgressing,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			addon := addontesting.NewAddonWithConditions("test", "cluster1", registrationAppliedCondition)
+			testAddon := &testAgent{name: "test", objects: []runtime.Object{
+				addontesting.NewUnstructured("v1", "ConfigMap", "default", "test"),
+			}, rolloutStrategy: c.strategy}
+
+			fakeWorkClient := fakework.NewSimpleClientset(c.existingWork...)
+			fakeClusterClient := fakecluster.NewSimpleClientset(addontesting.NewManagedCluster("cluster1"))
+			fakeAddonClient := fakeaddon.NewSimpleClientset(addon)
+
+			workInformerFactory := workinformers.NewSharedInformerFactory(fakeWorkClient, 10*time.Minute)
+			addonInformers := addoninformers.NewSharedInformerFactory(fakeAddonClient, 10*time.Minute)
+			clusterInformers := clusterv1informers.NewSharedInformerFactory(fakeClusterClient, 10*time.Minute)
+
+			err := workInformerFactory.Work().V1().ManifestWorks().Informer().AddIndexers(
+				cache.Indexers{
+					index.ManifestWorkByAddon:           index.IndexManifestWorkByAddon,
+					index.ManifestWorkByHostedAddon:     index.IndexManifestWorkByHostedAddon,
+					index.ManifestWorkHookByHostedAddon: index.IndexManifestWorkHookByHostedAddon,
+				},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := clusterInformers.Cluster().V1().ManagedClusters().Informer().GetStore().Add(
+				addontesting.NewManagedCluster("cluster1")); err != nil {
+				t.Fatal(err)
+			}
+			for _, obj := range append(c.otherAddons, addon) {
+				if err := addonInformers.Addon().V1beta1().ManagedClusterAddOns().Informer().GetStore().Add(obj); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, obj := range c.existingWork {
+				if err := workInformerFactory.Work().V1().ManifestWorks().Informer().GetStore().Add(obj); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			controller := addonDeployController{
+				workApplier:               workapplier.NewWorkApplierWithTypedClient(fakeWorkClient, workInformerFactory.Work().V1().ManifestWorks().Lister()),
+				workBuilder:               workbuilder.NewWorkBuilder(),
+				addonClient:               fakeAddonClient,
+				managedClusterLister:      clusterInformers.Cluster().V1().ManagedClusters().Lister(),
+				managedClusterAddonLister: addonInformers.Addon().V1beta1().ManagedClusterAddOns().Lister(),
+				workIndexer:               workInformerFactory.Work().V1().ManifestWorks().Informer().GetIndexer(),
+				workLister:                workInformerFactory.Work().V1().ManifestWorks().Lister(),
+				rolloutGate:               newRolloutGate(addonInformers.Addon().V1beta1().ManagedClusterAddOns().Lister()),
+				agentAddons:               map[string]agent.AgentAddon{testAddon.name: testAddon},
+			}
+
+			syncContext := addontesting.NewFakeSyncContext(t)
+			if err := controller.sync(context.TODO(), syncContext, "cluster1/test"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			addontesting.AssertActions(t, fakeWorkClient.Actions(), c.expectedWorkActions...)
+
+			var rolloutCond *metav1.Condition
+			for _, action := range fakeAddonClient.Actions() {
+				patchAction, ok := action.(clienttesting.PatchActionImpl)
+				if !ok || patchAction.GetSubresource() != "status" {
+					continue
+				}
+				patchedAddon := &addonapiv1beta1.ManagedClusterAddOn{}
+				if err := json.Unmarshal(patchAction.Patch, patchedAddon); err != nil {
+					t.Fatal(err)
+				}
+				rolloutCond = meta.FindStatusCondition(patchedAddon.Status.Conditions, constants.AddonConditionRollout)
+			}
+			switch {
+			case len(c.expectedRolloutReason) == 0 && rolloutCond != nil:
+				t.Errorf("expected no rollout condition, but got %v", rolloutCond)
+			case len(c.expectedRolloutReason) != 0 && (rolloutCond == nil || rolloutCond.Reason != c.expectedRolloutReason):
+				t.Errorf("expected rollout reason %s, but got %v", c.expectedRolloutReason, rolloutCond)
+			}
+		})
+	}
+}
+
+func TestRolloutSyncer(t *testing.T) {
+	// the updated works are observed 2 minutes ago in the cases.
+	observedTime := time.Now().Add(-2 * time.Minute)
+	availableCondition := func(status metav1.ConditionStatus) metav1.Condition {
+		return metav1.Condition{
+			Type:               addonapiv1beta1.ManagedClusterAddOnConditionAvailable,
+			Status:             status,
+			Reason:             "test",
+			LastTransitionTime: metav1.NewTime(observedTime.Add(time.Minute)),
+		}
+	}
+	staleAvailableCondition := func(status metav1.ConditionStatus) metav1.Condition {
+		cond := availableCondition(status)
+		cond.LastTransitionTime = metav1.NewTime(observedTime.Add(-time.Minute))
+		return cond
+	}
+	updatedWork := func(generation, observedGeneration int64) *workapiv1.ManifestWork {
+		work := newOutdatedDeployWork()
+		work.Generation = generation
+		work.Status.Conditions = []metav1.Condition{
+			{Type: workapiv1.WorkApplied, Status: metav1.ConditionTrue, ObservedGeneration: observedGeneration},
+		}
+		return work
+	}
+
+	cases := []struct {
+		name                  string
+		addon                 *addonapiv1beta1.ManagedClusterAddOn
+		works                 []*workapiv1.ManifestWork
+		minAvailableTime      time.Duration
+		expectedRolloutReason string
+		expectedQueueLen      int
+	}{
+		{
+			name: "work is not applied yet",
+			addon: addontesting.NewAddonWithConditions("test", "cluster1",
+				newRolloutCondition(constants.RolloutReasonProgressing), availableCondition(metav1.ConditionTrue)),
+			works:                 []*workapiv1.ManifestWork{updatedWork(2, 1)},
+			expectedRolloutReason: constants.RolloutReasonProgressing,
+		},
+		{
+			name: "rollout succeeded",
+			addon: addontesting.NewAddonWithConditions("test", "cluster1",
+				newRolloutCondition(constants.RolloutReasonProgressing), availableCondition(metav1.ConditionTrue)),
+			works:                 []*workapiv1.ManifestWork{updatedWork(2, 2)},
+			expectedRolloutReason: constants.RolloutReasonSucceeded,
+			expectedQueueLen:      1,
+		},
+		{
+			name: "available before the works are applied",
+			addon: addontesting.NewAddonWithConditions("test", "cluster1",
+				newRolloutCondition(constants.RolloutReasonProgressing), staleAvailableCondition(metav1.ConditionTrue)),
+			works:                 []*workapiv1.ManifestWork{updatedWork(2, 2)},
+			minAvailableTime:      5 * time.Minute,
+			expectedRolloutReason: constants.RolloutReasonProgressing,
+		},
+		{
+			name: "available for min available time after the works are applied",
+			addon: addontesting.NewAddonWithConditions("test", "cluster1",
+				newRolloutCondition(constants.RolloutReasonProgressing), staleAvailableCondition(metav1.ConditionTrue)),
+			works:                 []*workapiv1.ManifestWork{updatedWork(2, 2)},
+			expectedRolloutReason: constants.RolloutReasonSucceeded,
+			expectedQueueLen:      1,
+		},
+		{
+			name: "rollout failed",
+			addon: addontesting.NewAddonWithConditions("test", "cluster1",
+				newRolloutCondition(constants.RolloutReasonProgressing), availableCondition(metav1.ConditionFalse)),
+			works:                 []*workapiv1.ManifestWork{updatedWork(2, 2)},
+			expectedRolloutReason: constants.RolloutReasonFailed,
+		},
+		{
+			name: "failed rollout recovered",
+			addon: addontesting.NewAddonWithConditions("test", "cluster1",
+				newRolloutCondition(constants.RolloutReasonFailed), availableCondition(metav1.ConditionTrue)),
+			works:                 []*workapiv1.ManifestWork{updatedWork(3, 3)},
+			expectedRolloutReason: constants.RolloutReasonSucceeded,
+			expectedQueueLen:      1,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fakeAddonClient := fakeaddon.NewSimpleClientset()
+			addonInformers := addoninformers.NewSharedInformerFactory(fakeAddonClient, 10*time.Minute)
+			pending := addontesting.NewAddonWithConditions("test", "cluster2", newRolloutCondition(constants.RolloutReasonPending))
+			for _, obj := range []runtime.Object{c.addon, pending} {
+				if err := addonInformers.Addon().V1beta1().ManagedClusterAddOns().Informer().GetStore().Add(obj); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			gate := newRolloutGate(addonInformers.Addon().V1beta1().ManagedClusterAddOns().Lister())
+			for _, work := range c.works {
+				gate.setGeneration(c.addon, work)
+				gate.works["cluster1/test"][work.Namespace+"/"+work.Name].observedTime = observedTime
+			}
+			syncer := &rolloutSyncer{
+				getWorkByAddon: func(addonName, addonNamespace string) ([]*workapiv1.ManifestWork, error) {
+					return c.works, nil
+				},
+				getWorkByHostedAddon: func(addonName, addonNamespace string) ([]*workapiv1.ManifestWork, error) {
+					return nil, nil
+				},
+				gate: gate,
+				agentAddon: &testAgent{name: "test",
+					rolloutStrategy: &agent.RolloutStrategy{MaxConcurrency: 1, MinAvailableTime: c.minAvailableTime},
+					healthProber:    &agent.HealthProber{Type: agent.HealthProberTypeWork}},
+			}
+
+			syncContext := addontesting.NewFakeSyncContext(t)
+			addon, err := syncer.sync(context.TODO(), syncContext, addontesting.NewManagedCluster("cluster1"), c.addon.DeepCopy())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			rolloutCond := meta.FindStatusCondition(addon.Status.Conditions, constants.AddonConditionRollout)
+			if rolloutCond == nil || rolloutCond.Reason != c.expectedRolloutReason {
+				t.Errorf("expected rollout reason %s, but got %v", c.expectedRolloutReason, rolloutCond)
+			}
+			if syncContext.Queue().Len() != c.expectedQueueLen {
+				t.Errorf("expected %d addons are enqueued, but got %d", c.expectedQueueLen, syncContext.Queue().Len())
+			}
+		})
+	}
+}
+
+func TestRolloutGateForget(t *testing.T) {
+	addonInformers := addoninformers.NewSharedInformerFactory(fakeaddon.NewSimpleClientset(), 10*time.Minute)
+	gate := newRolloutGate(addonInformers.Addon().V1beta1().ManagedClusterAddOns().Lister())
+
+	addon := addontesting.NewAddonWithConditions("test", "cluster1")
+	gate.transit(addon, constants.RolloutReasonProgressing, "test")
+	gate.setGeneration(addon, newOutdatedDeployWork())
+	gate.transit(addontesting.NewAddonWithConditions("test", "cluster2"), constants.RolloutReasonProgressing, "test")
+
+	gate.forget("test", "cluster1")
+	if _, ok := gate.reasons["test"]["cluster1"]; ok {
+		t.Errorf("expected the rollout reason of cluster1 is removed")
+	}
+	if _, ok := gate.works["cluster1/test"]; ok {
+		t.Errorf("expected the works of cluster1 are removed")
+	}
+	if _, ok := gate.reasons["test"]["cluster2"]; !ok {
+		t.Errorf("expected the rollout reason of cluster2 is kept")
+	}
+
+	gate.forget("test", "cluster2")
+	if len(gate.reasons) != 0 {
+		t.Errorf("expected no rollout reasons, but got %v", gate.reasons)
+	}
+}
@@ -14,6 +14,7 @@ import (
 	workapiv1 "open-cluster-management.io/api/work/v1"
 
 	"open-cluster-management.io/addon-framework/pkg/addonmanager/addontesting"
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
 	"open-cluster-management.io/addon-framework/pkg/agent"
 	"open-cluster-management.io/addon-framework/pkg/utils"
 )
@@ -199,6 +200,7 @@ func TestGetManifestConfigOption(t *testing.T) {
 						{
 							Type: workapiv1.WellKnownStatusType,
 						},
+						rolloutFeedbackRule("deployments"),
 					},
 				},
 			},
@@ -224,6 +226,7 @@ func TestGetManifestConfigOption(t *testing.T) {
 						{
 							Type: workapiv1.WellKnownStatusType,
 						},
+						rolloutFeedbackRule("deployments"),
 					},
 				},
 			},
@@ -250,6 +253,7 @@ func TestGetManifestConfigOption(t *testing.T) {
 						{
 							Type: workapiv1.WellKnownStatusType,
 						},
+						rolloutFeedbackRule("deployments"),
 					},
 				},
 				{
@@ -263,6 +267,7 @@ func TestGetManifestConfigOption(t *testing.T) {
 						{
 							Type: workapiv1.WellKnownStatusType,
 						},
+						rolloutFeedbackRule("daemonsets"),
 					},
 				},
 			},
@@ -328,6 +333,7 @@ func TestGetManifestConfigOption(t *testing.T) {
 						{
 							Type: workapiv1.WellKnownStatusType,
 						},
+						rolloutFeedbackRule("deployments"),
 						{
 							Type: workapiv1.JSONPathsType,
 							JsonPaths: []workapiv1.JsonPath{
@@ -371,6 +377,11 @@ func TestGetManifestConfigOption(t *testing.T) {
 	}
 }
 
+// rolloutFeedbackRule returns the feedback rule of WellKnowManifestConfig to probe the rollout of the workloads.
+func rolloutFeedbackRule(resource string) workapiv1.FeedbackRule {
+	return utils.WellKnowManifestConfig("apps", resource, "default", "test").FeedbackRules[1]
+}
+
 func TestMergeFeedbackRule(t *testing.T) {
 	cases := []struct {
 		name                  string
@@ -539,3 +550,111 @@ func TestMergeFeedbackRule(t *testing.T) {
 		})
 	}
 }
+
+func TestHookWorkStatus(t *testing.T) {
+	workflow := addontesting.NewUnstructured("argoproj.io/v1alpha1", "Workflow", "default", "cleanup")
+	workflow.SetAnnotations(map[string]string{
+		addonapiv1beta1.AddonPreDeleteHookAnnotationKey: "",
+		constants.HookStatusJSONPathAnnotationKey:       ".status.phase",
+		constants.HookCompletedValueAnnotationKey:       "Succeeded",
+		constants.HookFailedValueAnnotationKey:          "Failed",
+	})
+	pod := addontesting.NewUnstructured("v1", "Pod", "default", "cleanup")
+	pod.SetAnnotations(map[string]string{addonapiv1beta1.AddonPreDeleteHookAnnotationKey: ""})
+	job := addontesting.NewUnstructured("batch/v1", "Job", "default", "cleanup")
+	job.SetAnnotations(map[string]string{addonapiv1beta1.AddonPreDeleteHookAnnotationKey: ""})
+
+	addon := addontesting.NewAddon("test", "cluster1")
+	hookWork, err := newAddonWorksBuilder(false, newWorkBuilder()).BuildHookWork(
+		constants.InstallModeDefault, "cluster1", addon, []runtime.Object{workflow, pod, job})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hookWork.Spec.ManifestConfigs) != 3 ||
+		hookWork.Spec.ManifestConfigs[0].ResourceIdentifier.Resource != "workflows" ||
+		hookWork.Spec.ManifestConfigs[0].FeedbackRules[0].Type != workapiv1.JSONPathsType ||
+		hookWork.Spec.ManifestConfigs[2].ResourceIdentifier.Resource != "jobs" ||
+		len(hookWork.Spec.ManifestConfigs[2].FeedbackRules) != 2 {
+		t.Fatalf("unexpected manifest configs %v", hookWork.Spec.ManifestConfigs)
+	}
+
+	newStatus := func(workflowPhase, podPhase, jobComplete, jobFailed string) workapiv1.ManifestWorkStatus {
+		feedbackValue := func(name, value string) workapiv1.FeedbackValue {
+			return workapiv1.FeedbackValue{Name: name, Value: workapiv1.FieldValue{Type: workapiv1.String, String: &value}}
+		}
+		manifestCondition := func(resourceMeta workapiv1.ManifestResourceMeta,
+			values ...workapiv1.FeedbackValue) workapiv1.ManifestCondition {
+			return workapiv1.ManifestCondition{
+				ResourceMeta: resourceMeta,
+				StatusFeedbacks: workapiv1.StatusFeedbackResult{
+					Values: values,
+				},
+			}
+		}
+		return workapiv1.ManifestWorkStatus{
+			Conditions: []metav1.Condition{
+				{Type: workapiv1.WorkAvailable, Status: metav1.ConditionTrue},
+			},
+			ResourceStatus: workapiv1.ManifestResourceStatus{
+				Manifests: []workapiv1.ManifestCondition{
+					manifestCondition(workapiv1.ManifestResourceMeta{
+						Group: "argoproj.io", Resource: "workflows", Name: "cleanup", Namespace: "default",
+					}, feedbackValue("HookStatus", workflowPhase)),
+					manifestCondition(workapiv1.ManifestResourceMeta{
+						Resource: "pods", Name: "cleanup", Namespace: "default",
+					}, feedbackValue("PodPhase", podPhase)),
+					manifestCondition(workapiv1.ManifestResourceMeta{
+						Group: "batch", Resource: "jobs", Name: "cleanup", Namespace: "default",
+					}, feedbackValue("JobComplete", jobComplete), feedbackValue("JobFailed", jobFailed)),
+				},
+			},
+		}
+	}
+
+	cases := []struct {
+		name              string
+		status            workapiv1.ManifestWorkStatus
+		expectedCompleted bool
+		expectedFailed    bool
+	}{
+		{
+			name: "no status",
+		},
+		{
+			name:   "running",
+			status: newStatus("Running", "Running", "False", "False"),
+		},
+		{
+			name:              "completed",
+			status:            newStatus("Succeeded", "Succeeded", "True", "False"),
+			expectedCompleted: true,
+		},
+		{
+			name:           "workflow failed",
+			status:         newStatus("Failed", "Succeeded", "True", "False"),
+			expectedFailed: true,
+		},
+		{
+			name:           "pod failed",
+			status:         newStatus("Succeeded", "Failed", "True", "False"),
+			expectedFailed: true,
+		},
+		{
+			name:           "job failed",
+			status:         newStatus("Succeeded", "Succeeded", "False", "True"),
+			expectedFailed: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			work := hookWork.DeepCopy()
+			work.Status = c.status
+			completed, failed := hookWorkStatus(work)
+			if completed != c.expectedCompleted || failed != c.expectedFailed {
+				t.Errorf("expected completed %v failed %v, but got completed %v failed %v",
+					c.expectedCompleted, c.expectedFailed, completed, failed)
+			}
+		})
+	}
+}
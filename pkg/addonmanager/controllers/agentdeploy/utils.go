@@ -2,8 +2,13 @@ package agentdeploy
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"time"
 
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -23,6 +28,28 @@ import (
 	"open-cluster-management.io/addon-framework/pkg/utils"
 )
 
+// setManifestsRenderedCondition sets the ManifestsRendered condition of the addon to false if the agentAddon
+// returns a ManifestsRenderError, and sets it back to true once the manifests are rendered.
+func setManifestsRenderedCondition(addon *addonapiv1beta1.ManagedClusterAddOn, err error) {
+	var renderErr *agent.ManifestsRenderError
+	switch {
+	case errors.As(err, &renderErr):
+		meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
+			Type:    constants.AddonConditionManifestsRendered,
+			Status:  metav1.ConditionFalse,
+			Reason:  renderErr.Reason,
+			Message: renderErr.Error(),
+		})
+	case err == nil && meta.FindStatusCondition(addon.Status.Conditions, constants.AddonConditionManifestsRendered) != nil:
+		meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
+			Type:    constants.AddonConditionManifestsRendered,
+			Status:  metav1.ConditionTrue,
+			Reason:  constants.ManifestsRenderedReasonRendered,
+			Message: "manifests of addon are rendered successfully",
+		})
+	}
+}
+
 func addonHasFinalizer(addon *addonapiv1beta1.ManagedClusterAddOn, finalizer string) bool {
 	for _, f := range addon.Finalizers {
 		if f == finalizer {
@@ -81,6 +108,25 @@ func addonAddFinalizer(addon *addonapiv1beta1.ManagedClusterAddOn, finalizer str
 	return true
 }
 
+// preDeleteHookTimeLeft returns the time left before the pre-delete hook of the deleting addon times out, it
+// returns false if the timeout of the pre-delete hook is not set.
+func preDeleteHookTimeLeft(agentAddon agent.AgentAddon, addon *addonapiv1beta1.ManagedClusterAddOn) (time.Duration, bool) {
+	timeout := agentAddon.GetAgentAddonOptions().PreDeleteHookTimeout
+	if value, ok := addon.Annotations[constants.PreDeleteHookTimeoutAnnotationKey]; ok {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			klog.Warningf("invalid pre-delete hook timeout %q of addon %s/%s: %v", value, addon.Namespace, addon.Name, err)
+		} else {
+			timeout = d
+		}
+	}
+
+	if timeout <= 0 || addon.DeletionTimestamp.IsZero() {
+		return 0, false
+	}
+	return timeout - time.Since(addon.DeletionTimestamp.Time), true
+}
+
 func newManifestWork(addonNamespace, addonName, clusterName string, manifests []workapiv1.Manifest,
 	manifestWorkNameFunc func(addonNamespace, addonName string) string) *workapiv1.ManifestWork {
 	if len(manifests) == 0 {
@@ -113,17 +159,6 @@ func newManifestWork(addonNamespace, addonName, clusterName string, manifests []
 // currently, we only support job and pod as hook resources.
 // we use WellKnownStatus here to get the job/pad status fields to check if the job/pod is completed.
 func (b *addonWorksBuilder) isPreDeleteHookObject(obj runtime.Object) (bool, *workapiv1.ManifestConfigOption) {
-	var resource string
-	gvk := obj.GetObjectKind().GroupVersionKind()
-	switch gvk.Kind {
-	case "Job":
-		resource = "jobs"
-	case "Pod":
-		resource = "pods"
-	default:
-		return false, nil
-	}
-
 	accessor, err := meta.Accessor(obj)
 	if err != nil {
 		return false, nil
@@ -139,20 +174,128 @@ func (b *addonWorksBuilder) isPreDeleteHookObject(obj runtime.Object) (bool, *wo
 		return false, nil
 	}
 
-	return true, &workapiv1.ManifestConfigOption{
+	manifestConfig := hookManifestConfig(obj)
+	return manifestConfig != nil, manifestConfig
+}
+
+// lifecycleHook is a hook run around the installation and upgrade of the addon. The hook resources of
+// each lifecycle hook are deployed by a separate manifestWork.
+type lifecycleHook struct {
+	// annotationKey is the annotation key of the hook resources.
+	annotationKey string
+	// conditionType is the condition type of the addon to represent whether the hook manifestWork is completed.
+	conditionType string
+}
+
+var (
+	postInstallHook = lifecycleHook{
+		annotationKey: constants.AddonPostInstallHookAnnotationKey,
+		conditionType: constants.AddonConditionPostInstallHookCompleted,
+	}
+	preUpgradeHook = lifecycleHook{
+		annotationKey: constants.AddonPreUpgradeHookAnnotationKey,
+		conditionType: constants.AddonConditionPreUpgradeHookCompleted,
+	}
+	postUpgradeHook = lifecycleHook{
+		annotationKey: constants.AddonPostUpgradeHookAnnotationKey,
+		conditionType: constants.AddonConditionPostUpgradeHookCompleted,
+	}
+
+	lifecycleHooks = []lifecycleHook{postInstallHook, preUpgradeHook, postUpgradeHook}
+)
+
+// isLifecycleHookObject check the object is a post-install, pre-upgrade or post-upgrade hook resource,
+// and returns the annotation key of the hook. The same as the pre-delete hook, only job and pod are supported.
+func (b *addonWorksBuilder) isLifecycleHookObject(obj runtime.Object) (string, *workapiv1.ManifestConfigOption) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return "", nil
+	}
+
+	for _, hook := range lifecycleHooks {
+		if _, ok := accessor.GetAnnotations()[hook.annotationKey]; !ok {
+			continue
+		}
+		manifestConfig := hookManifestConfig(obj)
+		if manifestConfig == nil {
+			return "", nil
+		}
+		return hook.annotationKey, manifestConfig
+	}
+	return "", nil
+}
+
+// hookStatusFeedbackName is the name of the JSONPath feedback rule of the hook resources with a custom
+// completion rule.
+const hookStatusFeedbackName = "HookStatus"
+
+// jobFailedFeedbackName is the name of the JSONPath feedback rule of the hook jobs to get the status of the
+// Failed condition, which is not in the WellKnownStatus of the job.
+const jobFailedFeedbackName = "JobFailed"
+
+// hookManifestConfig returns the manifest config to get the status of the hook resource. If the JSONPath of the
+// status field is set in the annotation of the hook resource, the status field is got by a JSONPath feedback rule,
+// otherwise only job and pod are supported and their status are got by WellKnownStatus. It returns nil if the
+// resource is not supported as a hook resource.
+func hookManifestConfig(obj runtime.Object) *workapiv1.ManifestConfigOption {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return nil
+	}
+
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	if path, ok := accessor.GetAnnotations()[constants.HookStatusJSONPathAnnotationKey]; ok {
+		plural, _ := meta.UnsafeGuessKindToResource(gvk)
+		return &workapiv1.ManifestConfigOption{
+			ResourceIdentifier: workapiv1.ResourceIdentifier{
+				Group:     gvk.Group,
+				Resource:  plural.Resource,
+				Name:      accessor.GetName(),
+				Namespace: accessor.GetNamespace(),
+			},
+			FeedbackRules: []workapiv1.FeedbackRule{
+				{
+					Type: workapiv1.JSONPathsType,
+					JsonPaths: []workapiv1.JsonPath{
+						{Name: hookStatusFeedbackName, Path: path},
+					},
+				},
+			},
+		}
+	}
+
+	var resource string
+	feedbackRules := []workapiv1.FeedbackRule{
+		{
+			Type: workapiv1.WellKnownStatusType,
+		},
+	}
+	switch gvk.Kind {
+	case "Job":
+		resource = "jobs"
+		feedbackRules = append(feedbackRules, workapiv1.FeedbackRule{
+			Type: workapiv1.JSONPathsType,
+			JsonPaths: []workapiv1.JsonPath{
+				{Name: jobFailedFeedbackName, Path: `.conditions[?(@.type=="Failed")].status`},
+			},
+		})
+	case "Pod":
+		resource = "pods"
+	default:
+		return nil
+	}
+
+	return &workapiv1.ManifestConfigOption{
 		ResourceIdentifier: workapiv1.ResourceIdentifier{
 			Group:     gvk.Group,
 			Resource:  resource,
 			Name:      accessor.GetName(),
 			Namespace: accessor.GetNamespace(),
 		},
-		FeedbackRules: []workapiv1.FeedbackRule{
-			{
-				Type: workapiv1.WellKnownStatusType,
-			},
-		},
+		FeedbackRules: feedbackRules,
 	}
 }
+
 func newAddonWorksBuilder(hostedModeEnabled bool, workBuilder *workbuilder.WorkBuilder) *addonWorksBuilder {
 	return &addonWorksBuilder{
 		processor:         &managedManifest{},
@@ -179,6 +322,7 @@ type manifestProcessor interface {
 	deployable(hostedModeEnabled bool, installMode string, obj runtime.Object) (bool, error)
 	manifestWorkNamePrefix(addonNamespace, addonName string) string
 	preDeleteHookManifestWorkName(addonNamespace, addonName string) string
+	lifecycleHookManifestWorkName(hookAnnotationKey, addonNamespace, addonName string) string
 }
 
 // hostingManifest process manifests which will be deployed on the hosting cluster
@@ -221,6 +365,17 @@ func (m *hostingManifest) preDeleteHookManifestWorkName(addonNamespace, addonNam
 	return constants.PreDeleteHookHostingWorkName(addonNamespace, addonName)
 }
 
+func (m *hostingManifest) lifecycleHookManifestWorkName(hookAnnotationKey, addonNamespace, addonName string) string {
+	switch hookAnnotationKey {
+	case constants.AddonPostInstallHookAnnotationKey:
+		return constants.PostInstallHookHostingWorkName(addonNamespace, addonName)
+	case constants.AddonPreUpgradeHookAnnotationKey:
+		return constants.PreUpgradeHookHostingWorkName(addonNamespace, addonName)
+	default:
+		return constants.PostUpgradeHookHostingWorkName(addonNamespace, addonName)
+	}
+}
+
 // managedManifest process manifests which will be deployed on the managed cluster
 type managedManifest struct {
 }
@@ -262,13 +417,25 @@ func (m *managedManifest) preDeleteHookManifestWorkName(addonNamespace, addonNam
 	return constants.PreDeleteHookWorkName(addonName)
 }
 
+func (m *managedManifest) lifecycleHookManifestWorkName(hookAnnotationKey, addonNamespace, addonName string) string {
+	switch hookAnnotationKey {
+	case constants.AddonPostInstallHookAnnotationKey:
+		return constants.PostInstallHookWorkName(addonName)
+	case constants.AddonPreUpgradeHookAnnotationKey:
+		return constants.PreUpgradeHookWorkName(addonName)
+	default:
+		return constants.PostUpgradeHookWorkName(addonName)
+	}
+}
+
 // BuildDeployWorks returns the deploy manifestWorks. if there is no manifest need
 // to deploy, will return nil.
 func (b *addonWorksBuilder) BuildDeployWorks(installMode, addonWorkNamespace string,
 	addon *addonapiv1beta1.ManagedClusterAddOn,
 	existingWorks []workapiv1.ManifestWork,
 	objects []runtime.Object,
-	manifestOptions []workapiv1.ManifestConfigOption) (deployWorks, deleteWorks []*workapiv1.ManifestWork, err error) {
+	manifestOptions []workapiv1.ManifestConfigOption,
+	workAnnotations map[string]string) (deployWorks, deleteWorks []*workapiv1.ManifestWork, err error) {
 	var deployObjects []runtime.Object
 	// This owner is only added to the manifestWork deployed in managed cluster ns.
 	// the manifestWork in managed cluster ns is cleaned up via the addon ownerRef, so need to add the owner.
@@ -293,6 +460,9 @@ func (b *addonWorksBuilder) BuildDeployWorks(installMode, addonWorkNamespace str
 		if isHookObject {
 			continue
 		}
+		if hook, _ := b.isLifecycleHookObject(object); len(hook) > 0 {
+			continue
+		}
 
 		rule, err := getDeletionOrphaningRule(object)
 		if err != nil {
@@ -322,13 +492,121 @@ func (b *addonWorksBuilder) BuildDeployWorks(installMode, addonWorkNamespace str
 	if err != nil {
 		return nil, nil, err
 	}
+	for k, v := range workAnnotations {
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[k] = v
+	}
 
-	return b.workBuilder.Build(deployObjects,
-		newAddonWorkObjectMeta(b.processor.manifestWorkNamePrefix(addon.Namespace, addon.Name), addon.Name, addon.Namespace, addonWorkNamespace, owner),
-		workbuilder.ExistingManifestWorksOption(existingWorks),
-		workbuilder.ManifestConfigOption(manifestOptions),
-		workbuilder.ManifestAnnotations(annotations),
-		workbuilder.DeletionOption(deletionOption))
+	// the deploy manifestWorks are annotated with the hash of the addon manifests if the addon has lifecycle
+	// hooks, so the hooks can be run when the addon is installed or upgraded.
+	manifestsHash, err := b.lifecycleManifestsHash(installMode, objects)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(manifestsHash) > 0 {
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[constants.ManifestsHashAnnotationKey] = manifestsHash
+		installedHash := manifestsHash
+		if len(existingWorks) > 0 {
+			installedHash = installedManifestsHash(existingWorks)
+		}
+		if len(installedHash) > 0 {
+			annotations[constants.InstalledManifestsHashAnnotationKey] = installedHash
+		}
+	}
+
+	namePrefix := b.processor.manifestWorkNamePrefix(addon.Namespace, addon.Name)
+	waves, waveObjects, err := groupObjectsByDeployWave(deployObjects)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(waves) == 1 && waves[0] == 0 {
+		return b.workBuilder.Build(deployObjects,
+			newAddonWorkObjectMeta(namePrefix, addon.Name, addon.Namespace, addonWorkNamespace, owner),
+			workbuilder.ExistingManifestWorksOption(existingWorks),
+			workbuilder.ManifestConfigOption(manifestOptions),
+			workbuilder.ManifestAnnotations(annotations),
+			workbuilder.DeletionOption(deletionOption))
+	}
+
+	// the manifests of each wave are deployed by separate manifestWorks, the manifestWorks of the waves
+	// are returned in the order of the waves.
+	existingWaveWorks := map[int][]workapiv1.ManifestWork{}
+	for _, work := range existingWorks {
+		wave := deployWave(&work)
+		existingWaveWorks[wave] = append(existingWaveWorks[wave], work)
+	}
+	for _, wave := range waves {
+		waveAnnotations := map[string]string{}
+		for k, v := range annotations {
+			waveAnnotations[k] = v
+		}
+		if wave != 0 {
+			waveAnnotations[constants.DeployWaveAnnotationKey] = strconv.Itoa(wave)
+		}
+
+		works, deletedWorks, err := b.workBuilder.Build(waveObjects[wave],
+			newAddonWorkObjectMeta(constants.DeployWaveWorkNamePrefix(namePrefix, wave),
+				addon.Name, addon.Namespace, addonWorkNamespace, owner),
+			workbuilder.ExistingManifestWorksOption(existingWaveWorks[wave]),
+			workbuilder.ManifestConfigOption(manifestOptions),
+			workbuilder.ManifestAnnotations(waveAnnotations),
+			workbuilder.DeletionOption(deletionOption))
+		if err != nil {
+			return nil, nil, err
+		}
+		deployWorks = append(deployWorks, works...)
+		deleteWorks = append(deleteWorks, deletedWorks...)
+		delete(existingWaveWorks, wave)
+	}
+
+	// delete the manifestWorks of the waves which are removed from the manifests.
+	for _, works := range existingWaveWorks {
+		for i := range works {
+			deleteWorks = append(deleteWorks, works[i].DeepCopy())
+		}
+	}
+	return deployWorks, deleteWorks, nil
+}
+
+// groupObjectsByDeployWave groups the objects by the deploy wave annotation, and returns the waves in
+// ascending order.
+func groupObjectsByDeployWave(objects []runtime.Object) ([]int, map[int][]runtime.Object, error) {
+	var waves []int
+	waveObjects := map[int][]runtime.Object{}
+	for _, object := range objects {
+		accessor, err := meta.Accessor(object)
+		if err != nil {
+			return nil, nil, err
+		}
+		wave := 0
+		if value, ok := accessor.GetAnnotations()[constants.DeployWaveAnnotationKey]; ok {
+			wave, err = strconv.Atoi(value)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid deploy wave %q of %s %s/%s: %v", value,
+					object.GetObjectKind().GroupVersionKind().Kind, accessor.GetNamespace(), accessor.GetName(), err)
+			}
+		}
+		if _, ok := waveObjects[wave]; !ok {
+			waves = append(waves, wave)
+		}
+		waveObjects[wave] = append(waveObjects[wave], object)
+	}
+	sort.Ints(waves)
+	return waves, waveObjects, nil
+}
+
+// deployWave returns the deploy wave of the deploy manifestWork, it is 0 if the manifestWork has no wave.
+func deployWave(work *workapiv1.ManifestWork) int {
+	wave, err := strconv.Atoi(work.Annotations[constants.DeployWaveAnnotationKey])
+	if err != nil {
+		return 0
+	}
+	return wave
 }
 
 // BuildHookWork returns the preDelete manifestWork, if there is no manifest need
@@ -383,6 +661,123 @@ func (b *addonWorksBuilder) BuildHookWork(installMode, addonWorkNamespace string
 	return hookWork, nil
 }
 
+// BuildLifecycleHookWorks returns the post-install, pre-upgrade and post-upgrade hook manifestWorks keyed by the
+// annotation key of the hook, the hook manifestWorks are annotated with the hash of the addon manifests.
+func (b *addonWorksBuilder) BuildLifecycleHookWorks(installMode, addonWorkNamespace string,
+	addon *addonapiv1beta1.ManagedClusterAddOn,
+	objects []runtime.Object) (map[string]*workapiv1.ManifestWork, error) {
+	hookManifests := map[string][]workapiv1.Manifest{}
+	hookManifestConfigs := map[string][]workapiv1.ManifestConfigOption{}
+
+	for _, object := range objects {
+		deployable, err := b.processor.deployable(b.hostedModeEnabled, installMode, object)
+		if err != nil {
+			return nil, err
+		}
+		if !deployable {
+			continue
+		}
+
+		hook, manifestConfig := b.isLifecycleHookObject(object)
+		if len(hook) == 0 {
+			continue
+		}
+		rawObject, err := runtime.Encode(unstructured.UnstructuredJSONScheme, object)
+		if err != nil {
+			return nil, err
+		}
+
+		hookManifests[hook] = append(hookManifests[hook], workapiv1.Manifest{RawExtension: runtime.RawExtension{Raw: rawObject}})
+		hookManifestConfigs[hook] = append(hookManifestConfigs[hook], *manifestConfig)
+	}
+	if len(hookManifests) == 0 {
+		return nil, nil
+	}
+
+	manifestsHash, err := b.lifecycleManifestsHash(installMode, objects)
+	if err != nil {
+		return nil, err
+	}
+
+	owner := metav1.NewControllerRef(addon, schema.GroupVersionKind{
+		Group:   addonapiv1beta1.GroupName,
+		Version: addonapiv1beta1.GroupVersion.Version,
+		Kind:    "ManagedClusterAddOn",
+	})
+
+	hookWorks := map[string]*workapiv1.ManifestWork{}
+	for hook, manifests := range hookManifests {
+		hookWork := newManifestWork(addon.Namespace, addon.Name, addonWorkNamespace, manifests,
+			func(addonNamespace, addonName string) string {
+				return b.processor.lifecycleHookManifestWorkName(hook, addonNamespace, addonName)
+			})
+		// This owner is only added to the manifestWork deployed in managed cluster ns.
+		if addon.Namespace == addonWorkNamespace {
+			hookWork.OwnerReferences = []metav1.OwnerReference{*owner}
+		}
+		hookWork.Annotations = map[string]string{
+			constants.ManifestsHashAnnotationKey: manifestsHash,
+		}
+		hookWork.Spec.ManifestConfigs = hookManifestConfigs[hook]
+		hookWorks[hook] = hookWork
+	}
+	return hookWorks, nil
+}
+
+// lifecycleManifestsHash returns the hash of the deployable addon manifests if there is any lifecycle hook
+// in the manifests, otherwise returns empty.
+func (b *addonWorksBuilder) lifecycleManifestsHash(installMode string, objects []runtime.Object) (string, error) {
+	var hasLifecycleHook bool
+	hash := sha256.New()
+	for _, object := range objects {
+		deployable, err := b.processor.deployable(b.hostedModeEnabled, installMode, object)
+		if err != nil {
+			return "", err
+		}
+		if !deployable {
+			continue
+		}
+
+		if hook, _ := b.isLifecycleHookObject(object); len(hook) > 0 {
+			hasLifecycleHook = true
+		}
+		rawObject, err := runtime.Encode(unstructured.UnstructuredJSONScheme, object)
+		if err != nil {
+			return "", err
+		}
+		hash.Write(rawObject)
+	}
+	if !hasLifecycleHook {
+		return "", nil
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// installedManifestsHash returns the hash of the addon manifests when the addon is installed, which is
+// recorded on the existing deploy manifestWorks.
+func installedManifestsHash(works []workapiv1.ManifestWork) string {
+	for _, work := range works {
+		if hash, ok := work.Annotations[constants.InstalledManifestsHashAnnotationKey]; ok {
+			return hash
+		}
+	}
+	return ""
+}
+
+// deployedManifestsHash returns the hash of the addon manifests that all the deploy manifestWorks are built
+// from, it returns empty if the deploy manifestWorks are built from different manifests.
+func deployedManifestsHash(works []*workapiv1.ManifestWork) string {
+	var hash string
+	for i, work := range works {
+		workHash := work.Annotations[constants.ManifestsHashAnnotationKey]
+		if i > 0 && workHash != hash {
+			return ""
+		}
+		hash = workHash
+	}
+	return hash
+}
+
 func FindManifestValue(
 	resourceStatus workapiv1.ManifestResourceStatus,
 	identifier workapiv1.ResourceIdentifier,
@@ -408,53 +803,116 @@ func FindManifestValue(
 }
 
 // hookWorkIsCompleted checks the hook resources are completed.
-// hookManifestWork is completed if all resources are completed.
-// currently, we only support job and pod as hook manifest.
-// job is completed if the Completed condition of status is true.
-// pod is completed if the phase of status is Succeeded.
 func hookWorkIsCompleted(hookWork *workapiv1.ManifestWork) bool {
+	completed, _ := hookWorkStatus(hookWork)
+	return completed
+}
+
+// hookWorkStatus checks the hook resources are completed or failed.
+// hookManifestWork is completed if all resources are completed, and is failed if any resource is failed.
+// the resource with a custom completion rule is completed or failed if the value of its status field is
+// equal to the completed or failed value in its annotations.
+// otherwise, job is completed if the Complete condition of status is true, and is failed if the Failed condition
+// of status is true.
+// pod is completed if the phase of status is Succeeded, and is failed if the phase of status is Failed.
+func hookWorkStatus(hookWork *workapiv1.ManifestWork) (completed, failed bool) {
 	if hookWork == nil {
-		return false
-	}
-	if !meta.IsStatusConditionTrue(hookWork.Status.Conditions, workapiv1.WorkAvailable) {
-		return false
+		return false, false
 	}
 
 	if len(hookWork.Spec.ManifestConfigs) == 0 {
 		klog.Errorf("the hook manifestWork should have manifest configs,but got 0.")
-		return false
+		return false, false
 	}
+
+	completed = meta.IsStatusConditionTrue(hookWork.Status.Conditions, workapiv1.WorkAvailable)
+	rules := hookCompletionRules(hookWork)
 	for _, manifestConfig := range hookWork.Spec.ManifestConfigs {
+		if rule, ok := rules[manifestConfig.ResourceIdentifier]; ok {
+			value, ok := fieldValueString(
+				FindManifestValue(hookWork.Status.ResourceStatus, manifestConfig.ResourceIdentifier, hookStatusFeedbackName))
+			if !ok || value != rule.completedValue {
+				completed = false
+			}
+			if ok && len(rule.failedValue) > 0 && value == rule.failedValue {
+				failed = true
+			}
+			continue
+		}
+
 		switch manifestConfig.ResourceIdentifier.Resource {
 		case "jobs":
-			value := FindManifestValue(hookWork.Status.ResourceStatus, manifestConfig.ResourceIdentifier, "JobComplete")
-			if value.Type == "" {
-				return false
-			}
-			if value.String == nil {
-				return false
+			value, ok := fieldValueString(
+				FindManifestValue(hookWork.Status.ResourceStatus, manifestConfig.ResourceIdentifier, "JobComplete"))
+			if !ok || value != "True" {
+				completed = false
 			}
-			if *value.String != "True" {
-				return false
+			value, ok = fieldValueString(
+				FindManifestValue(hookWork.Status.ResourceStatus, manifestConfig.ResourceIdentifier, jobFailedFeedbackName))
+			if ok && value == "True" {
+				failed = true
 			}
-
 		case "pods":
-			value := FindManifestValue(hookWork.Status.ResourceStatus, manifestConfig.ResourceIdentifier, "PodPhase")
-			if value.Type == "" {
-				return false
-			}
-			if value.String == nil {
-				return false
+			value, ok := fieldValueString(
+				FindManifestValue(hookWork.Status.ResourceStatus, manifestConfig.ResourceIdentifier, "PodPhase"))
+			if !ok || value != "Succeeded" {
+				completed = false
 			}
-			if *value.String != "Succeeded" {
-				return false
+			if ok && value == "Failed" {
+				failed = true
 			}
 		default:
-			return false
+			completed = false
 		}
 	}
 
-	return true
+	return completed && !failed, failed
+}
+
+// hookCompletionRule is the custom completion rule of a hook resource set by its annotations.
+type hookCompletionRule struct {
+	completedValue string
+	failedValue    string
+}
+
+// hookCompletionRules returns the custom completion rules of the hook resources in the hook manifestWork keyed
+// by the resource identifier.
+func hookCompletionRules(hookWork *workapiv1.ManifestWork) map[workapiv1.ResourceIdentifier]hookCompletionRule {
+	rules := map[workapiv1.ResourceIdentifier]hookCompletionRule{}
+	for _, manifest := range hookWork.Spec.Workload.Manifests {
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(manifest.Raw); err != nil {
+			continue
+		}
+		annotations := obj.GetAnnotations()
+		if _, ok := annotations[constants.HookStatusJSONPathAnnotationKey]; !ok {
+			continue
+		}
+		manifestConfig := hookManifestConfig(obj)
+		if manifestConfig == nil {
+			continue
+		}
+		rules[manifestConfig.ResourceIdentifier] = hookCompletionRule{
+			completedValue: annotations[constants.HookCompletedValueAnnotationKey],
+			failedValue:    annotations[constants.HookFailedValueAnnotationKey],
+		}
+	}
+	return rules
+}
+
+// fieldValueString returns the string format of the status feedback value, it returns false if there is no value.
+func fieldValueString(value workapiv1.FieldValue) (string, bool) {
+	switch {
+	case value.String != nil:
+		return *value.String, true
+	case value.Integer != nil:
+		return strconv.FormatInt(*value.Integer, 10), true
+	case value.Boolean != nil:
+		return strconv.FormatBool(*value.Boolean), true
+	case value.JsonRaw != nil:
+		return *value.JsonRaw, true
+	}
+	return "", false
 }
 
 func newAddonWorkObjectMeta(namePrefix, addonName, addonNamespace, workNamespace string,
@@ -481,13 +939,42 @@ func newAddonWorkObjectMeta(namePrefix, addonName, addonNamespace, workNamespace
 	}
 }
 
+// getManifestWorkAnnotations returns the annotations of the deploy manifestWorks from the agentAddon.
+func getManifestWorkAnnotations(ctx context.Context, agentAddon agent.AgentAddon,
+	cluster *clusterv1.ManagedCluster,
+	addon *addonapiv1beta1.ManagedClusterAddOn) (map[string]string, error) {
+	if agentAddon.GetAgentAddonOptions().ManifestWorkAnnotations == nil {
+		return nil, nil
+	}
+	return agentAddon.GetAgentAddonOptions().ManifestWorkAnnotations(ctx, cluster, addon)
+}
+
+// setSensitiveDataAnnotation sets the SensitiveDataAnnotationKey annotation on the hook manifestWorks if it is in
+// the annotations of the deploy manifestWorks, since the hook manifests are rendered with the same values.
+func setSensitiveDataAnnotation(workAnnotations map[string]string, works ...*workapiv1.ManifestWork) {
+	value, ok := workAnnotations[constants.SensitiveDataAnnotationKey]
+	if !ok {
+		return
+	}
+	for _, work := range works {
+		if work == nil {
+			continue
+		}
+		if work.Annotations == nil {
+			work.Annotations = map[string]string{}
+		}
+		work.Annotations[constants.SensitiveDataAnnotationKey] = value
+	}
+}
+
 func getManifestConfigOption(ctx context.Context, agentAddon agent.AgentAddon,
 	cluster *clusterv1.ManagedCluster,
 	addon *addonapiv1beta1.ManagedClusterAddOn) ([]workapiv1.ManifestConfigOption, error) {
 	manifestConfigs := []workapiv1.ManifestConfigOption{}
 
 	if agentAddon.GetAgentAddonOptions().HealthProber != nil &&
-		agentAddon.GetAgentAddonOptions().HealthProber.Type == agent.HealthProberTypeWork &&
+		(agentAddon.GetAgentAddonOptions().HealthProber.Type == agent.HealthProberTypeWork ||
+			agentAddon.GetAgentAddonOptions().HealthProber.Type == agent.HealthProberTypeLeaseAndWork) &&
 		agentAddon.GetAgentAddonOptions().HealthProber.WorkProber != nil {
 		probeRules := agentAddon.GetAgentAddonOptions().HealthProber.WorkProber.ProbeFields
 		for _, rule := range probeRules {
@@ -513,8 +1000,11 @@ func getManifestConfigOption(ctx context.Context, agentAddon agent.AgentAddon,
 		}
 	}
 
+	// the availability of all the workloads is probed by the HealthProberTypeLeaseAndWork if the WorkProber is nil.
 	if agentAddon.GetAgentAddonOptions().HealthProber != nil &&
-		agentAddon.GetAgentAddonOptions().HealthProber.Type == agent.HealthProberTypeWorkloadAvailability {
+		(agentAddon.GetAgentAddonOptions().HealthProber.Type == agent.HealthProberTypeWorkloadAvailability ||
+			(agentAddon.GetAgentAddonOptions().HealthProber.Type == agent.HealthProberTypeLeaseAndWork &&
+				agentAddon.GetAgentAddonOptions().HealthProber.WorkProber == nil)) {
 
 		manifests, err := agentAddon.Manifests(ctx, cluster, addon)
 		if err != nil {
@@ -528,6 +1018,16 @@ func getManifestConfigOption(ctx context.Context, agentAddon agent.AgentAddon,
 		}
 	}
 
+	if agentAddon.GetAgentAddonOptions().HealthProber != nil {
+		if plugin, ok := agent.GetHealthProberPlugin(agentAddon.GetAgentAddonOptions().HealthProber.Type); ok {
+			manifests, err := agentAddon.Manifests(ctx, cluster, addon)
+			if err != nil {
+				return manifestConfigs, fmt.Errorf("get all manifests error: %v", err)
+			}
+			manifestConfigs = append(manifestConfigs, plugin.ManifestConfigs(manifests)...)
+		}
+	}
+
 	userConfiguredManifestConfigs := agentAddon.GetAgentAddonOptions().ManifestConfigs
 	for _, mc := range userConfiguredManifestConfigs {
 		index := containsResourceIdentifier(manifestConfigs, mc.ResourceIdentifier)
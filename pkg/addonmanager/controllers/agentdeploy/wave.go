@@ -0,0 +1,53 @@
+package agentdeploy
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+	workapiv1 "open-cluster-management.io/api/work/v1"
+	workapplier "open-cluster-management.io/sdk-go/pkg/apis/work/v1/applier"
+)
+
+// filterDeployWaves returns the deploy manifestWorks which can be applied. The deploy manifestWorks are in the
+// order of the waves, and the manifestWorks of a wave are applied only after the manifestWorks of all the
+// previous waves are applied with the latest spec and available.
+func filterDeployWaves(addon *addonapiv1beta1.ManagedClusterAddOn,
+	deployWorks, existingWorks []*workapiv1.ManifestWork) []*workapiv1.ManifestWork {
+	existing := map[string]*workapiv1.ManifestWork{}
+	for _, work := range existingWorks {
+		existing[work.Namespace+"/"+work.Name] = work
+	}
+
+	for i := 0; i < len(deployWorks); {
+		wave := deployWave(deployWorks[i])
+		next := i
+		for next < len(deployWorks) && deployWave(deployWorks[next]) == wave {
+			next++
+		}
+		if next == len(deployWorks) {
+			break
+		}
+
+		for _, work := range deployWorks[i:next] {
+			if !waveWorkIsAvailable(work, existing[work.Namespace+"/"+work.Name]) {
+				klog.V(4).InfoS("Waiting for the deploy wave to be available before applying the next wave",
+					"addonNamespace", addon.Namespace, "addonName", addon.Name, "wave", wave, "workName", work.Name)
+				return deployWorks[:next]
+			}
+		}
+		i = next
+	}
+	return deployWorks
+}
+
+// waveWorkIsAvailable returns true if the existing manifestWork has the spec of the desired manifestWork and
+// the spec is available on the cluster.
+func waveWorkIsAvailable(desired, existing *workapiv1.ManifestWork) bool {
+	if existing == nil || !workapplier.ManifestWorkEqual(desired, existing) {
+		return false
+	}
+	cond := meta.FindStatusCondition(existing.Status.Conditions, workapiv1.WorkAvailable)
+	return cond != nil && cond.Status == metav1.ConditionTrue && cond.ObservedGeneration == existing.Generation
+}
@@ -0,0 +1,182 @@
+package agentdeploy
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	workapiv1 "open-cluster-management.io/api/work/v1"
+	"open-cluster-management.io/sdk-go/pkg/apis/work/v1/builder"
+
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/addontesting"
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
+)
+
+func newWaveObject(name, wave string) *unstructured.Unstructured {
+	obj := addontesting.NewUnstructured("v1", "ConfigMap", "default", name)
+	if len(wave) > 0 {
+		obj.SetAnnotations(map[string]string{constants.DeployWaveAnnotationKey: wave})
+	}
+	return obj
+}
+
+func TestBuildDeployWorksWithWaves(t *testing.T) {
+	addon := addontesting.NewAddon("test", "cluster1")
+	workBuilder := newAddonWorksBuilder(false, builder.NewWorkBuilder())
+
+	cases := []struct {
+		name                string
+		objects             []runtime.Object
+		existingWorks       []workapiv1.ManifestWork
+		expectedWorks       []string
+		expectedWaves       []int
+		expectedDeleteWorks []string
+		expectedErr         bool
+	}{
+		{
+			name:          "no wave",
+			objects:       []runtime.Object{newWaveObject("a", ""), newWaveObject("b", "")},
+			expectedWorks: []string{"addon-test-deploy-0"},
+			expectedWaves: []int{0},
+		},
+		{
+			name: "multiple waves",
+			objects: []runtime.Object{
+				newWaveObject("c", "2"), newWaveObject("a", ""), newWaveObject("b", "1"), newWaveObject("d", "-1"),
+			},
+			expectedWorks: []string{
+				"addon-test-deploy-wave--1-0", "addon-test-deploy-0", "addon-test-deploy-wave-1-0", "addon-test-deploy-wave-2-0",
+			},
+			expectedWaves: []int{-1, 0, 1, 2},
+		},
+		{
+			name:    "wave is removed",
+			objects: []runtime.Object{newWaveObject("a", ""), newWaveObject("b", "1")},
+			existingWorks: func() []workapiv1.ManifestWork {
+				work := addontesting.NewManifestWork("addon-test-deploy-wave-2-0", "cluster1", newWaveObject("c", "2"))
+				work.Annotations = map[string]string{constants.DeployWaveAnnotationKey: "2"}
+				return []workapiv1.ManifestWork{*work}
+			}(),
+			expectedWorks:       []string{"addon-test-deploy-0", "addon-test-deploy-wave-1-0"},
+			expectedWaves:       []int{0, 1},
+			expectedDeleteWorks: []string{"addon-test-deploy-wave-2-0"},
+		},
+		{
+			name:        "invalid wave",
+			objects:     []runtime.Object{newWaveObject("a", "first")},
+			expectedErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			works, deleteWorks, err := workBuilder.BuildDeployWorks(constants.InstallModeDefault, "cluster1", addon,
+				c.existingWorks, c.objects, nil, nil)
+			if c.expectedErr {
+				if err == nil {
+					t.Fatalf("expected error, but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(works) != len(c.expectedWorks) {
+				t.Fatalf("expected works %v, but got %d works", c.expectedWorks, len(works))
+			}
+			for i, work := range works {
+				if work.Name != c.expectedWorks[i] {
+					t.Errorf("expected work %s, but got %s", c.expectedWorks[i], work.Name)
+				}
+				if deployWave(work) != c.expectedWaves[i] {
+					t.Errorf("expected wave %d of work %s, but got %d", c.expectedWaves[i], work.Name, deployWave(work))
+				}
+			}
+
+			if len(deleteWorks) != len(c.expectedDeleteWorks) {
+				t.Fatalf("expected delete works %v, but got %d works", c.expectedDeleteWorks, len(deleteWorks))
+			}
+			for i, work := range deleteWorks {
+				if work.Name != c.expectedDeleteWorks[i] {
+					t.Errorf("expected delete work %s, but got %s", c.expectedDeleteWorks[i], work.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestFilterDeployWaves(t *testing.T) {
+	addon := addontesting.NewAddon("test", "cluster1")
+	workBuilder := newAddonWorksBuilder(false, builder.NewWorkBuilder())
+	deployWorks, _, err := workBuilder.BuildDeployWorks(constants.InstallModeDefault, "cluster1", addon, nil,
+		[]runtime.Object{newWaveObject("a", ""), newWaveObject("b", "1"), newWaveObject("c", "2")}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	existingWork := func(index int, available bool, generation, observedGeneration int64) *workapiv1.ManifestWork {
+		work := deployWorks[index].DeepCopy()
+		work.Generation = generation
+		status := metav1.ConditionFalse
+		if available {
+			status = metav1.ConditionTrue
+		}
+		work.Status.Conditions = []metav1.Condition{
+			{Type: workapiv1.WorkAvailable, Status: status, ObservedGeneration: observedGeneration},
+		}
+		return work
+	}
+
+	cases := []struct {
+		name          string
+		existingWorks []*workapiv1.ManifestWork
+		expectedWorks int
+	}{
+		{
+			name:          "first wave is not applied",
+			expectedWorks: 1,
+		},
+		{
+			name:          "first wave is not available",
+			existingWorks: []*workapiv1.ManifestWork{existingWork(0, false, 1, 1)},
+			expectedWorks: 1,
+		},
+		{
+			name:          "first wave is available",
+			existingWorks: []*workapiv1.ManifestWork{existingWork(0, true, 1, 1)},
+			expectedWorks: 2,
+		},
+		{
+			name:          "latest spec of first wave is not available",
+			existingWorks: []*workapiv1.ManifestWork{existingWork(0, true, 2, 1)},
+			expectedWorks: 1,
+		},
+		{
+			name: "first wave is changed",
+			existingWorks: func() []*workapiv1.ManifestWork {
+				work := existingWork(0, true, 1, 1)
+				work.Spec.Workload.Manifests = nil
+				return []*workapiv1.ManifestWork{work, existingWork(1, true, 1, 1)}
+			}(),
+			expectedWorks: 1,
+		},
+		{
+			name: "all waves are available",
+			existingWorks: []*workapiv1.ManifestWork{
+				existingWork(0, true, 1, 1), existingWork(1, true, 1, 1), existingWork(2, false, 1, 1),
+			},
+			expectedWorks: 3,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			works := filterDeployWaves(addon, deployWorks, c.existingWorks)
+			if len(works) != c.expectedWorks {
+				t.Errorf("expected %d works, but got %d", c.expectedWorks, len(works))
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package agent
 import (
 	"context"
 	"fmt"
+	"time"
 
 	certificatesv1 "k8s.io/api/certificates/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -24,6 +25,23 @@ func (e *SubjectNotReadyError) Error() string {
 	return "registration subject not ready"
 }
 
+// ManifestsRenderError indicates that the manifests of the addon can not be rendered because of the invalid
+// inputs of the addon, e.g. the values do not meet the schema of the chart. When Manifests returns this error,
+// the controller will set the ManifestsRendered condition of the addon to false with the reason of the error.
+type ManifestsRenderError struct {
+	// Reason is the reason of the ManifestsRendered condition, it should be in CamelCase.
+	Reason string
+	Err    error
+}
+
+func (e *ManifestsRenderError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ManifestsRenderError) Unwrap() error {
+	return e.Err
+}
+
 // AgentAddon is a mandatory interface for implementing a custom addon.
 // The addon is expected to be registered into an AddonManager so the manager will be invoking the addon
 // implementation below as callbacks upon:
@@ -82,7 +100,9 @@ type AgentAddonOptions struct {
 	HostedModeInfoFunc func(addon *addonapiv1beta1.ManagedClusterAddOn, cluster *clusterv1.ManagedCluster) (string, string)
 
 	// SupportedConfigGVRs is a list of addon supported configuration GroupVersionResource
-	// each configuration GroupVersionResource should be unique
+	// each configuration GroupVersionResource should be unique.
+	// If the ManifestOverride (utils.ManifestOverrideConfigGVR) is supported, the patches in the ManifestOverride
+	// referenced by the addon are applied to the manifests of the addon before the manifestWorks are built.
 	SupportedConfigGVRs []schema.GroupVersionResource
 
 	// AgentDeployTriggerClusterFilter defines the filter func to trigger the agent deploy/redploy when cluster info is
@@ -111,6 +131,39 @@ type AgentAddonOptions struct {
 	// If not set, will be defaulted to false.
 	// +optional
 	ConfigCheckEnabled bool
+
+	// RolloutStrategy defines how the changed manifests of the addon are rolled out across the clusters.
+	// The deploy manifestWorks of an addon are only updated after the cluster is admitted by the strategy,
+	// the manifestWorks of newly installed addons are created without waiting.
+	// If nil, the changed manifests are applied to all the clusters at once.
+	// +optional
+	RolloutStrategy *RolloutStrategy
+
+	// RollbackOption enables to roll back the deploy manifestWorks of the addon on a cluster to the last known
+	// good spec when the addon becomes unavailable after the manifests are changed.
+	// If nil, the rollback is disabled.
+	// +optional
+	RollbackOption *RollbackOption
+
+	// FlapDetection enables to keep a bounded history of the Available condition transitions of the addon
+	// on each cluster, and to set the Flapping condition when the addon is flapping. The transitions are
+	// recorded whatever the health prober type is, including the Available condition set by the lease prober.
+	// If nil, the history is not kept.
+	// +optional
+	FlapDetection *FlapDetectionOption
+
+	// PreDeleteHookTimeout is the time to wait for the pre-delete hook to complete after the addon is deleted.
+	// Once the timeout is reached, the pre-delete hook manifestWork is deleted and the addon is deleted without
+	// waiting for the hook. It can be overridden for an addon by the annotation
+	// "addon.open-cluster-management.io/pre-delete-hook-timeout" on the ManagedClusterAddOn.
+	// If not set, will wait for the pre-delete hook to complete forever.
+	// +optional
+	PreDeleteHookTimeout time.Duration
+
+	// ManifestWorkAnnotations returns the annotations added to the deploy manifestWorks of the addon, e.g. to
+	// record how the manifests are rendered for debugging.
+	// +optional
+	ManifestWorkAnnotations ManifestWorkAnnotationsFunc
 }
 
 type RegistrationConfigurationsFunc func(ctx context.Context, cluster *clusterv1.ManagedCluster,
@@ -124,6 +177,9 @@ type CSRApproveFunc func(ctx context.Context, cluster *clusterv1.ManagedCluster,
 
 type PermissionConfigFunc func(ctx context.Context, cluster *clusterv1.ManagedCluster, addon *addonapiv1beta1.ManagedClusterAddOn) error
 
+type ManifestWorkAnnotationsFunc func(ctx context.Context, cluster *clusterv1.ManagedCluster,
+	addon *addonapiv1beta1.ManagedClusterAddOn) (map[string]string, error)
+
 type AgentInstallNamespaceFunc func(ctx context.Context, addon *addonapiv1beta1.ManagedClusterAddOn) (string, error)
 
 // RegistrationOption defines how agent is registered to the hub cluster. It needs to define:
@@ -165,6 +221,49 @@ type RegistrationOption struct {
 	CSRSign CSRSignerFunc
 }
 
+// RolloutStrategy defines how the changed manifests of an addon are rolled out across the clusters. A cluster
+// is rolling out from the time its deploy manifestWorks are updated until the addon becomes Available with the
+// updated manifestWorks. If the addon becomes unavailable instead, the rollout fails on the cluster.
+type RolloutStrategy struct {
+	// MaxConcurrency is the max number of clusters rolling out or failed at the same time.
+	// If it is zero, there is no limit.
+	MaxConcurrency int
+
+	// MaxUnavailable is the max number of clusters on which the rollout is allowed to fail. Once the number of
+	// failed clusters exceeds it, the rollout is held on the remaining clusters until the failed clusters become
+	// available again, e.g. after the manifests are fixed.
+	MaxUnavailable int
+
+	// MinAvailableTime is how long the addon must stay available after the changed manifests are applied
+	// by the work agent before the rollout on the cluster succeeds, if the Available condition of the addon
+	// does not transition after the changed manifests are applied. It is 1 minute by default.
+	MinAvailableTime time.Duration
+}
+
+// RollbackOption defines how the deploy manifestWorks of an addon are rolled back. The spec of each deploy
+// manifestWork is recorded as the last known good spec in a Secret in the cluster namespace whenever the
+// addon is Available, so the addon manager is required to have the permission to list, watch, create and
+// update Secrets on the hub. The spec is not recorded if it is larger than about 900KiB after compressed. Only the manifestWorks in the cluster namespace are rolled back, the
+// manifestWorks on the hosting cluster in Hosted mode and the manifestWorks with the sensitive data, e.g.
+// the values from the Secrets, are not rolled back.
+type RollbackOption struct {
+	// GracePeriod is how long the addon is allowed to be unavailable after the changed manifests are applied
+	// before the deploy manifestWorks are rolled back.
+	GracePeriod time.Duration
+}
+
+// FlapDetectionOption defines when an addon is considered flapping. The addon is flapping if its Available
+// condition transitions at least Transitions times in the Window.
+type FlapDetectionOption struct {
+	// Transitions is the number of the transitions in the Window to consider the addon flapping, defaults to 4.
+	Transitions int
+	// Window is the duration to count the transitions, defaults to 10 minutes.
+	Window time.Duration
+	// HistoryLimit is the max number of the transitions kept in the history, defaults to 10. It is at least
+	// one more than the Transitions.
+	HistoryLimit int
+}
+
 type Updater struct {
 	// ResourceIdentifier sets what resources the strategy applies to
 	ResourceIdentifier workapiv1.ResourceIdentifier
@@ -177,6 +276,24 @@ type HealthProber struct {
 	Type HealthProberType
 
 	WorkProber *WorkHealthProber
+
+	// LeaseProber configures how the lease is probed for the HealthProberTypeLeaseAndWork, the defaults
+	// are used if it is nil.
+	LeaseProber *LeaseHealthProber
+
+	// ProgressDeadline is the duration the workloads of the addon are allowed to roll out for the work based
+	// health probers. The Available condition of the addon is kept true while the workloads are rolling out
+	// within the deadline if the other workloads are available, and the WorkloadProgressing condition is set to
+	// false once the deadline is exceeded. The deployments are rolled out within their spec.progressDeadlineSeconds
+	// instead. It defaults to 10 minutes, the same as the default progressDeadlineSeconds of the deployments.
+	ProgressDeadline time.Duration
+}
+
+// LeaseHealthProber defines how the lease of the addon is probed on the hub.
+type LeaseHealthProber struct {
+	// GracePeriod is the duration after the last renew time of the lease when the lease is considered as
+	// stale. It defaults to 5 times of the lease duration of the lease.
+	GracePeriod time.Duration
 }
 
 type AddonHealthCheckerFunc func([]FieldResult, *clusterv1.ManagedCluster, *addonapiv1beta1.ManagedClusterAddOn) error
@@ -207,6 +324,8 @@ type FieldResult struct {
 	FeedbackResult workapiv1.StatusFeedbackResult
 }
 
+// HealthProberType is the type of the HealthProber, the custom types are supported by registering a
+// HealthProberPlugin with RegisterHealthProberPlugin.
 type HealthProberType string
 
 const (
@@ -229,10 +348,22 @@ const (
 	// It's a special case of HealthProberTypeWork.
 	HealthProberTypeDeploymentAvailability HealthProberType = "DeploymentAvailability"
 	// HealthProberTypeWorkloadAvailability indicates the healthiness of the addon is connected
-	// with the availability of all the corresponding agent workload resources(only Deployment and
-	// DaemonSet are supported for now) on the managed cluster.
+	// with the availability of all the corresponding agent workload resources(only Deployment,
+	// DaemonSet, StatefulSet and ReplicaSet are supported for now) on the managed cluster. A StatefulSet
+	// is available only if all its replicas are ready and the replicas out of the partition of its
+	// rolling update are updated. A ReplicaSet is available only if all its replicas are ready and
+	// available.
 	// It's a special case of HealthProberTypeWork.
 	HealthProberTypeWorkloadAvailability HealthProberType = "WorkloadAvailability"
+	// HealthProberTypeLeaseAndWork indicates the healthiness of the addon is connected with both the
+	// lease in the cluster namespace on the hub with the same name as the addon, and the status of the
+	// addon manifestWorks probed by the WorkProber, or the availability of all the workloads as
+	// HealthProberTypeWorkloadAvailability if the WorkProber is nil. The addon is available only if
+	// the lease is fresh and the workloads are available, and it is degraded if only one of them is
+	// healthy. Note that the addon agent should update the lease with the addon label
+	// "open-cluster-management.io/addon-name" on the hub, see lease.LeaseUpdater.WithHubLeaseSync, and
+	// the addon manager should have the permission to list and watch the leases on the hub.
+	HealthProberTypeLeaseAndWork HealthProberType = "LeaseAndWork"
 )
 
 func KubeClientSignerConfigurations(addonName, agentName string) RegistrationConfigurationsFunc {
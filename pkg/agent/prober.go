@@ -0,0 +1,81 @@
+package agent
+
+import (
+	"fmt"
+	"sync"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	workapiv1 "open-cluster-management.io/api/work/v1"
+)
+
+// HealthProberPlugin probes the healthiness of the addon for a custom HealthProberType registered by
+// RegisterHealthProberPlugin.
+type HealthProberPlugin interface {
+	// ManifestConfigs returns the manifest configs with the feedback rules added to the deploy manifestWorks of
+	// the addon, so the status to probe is returned by the work agent. The manifests are the manifests of the
+	// addon on the cluster.
+	ManifestConfigs(manifests []runtime.Object) []workapiv1.ManifestConfigOption
+
+	// Probe returns the Available condition of the addon from the deploy manifestWorks of the addon on the
+	// cluster. It is called after the manifestWorks are applied and available, the type of the returned
+	// condition is always set to Available.
+	Probe(works []*workapiv1.ManifestWork, cluster *clusterv1.ManagedCluster,
+		addon *addonapiv1beta1.ManagedClusterAddOn) metav1.Condition
+}
+
+const (
+	// HealthProberTypeJobSucceeded indicates the healthiness of the addon is connected with the Complete
+	// and Failed conditions of all the Jobs of the addon on the managed cluster.
+	HealthProberTypeJobSucceeded HealthProberType = "JobSucceeded"
+	// HealthProberTypeCRDEstablished indicates the healthiness of the addon is connected with the Established
+	// condition of all the CustomResourceDefinitions of the addon on the managed cluster.
+	HealthProberTypeCRDEstablished HealthProberType = "CRDEstablished"
+)
+
+var (
+	healthProberPluginsLock sync.RWMutex
+	// healthProberPlugins are the registered plugins, the plugins of the HealthProberTypeJobSucceeded and
+	// HealthProberTypeCRDEstablished are provided by the framework.
+	healthProberPlugins = map[HealthProberType]HealthProberPlugin{
+		HealthProberTypeJobSucceeded: newJobProberPlugin(),
+		HealthProberTypeCRDEstablished: NewConditionProberPlugin(
+			schema.GroupKind{Group: apiextensionsv1.GroupName, Kind: "CustomResourceDefinition"},
+			"customresourcedefinitions", string(apiextensionsv1.Established)),
+	}
+)
+
+// RegisterHealthProberPlugin registers the plugin of the custom HealthProberType, the addons whose HealthProber
+// has the type are probed by the plugin. It returns an error if the type is a builtin type or it is already
+// registered. It is usually called in the init func of the package of the plugin.
+func RegisterHealthProberPlugin(proberType HealthProberType, plugin HealthProberPlugin) error {
+	switch proberType {
+	case HealthProberTypeNone, HealthProberTypeLease, HealthProberTypeWork,
+		HealthProberTypeDeploymentAvailability, HealthProberTypeWorkloadAvailability, HealthProberTypeLeaseAndWork:
+		return fmt.Errorf("health prober type %s is builtin", proberType)
+	}
+	if len(proberType) == 0 || plugin == nil {
+		return fmt.Errorf("health prober type and plugin are required")
+	}
+
+	healthProberPluginsLock.Lock()
+	defer healthProberPluginsLock.Unlock()
+	if _, ok := healthProberPlugins[proberType]; ok {
+		return fmt.Errorf("health prober type %s is already registered", proberType)
+	}
+	healthProberPlugins[proberType] = plugin
+	return nil
+}
+
+// GetHealthProberPlugin returns the plugin registered for the HealthProberType.
+func GetHealthProberPlugin(proberType HealthProberType) (HealthProberPlugin, bool) {
+	healthProberPluginsLock.RLock()
+	defer healthProberPluginsLock.RUnlock()
+	plugin, ok := healthProberPlugins[proberType]
+	return plugin, ok
+}
@@ -0,0 +1,181 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	workapiv1 "open-cluster-management.io/api/work/v1"
+)
+
+// feedbackProberPlugin probes the resources of a kind in the manifests of the addon by the feedback values of
+// the JSONPaths, the feedback values of each resource are checked by the check func.
+type feedbackProberPlugin struct {
+	groupKind schema.GroupKind
+	resource  string
+	jsonPaths []workapiv1.JsonPath
+	check     func(identifier workapiv1.ResourceIdentifier, values map[string]workapiv1.FieldValue) error
+}
+
+// NewConditionProberPlugin returns a HealthProberPlugin which probes the status condition of the conditionType
+// of all the resources of the groupKind in the manifests of the addon, e.g. the custom resources reconciled by the
+// addon agent. The resource is the plural resource name of the groupKind. The addon is available if the status of
+// the condition of each resource is True.
+func NewConditionProberPlugin(groupKind schema.GroupKind, resource, conditionType string) HealthProberPlugin {
+	return &feedbackProberPlugin{
+		groupKind: groupKind,
+		resource:  resource,
+		jsonPaths: []workapiv1.JsonPath{
+			{Name: conditionType, Path: fmt.Sprintf(`.conditions[?(@.type=="%s")].status`, conditionType)},
+		},
+		check: func(identifier workapiv1.ResourceIdentifier, values map[string]workapiv1.FieldValue) error {
+			status, ok := values[conditionType]
+			if !ok || status.String == nil {
+				return fmt.Errorf("condition %s is not probed for %s %s", conditionType, identifier.Resource,
+					namespacedName(identifier))
+			}
+			if *status.String != string(metav1.ConditionTrue) {
+				return fmt.Errorf("condition %s is %s for %s %s", conditionType, *status.String, identifier.Resource,
+					namespacedName(identifier))
+			}
+			return nil
+		},
+	}
+}
+
+// newJobProberPlugin returns the HealthProberPlugin of the HealthProberTypeJobSucceeded. The addon is available
+// if the Complete condition of each Job is True, and is unavailable once any Job has the Failed condition True.
+func newJobProberPlugin() HealthProberPlugin {
+	complete, failed := string(batchv1.JobComplete), string(batchv1.JobFailed)
+	return &feedbackProberPlugin{
+		groupKind: schema.GroupKind{Group: batchv1.GroupName, Kind: "Job"},
+		resource:  "jobs",
+		jsonPaths: []workapiv1.JsonPath{
+			{Name: complete, Path: fmt.Sprintf(`.conditions[?(@.type=="%s")].status`, complete)},
+			{Name: failed, Path: fmt.Sprintf(`.conditions[?(@.type=="%s")].status`, failed)},
+		},
+		check: func(identifier workapiv1.ResourceIdentifier, values map[string]workapiv1.FieldValue) error {
+			if status, ok := values[failed]; ok && status.String != nil && *status.String == string(metav1.ConditionTrue) {
+				return fmt.Errorf("jobs %s is failed", namespacedName(identifier))
+			}
+			status, ok := values[complete]
+			if !ok || status.String == nil || *status.String != string(metav1.ConditionTrue) {
+				return fmt.Errorf("jobs %s is not complete", namespacedName(identifier))
+			}
+			return nil
+		},
+	}
+}
+
+func (p *feedbackProberPlugin) ManifestConfigs(manifests []runtime.Object) []workapiv1.ManifestConfigOption {
+	var manifestConfigs []workapiv1.ManifestConfigOption
+	for _, manifest := range manifests {
+		if manifest.GetObjectKind().GroupVersionKind().GroupKind() != p.groupKind {
+			continue
+		}
+		accessor, err := meta.Accessor(manifest)
+		if err != nil {
+			continue
+		}
+		manifestConfigs = append(manifestConfigs, workapiv1.ManifestConfigOption{
+			ResourceIdentifier: workapiv1.ResourceIdentifier{
+				Group:     p.groupKind.Group,
+				Resource:  p.resource,
+				Name:      accessor.GetName(),
+				Namespace: accessor.GetNamespace(),
+			},
+			FeedbackRules: []workapiv1.FeedbackRule{
+				{Type: workapiv1.JSONPathsType, JsonPaths: p.jsonPaths},
+			},
+		})
+	}
+	return manifestConfigs
+}
+
+// Probe checks each resource of the kind in the manifest configs of the works. The resource whose feedback values
+// are not returned yet is not probed until the work is available, after that the missing values are checked as
+// not ready since the resource has been applied.
+func (p *feedbackProberPlugin) Probe(works []*workapiv1.ManifestWork, cluster *clusterv1.ManagedCluster,
+	addon *addonapiv1beta1.ManagedClusterAddOn) metav1.Condition {
+	var probed int
+	var notProbed []string
+	for _, work := range works {
+		workAvailable := meta.IsStatusConditionTrue(work.Status.Conditions, workapiv1.WorkAvailable)
+		for _, manifestConfig := range work.Spec.ManifestConfigs {
+			identifier := manifestConfig.ResourceIdentifier
+			if identifier.Group != p.groupKind.Group || identifier.Resource != p.resource {
+				continue
+			}
+
+			values := feedbackValues(work, identifier)
+			if len(values) == 0 && !workAvailable {
+				// the work agent has not returned the feedback values.
+				notProbed = append(notProbed, fmt.Sprintf("%s %s", identifier.Resource, namespacedName(identifier)))
+				continue
+			}
+			probed++
+
+			if err := p.check(identifier, values); err != nil {
+				return metav1.Condition{
+					Type:    addonapiv1beta1.ManagedClusterAddOnConditionAvailable,
+					Status:  metav1.ConditionFalse,
+					Reason:  addonapiv1beta1.AddonAvailableReasonProbeUnavailable,
+					Message: fmt.Sprintf("Probe addon unavailable with err %v", err),
+				}
+			}
+		}
+	}
+
+	if probed == 0 {
+		return metav1.Condition{
+			Type:    addonapiv1beta1.ManagedClusterAddOnConditionAvailable,
+			Status:  metav1.ConditionUnknown,
+			Reason:  addonapiv1beta1.AddonAvailableReasonNoProbeResult,
+			Message: "Probe results are not returned",
+		}
+	}
+	if len(notProbed) > 0 {
+		return metav1.Condition{
+			Type:    addonapiv1beta1.ManagedClusterAddOnConditionAvailable,
+			Status:  metav1.ConditionUnknown,
+			Reason:  addonapiv1beta1.AddonAvailableReasonNoProbeResult,
+			Message: fmt.Sprintf("Probe results of %s are not returned", strings.Join(notProbed, ", ")),
+		}
+	}
+	return metav1.Condition{
+		Type:    addonapiv1beta1.ManagedClusterAddOnConditionAvailable,
+		Status:  metav1.ConditionTrue,
+		Reason:  addonapiv1beta1.AddonAvailableReasonProbeAvailable,
+		Message: fmt.Sprintf("%s add-on is available.", addon.Name),
+	}
+}
+
+// feedbackValues returns the feedback values of the resource in the work status keyed by the value name.
+func feedbackValues(work *workapiv1.ManifestWork, identifier workapiv1.ResourceIdentifier) map[string]workapiv1.FieldValue {
+	values := map[string]workapiv1.FieldValue{}
+	for _, manifest := range work.Status.ResourceStatus.Manifests {
+		resourceMeta := manifest.ResourceMeta
+		if resourceMeta.Group != identifier.Group || resourceMeta.Resource != identifier.Resource ||
+			resourceMeta.Name != identifier.Name || resourceMeta.Namespace != identifier.Namespace {
+			continue
+		}
+		for _, value := range manifest.StatusFeedbacks.Values {
+			values[value.Name] = value.Value
+		}
+	}
+	return values
+}
+
+func namespacedName(identifier workapiv1.ResourceIdentifier) string {
+	if len(identifier.Namespace) == 0 {
+		return identifier.Name
+	}
+	return identifier.Namespace + "/" + identifier.Name
+}
@@ -0,0 +1,171 @@
+package agent
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+	workapiv1 "open-cluster-management.io/api/work/v1"
+)
+
+type probedResource struct {
+	name   string
+	values []workapiv1.FeedbackValue
+}
+
+func newProbedWork(group, resource string, available bool, resources ...probedResource) *workapiv1.ManifestWork {
+	work := &workapiv1.ManifestWork{}
+	if available {
+		work.Status.Conditions = []metav1.Condition{
+			{Type: workapiv1.WorkAvailable, Status: metav1.ConditionTrue},
+		}
+	}
+	for _, r := range resources {
+		work.Spec.ManifestConfigs = append(work.Spec.ManifestConfigs, workapiv1.ManifestConfigOption{
+			ResourceIdentifier: workapiv1.ResourceIdentifier{
+				Group:     group,
+				Resource:  resource,
+				Name:      r.name,
+				Namespace: "default",
+			},
+		})
+		if len(r.values) == 0 {
+			continue
+		}
+		work.Status.ResourceStatus.Manifests = append(work.Status.ResourceStatus.Manifests, workapiv1.ManifestCondition{
+			ResourceMeta: workapiv1.ManifestResourceMeta{
+				Group:     group,
+				Resource:  resource,
+				Name:      r.name,
+				Namespace: "default",
+			},
+			StatusFeedbacks: workapiv1.StatusFeedbackResult{Values: r.values},
+		})
+	}
+	return work
+}
+
+func conditionValue(conditionType, status string) workapiv1.FeedbackValue {
+	return workapiv1.FeedbackValue{Name: conditionType, Value: workapiv1.FieldValue{String: stringPtr(status)}}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func TestProberPlugins(t *testing.T) {
+	cases := []struct {
+		name           string
+		proberType     HealthProberType
+		works          []*workapiv1.ManifestWork
+		expectedStatus metav1.ConditionStatus
+	}{
+		{
+			name:       "job is complete",
+			proberType: HealthProberTypeJobSucceeded,
+			works: []*workapiv1.ManifestWork{newProbedWork("batch", "jobs", true,
+				probedResource{name: "test", values: []workapiv1.FeedbackValue{conditionValue("Complete", "True")}},
+			)},
+			expectedStatus: metav1.ConditionTrue,
+		},
+		{
+			name:           "job is not probed",
+			proberType:     HealthProberTypeJobSucceeded,
+			works:          []*workapiv1.ManifestWork{newProbedWork("batch", "jobs", false, probedResource{name: "test"})},
+			expectedStatus: metav1.ConditionUnknown,
+		},
+		{
+			name:           "job is running after the work is available",
+			proberType:     HealthProberTypeJobSucceeded,
+			works:          []*workapiv1.ManifestWork{newProbedWork("batch", "jobs", true, probedResource{name: "test"})},
+			expectedStatus: metav1.ConditionFalse,
+		},
+		{
+			name:       "one job is complete and the other is not probed",
+			proberType: HealthProberTypeJobSucceeded,
+			works: []*workapiv1.ManifestWork{newProbedWork("batch", "jobs", false,
+				probedResource{name: "complete", values: []workapiv1.FeedbackValue{conditionValue("Complete", "True")}},
+				probedResource{name: "running"},
+			)},
+			expectedStatus: metav1.ConditionUnknown,
+		},
+		{
+			name:       "one job is complete and the other is failed",
+			proberType: HealthProberTypeJobSucceeded,
+			works: []*workapiv1.ManifestWork{newProbedWork("batch", "jobs", true,
+				probedResource{name: "complete", values: []workapiv1.FeedbackValue{conditionValue("Complete", "True")}},
+				probedResource{name: "failed", values: []workapiv1.FeedbackValue{conditionValue("Failed", "True")}},
+			)},
+			expectedStatus: metav1.ConditionFalse,
+		},
+		{
+			name:       "failed job in another work",
+			proberType: HealthProberTypeJobSucceeded,
+			works: []*workapiv1.ManifestWork{
+				newProbedWork("batch", "jobs", true,
+					probedResource{name: "complete", values: []workapiv1.FeedbackValue{conditionValue("Complete", "True")}}),
+				newProbedWork("batch", "jobs", false,
+					probedResource{name: "failed", values: []workapiv1.FeedbackValue{
+						conditionValue("Complete", "False"), conditionValue("Failed", "True")}}),
+			},
+			expectedStatus: metav1.ConditionFalse,
+		},
+		{
+			name:       "crd is not established",
+			proberType: HealthProberTypeCRDEstablished,
+			works: []*workapiv1.ManifestWork{newProbedWork("apiextensions.k8s.io", "customresourcedefinitions", true,
+				probedResource{name: "test", values: []workapiv1.FeedbackValue{conditionValue("Established", "False")}},
+			)},
+			expectedStatus: metav1.ConditionFalse,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			plugin, ok := GetHealthProberPlugin(c.proberType)
+			if !ok {
+				t.Fatalf("expected the plugin of %s is registered", c.proberType)
+			}
+			condition := plugin.Probe(c.works, nil, &addonapiv1beta1.ManagedClusterAddOn{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "cluster1"},
+			})
+			if condition.Status != c.expectedStatus {
+				t.Errorf("expected status %s, but got %s: %s", c.expectedStatus, condition.Status, condition.Message)
+			}
+		})
+	}
+}
+
+func TestConditionProberPluginManifestConfigs(t *testing.T) {
+	plugin := NewConditionProberPlugin(schema.GroupKind{Group: "example.io", Kind: "Widget"}, "widgets", "Ready")
+
+	widget := &unstructured.Unstructured{}
+	widget.SetAPIVersion("example.io/v1")
+	widget.SetKind("Widget")
+	widget.SetName("test")
+	widget.SetNamespace("default")
+	manifests := []runtime.Object{
+		widget,
+		&batchv1.Job{TypeMeta: metav1.TypeMeta{APIVersion: "batch/v1", Kind: "Job"}},
+		&appsv1.Deployment{TypeMeta: metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"}},
+	}
+
+	configs := plugin.ManifestConfigs(manifests)
+	if len(configs) != 1 {
+		t.Fatalf("expected 1 manifest config, but got %v", configs)
+	}
+	expected := workapiv1.ResourceIdentifier{Group: "example.io", Resource: "widgets", Name: "test", Namespace: "default"}
+	if configs[0].ResourceIdentifier != expected {
+		t.Errorf("expected resource identifier %v, but got %v", expected, configs[0].ResourceIdentifier)
+	}
+	rules := configs[0].FeedbackRules
+	if len(rules) != 1 || rules[0].Type != workapiv1.JSONPathsType ||
+		rules[0].JsonPaths[0].Path != `.conditions[?(@.type=="Ready")].status` {
+		t.Errorf("unexpected feedback rules %v", rules)
+	}
+}
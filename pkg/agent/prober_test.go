@@ -0,0 +1,76 @@
+package agent
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	addonv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	workapiv1 "open-cluster-management.io/api/work/v1"
+)
+
+type fakeHealthProberPlugin struct{}
+
+func (p *fakeHealthProberPlugin) ManifestConfigs([]runtime.Object) []workapiv1.ManifestConfigOption {
+	return nil
+}
+
+func (p *fakeHealthProberPlugin) Probe([]*workapiv1.ManifestWork, *clusterv1.ManagedCluster,
+	*addonv1beta1.ManagedClusterAddOn) metav1.Condition {
+	return metav1.Condition{Status: metav1.ConditionTrue}
+}
+
+func TestRegisterHealthProberPlugin(t *testing.T) {
+	cases := []struct {
+		name       string
+		proberType HealthProberType
+		plugin     HealthProberPlugin
+		expectErr  bool
+	}{
+		{
+			name:       "builtin type",
+			proberType: HealthProberTypeWork,
+			plugin:     &fakeHealthProberPlugin{},
+			expectErr:  true,
+		},
+		{
+			name:       "type provided by the framework",
+			proberType: HealthProberTypeJobSucceeded,
+			plugin:     &fakeHealthProberPlugin{},
+			expectErr:  true,
+		},
+		{
+			name:       "nil plugin",
+			proberType: "FakeNil",
+			expectErr:  true,
+		},
+		{
+			name:       "custom type",
+			proberType: "Fake",
+			plugin:     &fakeHealthProberPlugin{},
+		},
+		{
+			name:       "duplicated type",
+			proberType: "Fake",
+			plugin:     &fakeHealthProberPlugin{},
+			expectErr:  true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := RegisterHealthProberPlugin(c.proberType, c.plugin)
+			if c.expectErr != (err != nil) {
+				t.Errorf("expected error %v, but got %v", c.expectErr, err)
+			}
+		})
+	}
+
+	if _, ok := GetHealthProberPlugin("Fake"); !ok {
+		t.Errorf("expected the plugin is registered")
+	}
+	if _, ok := GetHealthProberPlugin("FakeNil"); ok {
+		t.Errorf("expected the nil plugin is not registered")
+	}
+}
@@ -244,8 +244,11 @@ const (
 	// It's a special case of HealthProberTypeWork.
 	HealthProberTypeDeploymentAvailability HealthProberType = "DeploymentAvailability"
 	// HealthProberTypeWorkloadAvailability indicates the healthiness of the addon is connected
-	// with the availability of all the corresponding agent workload resources(only Deployment and
-	// DaemonSet are supported for now) on the managed cluster.
+	// with the availability of all the corresponding agent workload resources(only Deployment,
+	// DaemonSet, StatefulSet and ReplicaSet are supported for now) on the managed cluster. A StatefulSet
+	// is available only if all its replicas are ready and the replicas out of the partition of its
+	// rolling update are updated. A ReplicaSet is available only if all its replicas are ready and
+	// available.
 	// It's a special case of HealthProberTypeWork.
 	HealthProberTypeWorkloadAvailability HealthProberType = "WorkloadAvailability"
 )
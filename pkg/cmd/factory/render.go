@@ -0,0 +1,355 @@
+package factory
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes"
+	fakekube "k8s.io/client-go/kubernetes/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/component-base/logs"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+	addonclient "open-cluster-management.io/api/client/addon/clientset/versioned"
+	fakeaddon "open-cluster-management.io/api/client/addon/clientset/versioned/fake"
+	clusterclientset "open-cluster-management.io/api/client/cluster/clientset/versioned"
+	fakecluster "open-cluster-management.io/api/client/cluster/clientset/versioned/fake"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	workapiv1 "open-cluster-management.io/api/work/v1"
+
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/controllers/agentdeploy"
+	"open-cluster-management.io/addon-framework/pkg/agent"
+	"open-cluster-management.io/addon-framework/pkg/utils"
+)
+
+// AgentAddonBuildFunc builds the agentAddon to render. The given clients are fake clients which only serve the
+// objects loaded from the input files, the agentAddon should use them instead of the clients of a real hub, e.g.
+// to get the AddOnDeploymentConfig by utils.NewAddOnDeploymentConfigGetter(addonClient).
+type AgentAddonBuildFunc func(kubeClient kubernetes.Interface, addonClient addonclient.Interface,
+	clusterClient clusterclientset.Interface) (agent.AgentAddon, error)
+
+// RenderFlags provides the flags of the render command
+type RenderFlags struct {
+	// ClusterFile points to the file of the ManagedCluster the addon is rendered for
+	ClusterFile string
+	// AddonFile points to the file of the ManagedClusterAddOn to render
+	AddonFile string
+	// HostingClusterFile points to the file of the hosting ManagedCluster, it is only used in Hosted mode
+	HostingClusterFile string
+	// ConfigFiles point to the files of the addon configs, e.g. AddOnDeploymentConfigs, ManifestOverrides and
+	// ConfigMaps
+	ConfigFiles []string
+}
+
+// NewRenderFlags returns flags with default values set
+func NewRenderFlags() *RenderFlags {
+	return &RenderFlags{}
+}
+
+// AddFlags register and binds the render flags
+func (f *RenderFlags) AddFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+
+	flags.StringVar(&f.ClusterFile, "cluster", f.ClusterFile, "Location of the ManagedCluster file.")
+	flags.StringVar(&f.AddonFile, "addon", f.AddonFile, "Location of the ManagedClusterAddOn file.")
+	flags.StringVar(&f.HostingClusterFile, "hosting-cluster", f.HostingClusterFile,
+		"Location of the hosting ManagedCluster file, only used when the addon is in Hosted mode.")
+	flags.StringArrayVar(&f.ConfigFiles, "config", f.ConfigFiles,
+		"Location of the addon config files, e.g. AddOnDeploymentConfigs. Can be specified multiple times.")
+}
+
+// RenderCommandConfig holds values required to construct a command to render the manifestWorks of an addon offline.
+type RenderCommandConfig struct {
+	buildFunc AgentAddonBuildFunc
+
+	flags *RenderFlags
+}
+
+// NewRenderCommandConfig returns a new RenderCommandConfig which can be used to render the manifestWorks of the
+// addon built by buildFunc from the ManagedCluster, ManagedClusterAddOn and addon config files on the disk.
+func NewRenderCommandConfig(buildFunc AgentAddonBuildFunc) *RenderCommandConfig {
+	return &RenderCommandConfig{
+		buildFunc: buildFunc,
+		flags:     NewRenderFlags(),
+	}
+}
+
+func (c *RenderCommandConfig) NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "render",
+		Short: "Render the manifestWorks of the addon",
+		Run: func(cmd *cobra.Command, args []string) {
+			logs.InitLogs()
+
+			if err := c.Render(context.TODO(), cmd.OutOrStdout()); err != nil {
+				klog.Fatal(err)
+			}
+		},
+	}
+
+	c.flags.AddFlags(cmd)
+
+	return cmd
+}
+
+// Render writes the manifestWorks of the addon to out in yaml format, the deploy manifestWorks are written
+// first, then the pre-delete hook manifestWork, and then the manifestWorks on the hosting cluster in Hosted mode.
+func (c *RenderCommandConfig) Render(ctx context.Context, out io.Writer) error {
+	if len(c.flags.ClusterFile) == 0 || len(c.flags.AddonFile) == 0 {
+		return fmt.Errorf("the cluster and addon files are required")
+	}
+
+	cluster := &clusterv1.ManagedCluster{}
+	if err := loadObject(c.flags.ClusterFile, cluster); err != nil {
+		return err
+	}
+
+	addon := &addonapiv1beta1.ManagedClusterAddOn{}
+	if err := loadObject(c.flags.AddonFile, addon); err != nil {
+		return err
+	}
+	if len(addon.Namespace) == 0 {
+		addon.Namespace = cluster.Name
+	}
+
+	clusters := []runtime.Object{cluster}
+	if len(c.flags.HostingClusterFile) != 0 {
+		hostingCluster := &clusterv1.ManagedCluster{}
+		if err := loadObject(c.flags.HostingClusterFile, hostingCluster); err != nil {
+			return err
+		}
+		clusters = append(clusters, hostingCluster)
+	}
+
+	var kubeObjects, addonObjects []runtime.Object
+	var deploymentConfigs []*addonapiv1beta1.AddOnDeploymentConfig
+	var manifestOverrides manifestOverrideGetter
+	for _, file := range c.flags.ConfigFiles {
+		objects, err := loadObjects(file)
+		if err != nil {
+			return err
+		}
+		for _, obj := range objects {
+			switch config := obj.(type) {
+			case *addonapiv1beta1.AddOnDeploymentConfig:
+				deploymentConfigs = append(deploymentConfigs, config)
+				addonObjects = append(addonObjects, config)
+			case *unstructured.Unstructured:
+				// only the ManifestOverride configs are decoded as unstructured.
+				manifestOverrides = append(manifestOverrides, config)
+			default:
+				kubeObjects = append(kubeObjects, config)
+			}
+		}
+	}
+
+	if err := setDeploymentConfigReferences(addon, deploymentConfigs); err != nil {
+		return err
+	}
+	if err := setManifestOverrideConfigReferences(addon, manifestOverrides); err != nil {
+		return err
+	}
+
+	agentAddon, err := c.buildFunc(
+		fakekube.NewSimpleClientset(kubeObjects...),
+		fakeaddon.NewSimpleClientset(addonObjects...),
+		fakecluster.NewSimpleClientset(clusters...),
+	)
+	if err != nil {
+		return err
+	}
+
+	rendered, err := agentdeploy.RenderManifestWorks(ctx, agentAddon, cluster, addon, manifestOverrides)
+	if err != nil {
+		return err
+	}
+
+	works := append([]*workapiv1.ManifestWork{}, rendered.DeployWorks...)
+	if rendered.PreDeleteHookWork != nil {
+		works = append(works, rendered.PreDeleteHookWork)
+	}
+	works = append(works, rendered.LifecycleHookWorks...)
+	works = append(works, rendered.HostingDeployWorks...)
+	if rendered.HostingPreDeleteHookWork != nil {
+		works = append(works, rendered.HostingPreDeleteHookWork)
+	}
+	works = append(works, rendered.HostingLifecycleHookWorks...)
+
+	for _, work := range works {
+		work.APIVersion = workapiv1.GroupVersion.String()
+		work.Kind = "ManifestWork"
+		data, err := yaml.Marshal(work)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(out, "---\n%s", data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setDeploymentConfigReferences sets the AddOnDeploymentConfig reference in the addon status, which is set by the
+// addon-manager on a real hub. The config in the addon spec takes precedence, otherwise the first loaded
+// AddOnDeploymentConfig is used as the default config.
+func setDeploymentConfigReferences(addon *addonapiv1beta1.ManagedClusterAddOn,
+	configs []*addonapiv1beta1.AddOnDeploymentConfig) error {
+	objects := make([]metav1.Object, 0, len(configs))
+	for _, config := range configs {
+		objects = append(objects, config)
+	}
+	return setConfigReference(addon, utils.AddOnDeploymentConfigGVR, objects, func(obj metav1.Object) (string, error) {
+		return utils.GetAddOnDeploymentConfigSpecHash(obj.(*addonapiv1beta1.AddOnDeploymentConfig))
+	})
+}
+
+// setManifestOverrideConfigReferences sets the ManifestOverride reference in the addon status in the same way as
+// setDeploymentConfigReferences.
+func setManifestOverrideConfigReferences(addon *addonapiv1beta1.ManagedClusterAddOn,
+	configs []*unstructured.Unstructured) error {
+	objects := make([]metav1.Object, 0, len(configs))
+	for _, config := range configs {
+		objects = append(objects, config)
+	}
+	return setConfigReference(addon, utils.ManifestOverrideConfigGVR, objects, func(obj metav1.Object) (string, error) {
+		return utils.GetSpecHash(obj.(*unstructured.Unstructured))
+	})
+}
+
+// setConfigReference sets the reference of the config type gvr in the addon status. The config in the addon
+// spec takes precedence, otherwise the first config is used as the default config.
+func setConfigReference(addon *addonapiv1beta1.ManagedClusterAddOn, gvr schema.GroupVersionResource,
+	configs []metav1.Object, specHashFunc func(obj metav1.Object) (string, error)) error {
+	if ok, _ := utils.GetAddOnConfigRef(addon.Status.ConfigReferences, gvr.Group, gvr.Resource); ok {
+		return nil
+	}
+	if len(configs) == 0 {
+		return nil
+	}
+
+	config := configs[0]
+	for _, specConfig := range addon.Spec.Configs {
+		if specConfig.Group != gvr.Group || specConfig.Resource != gvr.Resource {
+			continue
+		}
+		config = nil
+		for _, c := range configs {
+			if c.GetNamespace() == specConfig.Namespace && c.GetName() == specConfig.Name {
+				config = c
+				break
+			}
+		}
+		if config == nil {
+			return fmt.Errorf("addon config %s %s/%s is not found", gvr.Resource, specConfig.Namespace, specConfig.Name)
+		}
+		break
+	}
+
+	specHash, err := specHashFunc(config)
+	if err != nil {
+		return err
+	}
+	addon.Status.ConfigReferences = append(addon.Status.ConfigReferences, addonapiv1beta1.ConfigReference{
+		ConfigGroupResource: addonapiv1beta1.ConfigGroupResource{
+			Group:    gvr.Group,
+			Resource: gvr.Resource,
+		},
+		DesiredConfig: &addonapiv1beta1.ConfigSpecHash{
+			ConfigReferent: addonapiv1beta1.ConfigReferent{
+				Namespace: config.GetNamespace(),
+				Name:      config.GetName(),
+			},
+			SpecHash: specHash,
+		},
+	})
+	return nil
+}
+
+// manifestOverrideGetter serves the ManifestOverride configs loaded from the input files.
+type manifestOverrideGetter []*unstructured.Unstructured
+
+func (g manifestOverrideGetter) Get(_ context.Context, namespace, name string) (*unstructured.Unstructured, error) {
+	for _, config := range g {
+		if config.GetNamespace() == namespace && config.GetName() == name {
+			return config, nil
+		}
+	}
+	return nil, errors.NewNotFound(utils.ManifestOverrideConfigGVR.GroupResource(), name)
+}
+
+var renderScheme = runtime.NewScheme()
+
+func init() {
+	_ = clientgoscheme.AddToScheme(renderScheme)
+	_ = addonapiv1beta1.Install(renderScheme)
+	_ = clusterv1.Install(renderScheme)
+}
+
+// loadObject decodes the single object in the file into obj.
+func loadObject(file string, obj runtime.Object) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if err := yaml.UnmarshalStrict(data, obj); err != nil {
+		return fmt.Errorf("failed to decode %s: %v", file, err)
+	}
+	return nil
+}
+
+// loadObjects decodes all the objects in the file, the objects in the file are separated by "---".
+func loadObjects(file string) ([]runtime.Object, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := serializer.NewCodecFactory(renderScheme).UniversalDeserializer()
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(data)))
+	var objects []runtime.Object
+	for {
+		b, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(b)) == 0 {
+			continue
+		}
+		// the ManifestOverride configs are not registered in the scheme, decode them as unstructured.
+		typeMeta := &metav1.TypeMeta{}
+		if err := yaml.Unmarshal(b, typeMeta); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %v", file, err)
+		}
+		if typeMeta.GroupVersionKind().GroupVersion() == utils.ManifestOverrideConfigGVR.GroupVersion() {
+			obj := &unstructured.Unstructured{}
+			if err := yaml.Unmarshal(b, &obj.Object); err != nil {
+				return nil, fmt.Errorf("failed to decode %s: %v", file, err)
+			}
+			objects = append(objects, obj)
+			continue
+		}
+		obj, _, err := decoder.Decode(b, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %v", file, err)
+		}
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
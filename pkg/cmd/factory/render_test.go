@@ -0,0 +1,245 @@
+package factory
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+
+	"open-cluster-management.io/addon-framework/pkg/utils"
+)
+
+func writeFile(t *testing.T, content string) string {
+	file := filepath.Join(t.TempDir(), "object.yaml")
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestLoadObject(t *testing.T) {
+	cases := []struct {
+		name         string
+		content      string
+		noFile       bool
+		expectedName string
+		expectErr    bool
+	}{
+		{
+			name: "valid cluster",
+			content: `apiVersion: cluster.open-cluster-management.io/v1
+kind: ManagedCluster
+metadata:
+  name: cluster1
+spec:
+  hubAcceptsClient: true
+`,
+			expectedName: "cluster1",
+		},
+		{
+			name: "unknown field",
+			content: `apiVersion: cluster.open-cluster-management.io/v1
+kind: ManagedCluster
+metadata:
+  name: cluster1
+spec:
+  unknown: true
+`,
+			expectErr: true,
+		},
+		{
+			name:      "file not found",
+			noFile:    true,
+			expectErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "not-found.yaml")
+			if !c.noFile {
+				file = writeFile(t, c.content)
+			}
+			cluster := &clusterv1.ManagedCluster{}
+			err := loadObject(file, cluster)
+			if c.expectErr != (err != nil) {
+				t.Fatalf("expected error %v, but got %v", c.expectErr, err)
+			}
+			if !c.expectErr && cluster.Name != c.expectedName {
+				t.Errorf("expected name %q, but got %q", c.expectedName, cluster.Name)
+			}
+		})
+	}
+}
+
+func TestLoadObjects(t *testing.T) {
+	cases := []struct {
+		name          string
+		content       string
+		expectedKinds []string
+		expectErr     bool
+	}{
+		{
+			name: "multiple objects",
+			content: `apiVersion: addon.open-cluster-management.io/v1beta1
+kind: AddOnDeploymentConfig
+metadata:
+  name: config
+  namespace: cluster1
+---
+
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: values
+  namespace: cluster1
+---
+apiVersion: addon-framework.open-cluster-management.io/v1alpha1
+kind: ManifestOverride
+metadata:
+  name: override
+  namespace: cluster1
+spec:
+  patches: []
+`,
+			expectedKinds: []string{"AddOnDeploymentConfig", "ConfigMap", "ManifestOverride"},
+		},
+		{
+			name: "unknown kind",
+			content: `apiVersion: example.io/v1
+kind: Widget
+metadata:
+  name: test
+`,
+			expectErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			objects, err := loadObjects(writeFile(t, c.content))
+			if c.expectErr != (err != nil) {
+				t.Fatalf("expected error %v, but got %v", c.expectErr, err)
+			}
+			if len(objects) != len(c.expectedKinds) {
+				t.Fatalf("expected %d objects, but got %d", len(c.expectedKinds), len(objects))
+			}
+			for i, obj := range objects {
+				switch obj.(type) {
+				case *addonapiv1beta1.AddOnDeploymentConfig:
+					if c.expectedKinds[i] != "AddOnDeploymentConfig" {
+						t.Errorf("expected kind %s, but got AddOnDeploymentConfig", c.expectedKinds[i])
+					}
+				case *unstructured.Unstructured:
+					if c.expectedKinds[i] != "ManifestOverride" {
+						t.Errorf("expected kind %s, but got ManifestOverride", c.expectedKinds[i])
+					}
+				default:
+					if c.expectedKinds[i] == "AddOnDeploymentConfig" || c.expectedKinds[i] == "ManifestOverride" {
+						t.Errorf("expected %s, but got %T", c.expectedKinds[i], obj)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSetDeploymentConfigReferences(t *testing.T) {
+	newConfig := func(name string) *addonapiv1beta1.AddOnDeploymentConfig {
+		return &addonapiv1beta1.AddOnDeploymentConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "cluster1"},
+		}
+	}
+	configGroupResource := addonapiv1beta1.ConfigGroupResource{
+		Group:    utils.AddOnDeploymentConfigGVR.Group,
+		Resource: utils.AddOnDeploymentConfigGVR.Resource,
+	}
+
+	cases := []struct {
+		name         string
+		addon        *addonapiv1beta1.ManagedClusterAddOn
+		configs      []*addonapiv1beta1.AddOnDeploymentConfig
+		expectedName string
+		expectErr    bool
+	}{
+		{
+			name:  "no configs",
+			addon: &addonapiv1beta1.ManagedClusterAddOn{},
+		},
+		{
+			name:         "first config is the default",
+			addon:        &addonapiv1beta1.ManagedClusterAddOn{},
+			configs:      []*addonapiv1beta1.AddOnDeploymentConfig{newConfig("first"), newConfig("second")},
+			expectedName: "first",
+		},
+		{
+			name: "config in the spec",
+			addon: &addonapiv1beta1.ManagedClusterAddOn{
+				Spec: addonapiv1beta1.ManagedClusterAddOnSpec{
+					Configs: []addonapiv1beta1.AddOnConfig{{
+						ConfigGroupResource: configGroupResource,
+						ConfigReferent:      addonapiv1beta1.ConfigReferent{Namespace: "cluster1", Name: "second"},
+					}},
+				},
+			},
+			configs:      []*addonapiv1beta1.AddOnDeploymentConfig{newConfig("first"), newConfig("second")},
+			expectedName: "second",
+		},
+		{
+			name: "config in the spec is not loaded",
+			addon: &addonapiv1beta1.ManagedClusterAddOn{
+				Spec: addonapiv1beta1.ManagedClusterAddOnSpec{
+					Configs: []addonapiv1beta1.AddOnConfig{{
+						ConfigGroupResource: configGroupResource,
+						ConfigReferent:      addonapiv1beta1.ConfigReferent{Namespace: "cluster1", Name: "missing"},
+					}},
+				},
+			},
+			configs:   []*addonapiv1beta1.AddOnDeploymentConfig{newConfig("first")},
+			expectErr: true,
+		},
+		{
+			name: "config reference is set in the status",
+			addon: &addonapiv1beta1.ManagedClusterAddOn{
+				Status: addonapiv1beta1.ManagedClusterAddOnStatus{
+					ConfigReferences: []addonapiv1beta1.ConfigReference{{
+						ConfigGroupResource: configGroupResource,
+						DesiredConfig: &addonapiv1beta1.ConfigSpecHash{
+							ConfigReferent: addonapiv1beta1.ConfigReferent{Namespace: "cluster1", Name: "status"},
+						},
+					}},
+				},
+			},
+			configs:      []*addonapiv1beta1.AddOnDeploymentConfig{newConfig("first")},
+			expectedName: "status",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := setDeploymentConfigReferences(c.addon, c.configs)
+			if c.expectErr != (err != nil) {
+				t.Fatalf("expected error %v, but got %v", c.expectErr, err)
+			}
+			if c.expectErr {
+				return
+			}
+
+			refs := c.addon.Status.ConfigReferences
+			if len(c.expectedName) == 0 {
+				if len(refs) != 0 {
+					t.Errorf("expected no config references, but got %v", refs)
+				}
+				return
+			}
+			if len(refs) != 1 || refs[0].DesiredConfig == nil || refs[0].DesiredConfig.Name != c.expectedName {
+				t.Errorf("expected config reference %s, but got %v", c.expectedName, refs)
+			}
+		})
+	}
+}
@@ -2,7 +2,6 @@ package index
 
 import (
 	"fmt"
-	"strings"
 
 	"k8s.io/apimachinery/pkg/util/sets"
 
@@ -93,7 +92,7 @@ func extractAddonFromWork(work *workapiv1.ManifestWork) (string, string, bool) {
 
 	addonNamespace := work.Labels[addonv1beta1.AddonNamespaceLabelKey]
 
-	isHook := strings.HasPrefix(work.Name, constants.PreDeleteHookWorkName(addonName))
+	isHook := constants.IsHookWorkName(addonName, work.Name)
 
 	return addonName, addonNamespace, isHook
 }
@@ -15,6 +15,8 @@ import (
 	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
 	"k8s.io/klog/v2"
+
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
 )
 
 const (
@@ -30,6 +32,11 @@ type LeaseUpdater interface {
 	// WithHubLeaseConfig sets the lease config on hub cluster. It allows LeaseUpdater to create/update
 	// addon lease on hub cluster when resource 'Lease' is not available on managed cluster.
 	WithHubLeaseConfig(config *rest.Config, clusterName string) LeaseUpdater
+
+	// WithHubLeaseSync makes LeaseUpdater also update the addon lease on hub cluster after the lease
+	// on managed cluster is updated, so the addon manager can probe the lease with the
+	// HealthProberTypeLeaseAndWork. It requires the hub lease config set by WithHubLeaseConfig.
+	WithHubLeaseSync() LeaseUpdater
 }
 
 // leaseUpdater update lease of with given name and namespace
@@ -40,6 +47,7 @@ type leaseUpdater struct {
 	leaseDurationSeconds int32
 	clusterName          string
 	hubKubeClient        kubernetes.Interface
+	syncHubLease         bool
 	healthCheckFuncs     []func() bool
 }
 
@@ -73,7 +81,15 @@ func (r *leaseUpdater) WithHubLeaseConfig(config *rest.Config, clusterName strin
 	return r
 }
 
-func (r *leaseUpdater) updateLease(ctx context.Context, namespace string, client kubernetes.Interface) error {
+func (r *leaseUpdater) WithHubLeaseSync() LeaseUpdater {
+	r.syncHubLease = true
+	return r
+}
+
+// updateLease creates or renews the lease in the namespace, the labels are set on the lease if they are
+// missing.
+func (r *leaseUpdater) updateLease(ctx context.Context, namespace string, client kubernetes.Interface,
+	labels map[string]string) error {
 	lease, err := client.CoordinationV1().Leases(namespace).Get(ctx, r.leaseName, metav1.GetOptions{})
 	switch {
 	case errors.IsNotFound(err):
@@ -82,6 +98,7 @@ func (r *leaseUpdater) updateLease(ctx context.Context, namespace string, client
 			ObjectMeta: metav1.ObjectMeta{
 				Name:      r.leaseName,
 				Namespace: namespace,
+				Labels:    labels,
 			},
 			Spec: coordinationv1.LeaseSpec{
 				LeaseDurationSeconds: &r.leaseDurationSeconds,
@@ -97,6 +114,12 @@ func (r *leaseUpdater) updateLease(ctx context.Context, namespace string, client
 		return err
 	default:
 		// update lease
+		if lease.Labels == nil && len(labels) > 0 {
+			lease.Labels = map[string]string{}
+		}
+		for key, value := range labels {
+			lease.Labels[key] = value
+		}
 		lease.Spec.RenewTime = &metav1.MicroTime{Time: time.Now()}
 		if _, err = client.CoordinationV1().Leases(namespace).Update(context.TODO(), lease, metav1.UpdateOptions{}); err != nil {
 			return err
@@ -115,9 +138,9 @@ func (r *leaseUpdater) reconcile(ctx context.Context) {
 	}
 	// Update lease on managed cluster at first, it returns in valid, it means lease is not supported yet
 	// and fallback to use hub lease.
-	err := r.updateLease(ctx, r.leaseNamespace, r.kubeClient)
+	err := r.updateLease(ctx, r.leaseNamespace, r.kubeClient, nil)
 	if errors.IsNotFound(err) && r.hubKubeClient != nil {
-		if err := r.updateLease(ctx, r.clusterName, r.hubKubeClient); err != nil {
+		if err := r.updateLease(ctx, r.clusterName, r.hubKubeClient, r.hubLeaseLabels()); err != nil {
 			klog.Errorf("Failed to update lease %s/%s: %v on hub", r.clusterName, r.leaseNamespace, err)
 		}
 		return
@@ -125,9 +148,22 @@ func (r *leaseUpdater) reconcile(ctx context.Context) {
 
 	if err != nil {
 		klog.Errorf("Failed to update lease %s/%s: %v on managed cluster", r.leaseName, r.leaseNamespace, err)
+		return
+	}
+
+	if r.syncHubLease && r.hubKubeClient != nil {
+		if err := r.updateLease(ctx, r.clusterName, r.hubKubeClient, r.hubLeaseLabels()); err != nil {
+			klog.Errorf("Failed to update lease %s/%s: %v on hub", r.clusterName, r.leaseName, err)
+		}
 	}
 }
 
+// hubLeaseLabels returns the labels of the lease on the hub. The addon manager watches the leases with the
+// addon label on the hub to probe the HealthProberTypeLeaseAndWork, and the lease name is the addon name.
+func (r *leaseUpdater) hubLeaseLabels() map[string]string {
+	return map[string]string{addonapiv1beta1.AddonLabelKey: r.leaseName}
+}
+
 // CheckAddonPodFunc checks whether the agent pod is running
 func CheckAddonPodFunc(podGetter corev1client.PodsGetter, namespace, labelSelector string) func() bool {
 	return func() bool {
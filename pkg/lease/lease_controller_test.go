@@ -16,6 +16,7 @@ import (
 	kubefake "k8s.io/client-go/kubernetes/fake"
 	clienttesting "k8s.io/client-go/testing"
 	"open-cluster-management.io/addon-framework/pkg/addonmanager/addontesting"
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
 )
 
 const (
@@ -90,6 +91,41 @@ func TestReconcileWithInvalidLease(t *testing.T) {
 	}
 }
 
+func TestReconcileWithHubLeaseSync(t *testing.T) {
+	kubeClient := kubefake.NewSimpleClientset()
+	hubClient := kubefake.NewSimpleClientset()
+
+	leaseReconciler := &leaseUpdater{
+		kubeClient:           kubeClient,
+		hubKubeClient:        hubClient,
+		leaseName:            leaseName,
+		clusterName:          "cluster1",
+		leaseDurationSeconds: 1,
+		leaseNamespace:       agentNs,
+	}
+
+	// the hub lease is not updated if the sync is not enabled
+	leaseReconciler.reconcile(context.TODO())
+	addontesting.AssertActions(t, kubeClient.Actions(), "get", "create")
+	addontesting.AssertNoActions(t, hubClient.Actions())
+
+	leaseReconciler.WithHubLeaseSync()
+	kubeClient.ClearActions()
+	leaseReconciler.reconcile(context.TODO())
+	addontesting.AssertActions(t, kubeClient.Actions(), "get", "update")
+	addontesting.AssertActions(t, hubClient.Actions(), "get", "create")
+
+	lease := hubClient.Actions()[1].(clienttesting.CreateActionImpl).Object.(*coordinationv1.Lease)
+	if lease.ObjectMeta.Namespace != "cluster1" {
+		t.Errorf(
+			"The namespace of lease is not correct, expected cluster1, actual %s",
+			lease.ObjectMeta.Namespace)
+	}
+	if lease.Labels[addonapiv1beta1.AddonLabelKey] != leaseName {
+		t.Errorf("The addon label of lease is not correct, expected %s, actual %v", leaseName, lease.Labels)
+	}
+}
+
 func TestReconcileWithHealthCheck(t *testing.T) {
 	kubeClient := kubefake.NewSimpleClientset()
 
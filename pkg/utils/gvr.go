@@ -16,6 +16,27 @@ var AddOnTemplateGVR = schema.GroupVersionResource{
 	Resource: "addontemplates",
 }
 
+// ManifestOverrideConfigGVR is the config type of the manifest overrides of the addon. The ManifestOverride
+// referenced by the addon contains the patches applied to the manifests of the addon in spec.patches, see
+// ManifestPatch. The CustomResourceDefinition of ManifestOverride is in
+// examples/deploy/addon-config/manifestoverride_crd.yaml.
+var ManifestOverrideConfigGVR = schema.GroupVersionResource{
+	Group:    "addon-framework.open-cluster-management.io",
+	Version:  "v1alpha1",
+	Resource: "manifestoverrides",
+}
+
+// SecretValuesConfigGVR is the config type of the sensitive values of the addon, e.g. the credentials. The
+// Secrets referenced by the addon contain the values to render the manifests of the addon, see SecretValuesKey.
+// Note that like the other config types, the addon manager starts an informer of the config type in all the
+// namespaces of the hub once an addon supports it, so all the Secrets on the hub are cached in the memory of the
+// addon manager, and the addon manager needs the permission to list and watch the Secrets cluster wide.
+var SecretValuesConfigGVR = schema.GroupVersionResource{
+	Group:    "",
+	Version:  "v1",
+	Resource: "secrets",
+}
+
 var BuiltInAddOnConfigGVRs = map[schema.GroupVersionResource]bool{
 	AddOnDeploymentConfigGVR: true,
 	AddOnTemplateGVR:         true,
@@ -0,0 +1,205 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/yaml"
+
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+)
+
+// ManifestPatchType is the type of the patch of the addon manifests.
+type ManifestPatchType string
+
+const (
+	// ManifestPatchTypeStrategicMerge is a strategic merge patch. The patch falls back to a json merge patch for
+	// the kinds which are not registered in the kubernetes scheme, e.g. the custom resources.
+	ManifestPatchTypeStrategicMerge ManifestPatchType = "StrategicMerge"
+	// ManifestPatchTypeJSON is a json patch (RFC 6902).
+	ManifestPatchTypeJSON ManifestPatchType = "JSON"
+)
+
+// ManifestPatchTarget selects the manifests to patch, an empty field matches any value.
+type ManifestPatchTarget struct {
+	Group     string `json:"group,omitempty"`
+	Version   string `json:"version,omitempty"`
+	Kind      string `json:"kind,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name,omitempty"`
+}
+
+// ManifestPatch is a patch applied to the manifests of the addon matched by the target.
+type ManifestPatch struct {
+	Target ManifestPatchTarget `json:"target"`
+	// Type is the type of the patch, defaults to StrategicMerge.
+	Type ManifestPatchType `json:"type,omitempty"`
+	// Patch is the content of the patch in yaml or json format.
+	Patch string `json:"patch"`
+}
+
+// ManifestOverrideConfigGetter has a method to return the ManifestOverride config.
+type ManifestOverrideConfigGetter interface {
+	Get(ctx context.Context, namespace, name string) (*unstructured.Unstructured, error)
+}
+
+// GetDesiredManifestPatches returns the patches in the desired manifest override config of the addon, it returns
+// nil if the addon has no manifest override config.
+func GetDesiredManifestPatches(ctx context.Context, addon *addonapiv1beta1.ManagedClusterAddOn,
+	getter ManifestOverrideConfigGetter) ([]ManifestPatch, error) {
+	ok, configRef := GetAddOnConfigRef(addon.Status.ConfigReferences,
+		ManifestOverrideConfigGVR.Group, ManifestOverrideConfigGVR.Resource)
+	if !ok {
+		return nil, nil
+	}
+
+	desiredConfig := configRef.DesiredConfig
+	if desiredConfig == nil || len(desiredConfig.SpecHash) == 0 {
+		return nil, fmt.Errorf("addon %s manifest override config desired spec hash is empty", addon.Name)
+	}
+
+	config, err := getter.Get(ctx, desiredConfig.Namespace, desiredConfig.Name)
+	if err != nil {
+		return nil, err
+	}
+	return ParseManifestPatches(config)
+}
+
+// ParseManifestPatches returns the patches in the spec.patches of the ManifestOverride config.
+func ParseManifestPatches(config *unstructured.Unstructured) ([]ManifestPatch, error) {
+	data, ok, err := unstructured.NestedFieldNoCopy(config.Object, "spec", "patches")
+	if err != nil || !ok {
+		return nil, err
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var patches []ManifestPatch
+	if err := json.Unmarshal(raw, &patches); err != nil {
+		return nil, fmt.Errorf("failed to parse the manifest patches of manifestoverride %s/%s: %v",
+			config.GetNamespace(), config.GetName(), err)
+	}
+	for i, patch := range patches {
+		switch patch.Type {
+		case "", ManifestPatchTypeStrategicMerge, ManifestPatchTypeJSON:
+		default:
+			return nil, fmt.Errorf("unsupported type %q of the manifest patch %d of manifestoverride %s/%s",
+				patch.Type, i, config.GetNamespace(), config.GetName())
+		}
+	}
+	return patches, nil
+}
+
+// ApplyManifestPatches applies the patches to the matched objects in order, the objects are not mutated and
+// the patched objects are returned in place of them.
+func ApplyManifestPatches(objects []runtime.Object, patches []ManifestPatch) ([]runtime.Object, error) {
+	if len(patches) == 0 {
+		return objects, nil
+	}
+
+	patchedObjects := make([]runtime.Object, 0, len(objects))
+	for _, obj := range objects {
+		gvk, err := objectKind(obj)
+		if err != nil {
+			return nil, err
+		}
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, patch := range patches {
+			if !patch.Target.matches(gvk, accessor.GetNamespace(), accessor.GetName()) {
+				continue
+			}
+			obj, err = applyManifestPatch(obj, gvk, patch)
+			if err != nil {
+				return nil, fmt.Errorf("failed to apply the manifest patch %d to %s %s/%s: %v",
+					i, gvk.Kind, accessor.GetNamespace(), accessor.GetName(), err)
+			}
+		}
+		patchedObjects = append(patchedObjects, obj)
+	}
+	return patchedObjects, nil
+}
+
+func (t ManifestPatchTarget) matches(gvk schema.GroupVersionKind, namespace, name string) bool {
+	return (len(t.Group) == 0 || t.Group == gvk.Group) &&
+		(len(t.Version) == 0 || t.Version == gvk.Version) &&
+		(len(t.Kind) == 0 || t.Kind == gvk.Kind) &&
+		(len(t.Namespace) == 0 || t.Namespace == namespace) &&
+		(len(t.Name) == 0 || t.Name == name)
+}
+
+func applyManifestPatch(obj runtime.Object, gvk schema.GroupVersionKind, patch ManifestPatch) (runtime.Object, error) {
+	original, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	patchData, err := yaml.YAMLToJSON([]byte(patch.Patch))
+	if err != nil {
+		return nil, err
+	}
+
+	var patched []byte
+	switch patch.Type {
+	case ManifestPatchTypeJSON:
+		jsonPatch, err := jsonpatch.DecodePatch(patchData)
+		if err != nil {
+			return nil, err
+		}
+		patched, err = jsonPatch.Apply(original)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		if dataStruct, err := scheme.Scheme.New(gvk); err == nil {
+			patched, err = strategicpatch.StrategicMergePatch(original, patchData, dataStruct)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			patched, err = jsonpatch.MergePatch(original, patchData)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// keep the type of the object, so the patched object can be handled in the same way as the original one.
+	if _, ok := obj.(*unstructured.Unstructured); !ok {
+		if typed, err := scheme.Scheme.New(gvk); err == nil {
+			if err := json.Unmarshal(patched, typed); err != nil {
+				return nil, err
+			}
+			typed.GetObjectKind().SetGroupVersionKind(gvk)
+			return typed, nil
+		}
+	}
+	patchedObj := &unstructured.Unstructured{}
+	if err := patchedObj.UnmarshalJSON(patched); err != nil {
+		return nil, err
+	}
+	return patchedObj, nil
+}
+
+func objectKind(obj runtime.Object) (schema.GroupVersionKind, error) {
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	if len(gvk.Kind) > 0 {
+		return gvk, nil
+	}
+	gvks, _, err := scheme.Scheme.ObjectKinds(obj)
+	if err != nil {
+		return schema.GroupVersionKind{}, err
+	}
+	return gvks[0], nil
+}
@@ -0,0 +1,206 @@
+package utils
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/yaml"
+)
+
+func newPatchTestDeployment() *appsv1.Deployment {
+	return &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "agent", Namespace: "addon"},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: ptr.To[int32](1),
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{Name: "agent", Image: "agent:v1"},
+						{Name: "sidecar", Image: "sidecar:v1"},
+					},
+				},
+			},
+		},
+	}
+}
+
+func newPatchTestCR() *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.io/v1",
+		"kind":       "Foo",
+		"metadata":   map[string]interface{}{"name": "foo", "namespace": "addon"},
+		"spec":       map[string]interface{}{"size": int64(1), "mode": "a"},
+	}}
+}
+
+func TestParseManifestPatches(t *testing.T) {
+	cases := []struct {
+		name            string
+		spec            string
+		expectedPatches int
+		expectedErr     bool
+	}{
+		{
+			name: "no patches",
+		},
+		{
+			name: "patches",
+			spec: `
+patches:
+- target:
+    kind: Deployment
+  patch: |
+    spec:
+      replicas: 2
+- target:
+    kind: Foo
+  type: JSON
+  patch: '[{"op": "replace", "path": "/spec/size", "value": 3}]'
+`,
+			expectedPatches: 2,
+		},
+		{
+			name:        "invalid patches",
+			spec:        "patches: patch",
+			expectedErr: true,
+		},
+		{
+			name:        "unsupported patch type",
+			spec:        `patches: [{"type": "Merge", "patch": "{}"}]`,
+			expectedErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			config := &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": ManifestOverrideConfigGVR.GroupVersion().String(),
+				"kind":       "ManifestOverride",
+				"metadata":   map[string]interface{}{"name": "override", "namespace": "cluster1"},
+			}}
+			if len(c.spec) != 0 {
+				spec := map[string]interface{}{}
+				if err := yaml.Unmarshal([]byte(c.spec), &spec); err != nil {
+					t.Fatal(err)
+				}
+				config.Object["spec"] = spec
+			}
+
+			patches, err := ParseManifestPatches(config)
+			if c.expectedErr != (err != nil) {
+				t.Fatalf("expected error %v, but got %v", c.expectedErr, err)
+			}
+			if len(patches) != c.expectedPatches {
+				t.Errorf("expected %d patches, but got %v", c.expectedPatches, patches)
+			}
+		})
+	}
+}
+
+func TestApplyManifestPatches(t *testing.T) {
+	cases := []struct {
+		name        string
+		patches     []ManifestPatch
+		validate    func(t *testing.T, objects []runtime.Object)
+		expectedErr bool
+	}{
+		{
+			name: "strategic merge patch",
+			patches: []ManifestPatch{{
+				Target: ManifestPatchTarget{Group: "apps", Kind: "Deployment", Name: "agent"},
+				Patch: `
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - name: sidecar
+        image: sidecar:v2`,
+			}},
+			validate: func(t *testing.T, objects []runtime.Object) {
+				deploy := objects[0].(*appsv1.Deployment)
+				if *deploy.Spec.Replicas != 2 {
+					t.Errorf("expected replicas 2, but got %d", *deploy.Spec.Replicas)
+				}
+				containers := deploy.Spec.Template.Spec.Containers
+				if len(containers) != 2 || containers[0].Image != "agent:v1" || containers[1].Image != "sidecar:v2" {
+					t.Errorf("unexpected containers %v", containers)
+				}
+			},
+		},
+		{
+			name: "merge patch of custom resource",
+			patches: []ManifestPatch{{
+				Target: ManifestPatchTarget{Kind: "Foo"},
+				Patch:  `{"spec": {"size": 2}}`,
+			}},
+			validate: func(t *testing.T, objects []runtime.Object) {
+				spec := objects[1].(*unstructured.Unstructured).Object["spec"].(map[string]interface{})
+				if spec["size"] != int64(2) || spec["mode"] != "a" {
+					t.Errorf("unexpected spec %v", spec)
+				}
+			},
+		},
+		{
+			name: "json patch",
+			patches: []ManifestPatch{{
+				Target: ManifestPatchTarget{Namespace: "addon"},
+				Type:   ManifestPatchTypeJSON,
+				Patch:  `[{"op": "add", "path": "/metadata/labels", "value": {"cluster": "cluster1"}}]`,
+			}},
+			validate: func(t *testing.T, objects []runtime.Object) {
+				if objects[0].(*appsv1.Deployment).Labels["cluster"] != "cluster1" {
+					t.Errorf("expected the deployment is patched")
+				}
+				if objects[1].(*unstructured.Unstructured).GetLabels()["cluster"] != "cluster1" {
+					t.Errorf("expected the custom resource is patched")
+				}
+			},
+		},
+		{
+			name: "target not matched",
+			patches: []ManifestPatch{{
+				Target: ManifestPatchTarget{Kind: "Deployment", Name: "other"},
+				Patch:  `{"spec": {"replicas": 2}}`,
+			}},
+			validate: func(t *testing.T, objects []runtime.Object) {
+				if *objects[0].(*appsv1.Deployment).Spec.Replicas != 1 {
+					t.Errorf("expected the deployment is not patched")
+				}
+			},
+		},
+		{
+			name: "invalid json patch",
+			patches: []ManifestPatch{{
+				Target: ManifestPatchTarget{Kind: "Foo"},
+				Type:   ManifestPatchTypeJSON,
+				Patch:  `[{"op": "remove", "path": "/spec/replicas"}]`,
+			}},
+			expectedErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			deploy, cr := newPatchTestDeployment(), newPatchTestCR()
+			objects, err := ApplyManifestPatches([]runtime.Object{deploy, cr}, c.patches)
+			if c.expectedErr != (err != nil) {
+				t.Fatalf("expected error %v, but got %v", c.expectedErr, err)
+			}
+			if err != nil {
+				return
+			}
+			c.validate(t, objects)
+
+			if *deploy.Spec.Replicas != 1 || len(cr.GetLabels()) != 0 {
+				t.Errorf("expected the original objects are not mutated")
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"fmt"
+	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -113,7 +114,28 @@ func DeploymentAvailabilityHealthChecker(results []agent.FieldResult,
 
 func WorkloadAvailabilityHealthChecker(results []agent.FieldResult,
 	cluster *clusterv1.ManagedCluster, addon *addonapiv1beta1.ManagedClusterAddOn) error {
+	return checkWorkloadsAvailabilityHealth(results, nil)
+}
+
+// NewWorkloadAvailabilityHealthChecker returns a health checker of the workloads filtered by FilterWorkloads.
+// Different from WorkloadAvailabilityHealthChecker, the statefulsets are checked with the update strategy in
+// their spec, so the replicas which are not updated on purpose do not make the statefulsets unavailable.
+func NewWorkloadAvailabilityHealthChecker(workloads []WorkloadMetadata) agent.AddonHealthCheckerFunc {
+	return func(results []agent.FieldResult,
+		cluster *clusterv1.ManagedCluster, addon *addonapiv1beta1.ManagedClusterAddOn) error {
+		return checkWorkloadsAvailabilityHealth(results, workloads)
+	}
+}
+
+func checkWorkloadsAvailabilityHealth(results []agent.FieldResult, workloads []WorkloadMetadata) error {
 	for _, result := range results {
+		if result.ResourceIdentifier.Resource == "statefulsets" {
+			if err := checkStatefulSetHealth(result.ResourceIdentifier, result.FeedbackResult,
+				findStatefulSetSpec(workloads, result.ResourceIdentifier)); err != nil {
+				return err
+			}
+			continue
+		}
 		if err := checkWorkloadAvailabilityHealth(result.ResourceIdentifier, result.FeedbackResult); err != nil {
 			return err
 		}
@@ -123,8 +145,10 @@ func WorkloadAvailabilityHealthChecker(results []agent.FieldResult,
 
 func checkWorkloadAvailabilityHealth(identifier workapiv1.ResourceIdentifier,
 	result workapiv1.StatusFeedbackResult) error {
-	// only support deployments and daemonsets for now
-	if identifier.Resource != "deployments" && identifier.Resource != "daemonsets" {
+	// only support deployments, daemonsets, statefulsets and replicasets for now
+	switch identifier.Resource {
+	case "deployments", "daemonsets", "statefulsets", "replicasets":
+	default:
 		return fmt.Errorf("unsupported resource type %s", identifier.Resource)
 	}
 	if identifier.Group != appsv1.GroupName {
@@ -136,6 +160,13 @@ func checkWorkloadAvailabilityHealth(identifier workapiv1.ResourceIdentifier,
 			identifier.Resource, identifier.Namespace, identifier.Name)
 	}
 
+	switch identifier.Resource {
+	case "statefulsets":
+		return checkStatefulSetHealth(identifier, result, nil)
+	case "replicasets":
+		return checkReplicaSetHealth(identifier, result)
+	}
+
 	readyReplicas := -1
 	desiredNumberReplicas := -1
 	for _, value := range result.Values {
@@ -178,6 +209,168 @@ func checkWorkloadAvailabilityHealth(identifier workapiv1.ResourceIdentifier,
 		desiredNumberReplicas, readyReplicas, identifier.Resource, identifier.Namespace, identifier.Name)
 }
 
+// checkStatefulSetHealth checks the statefulset probed by the json paths of WellKnowManifestConfig. A statefulset
+// is available if all its replicas are ready and the replicas out of the partition of its rolling update are
+// updated. The replicas of a statefulset with the OnDelete update strategy are only updated when they are deleted,
+// so they are not required to be updated. The statefulset is regarded as a rolling update without partition if
+// its spec is unknown.
+func checkStatefulSetHealth(identifier workapiv1.ResourceIdentifier,
+	result workapiv1.StatusFeedbackResult, spec *StatefulSetSpec) error {
+	if identifier.Group != appsv1.GroupName {
+		return fmt.Errorf("unsupported resource group %s", identifier.Group)
+	}
+	if len(result.Values) == 0 {
+		return fmt.Errorf("no values are probed for %s %s/%s",
+			identifier.Resource, identifier.Namespace, identifier.Name)
+	}
+
+	values := feedbackValues(result)
+	if _, ok := values["Replicas"]; !ok {
+		return fmt.Errorf("replicas is not probed for %s %s/%s",
+			identifier.Resource, identifier.Namespace, identifier.Name)
+	}
+	replicas := integerFeedbackValue(values, "Replicas")
+	readyReplicas := integerFeedbackValue(values, "ReadyReplicas")
+
+	if readyReplicas != replicas {
+		return fmt.Errorf("desiredNumberReplicas is %d but readyReplica is %d for %s %s/%s",
+			replicas, readyReplicas, identifier.Resource, identifier.Namespace, identifier.Name)
+	}
+	updatedReplicas := integerFeedbackValue(values, "UpdatedReplicas")
+	if expected := spec.expectedUpdatedReplicas(replicas); updatedReplicas < expected {
+		return fmt.Errorf("rollout is in progress for %s %s/%s, %d of %d replicas are updated to revision %s",
+			identifier.Resource, identifier.Namespace, identifier.Name,
+			updatedReplicas, expected, stringFeedbackValue(values, "UpdateRevision"))
+	}
+	return nil
+}
+
+// checkReplicaSetHealth checks the replicaset probed by the json paths of WellKnowManifestConfig. A replicaset is
+// available if all its replicas are ready and available.
+func checkReplicaSetHealth(identifier workapiv1.ResourceIdentifier, result workapiv1.StatusFeedbackResult) error {
+	values := feedbackValues(result)
+	if _, ok := values["Replicas"]; !ok {
+		return fmt.Errorf("replicas is not probed for %s %s/%s",
+			identifier.Resource, identifier.Namespace, identifier.Name)
+	}
+	replicas := integerFeedbackValue(values, "Replicas")
+	readyReplicas := integerFeedbackValue(values, "ReadyReplicas")
+	availableReplicas := integerFeedbackValue(values, "AvailableReplicas")
+
+	if readyReplicas < replicas {
+		return fmt.Errorf("desiredNumberReplicas is %d but readyReplica is %d for %s %s/%s",
+			replicas, readyReplicas, identifier.Resource, identifier.Namespace, identifier.Name)
+	}
+	if availableReplicas < replicas {
+		return fmt.Errorf("desiredNumberReplicas is %d but availableReplica is %d for %s %s/%s",
+			replicas, availableReplicas, identifier.Resource, identifier.Namespace, identifier.Name)
+	}
+	return nil
+}
+
+func feedbackValues(result workapiv1.StatusFeedbackResult) map[string]workapiv1.FieldValue {
+	values := map[string]workapiv1.FieldValue{}
+	for _, value := range result.Values {
+		values[value.Name] = value.Value
+	}
+	return values
+}
+
+func integerFeedbackValue(values map[string]workapiv1.FieldValue, name string) int64 {
+	// the zero values are omitted from the status, so they are not probed.
+	if value, ok := values[name]; ok && value.Integer != nil {
+		return *value.Integer
+	}
+	return 0
+}
+
+func stringFeedbackValue(values map[string]workapiv1.FieldValue, name string) string {
+	if value, ok := values[name]; ok && value.String != nil {
+		return *value.String
+	}
+	return ""
+}
+
+// WorkloadRolloutStatus is the rollout status of a workload probed by the feedback rules of WellKnowManifestConfig.
+type WorkloadRolloutStatus struct {
+	workapiv1.ResourceIdentifier
+	// ObservedGeneration is the generation of the workload observed by its controller.
+	ObservedGeneration int64
+	// InProgress is true if not all the replicas of the workload are updated to the latest revision.
+	InProgress bool
+	// DeadlineExceeded is true if the workload reports that its rollout exceeds the progress deadline, only the
+	// deployments report it by the Progressing condition.
+	DeadlineExceeded bool
+	// ProgressDeadline is the progress deadline of the workload which is checked by its controller, it is the
+	// spec.progressDeadlineSeconds of the deployments, and zero for the other workloads.
+	ProgressDeadline time.Duration
+	// Message describes the rollout status of the workload.
+	Message string
+}
+
+// GetWorkloadRolloutStatus returns the rollout status of the deployments, daemonsets and statefulsets from the
+// feedback values of the observedGeneration and the updated replicas. The rollout of a statefulset respects the
+// update strategy of its spec in the workloads filtered by FilterWorkloads. It returns false if the workload is
+// not supported or the rollout status is not probed yet.
+func GetWorkloadRolloutStatus(result agent.FieldResult, workloads []WorkloadMetadata) (WorkloadRolloutStatus, bool) {
+	identifier := result.ResourceIdentifier
+	if identifier.Group != appsv1.GroupName {
+		return WorkloadRolloutStatus{}, false
+	}
+
+	values := feedbackValues(result.FeedbackResult)
+	integerValue := func(name string) int64 {
+		return integerFeedbackValue(values, name)
+	}
+	stringValue := func(name string) string {
+		return stringFeedbackValue(values, name)
+	}
+
+	// the rollout status is not probed until the workload is observed by its controller.
+	if value, ok := values["ObservedGeneration"]; !ok || value.Integer == nil {
+		return WorkloadRolloutStatus{}, false
+	}
+	status := WorkloadRolloutStatus{
+		ResourceIdentifier: identifier,
+		ObservedGeneration: integerValue("ObservedGeneration"),
+	}
+
+	var updated, desired int64
+	switch identifier.Resource {
+	case "deployments":
+		updated, desired = integerValue("UpdatedReplicas"), integerValue("Replicas")
+		// the reason of the Progressing condition is set to NewReplicaSetAvailable by the deployment controller
+		// once the rollout is completed.
+		reason := stringValue("ProgressingReason")
+		status.DeadlineExceeded = reason == "ProgressDeadlineExceeded"
+		status.InProgress = !status.DeadlineExceeded &&
+			(updated < desired || (len(reason) != 0 && reason != "NewReplicaSetAvailable"))
+		status.ProgressDeadline = findDeploymentSpec(workloads, identifier).progressDeadline()
+	case "daemonsets":
+		updated, desired = integerValue("UpdatedNumberScheduled"), integerValue("DesiredNumberScheduled")
+		status.InProgress = updated < desired
+	case "statefulsets":
+		spec := findStatefulSetSpec(workloads, identifier)
+		updated, desired = integerValue("UpdatedReplicas"), spec.expectedUpdatedReplicas(integerValue("Replicas"))
+		status.InProgress = updated < desired
+	default:
+		return WorkloadRolloutStatus{}, false
+	}
+
+	switch {
+	case status.DeadlineExceeded:
+		status.Message = fmt.Sprintf("rollout of generation %d exceeds the progress deadline for %s %s/%s",
+			status.ObservedGeneration, identifier.Resource, identifier.Namespace, identifier.Name)
+	case status.InProgress:
+		status.Message = fmt.Sprintf("rollout of generation %d is in progress for %s %s/%s, %d of %d replicas are updated",
+			status.ObservedGeneration, identifier.Resource, identifier.Namespace, identifier.Name, updated, desired)
+	default:
+		status.Message = fmt.Sprintf("rollout of generation %d is completed for %s %s/%s",
+			status.ObservedGeneration, identifier.Resource, identifier.Namespace, identifier.Name)
+	}
+	return status, true
+}
+
 func FilterDeployments(objects []runtime.Object) []*appsv1.Deployment {
 	deployments := []*appsv1.Deployment{}
 	for _, obj := range objects {
@@ -193,11 +386,66 @@ func FilterDeployments(objects []runtime.Object) []*appsv1.Deployment {
 type WorkloadMetadata struct {
 	schema.GroupResource
 	types.NamespacedName
-	DeploymentSpec *DeploymentSpec
+	DeploymentSpec  *DeploymentSpec
+	StatefulSetSpec *StatefulSetSpec
 }
 
 type DeploymentSpec struct {
 	Replicas int32
+	// ProgressDeadlineSeconds is the spec.progressDeadlineSeconds of the deployment, it is nil if not set.
+	ProgressDeadlineSeconds *int32
+}
+
+// defaultProgressDeadlineSeconds is the default spec.progressDeadlineSeconds of the deployments.
+const defaultProgressDeadlineSeconds = 600
+
+// progressDeadline returns the progress deadline of the deployment, it is the default progressDeadlineSeconds
+// if the spec is unknown or the progressDeadlineSeconds is not set.
+func (s *DeploymentSpec) progressDeadline() time.Duration {
+	if s == nil || s.ProgressDeadlineSeconds == nil {
+		return defaultProgressDeadlineSeconds * time.Second
+	}
+	return time.Duration(*s.ProgressDeadlineSeconds) * time.Second
+}
+
+func findDeploymentSpec(workloads []WorkloadMetadata, identifier workapiv1.ResourceIdentifier) *DeploymentSpec {
+	for _, workload := range workloads {
+		if workload.Group == identifier.Group && workload.Resource == identifier.Resource &&
+			workload.Namespace == identifier.Namespace && workload.Name == identifier.Name {
+			return workload.DeploymentSpec
+		}
+	}
+	return nil
+}
+
+// StatefulSetSpec is the update strategy of a statefulset, which is not reflected in its status.
+type StatefulSetSpec struct {
+	// OnDelete is true if the replicas are only updated when they are deleted.
+	OnDelete bool
+	// Partition is the partition of the rolling update, the replicas with an ordinal less than it are not updated.
+	Partition int32
+}
+
+// expectedUpdatedReplicas returns the number of the replicas which are expected to be updated by the rollout of
+// the statefulset.
+func (s *StatefulSetSpec) expectedUpdatedReplicas(replicas int64) int64 {
+	if s == nil {
+		return replicas
+	}
+	if s.OnDelete {
+		return 0
+	}
+	return max(replicas-int64(s.Partition), 0)
+}
+
+func findStatefulSetSpec(workloads []WorkloadMetadata, identifier workapiv1.ResourceIdentifier) *StatefulSetSpec {
+	for _, workload := range workloads {
+		if workload.Group == identifier.Group && workload.Resource == identifier.Resource &&
+			workload.Namespace == identifier.Namespace && workload.Name == identifier.Name {
+			return workload.StatefulSetSpec
+		}
+	}
+	return nil
 }
 
 func FilterWorkloads(objects []runtime.Object) []WorkloadMetadata {
@@ -221,7 +469,8 @@ func FilterWorkloads(objects []runtime.Object) []WorkloadMetadata {
 					Name:      deployment.Name,
 				},
 				DeploymentSpec: &DeploymentSpec{
-					Replicas: deploymentReplicas,
+					Replicas:                deploymentReplicas,
+					ProgressDeadlineSeconds: deployment.Spec.ProgressDeadlineSeconds,
 				},
 			})
 		}
@@ -238,6 +487,40 @@ func FilterWorkloads(objects []runtime.Object) []WorkloadMetadata {
 				},
 			})
 		}
+		statefulset, err := ConvertToStatefulSet(obj)
+		if err == nil {
+			statefulSetSpec := &StatefulSetSpec{
+				OnDelete: statefulset.Spec.UpdateStrategy.Type == appsv1.OnDeleteStatefulSetStrategyType,
+			}
+			if rollingUpdate := statefulset.Spec.UpdateStrategy.RollingUpdate; rollingUpdate != nil &&
+				rollingUpdate.Partition != nil {
+				statefulSetSpec.Partition = *rollingUpdate.Partition
+			}
+			workloads = append(workloads, WorkloadMetadata{
+				GroupResource: schema.GroupResource{
+					Group:    appsv1.GroupName,
+					Resource: "statefulsets",
+				},
+				NamespacedName: types.NamespacedName{
+					Namespace: statefulset.Namespace,
+					Name:      statefulset.Name,
+				},
+				StatefulSetSpec: statefulSetSpec,
+			})
+		}
+		replicaset, err := ConvertToReplicaSet(obj)
+		if err == nil {
+			workloads = append(workloads, WorkloadMetadata{
+				GroupResource: schema.GroupResource{
+					Group:    appsv1.GroupName,
+					Resource: "replicasets",
+				},
+				NamespacedName: types.NamespacedName{
+					Namespace: replicaset.Namespace,
+					Name:      replicaset.Name,
+				},
+			})
+		}
 	}
 	return workloads
 }
@@ -254,7 +537,59 @@ func DeploymentWellKnowManifestConfig(namespace, name string) workapiv1.Manifest
 	return WellKnowManifestConfig(appsv1.GroupName, "deployments", namespace, name)
 }
 
+// workloadStatusJSONPaths are the status fields of the workloads which are not covered by the well known status
+// of the work agent, e.g. the revisions of the statefulsets and the status of the replicasets.
+var workloadStatusJSONPaths = map[string][]workapiv1.JsonPath{
+	"statefulsets": {
+		{Name: "Replicas", Path: ".replicas"},
+		{Name: "ReadyReplicas", Path: ".readyReplicas"},
+		{Name: "UpdatedReplicas", Path: ".updatedReplicas"},
+		{Name: "CurrentRevision", Path: ".currentRevision"},
+		{Name: "UpdateRevision", Path: ".updateRevision"},
+		{Name: "ObservedGeneration", Path: ".observedGeneration"},
+	},
+	"replicasets": {
+		{Name: "Replicas", Path: ".replicas"},
+		{Name: "ReadyReplicas", Path: ".readyReplicas"},
+		{Name: "AvailableReplicas", Path: ".availableReplicas"},
+	},
+}
+
+// workloadRolloutJSONPaths are the status fields of the workloads to probe the rollout status, they are probed
+// together with the well known status of the work agent.
+var workloadRolloutJSONPaths = map[string][]workapiv1.JsonPath{
+	"deployments": {
+		{Name: "ObservedGeneration", Path: ".observedGeneration"},
+		{Name: "UpdatedReplicas", Path: ".updatedReplicas"},
+		{Name: "ProgressingReason", Path: `.conditions[?(@.type=="Progressing")].reason`},
+	},
+	"daemonsets": {
+		{Name: "ObservedGeneration", Path: ".observedGeneration"},
+		{Name: "UpdatedNumberScheduled", Path: ".updatedNumberScheduled"},
+	},
+}
+
 func WellKnowManifestConfig(group, resources, namespace, name string) workapiv1.ManifestConfigOption {
+	feedbackRules := []workapiv1.FeedbackRule{
+		{
+			Type: workapiv1.WellKnownStatusType,
+		},
+	}
+	if jsonPaths, ok := workloadRolloutJSONPaths[resources]; ok && group == appsv1.GroupName {
+		feedbackRules = append(feedbackRules, workapiv1.FeedbackRule{
+			Type:      workapiv1.JSONPathsType,
+			JsonPaths: jsonPaths,
+		})
+	}
+	if jsonPaths, ok := workloadStatusJSONPaths[resources]; ok && group == appsv1.GroupName {
+		feedbackRules = []workapiv1.FeedbackRule{
+			{
+				Type:      workapiv1.JSONPathsType,
+				JsonPaths: jsonPaths,
+			},
+		}
+	}
+
 	return workapiv1.ManifestConfigOption{
 		ResourceIdentifier: workapiv1.ResourceIdentifier{
 			Group:     group,
@@ -262,11 +597,7 @@ func WellKnowManifestConfig(group, resources, namespace, name string) workapiv1.
 			Name:      name,
 			Namespace: namespace,
 		},
-		FeedbackRules: []workapiv1.FeedbackRule{
-			{
-				Type: workapiv1.WellKnownStatusType,
-			},
-		},
+		FeedbackRules: feedbackRules,
 	}
 }
 
@@ -313,3 +644,19 @@ func ConvertTo[T any](obj runtime.Object, group, kind string) (*T, error) {
 	}
 	return target, nil
 }
+
+func ConvertToStatefulSet(obj runtime.Object) (*appsv1.StatefulSet, error) {
+	if statefulSet, ok := obj.(*appsv1.StatefulSet); ok {
+		return statefulSet, nil
+	}
+
+	return ConvertTo[appsv1.StatefulSet](obj, appsv1.GroupName, "StatefulSet")
+}
+
+func ConvertToReplicaSet(obj runtime.Object) (*appsv1.ReplicaSet, error) {
+	if replicaSet, ok := obj.(*appsv1.ReplicaSet); ok {
+		return replicaSet, nil
+	}
+
+	return ConvertTo[appsv1.ReplicaSet](obj, appsv1.GroupName, "ReplicaSet")
+}
@@ -2,12 +2,15 @@ package utils
 
 import (
 	"testing"
+	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
 	"open-cluster-management.io/addon-framework/pkg/agent"
 	workapiv1 "open-cluster-management.io/api/work/v1"
 )
@@ -16,6 +19,10 @@ func boolPtr(n int64) *int64 {
 	return &n
 }
 
+func stringPtr(s string) *string {
+	return &s
+}
+
 func TestDeploymentProbe(t *testing.T) {
 	cases := []struct {
 		name        string
@@ -226,3 +233,303 @@ func TestFilterDeployment(t *testing.T) {
 		})
 	}
 }
+
+func TestWorkloadAvailabilityHealthChecker(t *testing.T) {
+	integerValue := func(name string, value int64) workapiv1.FeedbackValue {
+		return workapiv1.FeedbackValue{Name: name, Value: workapiv1.FieldValue{Integer: boolPtr(value)}}
+	}
+	stringValue := func(name, value string) workapiv1.FeedbackValue {
+		return workapiv1.FeedbackValue{Name: name, Value: workapiv1.FieldValue{String: &value}}
+	}
+
+	cases := []struct {
+		name            string
+		resource        string
+		statefulSetSpec *StatefulSetSpec
+		values          []workapiv1.FeedbackValue
+		expectedErr     string
+	}{
+		{
+			name:     "statefulset is available",
+			resource: "statefulsets",
+			values: []workapiv1.FeedbackValue{
+				integerValue("Replicas", 3), integerValue("ReadyReplicas", 3), integerValue("UpdatedReplicas", 3),
+				stringValue("CurrentRevision", "test-1"), stringValue("UpdateRevision", "test-1"),
+			},
+		},
+		{
+			name:     "statefulset rollout is in progress",
+			resource: "statefulsets",
+			values: []workapiv1.FeedbackValue{
+				integerValue("Replicas", 3), integerValue("ReadyReplicas", 3), integerValue("UpdatedReplicas", 1),
+				stringValue("CurrentRevision", "test-1"), stringValue("UpdateRevision", "test-2"),
+			},
+			expectedErr: "rollout is in progress for statefulsets testns/test, 1 of 3 replicas are updated to revision test-2",
+		},
+		{
+			name:            "statefulset replicas out of the partition are updated",
+			resource:        "statefulsets",
+			statefulSetSpec: &StatefulSetSpec{Partition: 2},
+			values: []workapiv1.FeedbackValue{
+				integerValue("Replicas", 3), integerValue("ReadyReplicas", 3), integerValue("UpdatedReplicas", 1),
+				stringValue("CurrentRevision", "test-1"), stringValue("UpdateRevision", "test-2"),
+			},
+		},
+		{
+			name:            "statefulset replicas out of the partition are not updated",
+			resource:        "statefulsets",
+			statefulSetSpec: &StatefulSetSpec{Partition: 1},
+			values: []workapiv1.FeedbackValue{
+				integerValue("Replicas", 3), integerValue("ReadyReplicas", 3), integerValue("UpdatedReplicas", 1),
+				stringValue("CurrentRevision", "test-1"), stringValue("UpdateRevision", "test-2"),
+			},
+			expectedErr: "rollout is in progress for statefulsets testns/test, 1 of 2 replicas are updated to revision test-2",
+		},
+		{
+			name:            "statefulset with the OnDelete strategy is not updated",
+			resource:        "statefulsets",
+			statefulSetSpec: &StatefulSetSpec{OnDelete: true},
+			values: []workapiv1.FeedbackValue{
+				integerValue("Replicas", 3), integerValue("ReadyReplicas", 3),
+				stringValue("CurrentRevision", "test-1"), stringValue("UpdateRevision", "test-2"),
+			},
+		},
+		{
+			name:     "statefulset has no ready replicas",
+			resource: "statefulsets",
+			values: []workapiv1.FeedbackValue{
+				integerValue("Replicas", 3),
+				stringValue("CurrentRevision", "test-1"), stringValue("UpdateRevision", "test-1"),
+			},
+			expectedErr: "desiredNumberReplicas is 3 but readyReplica is 0 for statefulsets testns/test",
+		},
+		{
+			name:        "statefulset replicas is not probed",
+			resource:    "statefulsets",
+			values:      []workapiv1.FeedbackValue{integerValue("ReadyReplicas", 3)},
+			expectedErr: "replicas is not probed for statefulsets testns/test",
+		},
+		{
+			name:     "replicaset is available",
+			resource: "replicasets",
+			values: []workapiv1.FeedbackValue{integerValue("Replicas", 3), integerValue("ReadyReplicas", 3),
+				integerValue("AvailableReplicas", 3)},
+		},
+		{
+			name:        "replicaset is not ready",
+			resource:    "replicasets",
+			values:      []workapiv1.FeedbackValue{integerValue("Replicas", 3), integerValue("ReadyReplicas", 1)},
+			expectedErr: "desiredNumberReplicas is 3 but readyReplica is 1 for replicasets testns/test",
+		},
+		{
+			name:     "replicaset is not available",
+			resource: "replicasets",
+			values: []workapiv1.FeedbackValue{integerValue("Replicas", 3), integerValue("ReadyReplicas", 3),
+				integerValue("AvailableReplicas", 2)},
+			expectedErr: "desiredNumberReplicas is 3 but availableReplica is 2 for replicasets testns/test",
+		},
+		{
+			name:        "replicas of replicaset is not probed",
+			resource:    "replicasets",
+			values:      []workapiv1.FeedbackValue{integerValue("ReadyReplicas", 1)},
+			expectedErr: "replicas is not probed for replicasets testns/test",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mc := WellKnowManifestConfig(appsv1.GroupName, c.resource, "testns", "test")
+			if c.resource == "statefulsets" &&
+				(len(mc.FeedbackRules) != 1 || mc.FeedbackRules[0].Type != workapiv1.JSONPathsType) {
+				t.Errorf("expected the json paths feedback rule, but got %v", mc.FeedbackRules)
+			}
+
+			healthChecker := NewWorkloadAvailabilityHealthChecker([]WorkloadMetadata{{
+				GroupResource:   schema.GroupResource{Group: appsv1.GroupName, Resource: c.resource},
+				NamespacedName:  types.NamespacedName{Namespace: "testns", Name: "test"},
+				StatefulSetSpec: c.statefulSetSpec,
+			}})
+			err := healthChecker([]agent.FieldResult{
+				{
+					ResourceIdentifier: mc.ResourceIdentifier,
+					FeedbackResult:     workapiv1.StatusFeedbackResult{Values: c.values},
+				},
+			}, nil, nil)
+			if err != nil && err.Error() != c.expectedErr {
+				t.Errorf("expected error %s but got %v", c.expectedErr, err)
+			}
+			if err == nil && len(c.expectedErr) != 0 {
+				t.Errorf("expected error %s but got no error", c.expectedErr)
+			}
+		})
+	}
+}
+
+func TestFilterWorkloads(t *testing.T) {
+	statefulset := &unstructured.Unstructured{}
+	statefulset.SetAPIVersion("apps/v1")
+	statefulset.SetKind("StatefulSet")
+	statefulset.SetNamespace("default")
+	statefulset.SetName("db")
+	if err := unstructured.SetNestedField(statefulset.Object, int64(2),
+		"spec", "updateStrategy", "rollingUpdate", "partition"); err != nil {
+		t.Fatal(err)
+	}
+
+	workloads := FilterWorkloads([]runtime.Object{
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "agent"}},
+		&appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "node-agent"}},
+		statefulset,
+		&appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cache"},
+			Spec: appsv1.StatefulSetSpec{
+				UpdateStrategy: appsv1.StatefulSetUpdateStrategy{Type: appsv1.OnDeleteStatefulSetStrategyType},
+			},
+		},
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "proxy"}},
+	})
+
+	expected := []string{"deployments/agent", "daemonsets/node-agent", "statefulsets/db", "statefulsets/cache",
+		"replicasets/proxy"}
+	if len(workloads) != len(expected) {
+		t.Fatalf("expected workloads %v, but got %v", expected, workloads)
+	}
+	for i, workload := range workloads {
+		if actual := workload.Resource + "/" + workload.Name; actual != expected[i] {
+			t.Errorf("expected workload %s, but got %s", expected[i], actual)
+		}
+	}
+	if spec := workloads[2].StatefulSetSpec; spec == nil || spec.OnDelete || spec.Partition != 2 {
+		t.Errorf("expected the statefulset spec with partition 2, but got %v", spec)
+	}
+	if spec := workloads[3].StatefulSetSpec; spec == nil || !spec.OnDelete {
+		t.Errorf("expected the statefulset spec with the OnDelete strategy, but got %v", spec)
+	}
+}
+
+func TestGetWorkloadRolloutStatus(t *testing.T) {
+	integer := func(name string, value int64) workapiv1.FeedbackValue {
+		return workapiv1.FeedbackValue{Name: name, Value: workapiv1.FieldValue{Integer: boolPtr(value)}}
+	}
+	str := func(name, value string) workapiv1.FeedbackValue {
+		return workapiv1.FeedbackValue{Name: name, Value: workapiv1.FieldValue{String: stringPtr(value)}}
+	}
+
+	cases := []struct {
+		name                     string
+		resource                 string
+		deploymentSpec           *DeploymentSpec
+		statefulSetSpec          *StatefulSetSpec
+		values                   []workapiv1.FeedbackValue
+		expectedProbed           bool
+		expectedInProgress       bool
+		expectedDeadlineExceeded bool
+		expectedProgressDeadline time.Duration
+	}{
+		{
+			name:     "observedGeneration is not probed",
+			resource: "deployments",
+			values:   []workapiv1.FeedbackValue{integer("Replicas", 2), integer("ReadyReplicas", 2)},
+		},
+		{
+			name:     "rollout of replicasets is not probed",
+			resource: "replicasets",
+			values:   []workapiv1.FeedbackValue{integer("ObservedGeneration", 1), integer("Replicas", 2)},
+		},
+		{
+			name:     "deployment is rolled out",
+			resource: "deployments",
+			values: []workapiv1.FeedbackValue{integer("ObservedGeneration", 2), integer("Replicas", 2),
+				integer("UpdatedReplicas", 2), str("ProgressingReason", "NewReplicaSetAvailable")},
+			expectedProbed: true,
+		},
+		{
+			name:     "deployment is rolling out",
+			resource: "deployments",
+			values: []workapiv1.FeedbackValue{integer("ObservedGeneration", 2), integer("Replicas", 2),
+				integer("UpdatedReplicas", 1), str("ProgressingReason", "ReplicaSetUpdated")},
+			expectedProbed:           true,
+			expectedInProgress:       true,
+			expectedProgressDeadline: 10 * time.Minute,
+		},
+		{
+			name:           "deployment is rolling out with the progress deadline in spec",
+			resource:       "deployments",
+			deploymentSpec: &DeploymentSpec{Replicas: 2, ProgressDeadlineSeconds: ptr.To[int32](1800)},
+			values: []workapiv1.FeedbackValue{integer("ObservedGeneration", 2), integer("Replicas", 2),
+				integer("UpdatedReplicas", 1), str("ProgressingReason", "ReplicaSetUpdated")},
+			expectedProbed:           true,
+			expectedInProgress:       true,
+			expectedProgressDeadline: 30 * time.Minute,
+		},
+		{
+			name:     "deployment exceeds the progress deadline",
+			resource: "deployments",
+			values: []workapiv1.FeedbackValue{integer("ObservedGeneration", 2), integer("Replicas", 2),
+				integer("UpdatedReplicas", 1), str("ProgressingReason", "ProgressDeadlineExceeded")},
+			expectedProbed:           true,
+			expectedDeadlineExceeded: true,
+		},
+		{
+			name:     "daemonset is rolling out",
+			resource: "daemonsets",
+			values: []workapiv1.FeedbackValue{integer("ObservedGeneration", 2),
+				integer("DesiredNumberScheduled", 3), integer("UpdatedNumberScheduled", 1)},
+			expectedProbed:     true,
+			expectedInProgress: true,
+		},
+		{
+			name:     "statefulset is rolling out",
+			resource: "statefulsets",
+			values: []workapiv1.FeedbackValue{integer("ObservedGeneration", 2), integer("Replicas", 3),
+				str("CurrentRevision", "test-1"), str("UpdateRevision", "test-2")},
+			expectedProbed:     true,
+			expectedInProgress: true,
+		},
+		{
+			name:            "statefulset is rolled out to the partition",
+			resource:        "statefulsets",
+			statefulSetSpec: &StatefulSetSpec{Partition: 2},
+			values: []workapiv1.FeedbackValue{integer("ObservedGeneration", 2), integer("Replicas", 3),
+				integer("UpdatedReplicas", 1), str("CurrentRevision", "test-1"), str("UpdateRevision", "test-2")},
+			expectedProbed: true,
+		},
+		{
+			name:            "statefulset with the OnDelete strategy is not rolling out",
+			resource:        "statefulsets",
+			statefulSetSpec: &StatefulSetSpec{OnDelete: true},
+			values: []workapiv1.FeedbackValue{integer("ObservedGeneration", 2), integer("Replicas", 3),
+				str("CurrentRevision", "test-1"), str("UpdateRevision", "test-2")},
+			expectedProbed: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			status, probed := GetWorkloadRolloutStatus(agent.FieldResult{
+				ResourceIdentifier: workapiv1.ResourceIdentifier{
+					Group: "apps", Resource: c.resource, Namespace: "testns", Name: "test",
+				},
+				FeedbackResult: workapiv1.StatusFeedbackResult{Values: c.values},
+			}, []WorkloadMetadata{{
+				GroupResource:   schema.GroupResource{Group: "apps", Resource: c.resource},
+				NamespacedName:  types.NamespacedName{Namespace: "testns", Name: "test"},
+				DeploymentSpec:  c.deploymentSpec,
+				StatefulSetSpec: c.statefulSetSpec,
+			}})
+			if probed != c.expectedProbed {
+				t.Fatalf("expected probed %v, but got %v", c.expectedProbed, probed)
+			}
+			if status.InProgress != c.expectedInProgress {
+				t.Errorf("expected in progress %v, but got %v: %s", c.expectedInProgress, status.InProgress, status.Message)
+			}
+			if status.DeadlineExceeded != c.expectedDeadlineExceeded {
+				t.Errorf("expected deadline exceeded %v, but got %v: %s",
+					c.expectedDeadlineExceeded, status.DeadlineExceeded, status.Message)
+			}
+			if status.InProgress && status.ProgressDeadline != c.expectedProgressDeadline {
+				t.Errorf("expected progress deadline %s, but got %s", c.expectedProgressDeadline, status.ProgressDeadline)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	corev1lister "k8s.io/client-go/listers/core/v1"
+
+	addonapiv1beta1 "open-cluster-management.io/api/addon/v1beta1"
+)
+
+// SecretValuesKey is the key of the values in the data of the secret values config, the value is the values in
+// yaml or json format.
+const SecretValuesKey = "values.yaml"
+
+// SecretValuesConfigGetter has a method to return the Secret referenced by the addon.
+type SecretValuesConfigGetter interface {
+	Get(ctx context.Context, namespace, name string) (*corev1.Secret, error)
+}
+
+type defaultSecretValuesConfigGetter struct {
+	kubeClient kubernetes.Interface
+}
+
+// NewSecretValuesConfigGetter returns a SecretValuesConfigGetter with kube client
+func NewSecretValuesConfigGetter(kubeClient kubernetes.Interface) SecretValuesConfigGetter {
+	return &defaultSecretValuesConfigGetter{kubeClient: kubeClient}
+}
+
+func (g *defaultSecretValuesConfigGetter) Get(ctx context.Context, namespace, name string) (*corev1.Secret, error) {
+	return g.kubeClient.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+type listerSecretValuesConfigGetter struct {
+	secretLister corev1lister.SecretLister
+}
+
+// NewSecretValuesConfigListerGetter returns a SecretValuesConfigGetter with the secret lister, so the Secrets
+// are not requested from the hub on every render of the addon. The informer of the lister should be started by
+// the caller.
+func NewSecretValuesConfigListerGetter(secretLister corev1lister.SecretLister) SecretValuesConfigGetter {
+	return &listerSecretValuesConfigGetter{secretLister: secretLister}
+}
+
+func (g *listerSecretValuesConfigGetter) Get(_ context.Context, namespace, name string) (*corev1.Secret, error) {
+	return g.secretLister.Secrets(namespace).Get(name)
+}
+
+// GetDesiredSecretValuesConfigs returns the desired Secrets referenced by the addon in the order of the config
+// references, it returns nil if the addon has no secret values config. The Secrets can only be referenced in the
+// cluster namespace of the addon and the allowedNamespaces, so the addon can not read the Secrets of the other
+// clusters or the hub components.
+func GetDesiredSecretValuesConfigs(ctx context.Context, addon *addonapiv1beta1.ManagedClusterAddOn,
+	getter SecretValuesConfigGetter, allowedNamespaces ...string) ([]*corev1.Secret, error) {
+	var secrets []*corev1.Secret
+	for _, configRef := range addon.Status.ConfigReferences {
+		if configRef.Group != SecretValuesConfigGVR.Group || configRef.Resource != SecretValuesConfigGVR.Resource {
+			continue
+		}
+
+		desiredConfig := configRef.DesiredConfig
+		if desiredConfig == nil || len(desiredConfig.SpecHash) == 0 {
+			return nil, fmt.Errorf("addon %s secret values config desired spec hash is empty", addon.Name)
+		}
+		if desiredConfig.Namespace != addon.Namespace && !slices.Contains(allowedNamespaces, desiredConfig.Namespace) {
+			return nil, fmt.Errorf("addon %s secret values config %s/%s is not in the cluster namespace or the "+
+				"allowed namespaces", addon.Name, desiredConfig.Namespace, desiredConfig.Name)
+		}
+
+		secret, err := getter.Get(ctx, desiredConfig.Namespace, desiredConfig.Name)
+		if err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, secret)
+	}
+	return secrets, nil
+}